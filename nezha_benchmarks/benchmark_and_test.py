@@ -5,638 +5,2657 @@ Linearizability tester for nezha_benchmarks.
 Usage
 -----
     python benchmark_and_test.py [options] <benchmark_folder | all>
-
-Positional argument
-    benchmark_folder   Subdirectory name under nezha_benchmarks/
-                       (e.g. adaptive_deadline, low_quality, all)
-    all                Run every benchmark folder that contains a docker-compose.yml
-
-Options
-    --check-only       Skip docker compose; only analyse existing logs/
-    --run-only         Run docker compose but skip the analysis step
-    --timeout N        Seconds to wait for client containers to finish (default 60)
-    --log-level LEVEL  RUST_LOG level passed to docker containers (default: info)
-    --no-plots         Skip matplotlib plots even if matplotlib is available
+    python benchmark_and_test.py --check-only [options] - < history.json
+    python benchmark_and_test.py --compare old.json new.json
+    python benchmark_and_test.py --report 3-nodes.json 5-nodes.json --report-out report.html
+    python benchmark_and_test.py --import-pcap capture.pcap out_dir/
+    python benchmark_and_test.py --replay logs_dir/ out_dir/ --proxy host:9000
+    python benchmark_and_test.py --fuzz 1000
+    python benchmark_and_test.py --suite release-suite.yaml --ci junit.xml
+
+benchmark_folder is a subdirectory of nezha_benchmarks/ (e.g.
+adaptive_deadline), `all` for every folder with a docker-compose.yml, a
+directory path or a quoted glob of directories; with --check-only also a
+directory of histories, an s3://, gs:// or http(s):// URL, or '-' for a
+history on stdin.
+
+CHECKER.md describes every option in detail, with the history format
+(outcomes, shards, events, retries, timestamps, field maps), request logs,
+soak tests, suites, config files and exit codes:
+
+    0  consistent         1  not consistent (or a threshold failed)
+    2  too many UNKNOWN   3  input error      4  internal error
+    5  unhealthy cluster
 """
 
 from __future__ import annotations
 
 import argparse
+import base64
+import contextlib
+import errno
+import io
 import json
+import netrc
 import os
 import pathlib
-import subprocess
+import re
+import shutil
+import sqlite3
 import sys
+import tempfile
 import time
+import urllib.parse
+import urllib.request
 from collections import defaultdict
-from dataclasses import dataclass
-from typing import Optional
-
-try:
-    import matplotlib
-    matplotlib.use("Agg")
-    import matplotlib.pyplot as plt
-    import numpy as np
-    HAS_MATPLOTLIB = True
-except ImportError:
-    HAS_MATPLOTLIB = False
+from dataclasses import dataclass, field, replace
+from typing import Callable, Optional, TextIO, Union
+
+from verifier.checkers import (CONSISTENCY_CHECKERS, CONSISTENCY_LEVELS, MODELS, SET_ELEMENT_PREFIX,
+                               WindowResult, check_in_windows, check_levels, check_read_paths, check_shards,
+                               check_windows, keys_in_several_shards, lost_set_elements, print_levels,
+                               print_read_path_report, print_shard_report, print_snapshot_report,
+                               print_window_report, reads_after_snapshots, run_fuzz, shrink_ops,
+                               write_counterexample, write_regression_test)
+from verifier.cluster import (ClusterMember, ClusterUnhealthy, DEFAULT_PROXY_PORT, Fault, SCENARIO_CONFIGS,
+                              cluster_health, compose_leader, compose_members, history_from_pcap,
+                              parse_nemesis, print_cluster_health, replay_history, run_compose)
+from verifier.common import (CheckOptions, CheckTimeout, DEFAULT_CHECK_TIMEOUT_S, EXIT_INPUT, EXIT_INTERNAL,
+                             EXIT_OK, EXIT_UNHEALTHY, EXIT_UNKNOWN, EXIT_VIOLATION, Event, LOG_CONFIG, LOG_FORMATS,
+                             LOG_LEVELS, LoadOptions, MEMORY, MemoryBudget, Operation, PROGRESS,
+                             PartitionTimeout, ReportOptions, STATUS_UNKNOWN, SelectOptions, TimelineOptions,
+                             configure_logging, log, parse_duration_ns, parse_size, utc_now)
+from verifier.crosscheck import (check_decided_log, check_state_snapshots, join_request_logs,
+                                 load_decided_logs, load_request_logs, load_state_snapshots,
+                                 print_request_log_report, stored_value)
+from verifier.dashboard import print_store_history, serve_dashboard, store_results
+from verifier.history import (CSV_FIELDS, HistoryError, STDIN, checkable_ops, checker_params,
+                              detect_clock_skew, filter_ops, find_client_anomalies, history_files, load_events,
+                              load_history, merge_histories, parse_csv_columns, parse_field_map,
+                              prepare_for_check, slice_ops, to_history_entry, widen_intervals)
+from verifier.linearizability import (Checkpoint, explain_key, partition_balance, partition_by_key,
+                                      quiescent_segments, write_witness)
+from verifier.plots import (LANE_LAYOUTS, browse_config, browse_results, first_violation, otlp_spans,
+                            plot_results, plot_timeline_png, print_partition_breakdown, print_tui_timeline,
+                            reduce_timeline, render_timeline_svg, send_otlp, timeline_data)
+from verifier.reports import (NOTIFY_FORMATS, assign_terms, availability_failures, availability_report,
+                              build_report, compare_results, compute_history_rps, compute_latency_report,
+                              config_settings, contention_report, failure_annotations, load_bench,
+                              load_metrics, load_seeds, notify_failures, open_visualization,
+                              parse_availability, print_availability_report, print_contention_report,
+                              print_github_annotations, print_key_stats, print_report, print_summary,
+                              print_term_report, render_report_html, summary_row, term_report,
+                              threshold_failures, write_junit)
 
 SCRIPT_DIR = pathlib.Path(__file__).parent.resolve()
 
-# ── Data structures ────────────────────────────────────────────────────────────
+# ── Single benchmark runner ────────────────────────────────────────────────────
 
-@dataclass
-class Operation:
-    client_id: int
-    op_type: str
-    key: str
-    write_val: Optional[str]
-    call_ns: int
-    return_ns: int
-    result_val: Optional[str]
-
-# ── Helpers ────────────────────────────────────────────────────────────────────
-
-def detect_compose_cmd() -> list[str]:
-    for candidate in (["docker", "compose"], ["docker-compose"]):
-        try:
-            subprocess.run(candidate + ["version"], capture_output=True, check=True, timeout=5)
-            return candidate
-        except (subprocess.CalledProcessError, FileNotFoundError, subprocess.TimeoutExpired):
-            pass
-    raise RuntimeError("Neither 'docker compose' nor 'docker-compose' is available on PATH.")
+def artifact_path(
+    opts: CheckOptions, logs_dir: pathlib.Path, config_name: str, stem: str, suffix: str
+) -> pathlib.Path:
+    """
+    Where a generated artifact is written: the config's logs/ directory by
+    default, or <out-dir>/<config>/ with --out-dir. --run-id is appended to
+    the file stem so repeated runs do not overwrite each other.
+    """
+    base = opts.report.out_dir / config_name if opts.report.out_dir else logs_dir
+    base.mkdir(parents=True, exist_ok=True)
+    if opts.report.run_id:
+        stem = f"{stem}-{opts.report.run_id}"
+    return base / f"{stem}{suffix}"
 
 
-def compose_cmd(compose_file: pathlib.Path) -> list[str]:
-    return detect_compose_cmd() + ["-f", str(compose_file), "--project-directory", str(compose_file.parent)]
+@dataclass
+class ConfigCheck:
+    """What run_single() learns about one config, phase by phase."""
+    name: str
+    logs_dir: pathlib.Path
+    opts: CheckOptions
+    ops: list[Operation] = field(default_factory=list)
+    events: list[Event] = field(default_factory=list)
+    metrics: Optional[dict] = None
+    bench: dict[str, dict] = field(default_factory=dict)
+    seeds: dict[str, int] = field(default_factory=dict)
+    request_log: Optional[dict] = None
+    unlogged: list[Operation] = field(default_factory=list)
+    lin_ok: Optional[bool] = True
+    violations: list[str] = field(default_factory=list)
+    verdicts: dict[str, tuple[str, int]] = field(default_factory=dict)
+    chains: list[list[Operation]] = field(default_factory=list)
+    shards: dict[str, dict] = field(default_factory=dict)
+    windows: list[WindowResult] = field(default_factory=list)
+    levels: dict[str, str] = field(default_factory=dict)
+    read_paths: dict[str, dict] = field(default_factory=dict)
+    decided_log: Optional[dict] = None
+    term_rows: list[dict] = field(default_factory=list)
+    snapshot_report: Optional[dict] = None
+    availability: Optional[dict] = None
+    contention: Optional[dict] = None
+    explanations: list[str] = field(default_factory=list)
+    annotations: list[dict] = field(default_factory=list)
+    otlp_trace: Optional[str] = None
+    artifacts: list[str] = field(default_factory=list)
+    timings: dict[str, float] = field(default_factory=dict)
+    phase_start: float = field(default_factory=time.monotonic)
+
+    @property
+    def verbose(self) -> bool:
+        return self.opts.report.verbosity > 0
+
+    def phase(self, name: str) -> None:
+        """Charge the time since the previous phase to `name`."""
+        now = time.monotonic()
+        self.timings[name] = self.timings.get(name, 0.0) + now - self.phase_start
+        self.phase_start = now
+
+    def artifact(self, stem: str, suffix: str) -> pathlib.Path:
+        return artifact_path(self.opts, self.logs_dir, self.name, stem, suffix)
+
+    def failed_keys(self) -> set[str]:
+        return {k for k, (v, _) in self.verdicts.items() if v == "FAIL"}
+
+    def fail(self, violations: list[str]) -> None:
+        """Add violations found outside the consistency check."""
+        self.violations = (self.violations if self.lin_ok is False else []) + violations
+        self.lin_ok = False
+
+
+def load_config_history(c: ConfigCheck) -> None:
+    """Load, filter and slice the history in c.logs_dir, with its events and metrics."""
+    opts = c.opts
+    c.events = load_events(c.logs_dir, strict=opts.load.strict)
+    client_map: Optional[dict[int, dict]] = {} if opts.load.namespace_clients else None
+    quarantine: Optional[list[dict]] = [] if opts.load.skip_invalid else None
+    ops = load_history(c.logs_dir, strict=opts.load.strict, events=c.events,
+                       include=opts.load.include, exclude=opts.load.exclude,
+                       max_listed=None if c.verbose else 10,
+                       client_map=client_map, time_offsets=opts.load.time_offsets,
+                       align_marker=opts.load.align_marker, time_unit=opts.load.time_unit,
+                       quarantine=quarantine, csv_columns=opts.load.csv_columns,
+                       field_map=opts.load.field_map)
+    request_logs = load_request_logs(c.logs_dir, opts.load.request_logs)
+    if request_logs:
+        ops, c.unlogged, c.request_log = join_request_logs(ops, request_logs)
+    c.events.sort(key=lambda ev: ev.time_ns)
+    c.metrics = load_metrics(c.logs_dir)
+    c.bench = load_bench(c.logs_dir)
+    c.seeds = load_seeds(c.logs_dir)
+    if c.seeds:
+        shown = sorted(set(c.seeds.values()))
+        print(f"  Workload seed: {', '.join(map(str, shown))}")
+    if opts.select.keys is not None or opts.select.clients is not None:
+        loaded = len(ops)
+        ops, context = filter_ops(ops, opts)
+        print(f"  Filtered history to {len(ops) - context} of {loaded} ops"
+              + (f" (+{context} other clients' write(s) as context)" if context else ""))
+    if opts.select.from_ns is not None or opts.select.to_ns is not None or opts.select.limit is not None:
+        loaded = len(ops)
+        ops, context = slice_ops(ops, opts.select.from_ns, opts.select.to_ns, opts.select.limit)
+        print(f"  Sliced history to {len(ops) - context} of {loaded} ops"
+              + (f" (+{context} earlier/later write(s) as context)" if context else ""))
+    c.ops = MODELS[opts.model][1](ops)
+    c.phase("load")
+    if quarantine:
+        q_path = c.artifact(f"{c.name}-quarantine", ".json")
+        with open(q_path, "w") as f:
+            json.dump(quarantine, f, indent=2)
+        print(f"  Quarantined records saved → {q_path}")
+        c.artifacts.append(str(q_path))
+    if client_map:
+        map_path = c.artifact(f"{c.name}-client-map", ".json")
+        with open(map_path, "w") as f:
+            json.dump({str(k): v for k, v in sorted(client_map.items())}, f, indent=2)
+        print(f"  Namespaced {len(client_map)} client id(s); mapping saved → {map_path}")
+        c.artifacts.append(str(map_path))
+
+
+def warn_about_history(c: ConfigCheck) -> None:
+    """Report recording anomalies, unchecked operations and clock skew in c.ops."""
+    ops, opts = c.ops, c.opts
+    anomalies = find_client_anomalies(ops, opts.load.sequential_clients)
+    if anomalies:
+        if opts.load.strict:
+            raise HistoryError(anomalies[0])
+        shown = anomalies if c.verbose else anomalies[:10]
+        more = f"\n       … and {len(anomalies) - len(shown)} more" if len(anomalies) > len(shown) else ""
+        log.warning(f"{len(anomalies)} client recording anomaly(ies):\n       "
+                    + "\n       ".join(shown) + more, extra={"anomalies": len(anomalies)})
+    if c.verbose:
+        unchecked = [op for op in ops if op.op_type == "Get" and op.ambiguous and not op.failed]
+        failed = [op for op in ops if op.failed]
+        if failed:
+            print(f"  Not checked: {len(failed)} operation(s) that definitely failed")
+        if unchecked:
+            print(f"  Not checked: {len(unchecked)} read(s) with an unknown outcome")
+            for op in unchecked:
+                print(f"       Get({op.key!r}) by client {op.client_id} "
+                      f"at t={op.call_ns:,} ({op.status})")
+    skewed, gap_ns = detect_clock_skew(ops)
+    if skewed and gap_ns > 2 * opts.clock_skew_ns:
+        log.warning(
+            f"{skewed} read(s) returned a value written only after the read "
+            f"returned (up to {gap_ns / 1e6:.3f} ms); clocks may be skewed — "
+            f"consider --clock-skew {gap_ns / 2e6:.3f}ms"
+        )
 
-# ── Docker compose runner ──────────────────────────────────────────────────────
 
-def run_compose(compose_file: pathlib.Path, log_level: str, timeout: int) -> bool:
+def check_consistency(c: ConfigCheck) -> None:
+    """Check c.ops at opts.consistency, per shard if the ops carry one."""
+    ops, opts = c.ops, c.opts
+    checker = CONSISTENCY_CHECKERS[opts.consistency][1]
+    kwargs = checker_params(opts)
+    if kwargs.get("epochs"):
+        sizes = [len(seg) for key_ops in partition_by_key(ops).values()
+                 for seg in quiescent_segments(key_ops)]
+        print(f"  Time epochs: {len(sizes):,} quiescent segment(s) over "
+              f"{len(partition_by_key(ops)):,} key(s), largest {max(sizes, default=0):,} ops")
+    if opts.consistency == "linearizable":
+        # Not suffixed with --run-id: a resumed run must find it.
+        base = opts.report.out_dir / c.name if opts.report.out_dir else c.logs_dir
+        kwargs["checkpoint"] = Checkpoint(base / f"{c.name}-check.progress", opts.resume)
+        kwargs["parallelism"] = opts.parallelism
+        kwargs["partition_timeout"] = opts.partition_timeout
+        kwargs["verdicts"] = c.verdicts
+    elif opts.consistency == "causal":
+        kwargs["chains"] = c.chains
+    sharded = any(op.shard is not None for op in ops)
+    if sharded:
+        split = keys_in_several_shards(ops)
+        if split:
+            log.warning(f"{len(split)} key(s) recorded under more than one shard, e.g. "
+                        + ", ".join(f"{k!r} in {'/'.join(v)}" for k, v in list(split.items())[:5]))
+    if opts.consistency in ("linearizable", "bounded-staleness"):
+        for warning in partition_balance(partition_by_key(ops), opts.parallelism):
+            log.warning(f"{warning}")
+    PROGRESS.begin(opts.report.progress)
+    try:
+        if sharded:
+            c.lin_ok, c.violations, c.shards = check_shards(
+                prepare_for_check(ops, opts),
+                opts,
+                deadline=time.monotonic() + opts.check_timeout,
+                verdicts=c.verdicts,
+            )
+        else:
+            c.lin_ok, c.violations = checker(
+                prepare_for_check(ops, opts),
+                deadline=time.monotonic() + opts.check_timeout,
+                **kwargs,
+            )
+    except (MemoryBudget, MemoryError) as ex:
+        reason = str(ex) or "out of memory"
+        if sharded:
+            c.lin_ok, c.violations = None, [f"memory limit reached: {reason}"]
+        else:
+            c.lin_ok, c.violations = check_in_windows(
+                ops, opts, reason, deadline=time.monotonic() + opts.check_timeout)
+    except PartitionTimeout as ex:
+        c.lin_ok, c.violations = None, [str(ex)]
+    except CheckTimeout as ex:
+        c.lin_ok, c.violations = None, [f"{opts.check_timeout:g}s budget exhausted after {ex}"]
+    finally:
+        PROGRESS.end()
+    c.phase("check")
+
+
+def find_witness(c: ConfigCheck) -> None:
+    """Save a linearization of a passing history; keys without one fail it."""
+    opts = c.opts
+    wit_path = c.artifact(f"{c.name}-linearization", ".json")
+    try:
+        missing = write_witness(prepare_for_check(c.ops, opts), wit_path,
+                                deadline=time.monotonic() + opts.check_timeout)
+        print(f"  Linearization witness saved → {wit_path}")
+        c.artifacts.append(str(wit_path))
+    except CheckTimeout as ex:
+        missing = []
+        log.warning(f"Witness search timed out after {ex}")
+    if missing:
+        # The search proved these keys have no order: that is a violation, whatever passed them.
+        c.lin_ok = False
+        c.violations = [f"Key '{key}': no linearization exists (witness search)" for key in missing]
+        for key in missing:
+            c.verdicts[key] = ("FAIL", c.verdicts.get(key, ("", 0))[1])
+        print(f"  ✗ No witness order exists for {len(missing)} key(s): "
+              f"{', '.join(repr(k) for k in missing[:10])}")
+    c.phase("witness")
+
+
+def check_further(c: ConfigCheck) -> None:
+    """The checks beyond the verdict: windows, consistency levels and read paths."""
+    ops, opts = c.ops, c.opts
+    if opts.window_ns:
+        PROGRESS.begin(opts.report.progress)
+        try:
+            c.windows = check_windows(ops, opts, opts.window_ns, opts.window_stride_ns,
+                                      deadline=time.monotonic() + opts.check_timeout)
+        finally:
+            PROGRESS.end()
+        c.phase("windows")
+    if opts.auto_levels:
+        PROGRESS.begin(opts.report.progress)
+        try:
+            c.levels = check_levels(ops, opts, c.lin_ok, deadline=time.monotonic() + opts.check_timeout)
+        finally:
+            PROGRESS.end()
+        c.phase("levels")
+    PROGRESS.begin(opts.report.progress)
+    try:
+        c.read_paths = check_read_paths(ops, opts, deadline=time.monotonic() + opts.check_timeout)
+    finally:
+        PROGRESS.end()
+    if c.read_paths:
+        c.phase("read paths")
+
+
+def cross_check_logs(c: ConfigCheck) -> None:
+    """Check c.ops against the replicas' decided logs, state snapshots and request logs."""
+    ops, opts = c.ops, c.opts
+    decided_logs = load_decided_logs(c.logs_dir, opts.load.decided_logs)
+    snapshots = load_state_snapshots(c.logs_dir, opts.load.state_snapshots)
+    if decided_logs or snapshots:
+        log_problems = check_decided_log(widen_intervals(ops, opts.clock_skew_ns), decided_logs)
+        state_problems = check_state_snapshots(decided_logs, snapshots)
+        c.decided_log = {
+            "logs": len(decided_logs),
+            "entries": max((len(entries) for entries in decided_logs.values()), default=0),
+            "problems": len(log_problems),
+            "snapshots": len(snapshots),
+            "state_problems": len(state_problems),
+        }
+        if log_problems or state_problems:
+            c.fail([f"Decided log: {p}" for p in log_problems]
+                   + [f"State replay: {p}" for p in state_problems])
+        c.phase("decided log")
+    if c.request_log:
+        selected = {(op.client_id, op.request_id) for op in ops}
+        c.unlogged = [op for op in c.unlogged if (op.client_id, op.request_id) in selected]
+        c.request_log["missing_writes"] = len(c.unlogged)
+        if c.unlogged:
+            c.fail([f"Request log: Put({op.key!r}, {stored_value(op.write_val)!r}) by client "
+                    f"{op.client_id} (request_id {op.request_id!r}) acknowledged at "
+                    f"t={op.return_ns:,} appears in no server request log"
+                    for op in c.unlogged])
+
+
+def print_config_report(c: ConfigCheck) -> None:
+    """Print the verdict and every report that applies to the config."""
+    ops, opts, events = c.ops, c.opts, c.events
+    print_summary(c.name, ops, c.metrics, c.lin_ok, c.violations, opts.consistency, events)
+    term_source = assign_terms(ops, events)
+    if term_source:
+        c.term_rows = term_report(ops, c.failed_keys(), events if term_source == "events" else None)
+    c.snapshot_report = reads_after_snapshots(ops, events, opts)
+    c.availability = availability_report(ops, events)
+    if c.shards:
+        print_shard_report(c.shards)
+    decided_log = c.decided_log
+    if decided_log and decided_log["logs"]:
+        head = f"  Decided log: {decided_log['logs']} replica dump(s), {decided_log['entries']} entries"
+        if decided_log["problems"]:
+            print(f"{head}, ✗ {decided_log['problems']} problem(s) (listed above)")
+        else:
+            print(f"{head}, ✓ every acknowledged write decided once, in real-time order")
+    if decided_log and decided_log["snapshots"]:
+        head = f"  State replay: {decided_log['snapshots']} replica snapshot(s)"
+        if decided_log["state_problems"]:
+            print(f"{head}, ✗ {decided_log['state_problems']} divergence(s) (listed above)")
+        else:
+            print(f"{head}, ✓ each matches a replay of the decided log")
+    if c.request_log:
+        print_request_log_report(c.request_log)
+    if c.levels:
+        print_levels(c.levels)
+    if c.read_paths:
+        print_read_path_report(c.read_paths)
+    if c.term_rows:
+        print_term_report(c.term_rows, term_source)
+    if c.snapshot_report:
+        print_snapshot_report(c.snapshot_report, opts.snapshot_window_ns)
+    if c.availability:
+        print_availability_report(c.availability)
+    if c.windows:
+        print_window_report(c.windows, opts.window_ns, opts.window_stride_ns, c.verbose)
+    if any(op.key.startswith(SET_ELEMENT_PREFIX) for op in ops):
+        lost = lost_set_elements(ops)
+        if lost:
+            print(f"  Set workload: ✗ {len(lost)} acknowledged element(s) lost")
+        else:
+            print("  Set workload: ✓ every acknowledged element survived")
+        for message in lost[:10]:
+            print(f"    • {message}")
+    for name, b in c.bench.items():
+        print(f"  Bench {name}: {b['responses']} responses, {b['throughput']:.0f} ops/s, "
+              f"p50 {b['p50_ms']} ms, p95 {b['p95_ms']} ms, p99 {b['p99_ms']} ms, max {b['max_ms']} ms")
+    if c.verdicts and c.verbose:
+        print_partition_breakdown(c.verdicts, top=len(c.verdicts), passing=True)
+    elif c.lin_ok is not True and c.verdicts:
+        print_partition_breakdown(c.verdicts)
+    if opts.report.stats and ops:
+        print_key_stats(ops)
+    c.contention = contention_report(ops) if opts.report.contention and ops else None
+    if c.contention:
+        print_contention_report(c.contention)
+    if c.lin_ok is False and opts.consistency == "linearizable":
+        explain_failures(c)
+    if c.lin_ok is False and opts.report.github_annotations:
+        c.annotations = failure_annotations(c.name, prepare_for_check(ops, opts), c.verdicts,
+                                            c.violations, opts.consistency)
+
+
+def explain_failures(c: ConfigCheck) -> None:
+    """Tell what went wrong on each failing key, in words."""
+    checked = prepare_for_check(c.ops, c.opts)
+    origin = min(op.call_ns for op in c.ops)
+    by_key = partition_by_key(checked)
+    failing = [k for k, (v, _) in c.verdicts.items() if v == "FAIL"] or list(by_key)
+    for key in failing:
+        story = explain_key(key, by_key.get(key, []), origin)
+        if story:
+            c.explanations.append(story)
+    if c.explanations:
+        print("  What went wrong:")
+        for story in c.explanations[:5]:
+            print(f"    • {story}")
+        if len(c.explanations) > 5:
+            print(f"    … and {len(c.explanations) - 5} more key(s)")
+
+
+def save_counterexample(c: ConfigCheck) -> None:
     """
-    Start docker compose in detached mode, wait for client containers to exit,
-    then bring everything down. Returns True on clean completion.
+    Save a failing history's counterexample (shrunk with --shrink) and, with
+    --emit-test, a regression test of it.
     """
-    compose_dir = compose_file.parent
-    logs_dir = compose_dir / "logs"
-    logs_dir.mkdir(exist_ok=True)
+    ops, opts = c.ops, c.opts
+    cex_path = c.artifact(f"{c.name}-counterexample", ".json")
+    if opts.shrink:
+        checker = CONSISTENCY_CHECKERS[opts.consistency][1]
+
+        written = {(op.key, op.write_val) for op in ops if op.op_type == "Put"}
+
+        def fails(sub: list[Operation]) -> bool:
+            # Dropping the write a read observed fails trivially; keep those.
+            kept = {(op.key, op.write_val) for op in sub if op.op_type == "Put"}
+            if any(op.op_type == "Get" and op.result_val is not None
+                   and (op.key, op.result_val) in written - kept for op in sub):
+                return False
+            return not checker(prepare_for_check(sub, opts), **checker_params(opts))[0]
+
+        start = ops
+        if opts.consistency in ("linearizable", "bounded-staleness"):
+            # Every failing key fails on its own: shrink the smallest one.
+            start = min((k for k in partition_by_key(ops).values() if fails(k)), key=len)
+        shrunk = shrink_ops(sorted(start, key=lambda o: o.call_ns), fails,
+                            deadline=time.monotonic() + opts.check_timeout)
+        with open(cex_path, "w") as f:
+            json.dump([to_history_entry(op) for op in shrunk], f, indent=2)
+        print(f"  Counterexample shrunk from {len(start)} to {len(shrunk)} ops, saved → {cex_path}")
+        c.artifacts.append(str(cex_path))
+    elif opts.consistency == "linearizable":
+        n = write_counterexample(checkable_ops(ops), cex_path, c.failed_keys() or None)
+        print(f"  Counterexample ({n} ops) saved → {cex_path}")
+        c.artifacts.append(str(cex_path))
+    if opts.report.emit_test:
+        if opts.shrink or opts.consistency == "linearizable":
+            with open(cex_path) as f:
+                cex = json.load(f)
+            test_name = "test_" + re.sub(r"\W+", "_", c.name) + "_counterexample"
+            test_path = c.artifact(test_name, ".py")
+            write_regression_test(test_path, c.name, cex, opts)
+            print(f"  Regression test ({len(cex)} ops) saved → {test_path}")
+            c.artifacts.append(str(test_path))
+        else:
+            log.warning(f"--emit-test needs a counterexample; with --consistency {opts.consistency} "
+                        f"add --shrink")
 
-    base = compose_cmd(compose_file)
-    env = {**os.environ, "RUST_LOG": log_level}
 
-    # Build images (only s1 has build: context, others share the image)
-    print("  Building images...")
-    result = subprocess.run(base + ["build"], env=env, cwd=str(compose_dir))
-    if result.returncode != 0:
-        print(f"  ⚠  docker compose build failed (exit {result.returncode})")
-        return False
+def export_timelines(c: ConfigCheck) -> None:
+    """
+    Show the timeline in the terminal (--tui-timeline), save it (--export)
+    and send it as a trace (--otlp-url).
+    """
+    ops, opts = c.ops, c.opts
+    if opts.timeline.tui_timeline:
+        marked = None
+        if c.lin_ok is False:
+            checker = CONSISTENCY_CHECKERS[opts.consistency][1]
+            marked = first_violation(
+                ops, lambda sub: not checker(prepare_for_check(sub, opts), **checker_params(opts))[0]
+            )
+        print_tui_timeline(ops, c.failed_keys(), c.events, marked, lanes=opts.timeline.lanes)
+
+    if opts.timeline.export:
+        data = timeline_data(c.name, ops, c.verdicts, c.events, c.violations, c.lin_ok, opts.consistency,
+                             c.chains)
+        pages = reduce_timeline(data, opts.timeline.failing,
+                                opts.timeline.page_ns / 1e6 if opts.timeline.page_ns else None,
+                                opts.timeline.max_ops, opts.timeline.lanes)
+        if not pages:
+            print("  No operations left to export on the timeline")
+        for fmt in opts.timeline.export:
+            saved = []
+            for n, page in enumerate(pages, 1):
+                stem = f"{c.name}-timeline" + (f"-p{n:03d}" if opts.timeline.page_ns else "")
+                tl_path = c.artifact(stem, f".{fmt}")
+                if fmt == "json":
+                    with open(tl_path, "w") as f:
+                        json.dump(page, f, indent=1)
+                elif fmt == "svg":
+                    tl_path.write_text(render_timeline_svg(page, lanes=opts.timeline.lanes))
+                elif not plot_timeline_png(page, tl_path, lanes=opts.timeline.lanes):
+                    print("  (matplotlib not available — skipping PNG timeline)")
+                    break
+                saved.append(tl_path)
+            c.artifacts.extend(map(str, saved))
+            if len(saved) == 1:
+                print(f"  Timeline {fmt.upper()} saved → {saved[0]}")
+            elif saved:
+                print(f"  Timeline {fmt.upper()} saved → {len(saved)} pages, {saved[0]} … {saved[-1].name}")
+
+    if opts.timeline.otlp_url:
+        trace = os.urandom(16).hex()
+        spans = otlp_spans(c.name, ops, c.verdicts, c.events, c.violations, c.lin_ok, opts.consistency, trace)
+        sent = send_otlp(opts.timeline.otlp_url, c.name, spans)
+        if sent:
+            print(f"  Trace {trace}: {sent} of {len(spans)} span(s) sent → {opts.timeline.otlp_url}")
+            c.otlp_trace = trace
+
+
+def config_result(c: ConfigCheck, config_dir: pathlib.Path, seed: Optional[int]) -> dict:
+    """The result of run_single(), as --json writes it."""
+    windows = c.windows
+    return {
+        "config": c.name,
+        "skipped": False,
+        "ops": len(c.ops),
+        "history_rps": compute_history_rps(c.ops),
+        "latency_ms": compute_latency_report(c.ops),
+        "consistency": c.opts.consistency,
+        "lin_ok": c.lin_ok,
+        "violations": len(c.violations) if c.lin_ok is False else 0,
+        "violation_details": c.violations if c.lin_ok is False else [],
+        "failed_keys": {k: n for k, (v, n) in c.verdicts.items() if v == "FAIL"},
+        "explanations": c.explanations,
+        "events": len(c.events),
+        "metrics": c.metrics,
+        "bench": c.bench,
+        "seed": seed if seed is not None else next(iter(c.seeds.values()), None),
+        "seeds": c.seeds,
+        "shards": c.shards,
+        "decided_log": c.decided_log,
+        "otlp_trace": c.otlp_trace,
+        "request_log": c.request_log,
+        "read_paths": c.read_paths,
+        "levels": c.levels,
+        "strongest_level": next((level for level, v in c.levels.items() if v == "PASS"), None),
+        "terms": c.term_rows,
+        "snapshot_reads": c.snapshot_report,
+        "availability": c.availability,
+        "contention": c.contention,
+        "first_failing_window": (
+            {"from_s": windows[-1].start_ns / 1e9, "to_s": windows[-1].end_ns / 1e9}
+            if windows and windows[-1].verdict is False else None
+        ),
+        "artifacts": c.artifacts,
+        "annotations": c.annotations,
+        "config_dir": str(config_dir if config_dir == STDIN else config_dir.resolve()),
+        "settings": config_settings(config_dir),
+        "check_options": options_record(c.opts),
+    }
 
-    # Start detached
-    print("  Starting containers (detached)...")
-    subprocess.run(base + ["up", "-d"], env=env, cwd=str(compose_dir), check=True)
 
-    # Discover client container names from compose ps
-    client_containers = _find_client_containers(base, compose_dir)
-    if not client_containers:
-        print("  ⚠  Could not identify client containers; falling back to names 'c1','c2'")
-        client_containers = ["c1", "c2"]
+def run_single(
+    config_dir: pathlib.Path,
+    do_run: bool,
+    do_check: bool,
+    timeout: int,
+    log_level: str,
+    no_plots: bool,
+    opts: CheckOptions,
+    faults: Optional[list[Fault]] = None,
+    seed: Optional[int] = None,
+    preflight: Optional[float] = None,
+) -> dict:
+    config_name = target_name(config_dir)
+    compose_file = config_dir / "docker-compose.yml"
+    if not compose_file.exists():
+        compose_file = config_dir / "docker-compose.yaml"
+    if do_run and not compose_file.exists():
+        print(f"  ✗ No docker-compose file in {config_name}, skipping.")
+        return {"config": config_name, "skipped": True}
 
-    # Poll until all clients have exited
-    print(f"  Waiting for clients {client_containers} (timeout={timeout}s)...")
-    deadline = time.monotonic() + timeout
-    all_done = _wait_for_containers(client_containers, deadline)
-    if not all_done:
-        print(f"  ⚠  Timeout reached; some clients may not have finished.")
+    # A plain directory of histories (no logs/ subdirectory) is checked as is.
+    logs_dir = config_dir / "logs"
+    if not do_run and not logs_dir.is_dir():
+        logs_dir = config_dir
 
-    # Bring everything down gracefully
-    print("  Stopping remaining containers...")
-    subprocess.run(base + ["down"], cwd=str(compose_dir), timeout=60, check=False)
-    return all_done
+    if do_run:
+        print(f"\n  ┌─ Running docker compose for '{config_name}' ─────────────────")
+        ok = run_compose(compose_file, log_level=log_level, timeout=timeout, faults=faults, seed=seed,
+                         preflight=preflight)
+        if not ok:
+            log.warning(f"Benchmark may be incomplete.")
 
+    c = ConfigCheck(config_name, logs_dir, opts)
+    if do_check:
+        if not logs_dir.exists() and logs_dir != STDIN:
+            log.warning(f"No logs/ directory found for '{config_name}'.")
+        else:
+            load_config_history(c)
+            if not c.ops:
+                log.warning(
+                    f"No history-*.json files in {logs_dir}.\n"
+                    f"     History is written by the client binary; make sure you ran\n"
+                    f"     a docker compose build since the last code change."
+                )
+            else:
+                warn_about_history(c)
+                check_consistency(c)
+                if c.lin_ok is True and opts.witness and opts.consistency == "linearizable":
+                    find_witness(c)
+                check_further(c)
+                cross_check_logs(c)
+
+        print_config_report(c)
+        if c.lin_ok is False:
+            save_counterexample(c)
+        if c.ops:
+            export_timelines(c)
+        c.phase("reports")
 
-def _find_client_containers(base: list[str], cwd: pathlib.Path) -> list[str]:
-    """Return the names of containers whose service starts with 'c' (clients)."""
-    try:
-        result = subprocess.run(
-            base + ["ps", "--format", "json"],
-            capture_output=True, text=True, timeout=10, cwd=str(cwd)
-        )
-        names = []
-        for line in result.stdout.strip().splitlines():
-            line = line.strip()
-            if not line:
-                continue
-            try:
-                obj = json.loads(line)
-                svc = obj.get("Service", obj.get("Name", ""))
-                name = obj.get("Name", obj.get("ID", svc))
-                if svc.startswith("c") and svc[1:].isdigit():
-                    names.append(name)
-            except json.JSONDecodeError:
-                pass
-        return names
-    except Exception:
-        return []
+        if not no_plots:
+            plot_path = c.artifact("benchmark_results", ".png")
+            if plot_results(config_name, c.ops, c.metrics, plot_path, c.events):
+                c.artifacts.append(str(plot_path))
+            c.phase("plots")
 
+        if c.verbose:
+            print("  Timing: " + " · ".join(f"{name} {sec:.3f}s" for name, sec in c.timings.items()))
 
-def _wait_for_containers(names: list[str], deadline: float) -> bool:
-    """Poll until all named containers report 'exited' status (or timeout)."""
-    while time.monotonic() < deadline:
-        time.sleep(3)
-        if all(_container_exited(n) for n in names):
-            return True
-    return all(_container_exited(n) for n in names)
+    result = config_result(c, config_dir, seed)
+    if opts.timeline.tui and do_check and c.ops:
+        # Popped by main() before the results are serialized.
+        svg_path = c.artifact(f"{config_name}-timeline", ".svg")
+        result["browse"] = browse_config(config_name, c.ops, c.verdicts, c.events, c.violations, c.lin_ok,
+                                         opts, svg_path)
+    return result
 
+# ── Watch mode ─────────────────────────────────────────────────────────────────
 
-def _container_exited(name: str) -> bool:
-    try:
-        result = subprocess.run(
-            ["docker", "inspect", "--format", "{{.State.Status}}", name],
-            capture_output=True, text=True, timeout=5
-        )
-        return result.stdout.strip() == "exited"
-    except Exception:
-        return False
-
-# ── History loading ────────────────────────────────────────────────────────────
-
-def load_history(logs_dir: pathlib.Path) -> list[Operation]:
-    import re as _re
-    ops: list[Operation] = []
-    # Only load canonical per-client files: history-1.json, history-2.json, …
-    # Ignore files with non-numeric suffixes (e.g. history-raw-c1.json from
-    # older runs) which would mix operations from different experiments.
-    _numeric_history = _re.compile(r"^history-\d+\.json$")
-    for path in sorted(p for p in logs_dir.glob("history-*.json")
-                       if _numeric_history.match(p.name)):
-        try:
-            with open(path) as f:
-                entries = json.load(f)
-            for e in entries:
-                inp = e["input"]
-                out = e.get("output", {})
-                ops.append(Operation(
-                    client_id=e["client_id"],
-                    op_type=inp["type"],
-                    key=inp["key"],
-                    write_val=inp.get("value"),
-                    call_ns=e["call"],
-                    return_ns=e["return_time"],
-                    result_val=out.get("value"),
-                ))
-        except Exception as ex:
-            print(f"  ⚠  Could not load {path}: {ex}")
-    return ops
-
-# ── Linearizability checker ────────────────────────────────────────────────────
-
-def _check_key(key: str, ops: list[Operation]) -> tuple[bool, str]:
-    """
-    Check linearizability for a single key (single-register model).
-
-    Rules:
-    (1) Get → None:  violation if any Put.return_ns ≤ Get.call_ns
-                     (a committed write must be visible)
-    (2) Get → V:
-        (a) There must exist Put(K,V) with return_ns ≤ Get.return_ns.
-        (b) If the latest Put(K,anything) that completed before Get.call_ns
-            wrote value W ≠ V, then there must also be a Put(K,V) with
-            return_ns > W_write.return_ns (V was written after W, so
-            the Get could have been linearized after V but before anything
-            newer).
-    """
-    puts = [op for op in ops if op.op_type == "Put"]
-    gets = [op for op in ops if op.op_type == "Get"]
-
-    for g in gets:
-        rv = g.result_val
-
-        if rv is None:
-            # No value returned — must mean the key was absent in this linearization.
-            # Violation if a write had fully committed before this get started.
-            for p in puts:
-                if p.return_ns <= g.call_ns:
-                    return False, (
-                        f"Key '{key}': Get by client {g.client_id} returned None, "
-                        f"but Put({p.write_val!r}) by client {p.client_id} "
-                        f"committed at t={p.return_ns:,} before Get started at t={g.call_ns:,}."
-                    )
-        else:
-            # Returned value rv must correspond to a write that could have been
-            # linearized before this Get.  Two operations can be ordered A before B
-            # iff A.call_ns ≤ B.return_ns (A started before B returned).  Using
-            # Put.return_ns ≤ Get.return_ns is too strict: it rejects valid
-            # concurrent executions where the Put's ack races the Get's ack but
-            # the write was committed (and visible) before the Get was served.
-            valid_writes = [p for p in puts if p.write_val == rv and p.call_ns <= g.return_ns]
-            if not valid_writes:
-                return False, (
-                    f"Key '{key}': Get by client {g.client_id} returned {rv!r}, "
-                    f"but no Put({rv!r}) started before Get.return_ns={g.return_ns:,}."
-                )
+# Inputs whose change triggers a re-check; generated artifacts are excluded.
+WATCHED_PATTERNS = ("history-*.json*", "events*.json", "metrics.json")
 
-            # Check for mandatory overwrite: find the latest Put that finished
-            # entirely before this Get was issued.
-            pre_gets = [p for p in puts if p.return_ns <= g.call_ns]
-            if pre_gets:
-                latest_pre = max(pre_gets, key=lambda p: p.return_ns)
-                if latest_pre.write_val != rv:
-                    # The register must have contained `latest_pre.write_val` when
-                    # the Get started — unless rv was written AFTER latest_pre and
-                    # before the end of the Get's execution window.
-                    later_rv_writes = [
-                        p for p in valid_writes
-                        if p.return_ns > latest_pre.return_ns
-                    ]
-                    if not later_rv_writes:
-                        return False, (
-                            f"Key '{key}': Get by client {g.client_id} returned {rv!r}, "
-                            f"but the latest committed write before Get.call_ns={g.call_ns:,} "
-                            f"was {latest_pre.write_val!r} (t={latest_pre.return_ns:,}), "
-                            f"and no write of {rv!r} occurred after that."
-                        )
 
-    return True, "ok"
+def _logs_signature(configs: list[pathlib.Path]) -> tuple:
+    sig = []
+    for cfg in configs:
+        for pattern in WATCHED_PATTERNS:
+            for path in (cfg / "logs").glob(pattern):
+                try:
+                    st = path.stat()
+                except FileNotFoundError:
+                    continue
+                sig.append((str(path), st.st_mtime_ns, st.st_size))
+    return tuple(sorted(sig))
+
 
+def watch(configs: list[pathlib.Path], interval: float, check) -> None:
+    """
+    Poll the configs' logs/ directories and call `check()` whenever a history,
+    events or metrics file changes (once the change has settled). Runs until
+    interrupted.
+    """
+    seen = None
+    try:
+        while True:
+            sig = _logs_signature(configs)
+            if sig != seen:
+                # Let writers finish: wait until two polls agree.
+                time.sleep(interval)
+                if _logs_signature(configs) != sig:
+                    continue
+                seen = sig
+                check()
+                print(f"\n  Watching {len(configs)} logs/ dir(s) every {interval:g}s (Ctrl+C to stop)…")
+            time.sleep(interval)
+    except KeyboardInterrupt:
+        print()
+
+# ── Soak tests ─────────────────────────────────────────────────────────────────
+
+SEGMENT_NAME = re.compile(r"^history-(\d+)\.(\d{6})(\.last)?\.json$")
+SOAK_STATE = "soak-state.json"
+SOAK_CARRIED = "soak-carried.json"
+SOAK_SUMMARY = "soak-summary.json"
+# Rounds listed in the rolling summary.
+SOAK_RECENT = 48
+
+
+def scan_segments(seg_dir: pathlib.Path) -> tuple[dict[int, dict[int, pathlib.Path]], dict[int, int]]:
+    """The segment files in `seg_dir` by round and client, and each finished client's last round."""
+    rounds: dict[int, dict[int, pathlib.Path]] = defaultdict(dict)
+    last: dict[int, int] = {}
+    for path in seg_dir.glob("history-*.json"):
+        m = SEGMENT_NAME.match(path.name)
+        if m:
+            client, seq = int(m.group(1)), int(m.group(2))
+            rounds[seq][client] = path
+            if m.group(3):
+                last[client] = seq
+    return rounds, last
+
+
+def _round_closed(seq: int, rounds: dict[int, dict[int, pathlib.Path]], last: dict[int, int]) -> bool:
+    clients = {c for files in rounds.values() for c in files}
+    return seq in rounds and all(c in rounds.get(seq, {}) or last.get(c, seq) < seq for c in clients)
+
+
+def carry_puts(carried: list[Operation], puts: list[Operation]) -> list[Operation]:
+    """
+    The Puts of `carried` + `puts` (one key's) that may still hold its value:
+    those no other Put was invoked after they returned.
+    """
+    puts = [p for p in carried + puts if not p.failed]
+    if len(puts) < 2:
+        return puts
+    by_call = sorted(puts, key=lambda p: p.call_ns)
+    last, runner_up = by_call[-1], by_call[-2].call_ns
+    return [p for p in puts if p.return_ns > (runner_up if p is last else last.call_ns)]
 
-def check_linearizability(ops: list[Operation]) -> tuple[bool, list[str]]:
-    """Check the full history by projecting onto each key independently."""
-    by_key: dict[str, list[Operation]] = defaultdict(list)
-    for op in ops:
-        by_key[op.key].append(op)
 
-    violations: list[str] = []
-    for key in sorted(by_key, key=lambda k: (len(k), k)):
-        ok, msg = _check_key(key, by_key[key])
-        if not ok:
-            violations.append(msg)
-    return not violations, violations
+@dataclass
+class SoakState:
+    """What a soak check carries from one round to the next."""
+    next_round: int = 0
+    carried: dict[str, list[Operation]] = field(default_factory=dict)
+    summary: dict = field(default_factory=dict)
 
-# ── Metrics ────────────────────────────────────────────────────────────────────
 
-def load_metrics(logs_dir: pathlib.Path) -> Optional[dict]:
-    path = logs_dir / "metrics.json"
+def load_soak_state(seg_dir: pathlib.Path, config_name: str) -> SoakState:
+    state = SoakState(summary={"config": config_name, "started": utc_now(), "rounds_checked": 0,
+                               "ops_checked": 0, "failing_rounds": [], "unknown_rounds": [], "recent": []})
+    path = seg_dir / SOAK_STATE
     if not path.exists():
-        return None
+        return state
     with open(path) as f:
-        return json.load(f)
+        saved = json.load(f)
+    state.next_round = saved["next_round"]
+    state.summary = saved["summary"]
+    if (seg_dir / SOAK_CARRIED).exists():
+        for op in load_history(seg_dir, include=[SOAK_CARRIED], time_unit="ns"):
+            state.carried.setdefault(op.key, []).append(op)
+    print(f"  Resuming at round {state.next_round} with {len(state.carried):,} key(s) carried")
+    return state
 
 
-def compute_history_rps(ops: list[Operation]) -> Optional[float]:
-    """Compute end-to-end throughput from operation history timestamps."""
-    if not ops:
-        return None
-    start_ns = min(op.call_ns for op in ops)
-    end_ns = max(op.return_ns for op in ops)
-    duration_ns = end_ns - start_ns
-    if duration_ns <= 0:
-        return None
-    return len(ops) / (duration_ns / 1e9)
+def _write_atomically(path: pathlib.Path, data: object) -> None:
+    partial = path.with_name(path.name + ".partial")
+    with open(partial, "w") as f:
+        json.dump(data, f, indent=1)
+    os.replace(partial, path)
 
 
-def compute_history_latencies_ms(ops: list[Operation]) -> tuple[list[float], list[float], list[float]]:
-    """Compute E2E latencies from history call/return timestamps."""
-    put_lats: list[float] = []
-    get_lats: list[float] = []
-    all_lats: list[float] = []
+def save_soak_state(seg_dir: pathlib.Path, logs_dir: pathlib.Path, state: SoakState) -> None:
+    _write_atomically(seg_dir / SOAK_CARRIED,
+                      [to_history_entry(op) for puts in state.carried.values() for op in puts])
+    _write_atomically(seg_dir / SOAK_STATE, {"next_round": state.next_round, "summary": state.summary})
+    _write_atomically(logs_dir / SOAK_SUMMARY, state.summary)
 
+
+def check_soak_round(
+    ops: list[Operation], later: list[Operation], state: SoakState, opts: CheckOptions
+) -> tuple[Optional[bool], list[str]]:
+    """
+    Check one round's ops with the Puts carried from earlier rounds and the
+    `later` round's Puts they may have overlapped as context, then carry its
+    own Puts forward.
+    """
+    last_return: dict[str, int] = {}
+    for op in ops:
+        last_return[op.key] = max(last_return.get(op.key, op.return_ns), op.return_ns)
+    context = [p for key in last_return for p in state.carried.get(key, [])]
+    context += [p for p in later if p.op_type == "Put" and p.key in last_return
+                and p.call_ns <= last_return[p.key]]
+    checker = CONSISTENCY_CHECKERS[opts.consistency][1]
+    try:
+        lin_ok, violations = checker(prepare_for_check(ops + context, opts), **checker_params(opts),
+                                     deadline=time.monotonic() + opts.check_timeout)
+    except (MemoryBudget, MemoryError) as ex:
+        lin_ok, violations = None, [f"memory limit reached: {str(ex) or 'out of memory'}"]
+    except PartitionTimeout as ex:
+        lin_ok, violations = None, [str(ex)]
+    except CheckTimeout as ex:
+        lin_ok, violations = None, [f"{opts.check_timeout:g}s budget exhausted after {ex}"]
+    puts: dict[str, list[Operation]] = defaultdict(list)
     for op in ops:
-        # Guard against malformed histories where return can be earlier than call.
-        duration_ns = op.return_ns - op.call_ns
-        if duration_ns < 0:
-            continue
-        lat_ms = duration_ns / 1e6
-        all_lats.append(lat_ms)
         if op.op_type == "Put":
-            put_lats.append(lat_ms)
-        elif op.op_type == "Get":
-            get_lats.append(lat_ms)
-
-    put_lats.sort()
-    get_lats.sort()
-    all_lats.sort()
-    return put_lats, get_lats, all_lats
-
-# ── Plotting ───────────────────────────────────────────────────────────────────
-
-def plot_results(
-    config_name: str,
-    ops: list[Operation],
-    metrics: Optional[dict],
-    logs_dir: pathlib.Path,
-) -> None:
-    if not HAS_MATPLOTLIB:
-        print("  (matplotlib not available — skipping plots)")
-        return
-    if not ops and not metrics:
-        return
-
-    fig, axes = plt.subplots(1, 3, figsize=(18, 5))
-    fig.suptitle(f"Benchmark: {config_name}", fontsize=14, fontweight="bold")
-
-    # ── Panel 1: Latency CDF ──────────────────────────────────────────────────
-    ax = axes[0]
-    ax.set_title("End-to-End Latency CDF")
-    put_lats, get_lats, all_lats = compute_history_latencies_ms(ops)
-    for lats, label, color in [
-        (put_lats, "Put (write)", "#2196F3"),
-        (get_lats, "Get (read)", "#FF5722"),
-    ]:
-        if not lats:
+            puts[op.key].append(op)
+    for key, key_puts in puts.items():
+        state.carried[key] = carry_puts(state.carried.get(key, []), key_puts)
+    return lin_ok, violations
+
+
+def soak(config_dir: pathlib.Path, opts: CheckOptions, interval: float, keep: int,
+         notify: Optional[Callable[[dict], None]] = None) -> int:
+    """
+    --soak: check the rounds of history segments in config_dir/logs/segments
+    as they close (see "Soak tests" in CHECKER.md), keeping only the last `keep` passing
+    rounds on disk, until every client wrote its last segment or Ctrl+C.
+    Returns the exit code of the rounds checked.
+    """
+    logs_dir = config_dir / "logs"
+    seg_dir = logs_dir / "segments"
+    seg_dir.mkdir(parents=True, exist_ok=True)
+    state = load_soak_state(seg_dir, config_dir.name)
+    summary = state.summary
+    passed: list[int] = [r["round"] for r in summary["recent"] if r["verdict"] == "PASS"]
+    print(f"  Soak: watching {seg_dir} every {interval:g}s (Ctrl+C to stop)…")
+
+    def load_round(files: dict[int, pathlib.Path]) -> list[Operation]:
+        names = [p.name for p in files.values()]
+        return filter_ops(load_history(seg_dir, include=names, time_unit=opts.load.time_unit,
+                                       max_listed=10), opts)[0]
+
+    try:
+        while True:
+            rounds, last = scan_segments(seg_dir)
+            done = bool(last) and all(c in last for files in rounds.values() for c in files)
+            seq = state.next_round
+            while _round_closed(seq, rounds, last) and (
+                    _round_closed(seq + 1, rounds, last) or (done and seq >= max(last.values()))):
+                started = time.monotonic()
+                ops = load_round(rounds[seq])
+                later = load_round(rounds.get(seq + 1, {}))
+                lin_ok, violations = check_soak_round(ops, later, state, opts) if ops else (True, [])
+                verdict = {True: "PASS", False: "FAIL", None: "UNKNOWN"}[lin_ok]
+                mark = {"PASS": "✓", "FAIL": "✗", "UNKNOWN": "?"}[verdict]
+                print(f"  {mark} round {seq}: {len(ops):,} ops, {verdict}"
+                      + (f" ({len(violations)} violation(s))" if lin_ok is False else ""))
+                for v in violations[:5]:
+                    print(f"      • {v}")
+                summary["rounds_checked"] += 1
+                summary["ops_checked"] += len(ops)
+                if lin_ok is False:
+                    summary["failing_rounds"].append(seq)
+                elif lin_ok is None:
+                    summary["unknown_rounds"].append(seq)
+                summary["recent"] = (summary["recent"] + [{
+                    "round": seq, "ops": len(ops), "verdict": verdict, "violations": violations[:5],
+                    "checked_at": utc_now(), "seconds": round(time.monotonic() - started, 3),
+                }])[-SOAK_RECENT:]
+                summary["updated"] = utc_now()
+                summary["carried_keys"] = len(state.carried)
+                state.next_round = seq + 1
+                save_soak_state(seg_dir, logs_dir, state)
+                if lin_ok is False and notify:
+                    notify({"config": f"{config_dir.name} round {seq}", "consistency": opts.consistency,
+                            "lin_ok": False, "violations": len(violations), "ops": len(ops),
+                            "violation_details": violations})
+                if lin_ok is True:
+                    passed.append(seq)
+                    while len(passed) > keep:
+                        for path in rounds.get(passed.pop(0), {}).values():
+                            path.unlink(missing_ok=True)
+                seq += 1
+            if done and seq > max(last.values()):
+                print("  Soak finished: every client wrote its last segment")
+                break
+            time.sleep(interval)
+    except KeyboardInterrupt:
+        print()
+    print(f"  Soak summary: {summary['rounds_checked']} round(s), {summary['ops_checked']:,} ops checked, "
+          f"{len(summary['failing_rounds'])} failing, {len(summary['unknown_rounds'])} unknown "
+          f"→ {logs_dir / SOAK_SUMMARY}")
+    if summary["failing_rounds"]:
+        return EXIT_VIOLATION
+    return EXIT_UNKNOWN if summary["unknown_rounds"] else EXIT_OK
+
+# ── Rechecks ───────────────────────────────────────────────────────────────────
+
+# CheckOptions fields that decide a verdict, by option group ("" for the top
+# level). A result records them in one flat object (see options_record) so
+# POST /results/{id}/recheck repeats the same check; the rest only change what
+# is printed or saved.
+RECHECK_FIELDS: dict[str, tuple[str, ...]] = {
+    "": ("consistency", "auto_levels", "check_timeout", "window_ns", "window_stride_ns", "clock_skew_ns",
+         "parallelism", "partition_timeout", "partition", "model", "bound_ns", "snapshot_window_ns"),
+    "select": ("keys", "clients", "from_ns", "to_ns", "limit"),
+    "load": ("strict", "include", "exclude", "sequential_clients", "namespace_clients", "time_offsets",
+             "align_marker", "time_unit", "skip_invalid", "decided_logs", "state_snapshots", "request_logs",
+             "csv_columns", "field_map"),
+}
+
+# Parameters a recheck may change: name → (CheckOptions field, parser).
+RECHECK_PARAMS: dict[str, tuple[str, Callable[[str], object]]] = {
+    "consistency": ("consistency", str),
+    "timeout": ("check_timeout", float),
+    "model": ("model", str),
+    "clock_skew": ("clock_skew_ns", parse_duration_ns),
+    "bound": ("bound_ns", parse_duration_ns),
+}
+
+
+def options_record(opts: CheckOptions) -> dict:
+    """The RECHECK_FIELDS of `opts` as JSON-ready values."""
+    record = {}
+    for group, names in RECHECK_FIELDS.items():
+        holder = getattr(opts, group) if group else opts
+        for name in names:
+            value = getattr(holder, name)
+            record[name] = sorted(value) if isinstance(value, set) else value
+    return record
+
+
+def options_from_record(record: dict) -> CheckOptions:
+    """Inverse of options_record; fields it lacks keep their defaults."""
+    opts = CheckOptions(report=ReportOptions(progress=False))
+    groups = {name: group for group, names in RECHECK_FIELDS.items() for name in names}
+    for name, value in record.items():
+        if name not in groups:
             continue
-        n = len(lats)
-        y = [(i + 1) / n for i in range(n)]
-        ax.plot(lats, y, label=label, color=color, linewidth=1.5)
-        for frac, pname in [(0.50, "p50"), (0.95, "p95"), (0.99, "p99")]:
-            v = lats[min(int(frac * n), n - 1)]
-            ax.axvline(v, color=color, linestyle="--", alpha=0.4, linewidth=0.8)
-            ax.text(v, frac + 0.02, f" {pname}={v:.1f}", fontsize=7, color=color)
-    ax.set_xlabel("Latency (ms)")
-    ax.set_ylabel("Cumulative fraction")
-    ax.legend(fontsize=8)
-    ax.grid(True, alpha=0.3)
-
-    # ── Panel 2: Latency histogram ────────────────────────────────────────────
-    ax = axes[1]
-    ax.set_title("Latency Distribution (histogram)")
-    if all_lats:
-        bins = min(60, max(20, len(all_lats) // 20))
-        ax.hist(put_lats, bins=bins, alpha=0.6, color="#2196F3", label="Put")
-        ax.hist(get_lats, bins=bins, alpha=0.6, color="#FF5722", label="Get")
-    ax.set_xlabel("Latency (ms)")
-    ax.set_ylabel("Count")
-    ax.legend(fontsize=8)
-    ax.grid(True, alpha=0.3)
-
-    # ── Panel 3: Path distribution (from proxy metrics) ───────────────────────
-    ax = axes[2]
-    if metrics:
-        fp = metrics.get("fast_path_committed", 0)
-        sp = metrics.get("slow_path_committed", 0)
-        aborted = metrics.get("fast_path_aborted", 0)
-        avg_fp_ms = metrics.get("avg_fast_path_latency_us", 0) / 1000.0
-        avg_sp_ms = metrics.get("avg_slow_path_latency_us", 0) / 1000.0
-        history_rps = compute_history_rps(ops)
-        throughput_label = (
-            f"throughput ≈ {history_rps:.0f} rps" if history_rps is not None else "throughput: n/a"
-        )
-        ax.set_title(f"Proxy metrics  |  {throughput_label}")
-        bars = ax.bar(
-            ["Fast-path", "Slow-path", "Aborted"],
-            [fp, sp, aborted],
-            color=["#4CAF50", "#FF9800", "#F44336"],
-        )
-        for bar, v in zip(bars, [fp, sp, aborted]):
-            ax.text(
-                bar.get_x() + bar.get_width() / 2,
-                bar.get_height() + 1,
-                str(v),
-                ha="center", va="bottom", fontsize=9,
-            )
-        ax.set_ylabel("Operations committed")
-        ax2 = ax.twinx()
-        ax2.plot(
-            ["Fast-path", "Slow-path"],
-            [avg_fp_ms, avg_sp_ms],
-            "D--", color="#9C27B0", markersize=8, label="Avg latency (ms)",
-        )
-        ax2.set_ylabel("Avg latency (ms)", color="#9C27B0")
-        ax2.tick_params(axis="y", labelcolor="#9C27B0")
-    else:
-        ax.set_title("Proxy metrics")
-        ax.text(
-            0.5, 0.5,
-            "No metrics.json\n(proxy telemetry flushed on shutdown;\n"
-            "check that the container exited cleanly)",
-            ha="center", va="center", transform=ax.transAxes, fontsize=9,
-        )
+        if name in ("keys", "clients") and value is not None:
+            value = set(value)
+        elif name == "time_offsets":
+            value = tuple(map(tuple, value))
+        elif name in ("exclude", "decided_logs", "state_snapshots", "request_logs"):
+            value = tuple(value)
+        setattr(getattr(opts, groups[name]) if groups[name] else opts, name, value)
+    return opts
 
-    plt.tight_layout()
-    out = logs_dir / "benchmark_results.png"
-    plt.savefig(out, dpi=150, bbox_inches="tight")
-    plt.close(fig)
-    print(f"  Plot saved → {out}")
-
-# ── Summary ────────────────────────────────────────────────────────────────────
-
-def print_summary(
-    config_name: str,
-    ops: list[Operation],
-    metrics: Optional[dict],
-    lin_ok: bool,
-    violations: list[str],
-) -> None:
-    puts = [o for o in ops if o.op_type == "Put"]
-    gets = [o for o in ops if o.op_type == "Get"]
-    _, _, lats = compute_history_latencies_ms(ops)
-    n = len(lats)
-
-    print(f"\n{'═' * 62}")
-    print(f"  Config : {config_name}")
-    print(f"  History: {len(ops)} ops  ({len(puts)} Puts / {len(gets)} Gets)")
-
-    if n > 0:
-        p50 = lats[int(0.50 * n)]
-        p95 = lats[int(0.95 * n)]
-        p99 = lats[min(int(0.99 * n), n - 1)]
-        print(
-            f"  E2E latency p50/p95/p99 : {p50:.2f} ms / {p95:.2f} ms / {p99:.2f} ms "
-            f"(from history call/return timestamps)"
-        )
 
-    history_rps = compute_history_rps(ops)
-
-    if metrics:
-        fp = metrics.get("fast_path_committed", 0)
-        sp = metrics.get("slow_path_committed", 0)
-        tot = fp + sp or 1
-        aborted = metrics.get("fast_path_aborted", 0)
-        avg_fp = metrics.get("avg_fast_path_latency_us", 0) / 1000
-        avg_sp = metrics.get("avg_slow_path_latency_us", 0) / 1000
-        print(
-            f"  Fast-path : {fp:6d} ops ({fp / tot * 100:.1f}%)  avg {avg_fp:.2f} ms "
-            f"| aborted: {aborted}"
+def recheck_options(stored: dict, params: dict[str, str]) -> CheckOptions:
+    """
+    The options to recheck a stored --json result with: those it was checked
+    with, changed by `params` (see RECHECK_PARAMS). Raises ValueError on an
+    unknown or invalid parameter.
+    """
+    opts = options_from_record(stored.get("check_options")
+                               or {"consistency": stored.get("consistency", "linearizable")})
+    for name, text in params.items():
+        if name not in RECHECK_PARAMS:
+            raise ValueError(f"unknown parameter {name!r} (expected {', '.join(RECHECK_PARAMS)})")
+        attr, parse = RECHECK_PARAMS[name]
+        try:
+            setattr(opts, attr, parse(str(text)))
+        except ValueError:
+            raise ValueError(f"{name}: cannot parse {text!r}") from None
+    if "consistency" in params:
+        opts.auto_levels = opts.consistency == "auto"
+        if opts.auto_levels:
+            opts.consistency = "linearizable"
+        elif opts.consistency not in CONSISTENCY_CHECKERS:
+            raise ValueError(f"consistency: expected one of {', '.join(CONSISTENCY_CHECKERS)} or auto")
+    if opts.model not in MODELS:
+        raise ValueError(f"model: expected one of {', '.join(MODELS)}")
+    if opts.check_timeout <= 0:
+        raise ValueError("timeout must be positive")
+    if opts.consistency == "bounded-staleness" and not opts.bound_ns:
+        raise ValueError("consistency bounded-staleness needs bound (e.g. 200ms)")
+    if "bound" in params and opts.consistency != "bounded-staleness":
+        raise ValueError("bound only applies to consistency bounded-staleness")
+    return opts
+
+
+def recheck_stored(db: pathlib.Path, rowid: int, stored: dict, opts: CheckOptions) -> tuple[int, dict]:
+    """
+    Check the history directory a stored result recorded again with `opts`
+    and store the outcome as a new run (run id recheck-<rowid>, which also
+    suffixes its artifacts). Returns the new result's row id and the result.
+    Raises HistoryError if the history no longer loads.
+    """
+    if pathlib.Path(stored["config_dir"]) == STDIN:
+        raise HistoryError("the history was piped to stdin and not kept")
+    started_at = time.time()
+    opts = replace(opts, report=replace(opts.report, run_id=f"recheck-{rowid}", verbosity=-1))
+    config_log = LOG_CONFIG.set(stored["config"])
+    try:
+        with contextlib.redirect_stdout(io.StringIO()):
+            result = run_single(pathlib.Path(stored["config_dir"]), do_run=False, do_check=True, timeout=0,
+                                log_level="info", no_plots=True, opts=opts)
+    finally:
+        LOG_CONFIG.reset(config_log)
+    result["recheck_of"] = rowid
+    argv = ["--recheck", str(rowid), "--consistency", "auto" if opts.auto_levels else opts.consistency,
+            "--check-timeout", f"{opts.check_timeout:g}"]
+    _, rowids = store_results(db, [result], started_at, opts.report.run_id, opts.consistency, True, argv=argv)
+    return rowids[result["config"]], result
+
+
+def recheck_result(db: pathlib.Path, rowid: int, stored: dict, params: dict[str, str]) -> tuple[int, dict]:
+    """The dashboard's recheck: recheck_stored() with recheck_options()."""
+    return recheck_stored(db, rowid, stored, recheck_options(stored, params))
+
+# ── Target discovery ───────────────────────────────────────────────────────────
+
+def resolve_targets(target: str) -> list[pathlib.Path]:
+    """
+    Directories to benchmark/check for the positional target: 'all' (every
+    folder here with a docker-compose.yml), a folder name under
+    nezha_benchmarks/, any directory path, or a glob of directories
+    (e.g. 'test_*' or 'runs/2024-*'), resolved against nezha_benchmarks/
+    and then the working directory.
+    """
+    if target == "all":
+        return sorted(
+            d for d in SCRIPT_DIR.iterdir()
+            if d.is_dir() and (d / "docker-compose.yml").exists()
         )
-        print(f"  Slow-path : {sp:6d} ops ({sp / tot * 100:.1f}%)  avg {avg_sp:.2f} ms")
-    else:
-        print("  Proxy metrics: not available (metrics.json missing)")
+    if any(ch in target for ch in "*?["):
+        if pathlib.Path(target).is_absolute():
+            root, pattern = pathlib.Path(target).anchor, target[len(pathlib.Path(target).anchor):]
+            return sorted(d for d in pathlib.Path(root).glob(pattern) if d.is_dir())
+        for base in (SCRIPT_DIR, pathlib.Path.cwd()):
+            matches = sorted(d for d in base.glob(target) if d.is_dir())
+            if matches:
+                return matches
+        return []
+    for candidate in (SCRIPT_DIR / target, pathlib.Path(target)):
+        if candidate.is_dir():
+            return [pathlib.Path(os.path.abspath(candidate))]
+    return []
 
-    if history_rps is not None:
-        print(f"  Throughput: {history_rps:.1f} rps  (from history)")
-    else:
-        print("  Throughput: n/a  (insufficient history timestamps)")
 
-    if not ops:
-        print("  Linearizability: SKIPPED  (no history files found)")
-    elif lin_ok:
-        print("  Linearizability: ✓  PASS")
-    else:
-        print(f"  Linearizability: ✗  FAIL  ({len(violations)} violation(s))")
-        for v in violations[:5]:
-            print(f"    • {v}")
-        if len(violations) > 5:
-            print(f"    … and {len(violations) - 5} more")
-    print(f"{'═' * 62}")
+def target_name(config_dir: pathlib.Path) -> str:
+    """A config's name: its folder's, or "stdin" for the history piped in."""
+    return "stdin" if config_dir == STDIN else config_dir.name
 
-# ── Single benchmark runner ────────────────────────────────────────────────────
 
-def run_single(
-    config_dir: pathlib.Path,
-    do_run: bool,
-    do_check: bool,
-    timeout: int,
-    log_level: str,
-    no_plots: bool,
-) -> dict:
-    config_name = config_dir.name
-    compose_file = config_dir / "docker-compose.yml"
-    if not compose_file.exists():
-        compose_file = config_dir / "docker-compose.yaml"
-    if not compose_file.exists():
-        print(f"  ✗ No docker-compose file in {config_name}, skipping.")
-        return {"config": config_name, "skipped": True}
+# URL schemes a target may use; the histories are downloaded first.
+REMOTE_SCHEMES = ("s3", "gs", "http", "https")
 
-    logs_dir = config_dir / "logs"
+# Files fetched from a remote prefix: histories and what is read next to them.
+REMOTE_SUFFIXES = (".json", ".jsonl", ".csv", ".gz", ".zst")
 
-    if do_run:
-        print(f"\n  ┌─ Running docker compose for '{config_name}' ─────────────────")
-        ok = run_compose(compose_file, log_level=log_level, timeout=timeout)
-        if not ok:
-            print(f"  ⚠  Benchmark may be incomplete.")
 
-    ops = []
-    metrics = None
-    lin_ok = True
-    violations: list[str] = []
+def is_remote_target(target: str) -> bool:
+    return urllib.parse.urlsplit(target).scheme in REMOTE_SCHEMES
 
-    if do_check:
-        if not logs_dir.exists():
-            print(f"  ⚠  No logs/ directory found for '{config_name}'.")
+
+def _remote_name(parts: list[str], fallback: str) -> str:
+    """Config name for a remote location: its last folder, skipping logs/."""
+    while parts and parts[-1] == "logs":
+        parts = parts[:-1]
+    return parts[-1] if parts else fallback
+
+
+def fetch_remote_target(url: str, root: pathlib.Path) -> pathlib.Path:
+    """
+    Download the histories at `url` into a directory of `root` named after
+    the location, and return it. s3:// and gs:// URLs name an object
+    or a prefix, whose REMOTE_SUFFIXES files are fetched keeping their
+    relative paths (so a prefix holding logs/ reads like a benchmark
+    folder); they need boto3 / google-cloud-storage, which take credentials
+    from the standard environment (AWS_* variables and profiles; Application
+    Default Credentials). http(s):// URLs name one file; ~/.netrc supplies
+    credentials. Raises HistoryError if nothing can be fetched.
+    """
+    split = urllib.parse.urlsplit(url)
+    path = split.path.strip("/")
+    is_file = not split.path.endswith("/") and pathlib.PurePosixPath(path).suffix in REMOTE_SUFFIXES
+    parts = path.split("/")[:-1] if is_file else [p for p in path.split("/") if p]
+    out = root / _remote_name(parts, split.hostname or "remote")
+    out.mkdir()
+    try:
+        if split.scheme == "s3":
+            fetched = _fetch_s3(split.netloc, path, is_file, out)
+        elif split.scheme == "gs":
+            fetched = _fetch_gcs(split.netloc, path, is_file, out)
         else:
-            ops = load_history(logs_dir)
-            metrics = load_metrics(logs_dir)
+            fetched = _fetch_http(url, out)
+    except HistoryError:
+        raise
+    except Exception as ex:     # the SDKs' and urllib's errors share no base class
+        raise HistoryError(f"cannot fetch {url}: {ex}") from None
+    if not fetched:
+        raise HistoryError(f"no {'/'.join(REMOTE_SUFFIXES)} files at {url}")
+    print(f"Fetched {fetched} file(s) from {url} → {out}")
+    return out
+
+
+def _remote_dest(out: pathlib.Path, key: str, prefix: str) -> Optional[pathlib.Path]:
+    rel = key[len(prefix):].lstrip("/") if prefix else key
+    if not rel or not rel.endswith(REMOTE_SUFFIXES) or ".." in rel.split("/"):
+        return None
+    dest = out / rel
+    dest.parent.mkdir(parents=True, exist_ok=True)
+    return dest
 
-            if not ops:
-                print(
-                    f"  ⚠  No history-*.json files in {logs_dir}.\n"
-                    f"     History is written by the client binary; make sure you ran\n"
-                    f"     a docker compose build since the last code change."
-                )
-            else:
-                lin_ok, violations = check_linearizability(ops)
 
-        print_summary(config_name, ops, metrics, lin_ok, violations)
+def _fetch_s3(bucket: str, key: str, is_file: bool, out: pathlib.Path) -> int:
+    try:
+        import boto3
+    except ImportError:
+        raise HistoryError("reading s3:// needs boto3 (pip install boto3)") from None
+    s3 = boto3.client("s3")
+    if is_file:
+        s3.download_file(bucket, key, str(out / pathlib.PurePosixPath(key).name))
+        return 1
+    prefix = key + "/" if key else ""
+    fetched = 0
+    for page in s3.get_paginator("list_objects_v2").paginate(Bucket=bucket, Prefix=prefix):
+        for obj in page.get("Contents", []):
+            dest = _remote_dest(out, obj["Key"], prefix)
+            if dest is not None:
+                s3.download_file(bucket, obj["Key"], str(dest))
+                fetched += 1
+    return fetched
+
+
+def _fetch_gcs(bucket: str, key: str, is_file: bool, out: pathlib.Path) -> int:
+    try:
+        from google.cloud import storage
+    except ImportError:
+        raise HistoryError("reading gs:// needs google-cloud-storage (pip install google-cloud-storage)") from None
+    gcs = storage.Client()
+    if is_file:
+        gcs.bucket(bucket).blob(key).download_to_filename(str(out / pathlib.PurePosixPath(key).name))
+        return 1
+    prefix = key + "/" if key else ""
+    fetched = 0
+    for blob in gcs.list_blobs(bucket, prefix=prefix):
+        dest = _remote_dest(out, blob.name, prefix)
+        if dest is not None:
+            blob.download_to_filename(str(dest))
+            fetched += 1
+    return fetched
+
+
+def _fetch_http(url: str, out: pathlib.Path) -> int:
+    name = pathlib.PurePosixPath(urllib.parse.urlsplit(url).path).name
+    if not name.endswith(REMOTE_SUFFIXES):
+        raise HistoryError(f"{url}: an http(s) target must name a history file ({'/'.join(REMOTE_SUFFIXES)}); "
+                           "directories cannot be listed over HTTP")
+    request = urllib.request.Request(url)
+    try:
+        login = netrc.netrc().authenticators(urllib.parse.urlsplit(url).hostname or "")
+    except (OSError, netrc.NetrcParseError):
+        login = None
+    if login:
+        token = base64.b64encode(f"{login[0]}:{login[2]}".encode()).decode()
+        request.add_header("Authorization", f"Basic {token}")
+    with urllib.request.urlopen(request, timeout=60) as response, open(out / name, "wb") as f:
+        shutil.copyfileobj(response, f)
+    return 1
 
-        if not no_plots:
-            plot_results(config_name, ops, metrics, logs_dir)
+# ── Config file ────────────────────────────────────────────────────────────────
 
-    return {
-        "config": config_name,
-        "skipped": False,
-        "ops": len(ops),
-        "history_rps": compute_history_rps(ops),
-        "lin_ok": lin_ok,
-        "violations": len(violations),
-        "metrics": metrics,
-    }
+DEFAULT_CONFIG_FILES = ("verifier.yaml", "verifier.yml", "verifier.toml")
 
-# ── Entry point ────────────────────────────────────────────────────────────────
 
-def main() -> None:
-    parser = argparse.ArgumentParser(
-        description="OmniPaxos-KV benchmark runner and linearizability tester",
-        formatter_class=argparse.RawDescriptionHelpFormatter,
-        epilog=__doc__,
-    )
-    parser.add_argument(
-        "target",
-        help="Benchmark folder name (e.g. adaptive_deadline) or 'all'",
-    )
-    parser.add_argument(
+def load_data_file(path: pathlib.Path) -> object:
+    """A YAML (needs PyYAML), TOML or JSON document, by file suffix."""
+    text = path.read_text()
+    if path.suffix in (".yaml", ".yml"):
+        try:
+            import yaml
+        except ImportError:
+            raise ValueError("reading YAML needs PyYAML (pip install pyyaml), or use TOML/JSON") from None
+        return yaml.safe_load(text) or {}
+    if path.suffix == ".toml":
+        import tomllib
+        return tomllib.loads(text)
+    return json.loads(text)
+
+
+def load_config_file(path: pathlib.Path) -> dict:
+    """Option defaults from a YAML, TOML or JSON file, keyed by argparse dest."""
+    data = load_data_file(path)
+    if not isinstance(data, dict):
+        raise ValueError("expected a mapping of option names to values")
+    return {str(k).replace("-", "_"): v for k, v in data.items()}
+
+# ── Scenario suites ────────────────────────────────────────────────────────────
+
+SCENARIO_KEYS = ("name", "benchmark", *SCENARIO_CONFIGS, "seed", "nemesis", "expect", "bound",
+                 "availability", "timeout", "check_timeout", "min_ops")
+
+
+@dataclass
+class Scenario:
+    """One entry of a --suite file (see "Suites" in CHECKER.md)."""
+    name: str
+    benchmark: pathlib.Path
+    overrides: dict[str, dict]          # SCENARIO_CONFIGS key → top-level TOML keys to set
+    expect: str = "linearizable"
+    bound_ns: int = 0
+    seed: Optional[int] = None
+    faults: Optional[list[Fault]] = None
+    timeout: Optional[int] = None
+    check_timeout: Optional[float] = None
+    min_ops: int = 0
+    # (phase, op class, metric, comparison, rate), see parse_availability
+    availability: list[tuple[str, str, str, str, float]] = field(default_factory=list)
+
+    def options(self, opts: CheckOptions) -> CheckOptions:
+        return replace(opts, consistency=self.expect, auto_levels=False, bound_ns=self.bound_ns,
+                       check_timeout=self.check_timeout or opts.check_timeout)
+
+
+def load_suite(path: pathlib.Path) -> list[Scenario]:
+    """
+    The scenarios of a --suite file, each merged over its "defaults".
+    Raises ValueError naming the scenario and key at fault.
+    """
+    data = load_data_file(path)
+    if not isinstance(data, dict) or not isinstance(data.get("scenarios"), list) or not data["scenarios"]:
+        raise ValueError("expected a mapping with a non-empty \"scenarios\" list")
+    defaults = data.get("defaults") or {}
+    if not isinstance(defaults, dict):
+        raise ValueError("defaults: expected a mapping")
+    scenarios, names = [], set()
+    for n, entry in enumerate(data["scenarios"], 1):
+        if not isinstance(entry, dict):
+            raise ValueError(f"scenario {n}: expected a mapping")
+        entry = {**defaults, **entry}
+        name = str(entry.get("name", ""))
+        where = f"scenario {n}" + (f" ({name})" if name else "")
+        unknown = set(entry) - set(SCENARIO_KEYS)
+        if unknown:
+            raise ValueError(f"{where}: unknown key(s) {', '.join(sorted(unknown))}")
+        if not re.fullmatch(r"[\w.-]+", name):
+            raise ValueError(f"{where}: name: expected letters, digits, '.', '_' or '-'")
+        if name in names:
+            raise ValueError(f"{where}: name used twice")
+        names.add(name)
+        folder = resolve_targets(str(entry.get("benchmark", "")))
+        if len(folder) != 1 or not any((folder[0] / f).is_file()
+                                       for f in ("docker-compose.yml", "docker-compose.yaml")):
+            raise ValueError(f"{where}: benchmark: {entry.get('benchmark')!r} is not a benchmark folder")
+        overrides = {}
+        for key in SCENARIO_CONFIGS:
+            if key in entry:
+                if not isinstance(entry[key], dict):
+                    raise ValueError(f"{where}: {key}: expected a mapping of config keys to values")
+                overrides[key] = entry[key]
+        sc = Scenario(name, folder[0], overrides)
+        try:
+            sc.expect = str(entry.get("expect", sc.expect))
+            if sc.expect not in CONSISTENCY_CHECKERS:
+                raise ValueError(f"expect: one of {', '.join(CONSISTENCY_CHECKERS)}")
+            if sc.expect == "bounded-staleness":
+                if "bound" not in entry:
+                    raise ValueError("expect bounded-staleness needs bound (e.g. 200ms)")
+                sc.bound_ns = parse_duration_ns(str(entry["bound"]))
+            if "nemesis" in entry:
+                sc.faults = parse_nemesis(str(entry["nemesis"]))
+            if "availability" in entry:
+                try:
+                    sc.availability = parse_availability(entry["availability"])
+                except ValueError as ex:
+                    raise ValueError(f"availability: {ex}") from None
+            for key in ("seed", "timeout", "min_ops"):
+                if key in entry:
+                    if not isinstance(entry[key], int) or isinstance(entry[key], bool) or entry[key] < 0:
+                        raise ValueError(f"{key}: expected a non-negative integer")
+                    setattr(sc, key, entry[key])
+            if "check_timeout" in entry:
+                sc.check_timeout = float(entry["check_timeout"])
+        except ValueError as ex:
+            raise ValueError(f"{where}: {ex}") from None
+        scenarios.append(sc)
+    return scenarios
+
+
+def toml_value(v: object) -> str:
+    if isinstance(v, bool):
+        return "true" if v else "false"
+    if isinstance(v, (int, float)):
+        return repr(v)
+    if isinstance(v, str):
+        return json.dumps(v)
+    if isinstance(v, list):
+        return "[" + ", ".join(map(toml_value, v)) + "]"
+    if isinstance(v, dict):
+        return "{ " + ", ".join(f"{k} = {toml_value(x)}" for k, x in v.items()) + " }"
+    raise ValueError(f"cannot write {v!r} to TOML")
+
+
+def dump_toml(data: dict) -> str:
+    """A config TOML: keys first, then arrays of tables (e.g. [[requests]]); tables inline."""
+    tables = {k: v for k, v in data.items()
+              if isinstance(v, list) and v and all(isinstance(x, dict) for x in v)}
+    lines = [f"{k} = {toml_value(v)}" for k, v in data.items() if k not in tables]
+    for k, rows in tables.items():
+        for row in rows:
+            lines += ["", f"[[{k}]]"] + [f"{rk} = {toml_value(rv)}" for rk, rv in row.items()]
+    return "\n".join(lines) + "\n"
+
+
+def prepare_scenario(sc: Scenario, root: pathlib.Path) -> pathlib.Path:
+    """
+    A fresh copy of the scenario's benchmark folder (without logs/) at
+    root/<name>, with its overrides written into the config TOMLs and the
+    compose file's build contexts made absolute so they still resolve.
+    """
+    import tomllib
+    dest = root / sc.name
+    if dest.exists():
+        shutil.rmtree(dest)
+    shutil.copytree(sc.benchmark, dest, ignore=shutil.ignore_patterns("logs"))
+    for key, pattern in SCENARIO_CONFIGS.items():
+        if key not in sc.overrides:
+            continue
+        files = sorted(dest.glob(pattern))
+        if not files:
+            raise ValueError(f"scenario {sc.name}: {key}: no {pattern} in {sc.benchmark.name}")
+        for path in files:
+            data = tomllib.loads(path.read_text())
+            data.update(sc.overrides[key])
+            path.write_text(dump_toml(data))
+    for compose in dest.glob("docker-compose.y*ml"):
+        compose.write_text(re.sub(
+            r"(?m)^(\s*context:\s*)(\S+)",
+            lambda m: m.group(1) + str((sc.benchmark / m.group(2)).resolve()),
+            compose.read_text(),
+        ))
+    return dest
+
+# ── Command line ───────────────────────────────────────────────────────────────
+
+def _seconds_or_auto(text: str) -> Union[float, str]:
+    if text == "auto":
+        return text
+    try:
+        return float(text)
+    except ValueError:
+        raise argparse.ArgumentTypeError(f"expected seconds or 'auto', got {text!r}") from None
+
+
+class ArgumentParser(argparse.ArgumentParser):
+    """Exits with EXIT_INPUT on usage errors: argparse's own 2 means UNKNOWN here."""
+
+    def error(self, message: str):
+        self.print_usage(sys.stderr)
+        self.exit(EXIT_INPUT, f"{self.prog}: error: {message}\n")
+
+
+def _size(text: str) -> int:
+    try:
+        size = parse_size(text)
+    except ValueError:
+        raise argparse.ArgumentTypeError(f"expected a size such as 512M or 2G, got {text!r}") from None
+    if size <= 0:
+        raise argparse.ArgumentTypeError(f"must be positive, got {text!r}")
+    return size
+
+
+def add_run_arguments(parser: ArgumentParser) -> None:
+    """Options of docker compose runs and of which configs run, and how often."""
+    group = parser.add_argument_group("running benchmarks")
+    group.add_argument(
         "--check-only",
         action="store_true",
         help="Skip docker compose; only analyse existing logs/",
     )
-    parser.add_argument(
+    group.add_argument(
         "--run-only",
         action="store_true",
         help="Run docker compose but skip the analysis step",
     )
-    parser.add_argument(
+    group.add_argument(
         "--timeout",
         type=int,
         default=60,
         help="Seconds to wait for client containers before forcing shutdown (default: 60)",
     )
-    parser.add_argument(
-        "--log-level",
+    group.add_argument(
+        "--log-level", "--rust-log",
+        dest="rust_log",
         default="info",
+        metavar="LEVEL",
         help="RUST_LOG level passed to docker containers (default: info)",
     )
-    parser.add_argument(
+    group.add_argument(
+        "--nemesis",
+        metavar="SCHEDULE",
+        help="Faults to inject while running, e.g. 'pause:s2@5s+3s,kill:s3@10s' "
+             "(actions: pause, kill, isolate, delay=LATENCY)",
+    )
+    group.add_argument(
+        "--seed",
+        type=int,
+        help="Random seed for --fuzz and the workload seed for runs (default: random)",
+    )
+    group.add_argument(
+        "--preflight",
+        type=float,
+        nargs="?",
+        const=60.0,
+        metavar="SECONDS",
+        help="With a run: abort unless every node and the proxy are running and a leader is elected "
+             "within SECONDS (default: 60)",
+    )
+    group.add_argument(
+        "--suite",
+        type=pathlib.Path,
+        metavar="FILE",
+        help="Run (or with --check-only re-check) the scenarios of a YAML/TOML/JSON suite file "
+             "and report them together; no target needed",
+    )
+    group.add_argument(
+        "--watch",
+        type=float,
+        nargs="?",
+        const=1.0,
+        metavar="SECONDS",
+        help="With --check-only: re-check whenever logs/ inputs change, polling every SECONDS (default: 1)",
+    )
+    group.add_argument(
+        "--soak",
+        type=float,
+        nargs="?",
+        const=10.0,
+        metavar="SECONDS",
+        help="With --check-only and one config: check the rotating history segments of a soak test "
+             "as they close, polling every SECONDS (default: 10)",
+    )
+    group.add_argument(
+        "--soak-keep",
+        type=int,
+        default=24,
+        metavar="N",
+        help="With --soak: keep the segments of the last N passing rounds on disk (default: 24)",
+    )
+
+
+def add_input_arguments(parser: ArgumentParser) -> None:
+    """Options of how histories are found, read and narrowed down."""
+    group = parser.add_argument_group("reading histories")
+    group.add_argument(
+        "--keep-download",
+        action="store_true",
+        help="Keep the histories of a URL target in their temporary directory (printed) instead of "
+             "removing them after the check; artifacts then go there too unless --out-dir",
+    )
+    group.add_argument(
+        "--include",
+        action="append",
+        metavar="GLOB",
+        help="History file-name glob to load, searched recursively (repeatable); "
+             "replaces the default history-<N>.json[.gz|.zst]",
+    )
+    group.add_argument(
+        "--exclude",
+        action="append",
+        default=[],
+        metavar="GLOB",
+        help="Skip history files matching this glob (repeatable)",
+    )
+    group.add_argument(
+        "--strict",
+        action="store_true",
+        help="Fail on the first malformed history record instead of skipping it",
+    )
+    group.add_argument(
+        "--skip-invalid",
+        action="store_true",
+        help="Quarantine records with impossible intervals (return before call, zero "
+             "timestamps) instead of rejecting the history",
+    )
+    group.add_argument(
+        "--namespace-clients",
+        action="store_true",
+        help="Renumber client ids per history file (FILE_INDEX*1000 + id) so files from "
+             "different nodes that reuse ids are not merged into one client",
+    )
+    group.add_argument(
+        "--sequential-clients",
+        action="store_true",
+        help="Clients issue one request at a time: report overlapping operations of a client",
+    )
+    group.add_argument(
+        "--time-offset",
+        action="append",
+        default=[],
+        metavar="GLOB=DURATION",
+        help="Shift timestamps of history files matching GLOB by DURATION (e.g. "
+             "history-2.json=-1.5ms); repeatable",
+    )
+    group.add_argument(
+        "--align-marker",
+        metavar="KEY",
+        help="Align each history file's clock on its first operation on KEY",
+    )
+    group.add_argument(
+        "--time-unit",
+        choices=["auto", "ns", "us", "ms", "s"],
+        default="auto",
+        help="Unit of history timestamps (default: auto-detect per file)",
+    )
+    group.add_argument(
+        "--field-map",
+        metavar="PATH",
+        type=pathlib.Path,
+        help="YAML/TOML/JSON mapping of history record fields to a foreign schema's field names",
+    )
+    group.add_argument(
+        "--csv-columns",
+        metavar="MAP",
+        default="",
+        help="Map CSV history columns: FIELD=COLUMN,... (fields: " + ", ".join(CSV_FIELDS) + ")",
+    )
+    group.add_argument(
+        "--keys",
+        help="Comma-separated keys; check and plot only operations on these keys",
+    )
+    group.add_argument(
+        "--clients",
+        help="Comma-separated client ids; check and plot only these clients' operations "
+             "(with the other clients' writes as context)",
+    )
+    group.add_argument(
+        "--from",
+        dest="from_",
+        metavar="T",
+        help="Check only operations overlapping the window starting T after the "
+             "first call (e.g. 42m, 90s)",
+    )
+    group.add_argument(
+        "--to",
+        metavar="T",
+        help="Check only operations overlapping the window ending T after the first call",
+    )
+    group.add_argument(
+        "--limit",
+        type=int,
+        metavar="N",
+        help="Check only the first N operations by call time (after --from/--to)",
+    )
+    group.add_argument(
+        "--decided-log",
+        action="append",
+        default=[],
+        metavar="PATH",
+        help="Decided-log dump to cross-check against the history, besides "
+             "logs/decided-*.jsonl (repeatable)",
+    )
+    group.add_argument(
+        "--request-log",
+        action="append",
+        default=[],
+        metavar="PATH",
+        help="Server or proxy request log to join to the history by request_id, besides "
+             "logs/requests-*.jsonl (repeatable)",
+    )
+    group.add_argument(
+        "--state-snapshot",
+        action="append",
+        default=[],
+        metavar="PATH",
+        help="Replica state snapshot to diff against a replay of the decided log, "
+             "besides logs/state-*.json (repeatable)",
+    )
+
+
+def add_check_arguments(parser: ArgumentParser) -> None:
+    """Options of the consistency check and what it produces on failure."""
+    group = parser.add_argument_group("checking")
+    group.add_argument(
+        "--consistency",
+        choices=sorted(CONSISTENCY_CHECKERS) + ["auto"],
+        default="linearizable",
+        help="Consistency model to check the history against (default: linearizable); "
+             "auto checks linearizable, sequential, causal and session and reports the "
+             "strongest that holds",
+    )
+    group.add_argument(
+        "--model",
+        choices=sorted(MODELS),
+        default="kv",
+        help="Data model of the history: kv (one register per key, default) or "
+             "register (a single register; keys are ignored)",
+    )
+    group.add_argument(
+        "--bound",
+        help="Staleness bound for --consistency bounded-staleness (e.g. 200ms)",
+    )
+    group.add_argument(
+        "--clock-skew",
+        default="0",
+        help="Clock-skew tolerance (e.g. 5ms, 200us): widens every operation "
+             "interval by this much on both sides before checking (default: 0)",
+    )
+    group.add_argument(
+        "--snapshot-window",
+        default="1s",
+        metavar="D",
+        help="Check a node's reads this long after a snapshot_install / compaction event "
+             "against prior acknowledged writes (default: 1s)",
+    )
+    group.add_argument(
+        "--check-timeout",
+        type=float,
+        default=DEFAULT_CHECK_TIMEOUT_S,
+        help=f"Seconds the consistency check may run before the verdict is UNKNOWN "
+             f"(default: {DEFAULT_CHECK_TIMEOUT_S})",
+    )
+    group.add_argument(
+        "--parallelism",
+        type=int,
+        default=1,
+        metavar="N",
+        help="Check key partitions in N worker processes (linearizable mode; default: 1)",
+    )
+    group.add_argument(
+        "--partition",
+        choices=("key", "time"),
+        default="key",
+        help="key (default): check each key on its own; time: also split each key's history at "
+             "quiescent points and check the segments in order (linearizable / bounded-staleness)",
+    )
+    group.add_argument(
+        "--partition-timeout",
+        type=_seconds_or_auto,
+        metavar="S",
+        help="Per-key time budget in seconds, or auto for a share of --check-timeout by key size "
+             "(linearizable mode); keys over budget make the verdict UNKNOWN without stopping the others",
+    )
+    group.add_argument(
+        "--max-memory",
+        type=_size,
+        metavar="SIZE",
+        help="Resident memory limit for the check (e.g. 512M, 2G): reduce parallelism, "
+             "fall back to time windows or stop loading instead of running out",
+    )
+    group.add_argument(
+        "--resume",
+        action="store_true",
+        help="Skip key partitions an interrupted or timed-out linearizability check already proved",
+    )
+    group.add_argument(
+        "--window",
+        metavar="SIZE",
+        help="Also check overlapping time windows of SIZE (e.g. 30s) and report the "
+             "earliest window containing a violation",
+    )
+    group.add_argument(
+        "--window-stride",
+        metavar="S",
+        help="Offset between window starts for --window (default: half the window)",
+    )
+    group.add_argument(
+        "--witness",
+        action="store_true",
+        help="For a linearizable history, save a witness linearization order per key",
+    )
+    group.add_argument(
+        "--shrink",
+        action="store_true",
+        help="On failure, delta-debug the history down to a minimal failing counterexample",
+    )
+    group.add_argument(
+        "--emit-test",
+        action="store_true",
+        help="On failure, also write a unittest module embedding the counterexample that asserts it still fails",
+    )
+    group.add_argument(
+        "--min-ops",
+        type=int,
+        default=0,
+        help="Fail a config whose (filtered) history has fewer operations (default: 0)",
+    )
+    group.add_argument(
+        "--max-unknown",
+        type=int,
+        default=0,
+        help="Number of configs allowed to end UNKNOWN (check timed out) before failing (default: 0)",
+    )
+
+
+def add_output_arguments(parser: ArgumentParser) -> None:
+    """Options of the log, the report and where results go."""
+    group = parser.add_argument_group("output")
+    group.add_argument(
+        "--checker-log-level",
+        choices=LOG_LEVELS,
+        help="Level of the checker's log on stderr (default: info; error with -q, debug with -v)",
+    )
+    group.add_argument(
+        "--log-format",
+        choices=LOG_FORMATS,
+        default="text",
+        help="Log as marked text lines (default) or one JSON object per line",
+    )
+    verbosity = group.add_mutually_exclusive_group()
+    verbosity.add_argument(
+        "-q", "--quiet",
+        action="store_true",
+        help="Print only one summary line per config (the exit code tells the rest)",
+    )
+    verbosity.add_argument(
+        "-v", "--verbose",
+        action="store_true",
+        help="Also print every per-key verdict, a timing breakdown, and all invalid "
+             "or unchecked operations",
+    )
+    group.add_argument(
+        "--no-progress",
+        action="store_true",
+        help="Do not print a progress line during long consistency checks",
+    )
+    group.add_argument(
         "--no-plots",
         action="store_true",
         help="Suppress matplotlib output",
     )
-    args = parser.parse_args()
+    group.add_argument(
+        "--out-dir",
+        type=pathlib.Path,
+        help="Write plots and counterexamples to OUT_DIR/<config>/ instead of <config>/logs/ "
+             "(./<config>/ for '-' and URL targets, whose histories are not kept)",
+    )
+    group.add_argument(
+        "--run-id",
+        help="Suffix for generated artifact names ('auto' = current timestamp)",
+    )
+    group.add_argument(
+        "--json",
+        metavar="PATH",
+        help="Write per-config results (verdict, op counts, latency percentiles, metrics) as JSON "
+             "('-': to stdout, with the report on stderr)",
+    )
+    group.add_argument(
+        "--stats",
+        action="store_true",
+        help="Print per-key statistics: ops per key, read/write ratio, hottest keys, conflicts",
+    )
+    group.add_argument(
+        "--contention",
+        action="store_true",
+        help="Report write-write / read-write races per key and their distribution",
+    )
+    group.add_argument(
+        "--store",
+        metavar="DB",
+        type=pathlib.Path,
+        help="Append this run's per-config results to the SQLite database DB",
+    )
+    group.add_argument(
+        "--notify-url",
+        metavar="URL",
+        help="POST a notification to this webhook when a config is not consistent",
+    )
+    group.add_argument(
+        "--notify-format",
+        choices=NOTIFY_FORMATS,
+        default="slack",
+        help="Notification payload: slack ({\"text\": ...}, default) or json (adds a failures list)",
+    )
+    group.add_argument(
+        "--dashboard-url",
+        metavar="URL",
+        help="Base URL of a --serve dashboard on the --store database, linked from notifications",
+    )
+    group.add_argument(
+        "--github-annotations",
+        action="store_true",
+        help="Print GitHub Actions ::error annotations pointing at the history files of violations",
+    )
+    group.add_argument(
+        "--ci",
+        metavar="JUNIT_XML",
+        help="CI mode: write a JUnit XML report (one consistency and one thresholds test case per config)",
+    )
 
-    if args.check_only and args.run_only:
-        parser.error("--check-only and --run-only are mutually exclusive.")
 
-    do_run = not args.check_only
-    do_check = not args.run_only
+def add_timeline_arguments(parser: ArgumentParser) -> None:
+    """Options of the operation timeline and its exports."""
+    group = parser.add_argument_group("timelines and traces")
+    group.add_argument(
+        "--export",
+        action="append",
+        choices=["json", "png", "svg"],
+        default=[],
+        help="Also export the operation timeline as <config>-timeline.FORMAT: json (data, see "
+             "timeline_data), svg or png (per-client lanes, failing keys in red); repeatable",
+    )
+    group.add_argument(
+        "--otlp",
+        metavar="URL",
+        help="Send each history as OpenTelemetry traces (a span per operation) to this OTLP/HTTP "
+             "collector, e.g. http://localhost:4318",
+    )
+    group.add_argument(
+        "--timeline-failing",
+        action="store_true",
+        help="Export only the operations on failing keys to the timeline",
+    )
+    group.add_argument(
+        "--timeline-page",
+        metavar="D",
+        help="Split the exported timeline into one file per D of time (e.g. 10s)",
+    )
+    group.add_argument(
+        "--timeline-max-ops",
+        type=int,
+        metavar="N",
+        help="Downsample dense regions of each exported timeline (page) to about N ops, "
+             "keeping every op on a failing key or with an unknown outcome",
+    )
+    group.add_argument(
+        "--tui-timeline",
+        action="store_true",
+        help="Print a compact per-client timeline of the (filtered) history in the terminal, "
+             "marking the first non-linearizable operation",
+    )
+    group.add_argument(
+        "--tui",
+        action="store_true",
+        help="After checking, browse the results in the terminal: configs, their key partitions "
+             "and operations, with jumps to the first violation and timelines opened in the browser",
+    )
+    group.add_argument(
+        "--lanes",
+        choices=sorted(LANE_LAYOUTS),
+        default="client",
+        help="Group timeline lanes (--export svg/png, --tui-timeline) by client (default), "
+             "by the node that served each op, or by key",
+    )
+    group.add_argument(
+        "--open",
+        action="store_true",
+        help="Open the result in the system browser: the --serve dashboard, or after a check "
+             "the timeline/plot of the first failing config (else the first one)",
+    )
 
-    if args.target == "all":
-        configs = sorted(
-            d for d in SCRIPT_DIR.iterdir()
-            if d.is_dir() and (d / "docker-compose.yml").exists()
+
+def add_mode_arguments(parser: ArgumentParser) -> None:
+    """Options selecting a mode other than running or checking benchmarks, and their settings."""
+    group = parser.add_argument_group("other modes (no benchmark run)")
+    group.add_argument(
+        "--compare",
+        nargs=2,
+        metavar=("OLD_JSON", "NEW_JSON"),
+        help="Diff two --json result files (verdicts, op counts, throughput, latency) "
+             "and exit 1 on regressions",
+    )
+    group.add_argument(
+        "--regression-threshold",
+        type=float,
+        default=10.0,
+        metavar="PCT",
+        help="Relative throughput drop / latency increase counted as a regression (default: 10)",
+    )
+    group.add_argument(
+        "--report",
+        nargs="+",
+        metavar="JSON",
+        help="Side-by-side report of --json result files from different cluster configurations "
+             "(differing settings, verdicts, anomalies, latency); no target needed",
+    )
+    group.add_argument(
+        "--report-out",
+        type=pathlib.Path,
+        default=pathlib.Path("report.html"),
+        metavar="PATH",
+        help="Where --report writes its .html (default: report.html) or .json",
+    )
+    group.add_argument(
+        "--import-pcap",
+        nargs=2,
+        metavar=("PCAP", "OUT_DIR"),
+        help="Rebuild per-client histories from a client↔proxy packet capture into OUT_DIR",
+    )
+    group.add_argument(
+        "--proxy-port",
+        type=int,
+        default=DEFAULT_PROXY_PORT,
+        help=f"Port the captured clients connect to (default: {DEFAULT_PROXY_PORT})",
+    )
+    group.add_argument(
+        "--merge",
+        nargs=2,
+        metavar=("HISTORY_DIR", "OUT"),
+        help="Merge the history files of HISTORY_DIR into one file OUT in call order, streaming",
+    )
+    group.add_argument(
+        "--replay",
+        nargs=2,
+        metavar=("HISTORY_DIR", "OUT_DIR"),
+        help="Re-issue a recorded history against --proxy and save the fresh one to OUT_DIR",
+    )
+    group.add_argument(
+        "--replay-timing",
+        action="store_true",
+        help="With --replay: keep the original call offsets (pipelined) instead of "
+             "issuing each request after the previous reply",
+    )
+    group.add_argument(
+        "--proxy",
+        default=f"localhost:{DEFAULT_PROXY_PORT}",
+        metavar="HOST:PORT",
+        help=f"Proxy address for --replay (default: localhost:{DEFAULT_PROXY_PORT})",
+    )
+    group.add_argument(
+        "--check-cluster",
+        action="store_true",
+        help="Probe the running cluster of each target (or --node/--proxy) and report its health",
+    )
+    group.add_argument(
+        "--node",
+        action="append",
+        default=[],
+        metavar="HOST:PORT",
+        help="A node for --check-cluster to probe instead of a target's compose services (repeatable)",
+    )
+    group.add_argument(
+        "--history",
+        metavar="DB",
+        type=pathlib.Path,
+        help="List the latest runs stored in DB by --store (target: optional glob of config names)",
+    )
+    group.add_argument(
+        "--serve",
+        metavar="DB",
+        type=pathlib.Path,
+        help="Serve an HTML dashboard of the runs stored in DB by --store",
+    )
+    group.add_argument(
+        "--listen",
+        default="127.0.0.1:8000",
+        metavar="HOST:PORT",
+        help="Loopback address for --serve (default: 127.0.0.1:8000)",
+    )
+    group.add_argument(
+        "--any-port",
+        action="store_true",
+        help="If the --listen port is in use, serve on a free one instead (printed)",
+    )
+    group.add_argument(
+        "--fuzz",
+        type=int,
+        metavar="N",
+        help="Self-test the checkers on N generated histories with known verdicts",
+    )
+
+
+def build_parser() -> ArgumentParser:
+    parser = ArgumentParser(
+        description="OmniPaxos-KV benchmark runner and linearizability tester",
+        formatter_class=argparse.RawDescriptionHelpFormatter,
+        epilog=__doc__,
+    )
+    parser.add_argument(
+        "target",
+        nargs="?",
+        help="Benchmark folder name (e.g. adaptive_deadline), directory path, glob of directories, "
+             "'all', or (with --check-only) an s3://, gs:// or http(s):// history URL or '-' for stdin",
+    )
+    parser.add_argument(
+        "--config",
+        metavar="PATH",
+        help="Read option defaults from a YAML/TOML/JSON file "
+             f"(default: {'/'.join(DEFAULT_CONFIG_FILES)} in the current directory)",
+    )
+    add_run_arguments(parser)
+    add_input_arguments(parser)
+    add_check_arguments(parser)
+    add_output_arguments(parser)
+    add_timeline_arguments(parser)
+    add_mode_arguments(parser)
+    return parser
+
+
+def parse_command_line(parser: ArgumentParser) -> argparse.Namespace:
+    """
+    Parse the command line over the defaults of the config file (--config,
+    else the first of DEFAULT_CONFIG_FILES present) and set up logging.
+    """
+    pre, _ = parser.parse_known_args()
+    config_path = pre.config and pathlib.Path(pre.config)
+    if config_path is None:
+        config_path = next((p for p in map(pathlib.Path, DEFAULT_CONFIG_FILES) if p.is_file()), None)
+    if config_path is not None:
+        try:
+            defaults = load_config_file(config_path)
+        except (OSError, ValueError) as ex:
+            parser.error(f"config file {config_path}: {ex}")
+        unknown = sorted(set(defaults) - set(vars(pre)) | set(defaults) & {"config"})
+        if unknown:
+            parser.error(f"config file {config_path}: unknown option(s) {', '.join(unknown)}")
+        # argparse validates only what is on the command line, not defaults.
+        for action in parser._actions:
+            value = defaults.get(action.dest)
+            if action.choices and value is not None:
+                if any(v not in action.choices for v in (value if isinstance(value, list) else [value])):
+                    parser.error(f"config file {config_path}: {action.dest}: {value!r} is not one of "
+                                 f"{', '.join(map(str, action.choices))}")
+        parser.set_defaults(**defaults)
+    args = parser.parse_args()
+    configure_logging(args.checker_log_level or ("error" if args.quiet else "debug" if args.verbose else "info"),
+                      args.log_format)
+    return args
+
+
+def check_options(parser: ArgumentParser, args: argparse.Namespace) -> CheckOptions:
+    """The CheckOptions the command line asks for; exits through parser.error() if invalid."""
+    try:
+        select = SelectOptions(
+            keys=set(args.keys.split(",")) if args.keys else None,
+            clients={int(c) for c in args.clients.split(",")} if args.clients else None,
+            limit=args.limit,
         )
-    else:
-        target_path = SCRIPT_DIR / args.target
-        if not target_path.is_dir():
-            print(f"Error: no such benchmark directory: {target_path}", file=sys.stderr)
-            sys.exit(1)
-        configs = [target_path]
+    except ValueError:
+        parser.error("--clients expects comma-separated integer client ids.")
+    opts = CheckOptions(
+        consistency="linearizable" if args.consistency == "auto" else args.consistency,
+        auto_levels=args.consistency == "auto",
+        check_timeout=args.check_timeout,
+        resume=args.resume,
+        parallelism=max(1, args.parallelism),
+        partition_timeout=args.partition_timeout,
+        partition=args.partition,
+        shrink=args.shrink,
+        witness=args.witness,
+        model=args.model,
+        load=LoadOptions(
+            strict=args.strict,
+            include=args.include,
+            exclude=tuple(args.exclude),
+            sequential_clients=args.sequential_clients,
+            namespace_clients=args.namespace_clients,
+            align_marker=args.align_marker,
+            time_unit=args.time_unit,
+            skip_invalid=args.skip_invalid,
+            decided_logs=tuple(args.decided_log),
+            state_snapshots=tuple(args.state_snapshot),
+            request_logs=tuple(args.request_log),
+        ),
+        select=select,
+        report=ReportOptions(
+            out_dir=args.out_dir,
+            run_id=time.strftime("%Y%m%d-%H%M%S") if args.run_id == "auto" else args.run_id,
+            stats=args.stats,
+            contention=args.contention,
+            verbosity=-1 if args.quiet else 1 if args.verbose else 0,
+            progress=not args.no_progress,
+            github_annotations=args.github_annotations,
+            emit_test=args.emit_test,
+        ),
+        timeline=TimelineOptions(
+            export=tuple(args.export),
+            failing=args.timeline_failing,
+            max_ops=args.timeline_max_ops,
+            tui_timeline=args.tui_timeline,
+            tui=args.tui,
+            lanes=args.lanes,
+            otlp_url=args.otlp,
+        ),
+    )
+    try:
+        opts.load.time_offsets = tuple(
+            (glob, parse_duration_ns(d)) for glob, _, d in (t.rpartition("=") for t in args.time_offset)
+        )
+        if any(not glob for glob, _ in opts.load.time_offsets):
+            raise ValueError
+    except ValueError:
+        parser.error("--time-offset expects GLOB=DURATION (e.g. history-2.json=-1.5ms).")
+    if args.partition == "time" and args.consistency not in ("linearizable", "bounded-staleness", "auto"):
+        parser.error("--partition time applies to --consistency linearizable / bounded-staleness "
+                     "(it relies on real-time order).")
+    MEMORY.limit = args.max_memory
+    try:
+        opts.load.csv_columns = parse_csv_columns(args.csv_columns)
+    except ValueError as ex:
+        parser.error(f"--csv-columns: {ex}")
+    if args.field_map:
+        try:
+            opts.load.field_map = parse_field_map(load_config_file(args.field_map))
+        except (OSError, ValueError) as ex:
+            parser.error(f"--field-map {args.field_map}: {ex}")
+    try:
+        opts.clock_skew_ns = parse_duration_ns(args.clock_skew)
+    except ValueError:
+        parser.error(f"--clock-skew: cannot parse duration {args.clock_skew!r} (e.g. 5ms).")
+    try:
+        opts.snapshot_window_ns = parse_duration_ns(args.snapshot_window)
+    except ValueError:
+        parser.error(f"--snapshot-window: cannot parse duration {args.snapshot_window!r} (e.g. 500ms).")
+    for flag, text in (("--from", args.from_), ("--to", args.to)):
+        if text is not None:
+            try:
+                setattr(opts.select, f"{flag[2:]}_ns", parse_duration_ns(text))
+            except ValueError:
+                parser.error(f"{flag}: cannot parse duration {text!r} (e.g. 42m, 90s).")
+    for flag, text in (("--window", args.window), ("--window-stride", args.window_stride)):
+        if text is not None:
+            try:
+                setattr(opts, f"{flag[2:].replace('-', '_')}_ns", parse_duration_ns(text))
+            except ValueError:
+                parser.error(f"{flag}: cannot parse duration {text!r} (e.g. 30s).")
+    if args.timeline_page is not None:
+        try:
+            opts.timeline.page_ns = parse_duration_ns(args.timeline_page)
+        except ValueError:
+            parser.error(f"--timeline-page: cannot parse duration {args.timeline_page!r} (e.g. 10s).")
+        if opts.timeline.page_ns <= 0:
+            parser.error("--timeline-page must be positive.")
+    if args.timeline_max_ops is not None and args.timeline_max_ops < 1:
+        parser.error("--timeline-max-ops must be at least 1.")
+    if opts.window_ns is not None:
+        if opts.window_ns <= 0:
+            parser.error("--window must be positive.")
+        opts.window_stride_ns = opts.window_stride_ns or opts.window_ns // 2
+        if opts.window_stride_ns <= 0:
+            parser.error("--window-stride must be positive.")
+    elif opts.window_stride_ns is not None:
+        parser.error("--window-stride needs --window.")
+    if opts.select.from_ns is not None and opts.select.to_ns is not None and opts.select.to_ns < opts.select.from_ns:
+        parser.error("--to must not be before --from.")
+    if args.limit is not None and args.limit < 1:
+        parser.error("--limit must be at least 1.")
+    if args.consistency == "bounded-staleness":
+        if args.bound is None:
+            parser.error("--consistency bounded-staleness needs --bound (e.g. 200ms).")
+        try:
+            opts.bound_ns = parse_duration_ns(args.bound)
+        except ValueError:
+            parser.error(f"--bound: cannot parse duration {args.bound!r} (e.g. 200ms).")
+    elif args.bound is not None:
+        parser.error("--bound only applies to --consistency bounded-staleness.")
+    return opts
 
-    print(f"OmniPaxos-KV Benchmark & Linearizability Test")
-    print(f"  Configs : {', '.join(c.name for c in configs)}")
-    print(f"  Mode    : {'run+check' if do_run and do_check else 'run-only' if do_run else 'check-only'}")
-    print(f"  Timeout : {args.timeout}s")
+# ── Other modes ────────────────────────────────────────────────────────────────
 
+def compare_mode(parser: ArgumentParser, args: argparse.Namespace) -> int:
+    """Compare two --json results (--compare OLD NEW)."""
     results = []
-    for cfg in configs:
-        print(f"\n{'─' * 62}")
-        print(f"▶  {cfg.name}")
-        results.append(
-            run_single(
-                cfg,
-                do_run=do_run,
-                do_check=do_check,
-                timeout=args.timeout,
-                log_level=args.log_level,
-                no_plots=args.no_plots,
-            )
-        )
+    for path in args.compare:
+        try:
+            with open(path) as f:
+                results.append(json.load(f))
+        except (OSError, ValueError) as ex:
+            parser.error(f"--compare: cannot read {path}: {ex}")
+    print(f"Comparing {args.compare[0]} → {args.compare[1]}")
+    regressions = compare_results(results[0], results[1], args.regression_threshold)
+    print(f"\n{regressions} regression(s) (threshold {args.regression_threshold:g}%)")
+    return EXIT_VIOLATION if regressions else EXIT_OK
+
+
+def report_mode(parser: ArgumentParser, args: argparse.Namespace) -> int:
+    """Tabulate --json results side by side (--report)."""
+    if args.report_out.suffix not in (".html", ".json"):
+        parser.error("--report-out: expected a .html or .json path.")
+    sources = []
+    for path in map(pathlib.Path, args.report):
+        try:
+            with open(path) as f:
+                results = json.load(f)
+            if not isinstance(results, list):
+                raise ValueError("expected a JSON array of results (--json output)")
+        except (OSError, ValueError) as ex:
+            parser.error(f"--report: cannot read {path}: {ex}")
+        sources.append((path.stem, results))
+    report = build_report(sources)
+    if not report["columns"]:
+        log.error("--report: no results to compare")
+        return EXIT_INPUT
+    print_report(report)
+    if args.report_out.suffix == ".json":
+        args.report_out.write_text(json.dumps(report, indent=2, default=str))
+    else:
+        args.report_out.write_bytes(render_report_html(report))
+    print(f"\nReport saved → {args.report_out}")
+    return EXIT_OK
+
+
+def import_pcap_mode(parser: ArgumentParser, args: argparse.Namespace) -> int:
+    """Rebuild client histories from a packet capture (--import-pcap)."""
+    pcap, out_dir = map(pathlib.Path, args.import_pcap)
+    try:
+        histories, warnings = history_from_pcap(pcap, args.proxy_port)
+    except (OSError, ValueError) as ex:
+        parser.error(f"--import-pcap: cannot read {pcap}: {ex}")
+    for warning in warnings:
+        log.warning(f"{warning}")
+    if not histories:
+        log.error(f"No client requests to port {args.proxy_port} in {pcap}")
+        return EXIT_INPUT
+    out_dir.mkdir(parents=True, exist_ok=True)
+    for client, entries in histories.items():
+        with open(out_dir / f"history-{client}.json", "w") as f:
+            json.dump(entries, f, indent=2)
+    print(f"Rebuilt {sum(map(len, histories.values()))} ops from {len(histories)} client "
+          f"connection(s) → {out_dir}/history-*.json")
+    return 0
+
+
+def merge_mode(parser: ArgumentParser, args: argparse.Namespace) -> int:
+    """Merge a directory's histories into one file in call order (--merge)."""
+    src, out = map(pathlib.Path, args.merge)
+    logs = src / "logs" if (src / "logs").is_dir() else src
+    paths = history_files(logs, args.include, tuple(args.exclude))
+    if not paths:
+        parser.error(f"--merge: no history files in {logs}")
+    try:
+        csv_columns = parse_csv_columns(args.csv_columns)
+    except ValueError as ex:
+        parser.error(f"--csv-columns: {ex}")
+    field_map = None
+    if args.field_map:
+        try:
+            field_map = parse_field_map(load_config_file(args.field_map))
+        except (OSError, ValueError) as ex:
+            parser.error(f"--field-map {args.field_map}: {ex}")
+    try:
+        n = merge_histories(paths, out, csv_columns, field_map, strict=args.strict)
+    except HistoryError as ex:
+        log.error(f"Invalid history: {ex}")
+        return EXIT_INPUT
+    except (OSError, ValueError) as ex:
+        log.error(f"--merge: {ex}")
+        return EXIT_INPUT
+    print(f"Merged {n:,} ops from {len(paths)} file(s) in call order → {out}")
+    return 0
+
+
+def fuzz_mode(parser: ArgumentParser, args: argparse.Namespace) -> int:
+    """Cross-check the checkers on random histories (--fuzz)."""
+    seed = args.seed if args.seed is not None else int.from_bytes(os.urandom(4), "little")
+    print(f"Fuzzing the checkers: {args.fuzz} histories, seed {seed}")
+    failures = run_fuzz(args.fuzz, seed)
+    print(f"{'✗' if failures else '✓'} {failures} disagreement(s)")
+    return EXIT_VIOLATION if failures else EXIT_OK
+
+
+def replay_mode(parser: ArgumentParser, args: argparse.Namespace) -> int:
+    """Replay a history's requests against a live cluster (--replay)."""
+    src, out_dir = map(pathlib.Path, args.replay)
+    host, _, port = args.proxy.rpartition(":")
+    if not host or not port.isdigit():
+        parser.error(f"--proxy: expected HOST:PORT, got {args.proxy!r}")
+    try:
+        ops = load_history(src if not (src / "logs").is_dir() else src / "logs", strict=args.strict)
+    except HistoryError as ex:
+        log.error(f"Invalid history: {ex}")
+        return EXIT_INPUT
+    if not ops:
+        parser.error(f"--replay: no history files in {src}")
+    print(f"Replaying {len(ops)} ops from {len({op.client_id for op in ops})} client(s) "
+          f"against {args.proxy}{' with original timing' if args.replay_timing else ''}")
+    try:
+        histories = replay_history(ops, (host, int(port)), timed=args.replay_timing)
+    except OSError as ex:
+        log.error(f"Cannot reach {args.proxy}: {ex}")
+        return EXIT_INPUT
+    out_dir.mkdir(parents=True, exist_ok=True)
+    for client, entries in histories.items():
+        with open(out_dir / f"history-{client}.json", "w") as f:
+            json.dump(entries, f, indent=2)
+    unanswered = sum(e["output"]["status"] == STATUS_UNKNOWN for es in histories.values() for e in es)
+    print(f"Fresh history saved → {out_dir}/history-*.json"
+          + (f"  ({unanswered} request(s) unanswered)" if unanswered else ""))
+    return 0
+
+
+def check_cluster_mode(parser: ArgumentParser, args: argparse.Namespace) -> int:
+    """Probe a cluster's health (--check-cluster)."""
+    json_out = sys.stdout
+    if args.json == "-":
+        sys.stdout = sys.stderr
+    if args.node:
+        members = []
+        for role, address in [("node", a) for a in args.node] + [("proxy", args.proxy)]:
+            host, _, port = address.rpartition(":")
+            if not host or not port.isdigit():
+                parser.error(f"--{role}: expected HOST:PORT, got {address!r}")
+            members.append(ClusterMember(address, role, int(port), host))
+        reports = [cluster_health("--node", members, leader=None, logs_read=False)]
+    else:
+        if args.target is None:
+            parser.error("--check-cluster probes the compose cluster of a target, or --node addresses.")
+        compose_files = [d / "docker-compose.yml" for d in resolve_targets(args.target)]
+        compose_files = [f if f.exists() else f.with_suffix(".yaml") for f in compose_files]
+        if not any(f.exists() for f in compose_files):
+            log.error(f"No docker compose cluster matches {args.target!r}")
+            return EXIT_INPUT
+        reports = []
+        for compose_file in filter(pathlib.Path.exists, compose_files):
+            members = compose_members(compose_file)
+            reports.append(cluster_health(compose_file.parent.name, members,
+                                          compose_leader(compose_file, members), logs_read=True))
+            if not args.json:
+                logs_dir = compose_file.parent / "logs"
+                logs_dir.mkdir(exist_ok=True)
+                with open(logs_dir / "cluster-health.json", "w") as f:
+                    json.dump(reports[-1], f, indent=1)
+    for report in reports:
+        print_cluster_health(report)
+    if args.json == "-":
+        json.dump(reports, json_out, indent=2)
+        json_out.write("\n")
+    elif args.json:
+        with open(args.json, "w") as f:
+            json.dump(reports, f, indent=2)
+    return EXIT_OK if all(r["healthy"] for r in reports) else EXIT_UNHEALTHY
+
+
+def history_mode(parser: ArgumentParser, args: argparse.Namespace) -> int:
+    """List the runs stored in a database (--history)."""
+    if not args.history.is_file():
+        parser.error(f"--history: no database at {args.history}")
+    try:
+        found = print_store_history(args.history, args.target)
+    except sqlite3.DatabaseError as ex:
+        parser.error(f"--history: cannot read {args.history}: {ex}")
+    if not found:
+        print(f"No runs stored in {args.history}")
+    return 0
+
+
+def serve_mode(parser: ArgumentParser, args: argparse.Namespace) -> int:
+    """Serve the dashboard of a database (--serve)."""
+    if not args.serve.is_file():
+        parser.error(f"--serve: no database at {args.serve}")
+    host, _, port = args.listen.rpartition(":")
+    if not host or not port.isdigit():
+        parser.error(f"--listen: expected HOST:PORT, got {args.listen!r}")
+    try:
+        serve_dashboard(args.serve, host.strip("[]"), int(port), open_browser=args.open,
+                        any_port=args.any_port, recheck=recheck_result)
+    except ValueError as ex:
+        parser.error(f"--listen: {ex}")
+    except OSError as ex:
+        hint = " (add --any-port to use a free one)" if ex.errno == errno.EADDRINUSE else ""
+        parser.error(f"--listen: cannot bind {args.listen}: {ex}{hint}")
+    return 0
+
+# ── Entry point ────────────────────────────────────────────────────────────────
+
+def resolve_configs(
+    parser: ArgumentParser, args: argparse.Namespace, do_run: bool, downloads: contextlib.ExitStack
+) -> tuple[list[pathlib.Path], dict[pathlib.Path, Scenario]]:
+    """
+    The config directories to run or check: the target's (STDIN for '-'),
+    downloaded, or the prepared scenario folders of --suite (also returned,
+    by folder). Downloads are removed when `downloads` closes, unless
+    --keep-download.
+    """
+    scenarios: dict[pathlib.Path, Scenario] = {}
+    if args.suite is not None:
+        root = SCRIPT_DIR / "suite-runs" / args.suite.stem
+        try:
+            suite = load_suite(args.suite)
+            # Prepare every scenario before running any, so a bad override stops nothing midway.
+            scenarios = {prepare_scenario(sc, root) if do_run else root / sc.name: sc for sc in suite}
+        except (OSError, ValueError) as ex:
+            log.error(f"--suite {args.suite}: {ex}")
+            sys.exit(EXIT_INPUT)
+        configs = [cfg for cfg in scenarios if cfg.is_dir()]
+        if len(configs) < len(scenarios):
+            log.error(f"No run of {len(scenarios) - len(configs)} scenario(s) in {root}; "
+                      f"run the suite without --check-only first")
+            sys.exit(EXIT_INPUT)
+    elif args.target == "-":
+        if do_run:
+            parser.error("'-' reads a history to check from stdin; add --check-only.")
+        if sys.stdin.isatty():
+            parser.error("'-' reads a history from stdin, but stdin is a terminal; pipe one in.")
+        if args.watch or args.soak is not None:
+            parser.error("'-' reads stdin once; --watch and --soak re-read their target.")
+        configs = [STDIN]
+    elif is_remote_target(args.target):
+        if do_run:
+            parser.error("a URL target holds histories to check; add --check-only.")
+        if args.keep_download:
+            root = pathlib.Path(tempfile.mkdtemp(prefix="histories-"))
+        else:
+            root = pathlib.Path(downloads.enter_context(tempfile.TemporaryDirectory(prefix="histories-")))
+        try:
+            configs = [fetch_remote_target(args.target, root)]
+        except HistoryError as ex:
+            log.error(str(ex))
+            sys.exit(EXIT_INPUT)
+    else:
+        if args.keep_download:
+            parser.error("--keep-download keeps the histories of a URL target; the target is not one.")
+        configs = resolve_targets(args.target)
+    if not configs:
+        log.error(f"No benchmark directory matches {args.target!r}")
+        sys.exit(EXIT_INPUT)
+    return configs, scenarios
+
+
+def report_results(args: argparse.Namespace, opts: CheckOptions, results: list[dict],
+                   scenarios: dict[pathlib.Path, Scenario], browse: list, started_at: float,
+                   do_check: bool, json_out: TextIO) -> int:
+    """
+    Judge the results against the thresholds and write them out: --json,
+    --store, --notify-url, annotations, --ci and the cross-config summary.
+    Returns the exit code.
+    """
+    for r in results:
+        if not r.get("skipped") and do_check:
+            sc = next((sc for sc in scenarios.values() if sc.name == r["config"]), None)
+            r["threshold_failures"] = threshold_failures(r, max(args.min_ops, sc.min_ops if sc else 0))
+            if sc and sc.availability:
+                r["threshold_failures"] += availability_failures(r.get("availability"), sc.availability)
+            if not args.quiet:
+                for failure in r["threshold_failures"]:
+                    print(f"  ✗ {r['config']}: {failure}")
+
+    if args.json == "-":
+        json.dump(results, json_out, indent=2)
+        json_out.write("\n")
+    elif args.json:
+        with open(args.json, "w") as f:
+            json.dump(results, f, indent=2)
+        if not args.quiet:
+            print(f"\nResults JSON saved → {args.json}")
+
+    stored = None
+    if args.store:
+        try:
+            run, stored = store_results(args.store, results, started_at, opts.report.run_id, opts.consistency, do_check)
+        except sqlite3.DatabaseError as ex:
+            log.error(f"Cannot store results in {args.store}: {ex}")
+        else:
+            if not args.quiet:
+                print(f"Results stored → {args.store} (run #{run})")
+
+    if args.notify_url and do_check:
+        notify_failures(args.notify_url, args.notify_format, results, args.dashboard_url, stored,
+                        quiet=args.quiet)
+
+    if args.github_annotations:
+        print_github_annotations(results, args.max_unknown)
+
+    if args.ci:
+        write_junit(results, pathlib.Path(args.ci), args.max_unknown)
+        if not args.quiet:
+            print(f"JUnit report saved → {args.ci}")
 
     # ── Cross-config summary ────────────────────────────────────────────────
     real = [r for r in results if not r.get("skipped")]
-    if len(real) > 1:
+    if args.quiet:
+        for r in real:
+            print(summary_row(r))
+    elif len(real) > 1:
         print(f"\n{'═' * 62}")
         print(f"GLOBAL SUMMARY  ({len(real)} benchmarks)")
         print(f"{'═' * 62}")
-        passed = sum(1 for r in real if r.get("lin_ok", True))
+        passed = sum(1 for r in real if r.get("lin_ok", True) is True)
         for r in real:
-            if r.get("skipped"):
-                continue
-            lin = "✓ PASS" if r.get("lin_ok", True) else f"✗ FAIL ({r['violations']})"
-            tp_str = ""
-            if r.get("history_rps") is not None:
-                tp_str = f"  tp≈{r['history_rps']:.0f}rps"
-            print(f"  {r['config']:<30s}  {lin}  {r['ops']} ops{tp_str}")
-        print(f"\nLinearizability: {passed}/{len(real)} passed")
-        if passed < len(real):
-            sys.exit(1)
+            print(summary_row(r))
+        print(f"\n{CONSISTENCY_CHECKERS[opts.consistency][0]}: {passed}/{len(real)} passed")
+    if args.tui:
+        browse_results(browse, opts.timeline.lanes, opts.timeline.max_ops)
+
+    if any(r.get("lin_ok", True) is False or r.get("threshold_failures") for r in real):
+        return EXIT_VIOLATION
+
+    # A timed-out check is not a consistency bug: exit distinctly so CI can
+    # retry with a larger --check-timeout.
+    if sum(1 for r in real if r.get("lin_ok", True) is None) > args.max_unknown:
+        return EXIT_UNKNOWN
+    return EXIT_OK
+
+
+def main() -> None:
+    parser = build_parser()
+    args = parse_command_line(parser)
+
+    if args.compare:
+        sys.exit(compare_mode(parser, args))
+    if args.report:
+        sys.exit(report_mode(parser, args))
+    if args.import_pcap:
+        sys.exit(import_pcap_mode(parser, args))
+    if args.merge:
+        sys.exit(merge_mode(parser, args))
+    if args.fuzz is not None:
+        sys.exit(fuzz_mode(parser, args))
+    if args.replay:
+        sys.exit(replay_mode(parser, args))
+    if args.check_cluster:
+        sys.exit(check_cluster_mode(parser, args))
+    if args.history:
+        sys.exit(history_mode(parser, args))
+    if args.serve:
+        sys.exit(serve_mode(parser, args))
+
+    if args.target is None and args.suite is None:
+        parser.error("the target argument is required (or use --compare OLD NEW / "
+                     "--import-pcap / --merge / --replay / --fuzz / --history DB / --serve DB / --suite FILE).")
+    if args.target is not None and args.suite is not None:
+        parser.error("--suite runs the folders its scenarios name; drop the target.")
+
+    if args.check_only and args.run_only:
+        parser.error("--check-only and --run-only are mutually exclusive.")
+
+    do_run = not args.check_only
+
+    opts = check_options(parser, args)
+    do_check = not args.run_only
+    faults = None
+    if args.nemesis:
+        if not do_run:
+            parser.error("--nemesis needs a docker compose run (drop --check-only).")
+        try:
+            faults = parse_nemesis(args.nemesis)
+        except ValueError as ex:
+            parser.error(f"--nemesis: {ex}")
+
+    if args.watch and do_run:
+        parser.error("--watch only re-checks existing logs; use it with --check-only.")
+    if args.preflight is not None and not do_run:
+        parser.error("--preflight checks a run's cluster as it starts (drop --check-only), "
+                     "or probe a running one with --check-cluster.")
+    if args.soak is not None and (do_run or args.watch):
+        parser.error("--soak monitors the segments of a run in progress; use it with --check-only, "
+                     "not --watch.")
+    if args.soak_keep < 0:
+        parser.error("--soak-keep must not be negative.")
+    if args.tui and (args.watch or not do_check):
+        parser.error("--tui browses the results of one check; it cannot be used with --watch or --run-only.")
+
+    # --json -: the results are all that goes to stdout; the report moves to stderr.
+    json_out = sys.stdout
+    if args.json == "-":
+        sys.stdout = sys.stderr
+
+    # Downloaded histories are removed however the check ends (see resolve_configs).
+    with contextlib.ExitStack() as downloads:
+        configs, scenarios = resolve_configs(parser, args, do_run, downloads)
+        removed = args.target is not None and is_remote_target(args.target) and not args.keep_download
+        if opts.report.out_dir is None and (configs == [STDIN] or removed):
+            # No folder that outlives the check to write artifacts next to: ./<config>/ instead.
+            opts.report.out_dir = pathlib.Path(".")
+        # Runs always get a seed, so any run's workload can be regenerated.
+        seed = None
+        if do_run:
+            seed = args.seed if args.seed is not None else int.from_bytes(os.urandom(4), "little")
+
+        if not args.quiet:
+            print(f"OmniPaxos-KV Benchmark & Linearizability Test")
+            print(f"  {'Suite' if scenarios else 'Configs'} : {', '.join(map(target_name, configs))}")
+            print(f"  Mode    : {'run+check' if do_run and do_check else 'run-only' if do_run else 'check-only'}")
+            print(f"  Timeout : {args.timeout}s")
+            if seed is not None:
+                print(f"  Seed    : {seed}")
+            check = "auto (" + ", ".join(CONSISTENCY_LEVELS) + ")" if opts.auto_levels else opts.consistency
+            print(f"  Check   : {check}  (model: {MODELS[args.model][0]})")
+        # -q: swallow the per-config report; summary_row() stands in for it.
+        muted = (lambda: contextlib.redirect_stdout(io.StringIO())) if args.quiet else contextlib.nullcontext
+
+        started_at = time.time()
+        opened = False
+
+        def check_all() -> list[dict]:
+            nonlocal opened
+            results = []
+            for cfg in configs:
+                if not args.quiet:
+                    print(f"\n{'─' * 62}")
+                    print(f"▶  {target_name(cfg)}")
+                sc = scenarios.get(cfg)
+                if sc is not None and not args.quiet:
+                    print(f"   {sc.benchmark.name}, expecting {sc.expect}"
+                          + (f", nemesis {len(sc.faults)} fault(s)" if sc.faults else ""))
+                config_log = LOG_CONFIG.set(target_name(cfg))
+                try:
+                    with muted():
+                        result = run_single(
+                            cfg,
+                            do_run=do_run,
+                            do_check=do_check,
+                            timeout=sc.timeout if sc and sc.timeout is not None else args.timeout,
+                            log_level=args.rust_log,
+                            no_plots=args.no_plots,
+                            opts=sc.options(opts) if sc else opts,
+                            faults=sc.faults if sc and sc.faults is not None else faults,
+                            seed=sc.seed if sc and sc.seed is not None and do_run else seed,
+                            preflight=args.preflight,
+                        )
+                    results.append(result)
+                    if args.quiet and args.watch and not result.get("skipped"):
+                        print(summary_row(result))
+                except HistoryError as ex:
+                    log.error(f"Invalid history: {ex}")
+                    if not args.watch:
+                        sys.exit(EXIT_INPUT)
+                except MemoryBudget as ex:
+                    log.error(str(ex))
+                    if not args.watch:
+                        sys.exit(EXIT_UNKNOWN)
+                except ClusterUnhealthy as ex:
+                    log.error(f"Cluster unhealthy, run aborted: {ex}")
+                    sys.exit(EXIT_UNHEALTHY)
+                finally:
+                    LOG_CONFIG.reset(config_log)
+            if args.open and do_check and not opened:
+                # Once: --watch re-renders the same files, a browser reload shows them.
+                opened = True
+                open_visualization(results)
+            return results
+
+        if args.soak is not None:
+            if len(configs) != 1:
+                parser.error("--soak monitors one config; name it as the target.")
+            notify = None
+            if args.notify_url:
+                notify = lambda r: notify_failures(args.notify_url, args.notify_format, [r], quiet=args.quiet)
+            sys.exit(soak(configs[0], opts, args.soak, args.soak_keep, notify))
+
+        if args.watch:
+            if args.notify_url:
+                watch(configs, args.watch,
+                      lambda: notify_failures(args.notify_url, args.notify_format, check_all(), args.dashboard_url,
+                                              quiet=args.quiet))
+            else:
+                watch(configs, args.watch, check_all)
+            return
+
+        results = check_all()
+        browse = [r.pop("browse") for r in results if "browse" in r]
+
+        sys.exit(report_results(args, opts, results, scenarios, browse, started_at, do_check, json_out))
 
 
 if __name__ == "__main__":
-    main()
+    try:
+        main()
+    except Exception:
+        log.critical("Internal error: unexpected exception", exc_info=True)
+        sys.exit(EXIT_INTERNAL)
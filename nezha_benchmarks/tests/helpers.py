@@ -0,0 +1,16 @@
+"""What the tests share: the checker on sys.path, and operations to build histories from."""
+import pathlib
+import sys
+from typing import Optional
+
+sys.path.insert(0, str(pathlib.Path(__file__).resolve().parent.parent))
+from verifier import common  # noqa: E402
+
+
+def op(client: int, op_type: str, call: int, value: Optional[str] = None, key: str = "x",
+       ret: Optional[int] = None, status: str = common.STATUS_OK) -> common.Operation:
+    """Put(key, value) or Get(key) → value by `client`, returning at `ret` (by default 5ns after `call`)."""
+    return common.Operation(client_id=client, op_type=op_type, key=key,
+                            write_val=value if op_type == "Put" else None, call_ns=call,
+                            return_ns=call + 5 if ret is None else ret,
+                            result_val=value if op_type == "Get" else None, status=status)
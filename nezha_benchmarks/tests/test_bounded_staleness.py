@@ -0,0 +1,30 @@
+"""check_bounded_staleness: reads may lag by up to the bound."""
+import unittest
+
+from helpers import op
+from verifier import checkers
+
+
+# 'a' is current until the Put of 'b' returns at 30; the Get starts at 50.
+HISTORY = [op(1, "Put", 0, "a", ret=10), op(1, "Put", 20, "b", ret=30), op(2, "Get", 50, "a", ret=60)]
+
+
+class TestBoundedStaleness(unittest.TestCase):
+    def test_read_within_the_bound(self):
+        self.assertEqual(checkers.check_bounded_staleness(HISTORY, bound_ns=40), (True, []))
+
+    def test_read_beyond_the_bound(self):
+        self.assertFalse(checkers.check_bounded_staleness(HISTORY, bound_ns=10)[0])
+
+    def test_zero_bound_is_linearizability(self):
+        self.assertFalse(checkers.check_bounded_staleness(HISTORY)[0])
+
+    def test_flip_flop_after_both_writes_returned(self):
+        # Both Puts returned before the bound reaches back: one of them won.
+        ops = [op(1, "Put", 0, "1", ret=50), op(2, "Put", 0, "2", ret=50),
+               op(3, "Get", 100, "1", ret=110), op(3, "Get", 120, "2", ret=130), op(3, "Get", 140, "1", ret=150)]
+        self.assertFalse(checkers.check_bounded_staleness(ops, bound_ns=40)[0])
+
+
+if __name__ == "__main__":
+    unittest.main()
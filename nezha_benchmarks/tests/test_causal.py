@@ -0,0 +1,44 @@
+"""check_causal: program order plus reads-from, tracked with vector clocks."""
+import unittest
+
+from helpers import op
+from verifier import checkers, plots
+
+
+class TestCausal(unittest.TestCase):
+    def test_causal_history_passes(self):
+        # Client 2 sees 'b' late, but never goes back to 'a' after it.
+        ops = [op(1, "Put", 0, "a"), op(1, "Put", 10, "b"),
+               op(2, "Get", 20, "a"), op(2, "Get", 30, "b"), op(3, "Get", 5, None)]
+        self.assertEqual(checkers.check_causal(ops), (True, []))
+
+    def test_read_ignoring_a_causally_later_write(self):
+        ops = [op(1, "Put", 0, "a"), op(1, "Put", 10, "b"), op(2, "Get", 20, "b"), op(2, "Get", 30, "a")]
+        chains = []
+        ok, violations = checkers.check_causal(ops, chains=chains)
+        self.assertFalse(ok)
+        self.assertIn("ignores causally preceding Put('x', 'b')", violations[0])
+        self.assertEqual(chains, [ops])
+
+    def test_cycle(self):
+        ops = [op(1, "Get", 0, "b"), op(1, "Put", 10, "a"), op(2, "Get", 0, "a"), op(2, "Put", 10, "b")]
+        chains = []
+        ok, violations = checkers.check_causal(ops, chains=chains)
+        self.assertFalse(ok)
+        self.assertTrue(violations[0].startswith("Causal cycle:"))
+        self.assertEqual(len(chains[0]), 5)
+        self.assertIs(chains[0][0], chains[0][-1])
+        self.assertEqual({id(o) for o in chains[0]}, {id(o) for o in ops})
+
+    def test_cycle_highlighted_on_the_timeline(self):
+        ops = [op(1, "Get", 0, "b"), op(1, "Put", 10, "a"), op(2, "Get", 0, "a"), op(2, "Put", 10, "b")]
+        chains = []
+        ok, violations = checkers.check_causal(ops, chains=chains)
+        data = plots.timeline_data("cycle", ops, {}, [], violations, ok, "causal", chains)
+        self.assertTrue(all(o["chain"] == 0 for o in data["operations"]))
+        svg = plots.render_timeline_svg(data)
+        self.assertEqual(svg.count('marker-end="url(#chain-arrow)"'), 4)
+
+
+if __name__ == "__main__":
+    unittest.main()
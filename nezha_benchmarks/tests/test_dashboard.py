@@ -0,0 +1,63 @@
+"""--serve: loopback only, and every route needs the token."""
+import contextlib
+import http.client
+import pathlib
+import sqlite3
+import tempfile
+import threading
+import unittest
+
+import helpers  # noqa: F401  (puts the checker on sys.path)
+import benchmark_and_test as bt
+from verifier import dashboard
+
+
+class TestDashboardAuth(unittest.TestCase):
+    def setUp(self):
+        tmp = tempfile.TemporaryDirectory()
+        self.addCleanup(tmp.cleanup)
+        db = pathlib.Path(tmp.name) / "runs.db"
+        with contextlib.closing(sqlite3.connect(db)) as conn:
+            conn.executescript(dashboard.STORE_SCHEMA)
+        self.server = dashboard.make_dashboard_server(db, "127.0.0.1", 0, token="secret",
+                                               recheck=bt.recheck_result)
+        threading.Thread(target=self.server.serve_forever, daemon=True).start()
+        self.addCleanup(self.server.server_close)
+        self.addCleanup(self.server.shutdown)
+
+    def request(self, method, path, headers=None):
+        conn = http.client.HTTPConnection("127.0.0.1", self.server.server_address[1])
+        self.addCleanup(conn.close)
+        conn.request(method, path, headers=headers or {})
+        response = conn.getresponse()
+        response.read()
+        return response
+
+    def test_non_loopback_address_refused(self):
+        with self.assertRaises(ValueError):
+            dashboard.make_dashboard_server(pathlib.Path("unused.db"), "0.0.0.0", 0)
+
+    def test_token_required(self):
+        self.assertEqual(self.request("GET", "/").status, 401)
+        self.assertEqual(self.request("POST", "/results/1/recheck").status, 401)
+        self.assertEqual(self.request("GET", "/", {"Authorization": "Bearer wrong"}).status, 401)
+
+    def test_bearer_token(self):
+        self.assertEqual(self.request("GET", "/", {"Authorization": "Bearer secret"}).status, 200)
+        # Authorized, but there is no such result.
+        self.assertEqual(self.request("POST", "/results/1/recheck", {"Authorization": "Bearer secret"}).status, 404)
+
+    def test_query_token_becomes_a_cookie(self):
+        response = self.request("GET", "/result?id=1&token=secret")
+        self.assertEqual(response.status, 303)
+        self.assertEqual(response.getheader("Location"), "/result?id=1")
+        cookie = response.getheader("Set-Cookie").split(";")[0]
+        self.assertEqual(self.request("GET", "/", {"Cookie": cookie}).status, 200)
+
+    def test_foreign_host_refused(self):
+        headers = {"Host": "attacker.example", "Authorization": "Bearer secret"}
+        self.assertEqual(self.request("GET", "/", headers).status, 403)
+
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,48 @@
+"""check_decided_log: the history against the replicas' decided logs."""
+import unittest
+
+from helpers import op
+from verifier import common, crosscheck
+
+
+def put(value, call, ret, status=common.STATUS_OK):
+    return op(1, "Put", call, value, ret=ret, status=status)
+
+
+def log(*values):
+    return {"decided-1.jsonl": [{"idx": i, "op": "Put", "key": "x", "value": v, "client_id": 1, "command_id": i}
+                                for i, v in enumerate(values, 1)]}
+
+
+class TestDecidedLog(unittest.TestCase):
+    def test_acknowledged_puts_decided_in_order(self):
+        ops = [put("1", 0, 10), put("2", 20, 30)]
+        self.assertEqual(crosscheck.check_decided_log(ops, log("1", "2")), [])
+
+    def test_failed_put_decided(self):
+        problems = crosscheck.check_decided_log([put("1", 0, 10, status=common.STATUS_FAIL)], log("1"))
+        self.assertEqual(len(problems), 1)
+        self.assertIn("a failed write was applied", problems[0])
+
+    def test_failed_put_decided_twice(self):
+        # Both problems are reported: applied though failed, and applied twice.
+        problems = crosscheck.check_decided_log([put("1", 0, 10, status=common.STATUS_FAIL)], log("1", "1"))
+        self.assertTrue(any("a failed write was applied" in p for p in problems), problems)
+        self.assertTrue(any("applied more than once" in p for p in problems), problems)
+
+    def test_ambiguous_put_may_be_decided(self):
+        self.assertEqual(crosscheck.check_decided_log([put("1", 0, 10, status=common.STATUS_INFO)], log("1")), [])
+
+    def test_acknowledged_put_lost(self):
+        problems = crosscheck.check_decided_log([put("1", 0, 10), put("2", 20, 30)], log("2"))
+        self.assertEqual(len(problems), 1)
+        self.assertIn("an acknowledged write was lost", problems[0])
+
+    def test_decided_out_of_real_time_order(self):
+        problems = crosscheck.check_decided_log([put("1", 0, 10), put("2", 20, 30)], log("2", "1"))
+        self.assertEqual(len(problems), 1)
+        self.assertIn("decided after it", problems[0])
+
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,55 @@
+"""
+--partition time must reach the same verdict as checking each key whole:
+both decide every key by the exact search, the epochs one segment at a time.
+"""
+import random
+import unittest
+
+from helpers import op
+from verifier import checkers, common, linearizability
+
+
+def verdicts(ops):
+    return linearizability.check_linearizability(ops)[0], linearizability.check_linearizability(ops, epochs=True)[0]
+
+
+class TestEpochsAgree(unittest.TestCase):
+    def test_unreachable_end_value_is_not_carried(self):
+        # Either Put of the second epoch may be the last one invoked, but the
+        # read after both pins 'c': the third epoch cannot start from 'b'.
+        ops = [op(1, "Put", 0, "a", ret=10),
+               op(1, "Put", 20, "b", ret=30), op(2, "Put", 20, "c", ret=30), op(4, "Get", 25, "b", ret=45),
+               op(3, "Get", 40, "c", ret=50),
+               op(3, "Get", 100, "b", ret=110)]
+        self.assertEqual(len(linearizability.quiescent_segments(ops)), 3)
+        self.assertEqual(verdicts(ops), (False, False))
+
+    def test_value_carried_across_epochs(self):
+        ops = [op(1, "Put", 0, "a", ret=10), op(2, "Get", 20, "a", ret=30),
+               op(1, "Put", 40, "b", ret=60), op(2, "Put", 40, "c", ret=60), op(3, "Get", 70, "b", ret=80),
+               op(3, "Get", 100, "b", ret=110)]
+        self.assertEqual(verdicts(ops), (True, True))
+
+    def test_flip_flop_within_an_epoch(self):
+        ops = [op(1, "Put", 0, "1", ret=50), op(2, "Put", 0, "2", ret=50),
+               op(3, "Get", 100, "1", ret=110), op(3, "Get", 120, "2", ret=130), op(3, "Get", 140, "1", ret=150)]
+        self.assertEqual(verdicts(ops), (False, False))
+
+    def test_ambiguous_put_may_land_in_a_later_epoch(self):
+        ops = [op(1, "Put", 0, "a", ret=10), op(1, "Put", 20, "b", ret=30, status=common.STATUS_TIMEOUT),
+               op(2, "Get", 40, "a", ret=50), op(2, "Get", 100, "b", ret=110)]
+        self.assertEqual(verdicts(ops), (True, True))
+
+    def test_random_histories_agree(self):
+        rng = random.Random(1125)
+        for i in range(300):
+            ops = checkers.fuzz_history(rng, clients=rng.randrange(1, 4), keys=rng.randrange(1, 3),
+                                  ops_per_client=rng.randrange(1, 15))
+            if rng.random() < 0.5:
+                ops = checkers.mutate_history(ops, rng.choice(checkers.FUZZ_MUTATIONS), rng)[0]
+            whole, epochs = verdicts(ops)
+            self.assertEqual(whole, epochs, f"history {i}: whole key {whole}, time epochs {epochs}")
+
+
+if __name__ == "__main__":
+    unittest.main()
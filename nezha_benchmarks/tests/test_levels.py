@@ -0,0 +1,30 @@
+"""--consistency auto: every level decided by its own checker."""
+import unittest
+
+from helpers import op
+from verifier import checkers, common
+
+
+def levels(ops):
+    opts = common.CheckOptions(auto_levels=True)
+    primary = checkers.CONSISTENCY_CHECKERS[opts.consistency][1](ops)[0]
+    return checkers.check_levels(ops, opts, primary)
+
+
+class TestLevels(unittest.TestCase):
+    def test_linearizable_history_passes_every_level(self):
+        ops = [op(1, "Put", 0, "a"), op(2, "Get", 10, "a"), op(2, "Put", 20, "b"), op(1, "Get", 30, "b")]
+        self.assertEqual(levels(ops), dict.fromkeys(checkers.CONSISTENCY_LEVELS, "PASS"))
+
+    def test_stale_read_is_only_sequential(self):
+        ops = [op(1, "Put", 0, "a"), op(1, "Get", 10, "a"), op(2, "Get", 100, None), op(2, "Get", 110, "a")]
+        self.assertEqual(levels(ops), {"linearizable": "FAIL", "sequential": "PASS",
+                                       "causal": "PASS", "session": "PASS"})
+
+    def test_going_back_to_an_older_value_fails_every_level(self):
+        ops = [op(1, "Put", 0, "a"), op(1, "Put", 10, "b"), op(2, "Get", 20, "b"), op(2, "Get", 30, "a")]
+        self.assertEqual(levels(ops), dict.fromkeys(checkers.CONSISTENCY_LEVELS, "FAIL"))
+
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,52 @@
+"""check_linearizability: each key on its own, as a single register."""
+import unittest
+
+from helpers import op
+from verifier import common, linearizability
+
+
+class TestLinearizability(unittest.TestCase):
+    def test_linearizable_history_passes(self):
+        # The Get overlapping the second Put may see either value.
+        ops = [op(1, "Get", 0, None, ret=5), op(1, "Put", 10, "a", ret=20), op(2, "Get", 25, "a", ret=30),
+               op(1, "Put", 40, "b", ret=60), op(2, "Get", 45, "a", ret=50), op(3, "Get", 70, "b", ret=80),
+               op(1, "Put", 0, "z", ret=10, key="y"), op(2, "Get", 15, "z", ret=20, key="y")]
+        verdicts = {}
+        self.assertEqual(linearizability.check_linearizability(ops, verdicts=verdicts), (True, []))
+        self.assertEqual(verdicts, {"x": ("PASS", 6), "y": ("PASS", 2)})
+
+    def test_flip_flop(self):
+        # Put x=1 and Put x=2 overlap, so either may win, but not both in turn.
+        ops = [op(1, "Put", 0, "1", ret=50), op(2, "Put", 0, "2", ret=50),
+               op(3, "Get", 100, "1", ret=110), op(3, "Get", 120, "2", ret=130), op(3, "Get", 140, "1", ret=150)]
+        ok, violations = linearizability.check_linearizability(ops)
+        self.assertFalse(ok)
+        self.assertEqual(len(violations), 1)
+        self.assertIn("'x'", violations[0])
+
+    def test_stale_read(self):
+        ops = [op(1, "Put", 0, "a", ret=10), op(1, "Put", 20, "b", ret=30), op(2, "Get", 40, "a", ret=50)]
+        self.assertFalse(linearizability.check_linearizability(ops)[0])
+
+    def test_read_of_a_value_never_written(self):
+        ops = [op(1, "Put", 0, "a", ret=10), op(2, "Get", 20, "c", ret=30)]
+        self.assertFalse(linearizability.check_linearizability(ops)[0])
+
+    def test_ambiguous_put_may_or_may_not_apply(self):
+        ops = [op(1, "Put", 0, "a", ret=10), op(1, "Put", 20, "b", ret=30, status=common.STATUS_TIMEOUT),
+               op(2, "Get", 40, "a", ret=50), op(2, "Get", 60, "b", ret=70)]
+        self.assertEqual(linearizability.check_linearizability(ops), (True, []))
+
+    def test_only_the_failing_key_is_reported(self):
+        ops = [op(1, "Put", 0, "a", ret=10, key="good"), op(2, "Get", 20, "a", ret=30, key="good"),
+               op(1, "Put", 0, "a", ret=10, key="bad"), op(1, "Put", 20, "b", ret=30, key="bad"),
+               op(2, "Get", 40, "a", ret=50, key="bad")]
+        verdicts = {}
+        ok, violations = linearizability.check_linearizability(ops, verdicts=verdicts, parallelism=2)
+        self.assertFalse(ok)
+        self.assertEqual({k: v for k, (v, _) in verdicts.items()}, {"good": "PASS", "bad": "FAIL"})
+        self.assertIn("'bad'", violations[0])
+
+
+if __name__ == "__main__":
+    unittest.main()
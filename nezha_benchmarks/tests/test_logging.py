@@ -0,0 +1,66 @@
+"""The checker's log: marked text lines, or JSON objects with structured fields."""
+import io
+import json
+import sys
+import unittest
+
+import helpers  # noqa: F401  (puts the checker on sys.path)
+from verifier import common
+
+
+class TestLogging(unittest.TestCase):
+    def setUp(self):
+        self.saved = common.log.handlers[:], common.log.level, common.PROGRESS.structured
+        self.addCleanup(self.restore)
+        self.stream = io.StringIO()
+
+    def restore(self):
+        common.log.handlers[:], level, common.PROGRESS.structured = self.saved
+        common.log.setLevel(level)
+
+    def configure(self, level, fmt):
+        stderr, sys.stderr = sys.stderr, self.stream
+        try:
+            common.configure_logging(level, fmt)
+        finally:
+            sys.stderr = stderr
+
+    def test_text_marks_warnings_and_errors(self):
+        self.configure("info", "text")
+        common.log.info("loaded")
+        common.log.warning("skipped 2 records")
+        common.log.error("invalid history")
+        self.assertEqual(self.stream.getvalue().splitlines(),
+                         ["  loaded", "  ⚠  skipped 2 records", "  ✗ invalid history"])
+
+    def test_level_filters(self):
+        self.configure("error", "text")
+        common.log.warning("hidden")
+        self.assertEqual(self.stream.getvalue(), "")
+
+    def test_json_carries_config_and_extra_fields(self):
+        self.configure("info", "json")
+        token = common.LOG_CONFIG.set("cfg")
+        try:
+            common.log.warning("quarantined", extra={"quarantined": 2})
+        finally:
+            common.LOG_CONFIG.reset(token)
+        entry = json.loads(self.stream.getvalue())
+        self.assertEqual((entry["level"], entry["message"], entry["config"], entry["quarantined"]),
+                         ("warning", "quarantined", "cfg", 2))
+        self.assertTrue(entry["time"].endswith("Z"))
+
+    def test_json_exception(self):
+        self.configure("info", "json")
+        try:
+            raise ValueError("boom")
+        except ValueError:
+            common.log.critical("Internal error", exc_info=True)
+        entry = json.loads(self.stream.getvalue())
+        self.assertEqual(entry["level"], "critical")
+        self.assertIn("ValueError: boom", entry["exception"])
+        self.assertNotIn("config", entry)
+
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,86 @@
+"""--merge: a streaming k-way merge of history files, spilling sorted chunks."""
+import json
+import pathlib
+import random
+import tempfile
+import unittest
+from unittest import mock
+
+import helpers  # noqa: F401  (puts the checker on sys.path)
+from verifier import common, history
+
+
+# Epoch-based nanoseconds, as the clients record them.
+BASE = 1_700_000_000_000_000_000
+
+
+def entry(client, call, value):
+    return {"client_id": client, "call": BASE + call, "return_time": BASE + call + 7,
+            "input": {"type": "Put", "key": "x", "value": value}, "output": {"status": common.STATUS_OK}}
+
+
+class TestMerge(unittest.TestCase):
+    def setUp(self):
+        tmp = tempfile.TemporaryDirectory()
+        self.addCleanup(tmp.cleanup)
+        self.dir = pathlib.Path(tmp.name)
+        rng = random.Random(1102)
+        self.entries = []
+        for client in (1, 2, 3):
+            ops = [entry(client, rng.randrange(10, 10_000), f"{client}-{i}") for i in range(200)]
+            if client != 1:
+                rng.shuffle(ops)
+            else:
+                ops.sort(key=lambda e: e["call"])
+            self.entries += ops
+            (self.dir / f"history-{client}.json").write_text(json.dumps(ops))
+
+    def merged(self, out):
+        with history.open_history(out) as f:
+            return list(history.iter_history_entries(f, None, out.name, True))
+
+    def check_sorted(self, out):
+        got = self.merged(out)
+        self.assertEqual(len(got), len(self.entries))
+        self.assertEqual([e["call"] for e in got], sorted(e["call"] for e in self.entries))
+        self.assertEqual(sorted(e["input"]["value"] for e in got), sorted(e["input"]["value"] for e in self.entries))
+
+    def test_merge_in_call_order(self):
+        out = self.dir / "merged.json"
+        paths = history.history_files(self.dir)
+        self.assertEqual(history.merge_histories(paths, out, chunk_ops=30), 600)
+        self.check_sorted(out)
+
+    def test_several_merge_passes(self):
+        out = self.dir / "merged.json.gz"
+        with mock.patch.object(history, "MERGE_FAN_IN", 3):
+            history.merge_histories(history.history_files(self.dir), out, chunk_ops=17)
+        with open(out, "rb") as f:
+            self.assertEqual(f.read(2), history.GZIP_MAGIC)
+        self.check_sorted(out)
+
+    def test_events_and_invalid_records(self):
+        doc = {"events": [{"time": 5, "type": "node_kill", "node": 2}],
+               "operations": [entry(4, 3, "a"), {"client_id": 4, "call": "x"}]}
+        (self.dir / "history-4.json").write_text(json.dumps(doc))
+        out = self.dir / "merged.json"
+        self.assertEqual(history.merge_histories(history.history_files(self.dir), out), 601)
+        events = []
+        with history.open_history(out) as f:
+            ops = list(history.iter_history_entries(f, events, out.name, True))
+        self.assertEqual(ops[0]["input"]["value"], "a")
+        self.assertEqual(events, [common.Event(time_ns=5, kind="node_kill", node=2)])
+        with self.assertRaises(history.HistoryError):
+            history.merge_histories(history.history_files(self.dir), out, strict=True)
+
+    def test_merged_history_checks_the_same(self):
+        out = self.dir / "merged" / "history-1.json"
+        out.parent.mkdir()
+        history.merge_histories(history.history_files(self.dir), out, chunk_ops=50)
+        ops, merged = history.load_history(self.dir), history.load_history(out.parent)
+        self.assertEqual(sorted(map(history.to_history_entry, ops), key=json.dumps),
+                         sorted(map(history.to_history_entry, merged), key=json.dumps))
+
+
+if __name__ == "__main__":
+    unittest.main()
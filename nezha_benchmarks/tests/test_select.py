@@ -0,0 +1,57 @@
+"""--keys/--clients: the other clients' writes stay as context."""
+import json
+import pathlib
+import subprocess
+import sys
+import tempfile
+import unittest
+
+from helpers import op
+from verifier import common, history, linearizability
+
+CHECKER = pathlib.Path(__file__).resolve().parent.parent / "benchmark_and_test.py"
+
+# Epoch-based nanoseconds, as the clients record them.
+BASE = 1_700_000_000_000_000_000
+
+
+def selecting(keys=None, clients=None):
+    return common.CheckOptions(select=common.SelectOptions(keys=keys, clients=clients))
+
+
+# Client 2 reads the value client 1 wrote.
+CROSS_CLIENT_READ = [op(1, "Put", 0, "1", ret=10), op(2, "Get", 20, "1", ret=30)]
+
+
+class TestSelect(unittest.TestCase):
+    def test_other_clients_writes_kept(self):
+        ops, context = history.filter_ops(CROSS_CLIENT_READ, selecting(clients={2}))
+        self.assertEqual((ops, context), (CROSS_CLIENT_READ, 1))
+        self.assertEqual(linearizability.check_linearizability(ops), (True, []))
+
+    def test_other_clients_reads_dropped(self):
+        ops = CROSS_CLIENT_READ + [op(3, "Get", 40, "1", ret=50)]
+        self.assertEqual(history.filter_ops(ops, selecting(clients={2})), (CROSS_CLIENT_READ, 1))
+
+    def test_other_keys_dropped(self):
+        ops = CROSS_CLIENT_READ + [op(1, "Put", 0, "2", key="y", ret=10)]
+        self.assertEqual(history.filter_ops(ops, selecting(keys={"x"}, clients={2})), (CROSS_CLIENT_READ, 1))
+
+    def test_cross_client_read_passes_from_the_command_line(self):
+        with tempfile.TemporaryDirectory() as tmp:
+            config = pathlib.Path(tmp) / "cfg"
+            (config / "logs").mkdir(parents=True)
+            entries = [history.to_history_entry(o) for o in CROSS_CLIENT_READ]
+            for e in entries:
+                e["call"] += BASE
+                e["return_time"] += BASE
+            (config / "logs" / "history-1.json").write_text(json.dumps(entries))
+            run = subprocess.run([sys.executable, str(CHECKER), "--check-only", "--no-plots",
+                                  "--out-dir", tmp, "--clients", "2", str(config)],
+                                 capture_output=True, text=True)
+        self.assertEqual(run.returncode, common.EXIT_OK, run.stdout + run.stderr)
+        self.assertIn("Filtered history to 1 of 2 ops (+1 other clients' write(s) as context)", run.stdout)
+
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,40 @@
+"""check_sequential: one total order for the whole history, real time ignored."""
+import unittest
+from unittest import mock
+
+from helpers import op
+from verifier import checkers, linearizability
+
+
+class TestSequential(unittest.TestCase):
+    def test_stale_read_is_sequential(self):
+        # Client 2 reads nothing well after the Put returned: not linearizable,
+        # but ordering its Get before the Put respects every client's order.
+        ops = [op(1, "Put", 0, "a"), op(1, "Get", 10, "a"), op(2, "Get", 100, None), op(2, "Get", 110, "a")]
+        self.assertEqual(checkers.check_sequential(ops), (True, []))
+        self.assertFalse(linearizability.check_linearizability(ops)[0])
+
+    def test_flip_flop(self):
+        ops = [op(1, "Put", 0, "1"), op(2, "Put", 0, "2"),
+               op(3, "Get", 100, "1"), op(3, "Get", 120, "2"), op(3, "Get", 140, "1")]
+        self.assertFalse(checkers.check_sequential(ops)[0])
+
+    def test_clients_disagree_on_the_order_of_writes(self):
+        # Across keys, so no per-key check can see it.
+        ops = [op(1, "Put", 0, "a", key="x"), op(1, "Put", 10, "b", key="y"),
+               op(2, "Get", 20, "b", key="y"), op(2, "Get", 30, None, key="x")]
+        ok, violations = checkers.check_sequential(ops)
+        self.assertFalse(ok)
+        self.assertTrue(violations)
+
+    def test_states_at_the_same_positions_told_apart(self):
+        # Put a then Put b, and Put b then Put a, reach the same positions;
+        # only the second order lets client 2 read 'a'. Hashes that collide
+        # must not make the search skip it.
+        ops = [op(1, "Put", 0, "a"), op(2, "Put", 0, "b"), op(2, "Get", 10, "a")]
+        with mock.patch.object(checkers, "hash", lambda value: 0, create=True):
+            self.assertEqual(checkers.check_sequential(ops), (True, []))
+
+
+if __name__ == "__main__":
+    unittest.main()
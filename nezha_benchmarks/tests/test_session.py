@@ -0,0 +1,29 @@
+"""check_session: read-your-writes and monotonic reads, per client."""
+import unittest
+
+from helpers import op
+from verifier import checkers
+
+
+class TestSession(unittest.TestCase):
+    def test_other_clients_may_lag(self):
+        # Client 2 still sees nothing after client 1's Put, then catches up.
+        ops = [op(1, "Put", 0, "a"), op(1, "Get", 10, "a"),
+               op(2, "Get", 20, None), op(2, "Get", 30, "a"), op(2, "Get", 40, "a")]
+        self.assertEqual(checkers.check_session(ops), (True, []))
+
+    def test_read_your_writes(self):
+        ops = [op(1, "Put", 0, "a"), op(1, "Put", 10, "b"), op(1, "Get", 20, "a")]
+        ok, violations = checkers.check_session(ops)
+        self.assertFalse(ok)
+        self.assertIn("Client 1 violated read-your-writes", violations[0])
+
+    def test_monotonic_reads(self):
+        ops = [op(1, "Put", 0, "a"), op(1, "Put", 10, "b"), op(2, "Get", 20, "b"), op(2, "Get", 30, "a")]
+        ok, violations = checkers.check_session(ops)
+        self.assertFalse(ok)
+        self.assertIn("Client 2 violated monotonic reads", violations[0])
+
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,55 @@
+"""'-': a history piped to stdin is streamed, never saved."""
+import gzip
+import json
+import os
+import pathlib
+import subprocess
+import sys
+import tempfile
+import unittest
+
+from helpers import op
+from verifier import common, history
+
+CHECKER = pathlib.Path(__file__).resolve().parent.parent / "benchmark_and_test.py"
+
+# Epoch-based nanoseconds, as the clients record them.
+BASE = 1_700_000_000_000_000_000
+
+# A stale read: 'b' had replaced 'a' before the Get began.
+STALE_READ = [op(1, "Put", BASE, "a"), op(1, "Put", BASE + 20, "b"), op(2, "Get", BASE + 40, "a")]
+
+
+class TestStdin(unittest.TestCase):
+    def setUp(self):
+        tmp = tempfile.TemporaryDirectory()
+        self.addCleanup(tmp.cleanup)
+        self.dir = pathlib.Path(tmp.name)
+        (self.dir / "tmp").mkdir()
+
+    def check(self, data):
+        # TMPDIR is checked afterwards: nothing may be spooled there.
+        env = {**os.environ, "TMPDIR": str(self.dir / "tmp")}
+        return subprocess.run([sys.executable, str(CHECKER), "--check-only", "--no-plots", "--json", "-", "-"],
+                              input=data, cwd=self.dir, env=env, capture_output=True)
+
+    def test_gzip_json(self):
+        data = json.dumps([history.to_history_entry(o) for o in STALE_READ]).encode()
+        run = self.check(gzip.compress(data))
+        self.assertEqual(run.returncode, common.EXIT_VIOLATION, run.stderr.decode())
+        result = json.loads(run.stdout)[0]
+        self.assertEqual((result["config"], result["config_dir"], result["ops"]), ("stdin", "<stdin>", 3))
+        self.assertEqual(list((self.dir / "tmp").iterdir()), [])
+        self.assertTrue((self.dir / "stdin" / "stdin-counterexample.json").is_file())
+
+    def test_csv(self):
+        rows = ["client,op,key,value,status,call_ns,return_ns"]
+        rows += [f"{o.client_id},{o.op_type},{o.key},{o.write_val or o.result_val},ok,{o.call_ns},{o.return_ns}"
+                 for o in STALE_READ[:2]]
+        run = self.check("\n".join(rows).encode())
+        self.assertEqual(run.returncode, common.EXIT_OK, run.stderr.decode())
+        self.assertEqual(json.loads(run.stdout)[0]["ops"], 2)
+
+
+if __name__ == "__main__":
+    unittest.main()
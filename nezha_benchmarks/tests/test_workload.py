@@ -0,0 +1,28 @@
+"""lost_set_elements: the set workload's acknowledged adds stay visible."""
+import unittest
+
+from helpers import op
+from verifier import checkers, common
+
+
+class TestLostSetElements(unittest.TestCase):
+    def test_elements_found(self):
+        # The lookup at 2 overlaps the add, so it may miss the element.
+        ops = [op(1, "Put", 0, "1", key="set-1"), op(2, "Get", 2, key="set-1"), op(2, "Get", 10, "1", key="set-1"),
+               op(3, "Get", 10, key="set-2")]
+        self.assertEqual(checkers.lost_set_elements(ops), [])
+
+    def test_lost_element(self):
+        ops = [op(1, "Put", 0, "1", key="set-1"), op(2, "Get", 10, key="set-1"), op(3, "Get", 20, key="set-1")]
+        lost = checkers.lost_set_elements(ops)
+        self.assertEqual(len(lost), 1)
+        self.assertTrue(lost[0].startswith("element 'set-1' added by client 1"))
+        self.assertIn("lookup by client 2 at t=10", lost[0])
+
+    def test_unacknowledged_add_may_be_lost(self):
+        ops = [op(1, "Put", 0, "1", key="set-1", status=common.STATUS_TIMEOUT), op(2, "Get", 10, key="set-1")]
+        self.assertEqual(checkers.lost_set_elements(ops), [])
+
+
+if __name__ == "__main__":
+    unittest.main()
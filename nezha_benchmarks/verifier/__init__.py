@@ -0,0 +1,5 @@
+"""
+History checking for benchmark_and_test.py: loading histories, the
+consistency checkers, cross-checks against the servers' records, and the
+results store, reports and plots built on them.
+"""
@@ -0,0 +1,1014 @@
+"""
+The other consistency checkers and workload invariants, the registry the
+runner picks from, counterexample shrinking and the checker self-test.
+"""
+
+from __future__ import annotations
+
+import bisect
+import json
+import os
+import pathlib
+import pprint
+import re
+import time
+from collections import defaultdict
+from dataclasses import dataclass, replace
+from typing import Callable, Optional
+
+from .common import (CheckOptions, CheckTimeout, Event, MEMORY, MemoryBudget, Operation, PROGRESS,
+                     PartitionTimeout, STATUS_OK, STATUS_TIMEOUT, Value, check_deadline, describe_op,
+                     fit_workers, log, quiet_worker)
+from .history import checker_params, prepare_for_check, slice_ops, to_history_entry
+from .linearizability import check_key, check_linearizability, linearize_key, partition_by_key
+
+# ── Session-guarantee checker ──────────────────────────────────────────────────
+
+def _check_client_session(client_id: int, ops: list[Operation], puts: list[Operation]) -> list[str]:
+    """
+    Check read-your-writes and monotonic reads for a single client.
+
+    Program order is the order of invocation (call_ns); clients pipeline
+    requests, so only operations that completed before a Get was issued
+    constrain what it may return.
+
+    Read-your-writes: a Get must not return None, or a value whose every Put
+        completed before the client's own latest completed Put(K) was issued.
+    Monotonic reads: a Get must not return None, or a value whose every Put
+        completed before the Put that satisfied an earlier completed Get(K).
+    """
+    violations: list[str] = []
+    own = sorted(ops, key=lambda o: o.call_ns)
+
+    def older_than(rv: Optional[Value], ref: Operation) -> bool:
+        # True if every write of rv definitely finished before ref started.
+        if rv is None:
+            return True
+        writes = [p for p in puts if p.key == ref.key and p.write_val == rv]
+        return bool(writes) and all(
+            not p.ambiguous and p.return_ns < ref.call_ns for p in writes
+        )
+
+    for g in own:
+        if g.op_type != "Get":
+            continue
+        prior = [o for o in own if o.key == g.key and o.return_ns <= g.call_ns]
+
+        own_writes = [o for o in prior if o.op_type == "Put" and not o.ambiguous]
+        if own_writes:
+            last_write = max(own_writes, key=lambda o: o.return_ns)
+            if g.result_val != last_write.write_val and older_than(g.result_val, last_write):
+                violations.append(
+                    f"Client {client_id} violated read-your-writes on key '{g.key}': "
+                    f"Get returned {g.result_val!r} after its own Put({last_write.write_val!r}) "
+                    f"completed at t={last_write.return_ns:,}."
+                )
+                continue
+
+        prior_reads = [o for o in prior if o.op_type == "Get" and o.result_val is not None]
+        if prior_reads:
+            last_read = max(prior_reads, key=lambda o: o.return_ns)
+            sources = [p for p in puts if p.key == g.key and p.write_val == last_read.result_val]
+            if sources and g.result_val != last_read.result_val:
+                source = min(sources, key=lambda p: p.call_ns)
+                if older_than(g.result_val, source):
+                    violations.append(
+                        f"Client {client_id} violated monotonic reads on key '{g.key}': "
+                        f"Get returned {g.result_val!r} after an earlier Get observed "
+                        f"{last_read.result_val!r} (t={last_read.return_ns:,})."
+                    )
+    return violations
+
+
+def check_session(
+    ops: list[Operation], deadline: Optional[float] = None
+) -> tuple[bool, list[str]]:
+    """Check per-client session guarantees (read-your-writes, monotonic reads)."""
+    puts = [op for op in ops if op.op_type == "Put"]
+    by_client: dict[int, list[Operation]] = defaultdict(list)
+    for op in ops:
+        by_client[op.client_id].append(op)
+
+    violations: list[str] = []
+    for done, client_id in enumerate(sorted(by_client)):
+        check_deadline(deadline, f"{done}/{len(by_client)} clients checked")
+        violations.extend(_check_client_session(client_id, by_client[client_id], puts))
+    return not violations, violations
+
+# ── Sequential consistency checker ─────────────────────────────────────────────
+
+def check_sequential(
+    ops: list[Operation], deadline: Optional[float] = None
+) -> tuple[bool, list[str]]:
+    """
+    Search for a total order that respects each client's program order
+    (call_ns) and is legal for a map of registers, ignoring real time.
+
+    Unlike linearizability this property is not local, so the whole history
+    is searched at once. Two reductions keep the search tractable: a Get whose
+    value matches the current state is applied immediately (it cannot change
+    state, so taking it early never removes a solution), and explored
+    (positions, state) pairs are memoized on the exact register state.
+    A Put with an ambiguous status is tried both applied and skipped.
+    """
+    by_client: dict[int, list[Operation]] = defaultdict(list)
+    for op in ops:
+        by_client[op.client_id].append(op)
+    clients = sorted(by_client)
+    seqs = [sorted(by_client[c], key=lambda o: o.call_ns) for c in clients]
+    total = sum(len(s) for s in seqs)
+
+    pos = [0] * len(seqs)
+    state: dict[str, Optional[Value]] = {}
+    depth = 0
+    visited: set[tuple[tuple[int, ...], frozenset]] = set()
+    explored = 0
+    best_depth, best_pos = 0, list(pos)
+
+    def applicable(c: int) -> bool:
+        if pos[c] >= len(seqs[c]):
+            return False
+        op = seqs[c][pos[c]]
+        return op.op_type == "Put" or state.get(op.key) == op.result_val
+
+    # Each frame holds the next move to try (2 * client, +1 to skip an
+    # ambiguous Put) and the move that created it.
+    frames: list[list] = [[0, None]]
+    while frames:
+        if depth == total:
+            return True, []
+        explored += 1
+        if explored % 4096 == 0:
+            check_deadline(deadline, f"{explored:,} states explored, best order {best_depth}/{total} ops")
+
+        frame = frames[-1]
+        gets = [c for c in range(len(seqs)) if applicable(c) and seqs[c][pos[c]].op_type == "Get"]
+        if gets:
+            choices = [2 * gets[0]]
+        else:
+            choices = []
+            for c in range(len(seqs)):
+                if applicable(c):
+                    choices.append(2 * c)
+                    if seqs[c][pos[c]].ambiguous:
+                        choices.append(2 * c + 1)
+        choice = next((m for m in choices if m >= frame[0]), None)
+
+        if choice is None:
+            frames.pop()
+            move = frame[1]
+            if move is not None:
+                c, key, prev = move
+                pos[c] -= 1
+                depth -= 1
+                if key is not None:
+                    if prev is None:
+                        state.pop(key, None)
+                    else:
+                        state[key] = prev
+            continue
+
+        frame[0] = choice + 1
+        choice, skip = divmod(choice, 2)
+        op = seqs[choice][pos[choice]]
+        move = (choice, None, None)
+        if op.op_type == "Put" and not skip:
+            move = (choice, op.key, state.get(op.key))
+            state[op.key] = op.write_val
+        pos[choice] += 1
+        depth += 1
+
+        # A key never written and one written None read alike.
+        memo = (tuple(pos), frozenset((k, v) for k, v in state.items() if v is not None))
+        if memo in visited:
+            # Undo immediately; the frame's next choice is tried on the next pass.
+            frames.append([2 * len(seqs), move])
+            continue
+        visited.add(memo)
+        if depth > best_depth:
+            best_depth, best_pos = depth, list(pos)
+        frames.append([0, move])
+
+    stuck = [
+        f"client {clients[c]}: {seqs[c][best_pos[c]].op_type}('{seqs[c][best_pos[c]].key}')"
+        + (f" → {seqs[c][best_pos[c]].result_val!r}" if seqs[c][best_pos[c]].op_type == "Get" else "")
+        for c in range(len(seqs)) if best_pos[c] < len(seqs[c])
+    ]
+    return False, [
+        f"No sequential order exists: at most {best_depth}/{total} ops could be ordered "
+        f"consistently with program order; blocked at {', '.join(stuck)}."
+    ]
+
+# ── Causal consistency checker ─────────────────────────────────────────────────
+
+def _causal_chain(succ: list[list[int]], src: int, dst: int) -> list[int]:
+    """Breadth-first path src → dst over causal edges (empty if unreachable)."""
+    parent = {src: src}
+    queue = [src]
+    for node in queue:
+        if node == dst:
+            break
+        for nxt in succ[node]:
+            if nxt not in parent:
+                parent[nxt] = node
+                queue.append(nxt)
+    if dst not in parent:
+        return []
+    path = [dst]
+    while path[-1] != src:
+        path.append(parent[path[-1]])
+    return path[::-1]
+
+
+def check_causal(
+    ops: list[Operation], deadline: Optional[float] = None,
+    chains: Optional[list[list[Operation]]] = None,
+) -> tuple[bool, list[str]]:
+    """
+    Check causal consistency over write-read dependencies.
+
+    The causal order is the transitive closure of program order (each
+    client's ops by call_ns) and reads-from (Put(K,V) → Get(K) returning V).
+    Violations:
+      - the causal order is cyclic;
+      - a Get returns a value V although a different Put(K) is causally
+        after Put(K,V) and causally before the Get (or returns None although
+        some Put(K) is causally before it).
+    Values are assumed unique per key, as written by the omnipaxos-kv client.
+
+    The causal past of an op is kept as a vector clock over the clients:
+    program order makes each client's share of it a prefix of that client's
+    ops, so the position of its last one is enough. `chains`, when given,
+    receives the ops of each violation in causal order (a cycle closed on
+    its first op), for the timeline to highlight.
+    """
+    succ: list[list[int]] = [[] for _ in ops]
+    by_client: dict[int, list[int]] = defaultdict(list)
+    writer: dict[tuple[str, Value], int] = {}
+    for i, op in enumerate(ops):
+        by_client[op.client_id].append(i)
+        if op.op_type == "Put":
+            writer.setdefault((op.key, op.write_val), i)
+    session = {client: n for n, client in enumerate(by_client)}
+    position = [0] * len(ops)
+    for idxs in by_client.values():
+        idxs.sort(key=lambda i: ops[i].call_ns)
+        for n, i in enumerate(idxs):
+            position[i] = n
+        for a, b in zip(idxs, idxs[1:]):
+            succ[a].append(b)
+
+    violations: list[str] = []
+    source: dict[int, int] = {}
+    for i, op in enumerate(ops):
+        if op.op_type != "Get" or op.result_val is None:
+            continue
+        w = writer.get((op.key, op.result_val))
+        if w is None:
+            violations.append(f"{describe_op(op)} read a value that was never written.")
+            continue
+        source[i] = w
+        succ[w].append(i)
+
+    # Topological order; anything left over sits on a cycle.
+    indegree = [0] * len(ops)
+    for outs in succ:
+        for b in outs:
+            indegree[b] += 1
+    order = [i for i in range(len(ops)) if indegree[i] == 0]
+    for node in order:
+        for b in succ[node]:
+            indegree[b] -= 1
+            if indegree[b] == 0:
+                order.append(b)
+
+    if len(order) < len(ops):
+        preds: list[list[int]] = [[] for _ in ops]
+        for a, outs in enumerate(succ):
+            for b in outs:
+                preds[b].append(a)
+        # Every unsorted node has an unsorted predecessor: walk back until one repeats.
+        node = next(i for i in range(len(ops)) if indegree[i] > 0)
+        seen: list[int] = []
+        while node not in seen:
+            seen.append(node)
+            node = next(p for p in preds[node] if indegree[p] > 0)
+        cycle = seen[seen.index(node):][::-1]
+        chain = " → ".join(describe_op(ops[i]) for i in cycle + cycle[:1])
+        violations.append(f"Causal cycle: {chain}.")
+        if chains is not None:
+            chains.append([ops[i] for i in cycle + cycle[:1]])
+        return False, violations
+
+    # clock[i][s]: position of the last op of session s in i's causal past
+    # (i included), -1 if none. An op's predecessors are the one before it
+    # in its session and, for a Get, the Put it read from.
+    clock: list[Optional[list[int]]] = [None] * len(ops)
+    previous = {i: j for idxs in by_client.values() for j, i in zip(idxs, idxs[1:])}
+    for n, node in enumerate(order):
+        if n and n % 4096 == 0:
+            check_deadline(deadline, f"{n}/{len(ops)} causal pasts computed")
+        sources = [clock[p] for p in (previous.get(node), source.get(node)) if p is not None]
+        mine = list(map(max, *sources)) if len(sources) > 1 else list(sources[0]) if sources else [-1] * len(session)
+        mine[session[ops[node].client_id]] = position[node]
+        clock[node] = mine
+
+    def before(p: int, i: int) -> bool:
+        return position[p] <= clock[i][session[ops[p].client_id]] and p != i
+
+    # A session's Puts on a key, by position; only definite ones must be seen.
+    puts_of: dict[tuple[str, int], list[int]] = defaultdict(list)
+    for idxs in by_client.values():
+        for i in idxs:
+            if ops[i].op_type == "Put" and not ops[i].ambiguous:
+                puts_of[(ops[i].key, session[ops[i].client_id])].append(i)
+    put_positions = {k: [position[i] for i in idxs] for k, idxs in puts_of.items()}
+
+    for i, op in enumerate(ops):
+        if op.op_type != "Get":
+            continue
+        if i % 4096 == 0:
+            check_deadline(deadline, f"{i}/{len(ops)} ops checked")
+        w = source.get(i)
+        for s_id in range(len(session)):
+            idxs = puts_of.get((op.key, s_id))
+            if not idxs:
+                continue
+            # The session's last Put on the key in the Get's causal past: if
+            # any of its Puts follows the source, this one does.
+            n = bisect.bisect_right(put_positions[(op.key, s_id)], clock[i][s_id])
+            if not n:
+                continue
+            p = idxs[n - 1]
+            if p == w or w is not None and not before(w, p):
+                continue
+            path = (_causal_chain(succ, w, p) if w is not None else [p]) + _causal_chain(succ, p, i)[1:]
+            violations.append(
+                f"{describe_op(op)} ignores causally preceding {describe_op(ops[p])}; "
+                f"dependency chain: {' → '.join(describe_op(ops[j]) for j in path)}."
+            )
+            if chains is not None:
+                chains.append([ops[j] for j in path])
+            break
+    return not violations, violations
+
+# ── Bounded-staleness checker ──────────────────────────────────────────────────
+
+def check_bounded_staleness(
+    ops: list[Operation], deadline: Optional[float] = None, bound_ns: int = 0, epochs: bool = False
+) -> tuple[bool, list[str]]:
+    """
+    Reads may return any value that was current at some point within
+    `bound_ns` before they were invoked: extend every Get's interval back
+    by the bound and check linearizability. A bound of 0 is linearizability.
+    """
+    relaxed = [
+        replace(op, call_ns=op.call_ns - bound_ns) if op.op_type == "Get" else op
+        for op in ops
+    ]
+    return check_linearizability(relaxed, deadline=deadline, epochs=epochs)
+
+# ── Workload invariants ────────────────────────────────────────────────────────
+
+# Keys of the client's set workload: one per element, value = element.
+SET_ELEMENT_PREFIX = "set-"
+
+
+def lost_set_elements(ops: list[Operation]) -> list[str]:
+    """
+    Set workload: an element whose add was acknowledged must be found by
+    every lookup that starts afterwards. One message per lost element.
+    """
+    acked: dict[str, Operation] = {}
+    for op in ops:
+        if op.op_type == "Put" and op.key.startswith(SET_ELEMENT_PREFIX) and not op.ambiguous:
+            if op.key not in acked or op.return_ns < acked[op.key].return_ns:
+                acked[op.key] = op
+    lost = {}
+    for op in sorted(ops, key=lambda o: o.call_ns):
+        add = acked.get(op.key)
+        if (op.op_type == "Get" and add is not None and op.result_val is None
+                and not op.ambiguous and add.return_ns <= op.call_ns and op.key not in lost):
+            lost[op.key] = (
+                f"element {op.key!r} added by client {add.client_id} (acked t={add.return_ns:,}) "
+                f"missing from lookup by client {op.client_id} at t={op.call_ns:,}"
+            )
+    return list(lost.values())
+
+
+CONSISTENCY_CHECKERS = {
+    "bounded-staleness": ("Bounded staleness", check_bounded_staleness),
+    "causal": ("Causal consistency", check_causal),
+    "linearizable": ("Linearizability", check_linearizability),
+    "sequential": ("Sequential consistency", check_sequential),
+    "session": ("Session consistency", check_session),
+}
+
+# Levels checked by --consistency auto, strongest first: each implies the next.
+CONSISTENCY_LEVELS = ("linearizable", "sequential", "causal", "session")
+
+# Data models a history can be interpreted with; each maps the loaded
+# operations onto the per-key register semantics the checkers implement.
+REGISTER_KEY = "register"
+
+MODELS = {
+    "kv": ("key-value store (one register per key)", lambda ops: ops),
+    "register": (
+        "single register (keys ignored)",
+        lambda ops: [replace(op, key=REGISTER_KEY) for op in ops],
+    ),
+}
+
+# ── Shards ─────────────────────────────────────────────────────────────────────
+
+# Shard label of operations recorded without a "shard" field.
+UNSHARDED = "-"
+
+
+def partition_by_shard(ops: list[Operation]) -> dict[str, list[Operation]]:
+    """Group operations by shard, ordered as partition_by_key orders keys."""
+    shards: dict[str, list[Operation]] = defaultdict(list)
+    for op in ops:
+        shards[op.shard if op.shard is not None else UNSHARDED].append(op)
+    return dict(sorted(shards.items(), key=lambda kv: (len(kv[0]), kv[0])))
+
+
+def keys_in_several_shards(ops: list[Operation]) -> dict[str, list[str]]:
+    """Keys recorded under more than one shard: a routing bug, not a consistency one."""
+    seen: dict[str, set[str]] = defaultdict(set)
+    for op in ops:
+        if op.shard is not None:
+            seen[op.key].add(op.shard)
+    return {key: sorted(shards) for key, shards in seen.items() if len(shards) > 1}
+
+
+def _check_shard(
+    consistency: str, ops: list[Operation], params: dict, deadline: Optional[float]
+) -> tuple[Optional[bool], list[str], dict[str, tuple[str, int]]]:
+    """Check one shard: (verdict, violations, per-key verdicts if linearizable)."""
+    verdicts: dict[str, tuple[str, int]] = {}
+    if consistency == "linearizable":
+        params = {**params, "verdicts": verdicts}
+    try:
+        ok, violations = CONSISTENCY_CHECKERS[consistency][1](ops, deadline=deadline, **params)
+    except MemoryBudget as ex:
+        return None, [f"memory limit reached: {ex}"], verdicts
+    except PartitionTimeout as ex:
+        return None, [str(ex)], verdicts
+    except CheckTimeout as ex:
+        return None, [f"budget exhausted after {ex}"], verdicts
+    return ok, violations, verdicts
+
+
+def check_shards(
+    ops: list[Operation],
+    opts: CheckOptions,
+    deadline: Optional[float] = None,
+    verdicts: Optional[dict[str, tuple[str, int]]] = None,
+) -> tuple[Optional[bool], list[str], dict[str, dict]]:
+    """
+    Check each shard's operations on their own, in worker processes (one per
+    shard, up to the CPU count or --parallelism if higher). Returns the
+    aggregate verdict (FAIL if any shard fails, else UNKNOWN if any ran out
+    of budget), the violations prefixed with their shard, and a report
+    shard → {ops, verdict, violations}. `verdicts` receives the per-key
+    verdicts of linearizability checks.
+    """
+    shards = partition_by_shard(ops)
+    params = checker_params(opts)
+    if opts.consistency == "linearizable":
+        params["partition_timeout"] = opts.partition_timeout
+    results: dict[str, tuple[Optional[bool], list[str], dict]] = {}
+
+    def status() -> str:
+        return f"{len(results)}/{len(shards)} shards checked"
+
+    if len(shards) > 1:
+        from concurrent.futures import FIRST_COMPLETED, ProcessPoolExecutor, wait
+        workers = fit_workers(min(len(shards), max(opts.parallelism, os.cpu_count() or 1)))
+        with ProcessPoolExecutor(max_workers=workers, initializer=quiet_worker,
+                                 initargs=(MEMORY.share(workers),)) as pool:
+            # Every worker stops at the shared deadline (time.monotonic() is system-wide).
+            pending = {
+                pool.submit(_check_shard, opts.consistency, shard_ops, params, deadline): shard
+                for shard, shard_ops in shards.items()
+            }
+            while pending:
+                PROGRESS.tick(status())
+                done, _ = wait(pending, timeout=1.0, return_when=FIRST_COMPLETED)
+                for fut in done:
+                    results[pending.pop(fut)] = fut.result()
+    else:
+        for shard, shard_ops in shards.items():
+            results[shard] = _check_shard(opts.consistency, shard_ops, params, deadline)
+
+    report: dict[str, dict] = {}
+    violations: list[str] = []
+    for shard, shard_ops in shards.items():
+        ok, shard_violations, shard_verdicts = results[shard]
+        if verdicts is not None:
+            verdicts.update(shard_verdicts)
+        report[shard] = {
+            "ops": len(shard_ops),
+            "verdict": {True: "PASS", False: "FAIL", None: "UNKNOWN"}[ok],
+            "violations": len(shard_violations) if ok is False else 0,
+        }
+        if ok is False:
+            violations.extend(f"[shard {shard}] {v}" for v in shard_violations)
+    oks = [ok for ok, _, _ in results.values()]
+    if False in oks:
+        return False, violations, report
+    if None in oks:
+        unknown = [f"[shard {shard}] {v[0]}" for shard, (ok, v, _) in results.items() if ok is None]
+        return None, unknown, report
+    return True, [], report
+
+
+def print_shard_report(report: dict[str, dict]) -> None:
+    print(f"  Shards: {len(report)}")
+    marks = {"PASS": "✓  PASS", "FAIL": "✗  FAIL", "UNKNOWN": "?  UNKNOWN"}
+    width = max(len(shard) for shard in report)
+    for shard, r in report.items():
+        detail = f" ({r['violations']} violation(s))" if r["verdict"] == "FAIL" else ""
+        print(f"    shard {shard:<{width}} : {r['ops']:>6} ops  {marks[r['verdict']]}{detail}")
+
+# ── Sliding windows ────────────────────────────────────────────────────────────
+
+@dataclass
+class WindowResult:
+    """Verdict of one time window; times are offsets from the first call."""
+    start_ns: int
+    end_ns: int
+    ops: int
+    verdict: Optional[bool]
+    violations: list[str]
+
+
+def check_windows(
+    ops: list[Operation],
+    opts: CheckOptions,
+    size_ns: int,
+    stride_ns: int,
+    deadline: Optional[float] = None,
+) -> list[WindowResult]:
+    """
+    Check the windows [k*stride, k*stride + size] of the history in time
+    order, each sliced as by --from/--to (context writes included), and
+    stop at the first one that fails or runs out of budget. The last
+    result is then the earliest window in which consistency broke.
+    """
+    if not ops:
+        return []
+    origin = min(op.call_ns for op in ops)
+    span = max(op.return_ns for op in ops) - origin
+    checker = CONSISTENCY_CHECKERS[opts.consistency][1]
+    sharded = any(op.shard is not None for op in ops)
+    results: list[WindowResult] = []
+    start = 0
+    while True:
+        end = start + size_ns
+        window, _ = slice_ops(ops, start, end, None)
+        if window:
+            prepared = prepare_for_check(window, opts)
+            try:
+                if sharded:
+                    ok, violations, _ = check_shards(prepared, opts, deadline=deadline)
+                else:
+                    ok, violations = checker(prepared, deadline=deadline, **checker_params(opts))
+            except MemoryBudget as ex:
+                ok, violations = None, [f"memory limit reached: {ex}"]
+            except (CheckTimeout, PartitionTimeout) as ex:
+                ok, violations = None, [f"budget exhausted after {ex}"]
+            results.append(WindowResult(start, end, len(window), ok, violations))
+            if ok is not True:
+                break
+        if end >= span:
+            break
+        start += stride_ns
+    return results
+
+
+# Time windows a history is split into when its full check runs out of memory.
+MEMORY_WINDOWS = 8
+
+
+def check_in_windows(
+    ops: list[Operation], opts: CheckOptions, reason: str, deadline: Optional[float] = None
+) -> tuple[Optional[bool], list[str]]:
+    """
+    Fall back from a full check that ran past --max-memory (`reason`) to
+    MEMORY_WINDOWS consecutive time windows, each a fraction of the
+    history. A failing window is a real violation (its slice keeps the
+    context writes), but windows that pass say nothing of operations
+    spanning two of them, so the verdict is otherwise unknown.
+    """
+    span = max(op.return_ns for op in ops) - min(op.call_ns for op in ops)
+    size = span // MEMORY_WINDOWS + 1
+    log.warning(f"Memory limit reached ({reason}); checking {MEMORY_WINDOWS} time windows "
+                f"of {size / 1e9:.3f}s instead")
+    windows = check_windows(ops, opts, size, size, deadline)
+    last = windows[-1] if windows else None
+    where = f"{last.start_ns / 1e9:.3f}s–{last.end_ns / 1e9:.3f}s" if last else ""
+    if last is not None and last.verdict is False:
+        return False, [f"in window {where}: {v}" for v in last.violations]
+    if last is None or last.verdict is True:
+        return None, [f"memory limit reached ({reason}); all {len(windows)} time windows pass, "
+                      f"but operations spanning two windows were not checked"]
+    return None, [f"memory limit reached ({reason}); windowed check stopped in {where}: {last.violations[0]}"]
+
+
+def print_window_report(windows: list[WindowResult], size_ns: int, stride_ns: int, verbose: bool) -> None:
+    def span(w: WindowResult) -> str:
+        return f"{w.start_ns / 1e9:.3f}s–{w.end_ns / 1e9:.3f}s"
+
+    head = f"  Windows ({size_ns / 1e9:g}s, stride {stride_ns / 1e9:g}s): {len(windows)} checked"
+    last = windows[-1] if windows else None
+    if last is None or last.verdict is True:
+        print(f"{head}, ✓ every window passes")
+    elif last.verdict is False:
+        print(f"{head}, ✗ first violation in {span(last)} ({last.ops} ops)")
+    else:
+        print(f"{head}, ? stopped at {span(last)}: {last.violations[0]}")
+    if verbose:
+        marks = {True: "✓", False: "✗", None: "?"}
+        for w in windows:
+            print(f"    {marks[w.verdict]} {span(w)}  {w.ops} ops")
+    if last is not None and last.verdict is False:
+        for v in last.violations[:3]:
+            print(f"    • {v}")
+
+# ── Snapshot installs ──────────────────────────────────────────────────────────
+
+# Events after which a replica's reads are checked against prior acknowledged writes.
+SNAPSHOT_EVENTS = ("snapshot_install", "compaction")
+
+
+def reads_after_snapshots(ops: list[Operation], events: list[Event], opts: CheckOptions) -> Optional[dict]:
+    """
+    The reads served within opts.snapshot_window_ns after a SNAPSHOT_EVENTS
+    event, by its node when both it and the ops record one, each checked on
+    its own against every write of its key (offending_read's rule): {events,
+    reads, node_local, missed: [{event, node, at_ms, after_ms, message}]}
+    with at_ms since the first call; a read following several events counts
+    after the latest. None without such events.
+    """
+    marks = sorted((ev for ev in events if ev.kind in SNAPSHOT_EVENTS), key=lambda ev: ev.time_ns)
+    if not marks:
+        return None
+    checked = prepare_for_check(ops, opts)
+    origin = min((op.call_ns for op in checked), default=marks[0].time_ns)
+    by_node = any(op.node is not None for op in checked)
+    gets = sorted((op for op in checked if op.op_type == "Get"), key=lambda op: op.call_ns)
+    calls = [g.call_ns for g in gets]
+    after: dict[int, tuple[Operation, Event]] = {}
+    for ev in marks:
+        lo = bisect.bisect_left(calls, ev.time_ns)
+        hi = bisect.bisect_left(calls, ev.time_ns + opts.snapshot_window_ns)
+        for g in gets[lo:hi]:
+            if not by_node or ev.node is None or g.node == ev.node:
+                after[id(g)] = (g, ev)
+    puts: dict[str, list[Operation]] = defaultdict(list)
+    for op in checked:
+        if op.op_type == "Put":
+            puts[op.key].append(op)
+    missed = []
+    for g, ev in sorted(after.values(), key=lambda pair: pair[0].call_ns):
+        ok, message = check_key(g.key, puts[g.key] + [g])
+        if not ok:
+            missed.append({"event": ev.kind, "node": ev.node, "at_ms": (ev.time_ns - origin) / 1e6,
+                           "after_ms": (g.call_ns - ev.time_ns) / 1e6, "message": message})
+    return {"events": len(marks), "reads": len(after), "node_local": by_node, "missed": missed}
+
+
+def print_snapshot_report(report: dict, window_ns: int, top: int = 5) -> None:
+    where = "on their node" if report["node_local"] else "on any node"
+    print(f"  Snapshot installs / compactions: {report['events']}, {report['reads']} read(s) "
+          f"{where} within {window_ns / 1e9:g}s after")
+    if not report["missed"]:
+        if report["reads"]:
+            print("    ✓ each reflects the writes acknowledged before it")
+        return
+    print(f"    ✗ {len(report['missed'])} read(s) missed a write acknowledged before them:")
+    for m in report["missed"][:top]:
+        node = f" on node {m['node']}" if m["node"] is not None else ""
+        print(f"      • {m['after_ms']:.3f} ms after {m['event']}{node} at t={m['at_ms']:.3f}ms: "
+              f"{m['message']}")
+    if len(report["missed"]) > top:
+        print(f"      … and {len(report['missed']) - top} more")
+
+# ── Consistency levels ─────────────────────────────────────────────────────────
+
+def check_levels(
+    ops: list[Operation], opts: CheckOptions, primary: Optional[bool], deadline: Optional[float] = None
+) -> dict[str, str]:
+    """
+    PASS/FAIL/UNKNOWN per CONSISTENCY_LEVELS entry, strongest first, given
+    the verdict `primary` already computed for opts.consistency. Every level
+    is checked by its own checker, so a verdict never rests on another's.
+    """
+    sharded = any(op.shard is not None for op in ops)
+    levels: dict[str, str] = {}
+    for level in CONSISTENCY_LEVELS:
+        if level == opts.consistency:
+            ok = primary
+        else:
+            level_opts = replace(opts, consistency=level)
+            prepared = prepare_for_check(ops, level_opts)
+            try:
+                if sharded:
+                    ok = check_shards(prepared, level_opts, deadline=deadline)[0]
+                else:
+                    ok = CONSISTENCY_CHECKERS[level][1](prepared, deadline=deadline,
+                                                        **checker_params(level_opts))[0]
+            except (CheckTimeout, PartitionTimeout):
+                ok = None
+        levels[level] = {True: "PASS", False: "FAIL", None: "UNKNOWN"}[ok]
+    return levels
+
+
+def print_levels(levels: dict[str, str]) -> None:
+    marks = {"PASS": "✓  PASS   ", "FAIL": "✗  FAIL   ", "UNKNOWN": "?  UNKNOWN"}
+    print("  Consistency levels (strongest first):")
+    for level, verdict in levels.items():
+        print(f"    {marks[verdict]}  {CONSISTENCY_CHECKERS[level][0]}")
+    strongest = next((level for level, v in levels.items() if v == "PASS"), None)
+    if strongest is not None:
+        print(f"  Strongest level that holds: {CONSISTENCY_CHECKERS[strongest][0]}")
+    elif "UNKNOWN" in levels.values():
+        print("  Strongest level that holds: undecided (a check ran out of budget)")
+    else:
+        print("  Strongest level that holds: none of the checked levels")
+
+# ── Read paths ─────────────────────────────────────────────────────────────────
+
+# Read path label of Gets recorded without a "read_mode" field.
+UNTAGGED_READS = "untagged"
+
+
+def check_read_paths(
+    ops: list[Operation], opts: CheckOptions, deadline: Optional[float] = None
+) -> dict[str, dict]:
+    """
+    One verdict per read path: check every write together with only the
+    Gets served by that path. Dropping reads only drops constraints, so a
+    path that fails on its own is itself returning values it should not.
+    Empty unless some Get carries a read_mode.
+    """
+    gets: dict[str, list[Operation]] = defaultdict(list)
+    for op in ops:
+        if op.op_type == "Get":
+            gets[op.read_mode if op.read_mode is not None else UNTAGGED_READS].append(op)
+    if set(gets) <= {UNTAGGED_READS}:
+        return {}
+    writes = [op for op in ops if op.op_type != "Get"]
+    checker = CONSISTENCY_CHECKERS[opts.consistency][1]
+    sharded = any(op.shard is not None for op in ops)
+    report: dict[str, dict] = {}
+    for mode in sorted(gets, key=lambda m: (m == UNTAGGED_READS, m)):
+        prepared = prepare_for_check(writes + gets[mode], opts)
+        try:
+            if sharded:
+                ok, violations, _ = check_shards(prepared, opts, deadline=deadline)
+            else:
+                ok, violations = checker(prepared, deadline=deadline, **checker_params(opts))
+        except (CheckTimeout, PartitionTimeout) as ex:
+            ok, violations = None, [f"budget exhausted after {ex}"]
+        report[mode] = {
+            "reads": len(gets[mode]),
+            "verdict": {True: "PASS", False: "FAIL", None: "UNKNOWN"}[ok],
+            "violations": violations if ok is False else [],
+        }
+    return report
+
+
+def print_read_path_report(report: dict[str, dict]) -> None:
+    print("  Read paths (all writes + that path's reads):")
+    marks = {"PASS": "✓  PASS", "FAIL": "✗  FAIL", "UNKNOWN": "?  UNKNOWN"}
+    width = max(len(mode) for mode in report)
+    for mode, r in report.items():
+        detail = f" ({len(r['violations'])} violation(s))" if r["verdict"] == "FAIL" else ""
+        print(f"    {mode:<{width}} : {r['reads']:>6} reads  {marks[r['verdict']]}{detail}")
+        for v in r["violations"][:3]:
+            print(f"      • {v}")
+
+# ── Counterexamples ────────────────────────────────────────────────────────────
+
+def write_counterexample(ops: list[Operation], path: pathlib.Path, keys: Optional[set[str]] = None) -> int:
+    """
+    Write every operation of the key partitions that failed the
+    linearizability check (`keys`, or else those check_key rejects) to
+    `path`, in history format, so the failing slice can be attached to a bug
+    report and re-checked on its own. Returns the number of operations
+    written.
+    """
+    failing = [
+        op
+        for key, key_ops in partition_by_key(ops).items()
+        if (key in keys if keys is not None else not check_key(key, key_ops)[0])
+        for op in sorted(key_ops, key=lambda o: o.call_ns)
+    ]
+    with open(path, "w") as f:
+        json.dump([to_history_entry(op) for op in failing], f, indent=2)
+    return len(failing)
+
+
+# A unittest module pinning a counterexample (see write_regression_test).
+REGRESSION_TEST_TEMPLATE = '''"""
+Regression test for a history from {config!r} that is not {consistency}
+(generated by benchmark_and_test.py --emit-test on {date}): the checker must
+keep reporting these {n} operations as not {consistency}.
+"""
+import json
+import os
+import pathlib
+import sys
+import tempfile
+import unittest
+
+# Directory holding benchmark_and_test.py.
+CHECKER_DIR = os.environ.get("OMNIPAXOS_CHECKER_DIR", {checker_dir!r})
+sys.path.insert(0, CHECKER_DIR)
+import benchmark_and_test as bt  # noqa: E402
+
+HISTORY = {history}
+
+
+class {cls}(unittest.TestCase):
+    def test_not_{ident}(self):
+        with tempfile.TemporaryDirectory() as tmp:
+            pathlib.Path(tmp, "history-1.json").write_text(json.dumps(HISTORY))
+            ops = bt.load_history(pathlib.Path(tmp), strict=True, time_unit="ns")
+        opts = bt.CheckOptions(consistency={consistency!r}, clock_skew_ns={clock_skew_ns}, bound_ns={bound_ns})
+        checker = bt.CONSISTENCY_CHECKERS[opts.consistency][1]
+        ok, violations = checker(bt.prepare_for_check(ops, opts), **bt.checker_params(opts))
+        self.assertFalse(ok, "the history now passes the {consistency} check")
+        self.assertTrue(violations)
+
+
+if __name__ == "__main__":
+    unittest.main()
+'''
+
+
+def write_regression_test(path: pathlib.Path, config_name: str, entries: list[dict], opts: CheckOptions) -> None:
+    """
+    Write a self-contained unittest module embedding the counterexample
+    `entries` (history format) that loads and checks it through this
+    script's API with the same consistency mode and clock skew, asserting
+    that it still fails.
+    """
+    ident = re.sub(r"\W+", "_", opts.consistency)
+    path.write_text(REGRESSION_TEST_TEMPLATE.format(
+        consistency=opts.consistency,
+        config=config_name,
+        date=time.strftime("%Y-%m-%d"),
+        n=len(entries),
+        checker_dir=str(pathlib.Path(__file__).resolve().parent.parent),
+        history=pprint.pformat(entries, width=100, sort_dicts=False),
+        cls="Test" + "".join(part.capitalize() for part in re.split(r"\W+|_", config_name) if part)
+            + "Counterexample",
+        ident=ident,
+        clock_skew_ns=opts.clock_skew_ns,
+        bound_ns=opts.bound_ns,
+    ))
+
+
+def shrink_ops(
+    ops: list[Operation],
+    fails: Callable[[list[Operation]], bool],
+    deadline: Optional[float] = None,
+) -> list[Operation]:
+    """
+    Delta-debug (ddmin) a failing history: repeatedly drop chunks of
+    operations while `fails` still holds, down to a 1-minimal failing
+    subset. Stops early at `deadline` and returns the smallest found so far.
+    """
+    n = 2
+    while len(ops) >= 2:
+        size = -(-len(ops) // n)
+        chunks = [ops[i:i + size] for i in range(0, len(ops), size)]
+        candidates = chunks + [
+            [op for j, c in enumerate(chunks) if j != i for op in c] for i in range(len(chunks))
+        ] if len(chunks) > 2 else chunks
+        for i, cand in enumerate(candidates):
+            if deadline is not None and time.monotonic() > deadline:
+                return ops
+            if fails(cand):
+                # A single chunk restarts at granularity 2; a complement keeps n - 1.
+                ops, n = cand, 2 if i < len(chunks) else max(n - 1, 2)
+                break
+        else:
+            if n >= len(ops):
+                break
+            n = min(len(ops), 2 * n)
+    return ops
+
+# ── Checker self-test ──────────────────────────────────────────────────────────
+
+#
+# --fuzz generates histories whose verdict is known by construction and
+# checks that the checkers agree: linearizable executions (every op takes
+# effect at a random point of its interval) must pass every consistency
+# mode; each mutation below appends operations that no linearization can
+# explain, so linearizability (and the exact search) must fail.
+
+FUZZ_MUTATIONS = ("lost-write", "stale-read", "duplicated-effect", "phantom-read", "flip-flop")
+
+
+def fuzz_history(rng, clients: int = 3, keys: int = 2, ops_per_client: int = 12) -> list[Operation]:
+    """A random linearizable history of sequential clients over a few keys."""
+    planned = []
+    for c in range(1, clients + 1):
+        t = rng.randrange(0, 50)
+        for i in range(ops_per_client):
+            call = t + rng.randrange(1, 30)
+            ret = call + rng.randrange(1, 60)
+            point = rng.uniform(call, ret)
+            put = rng.random() < 0.5
+            # An ambiguous write may or may not have taken effect.
+            status = STATUS_OK if not put or rng.random() < 0.9 else STATUS_TIMEOUT
+            applied = status == STATUS_OK or rng.random() < 0.5
+            planned.append((point, applied, Operation(
+                client_id=c, op_type="Put" if put else "Get", key=str(rng.randrange(keys)),
+                write_val=f"c{c}-{i}" if put else None, call_ns=call, return_ns=ret,
+                result_val=None, status=status,
+            )))
+            t = ret
+    state: dict[str, Optional[Value]] = {}
+    ops = []
+    for _, applied, op in sorted(planned, key=lambda p: p[0]):
+        if op.op_type == "Put":
+            if applied:
+                state[op.key] = op.write_val
+        else:
+            op.result_val = state.get(op.key)
+        ops.append(op)
+    return sorted(ops, key=lambda o: o.call_ns)
+
+
+def mutate_history(ops: list[Operation], kind: str, rng) -> tuple[list[Operation], str]:
+    """Append a non-linearizable tail of the given FUZZ_MUTATIONS kind; returns (ops, key)."""
+    end = max(op.return_ns for op in ops) + 10
+    key = rng.choice(sorted({op.key for op in ops}))
+    old = next((op.write_val for op in ops if op.op_type == "Put" and op.key == key and not op.ambiguous),
+               "never-read")
+    def op(client, op_type, start, write=None, result=None):
+        return Operation(client_id=client, op_type=op_type, key=key, write_val=write,
+                         call_ns=end + start, return_ns=end + start + 5, result_val=result)
+    if kind == "lost-write":            # a committed write is not visible afterwards
+        tail = [op(90, "Put", 0, write="new"), op(91, "Get", 10)]
+    elif kind == "stale-read":          # a read returns a value overwritten before it began
+        tail = [op(90, "Put", 0, write="new"), op(91, "Get", 10, result=old)]
+        if old == "never-read":
+            tail.insert(0, op(90, "Put", -20, write=old))
+    elif kind == "duplicated-effect":   # an earlier write is applied a second time
+        tail = [op(90, "Put", 0, write="first"), op(90, "Put", 10, write="second"),
+                op(91, "Get", 20, result="second"), op(91, "Get", 30, result="first")]
+    elif kind == "flip-flop":           # reads each justified, but by two orders of the writes
+        tail = [op(90, "Put", 0, write="flip"), op(92, "Put", 0, write="flop"),
+                op(91, "Get", 10, result="flip"), op(91, "Get", 20, result="flop"),
+                op(91, "Get", 30, result="flip")]
+    else:                               # a read returns a value nobody wrote
+        tail = [op(91, "Get", 0, result="phantom")]
+    return ops + tail, key
+
+
+def run_fuzz(iterations: int, seed: int) -> int:
+    """
+    Run the self-test; prints each disagreement (and the first offending
+    valid history) and returns how many there were.
+    """
+    import random
+    rng = random.Random(seed)
+    failures = 0
+
+    def verdict(mode: str, ops: list[Operation]) -> bool:
+        params = {"bound_ns": 0} if mode == "bounded-staleness" else {}
+        return CONSISTENCY_CHECKERS[mode][1](ops, **params)[0]
+
+    for i in range(iterations):
+        ops = fuzz_history(rng, clients=rng.randrange(1, 5), keys=rng.randrange(1, 4),
+                           ops_per_client=rng.randrange(1, 20))
+        problems = []
+        for mode in sorted(CONSISTENCY_CHECKERS):
+            if not verdict(mode, ops):
+                problems.append(f"valid history rejected by {mode}")
+        for key, key_ops in partition_by_key(ops).items():
+            if linearize_key(key_ops) is None:
+                problems.append(f"no linearization found for valid key {key!r}")
+        if not check_linearizability(ops, epochs=True)[0]:
+            problems.append("valid history rejected by time epochs")
+        kind = rng.choice(FUZZ_MUTATIONS)
+        broken, key = mutate_history(ops, kind, rng)
+        if verdict("linearizable", broken):
+            problems.append(f"{kind} accepted as linearizable")
+        if check_linearizability(broken, epochs=True)[0]:
+            problems.append(f"{kind} accepted by time epochs")
+        if linearize_key(partition_by_key(broken)[key]) is not None:
+            problems.append(f"{kind} on key {key!r} has a linearization")
+        for problem in problems:
+            print(f"  ✗ iteration {i} (seed {seed}): {problem}")
+        if problems and not failures:
+            print(f"    history: {json.dumps([to_history_entry(op) for op in ops])}")
+        failures += len(problems)
+    return failures
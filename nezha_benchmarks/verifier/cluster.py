@@ -0,0 +1,851 @@
+"""
+Running the docker compose cluster: the runner, fault injection, replays,
+packet captures and health checks.
+"""
+
+from __future__ import annotations
+
+import json
+import os
+import pathlib
+import re
+import socket
+import subprocess
+import threading
+import time
+from collections import defaultdict
+from dataclasses import dataclass
+from typing import Optional
+
+from .common import KV_COMMANDS, Operation, STATUS_OK, STATUS_UNKNOWN, log, parse_duration_ns, utc_now
+from .history import plain_value
+
+# ── Helpers ────────────────────────────────────────────────────────────────────
+
+def detect_compose_cmd() -> list[str]:
+    for candidate in (["docker", "compose"], ["docker-compose"]):
+        try:
+            subprocess.run(candidate + ["version"], capture_output=True, check=True, timeout=5)
+            return candidate
+        except (subprocess.CalledProcessError, FileNotFoundError, subprocess.TimeoutExpired):
+            pass
+    raise RuntimeError("Neither 'docker compose' nor 'docker-compose' is available on PATH.")
+
+
+def compose_cmd(compose_file: pathlib.Path) -> list[str]:
+    return detect_compose_cmd() + ["-f", str(compose_file), "--project-directory", str(compose_file.parent)]
+
+# ── Docker compose runner ──────────────────────────────────────────────────────
+
+def run_compose(
+    compose_file: pathlib.Path, log_level: str, timeout: int, faults: Optional[list[Fault]] = None,
+    seed: Optional[int] = None, preflight: Optional[float] = None,
+) -> bool:
+    """
+    Start docker compose in detached mode, wait for client containers to exit,
+    then bring everything down. Returns True on clean completion. With
+    `faults`, a nemesis applies them meanwhile and the fault schedule is saved
+    to logs/events-nemesis.json. `seed` is handed to the clients as
+    OMNIPAXOS_SEED so the workload can be regenerated. With `preflight`, the
+    cluster gets that many seconds to come up healthy (see preflight_cluster)
+    or everything is brought down and ClusterUnhealthy raised.
+    """
+    compose_dir = compose_file.parent
+    logs_dir = compose_dir / "logs"
+    logs_dir.mkdir(exist_ok=True)
+
+    base = compose_cmd(compose_file)
+    env = {**os.environ, "RUST_LOG": log_level}
+    if seed is not None:
+        env["OMNIPAXOS_SEED"] = str(seed)
+
+    # Build images (only s1 has build: context, others share the image)
+    print("  Building images...")
+    result = subprocess.run(base + ["build"], env=env, cwd=str(compose_dir))
+    if result.returncode != 0:
+        log.warning(f"docker compose build failed (exit {result.returncode})")
+        return False
+
+    # Start detached
+    print("  Starting containers (detached)...")
+    subprocess.run(base + ["up", "-d"], env=env, cwd=str(compose_dir), check=True)
+    if preflight is not None:
+        try:
+            preflight_cluster(compose_file, preflight)
+        except ClusterUnhealthy:
+            subprocess.run(base + ["down"], cwd=str(compose_dir), timeout=60, check=False)
+            raise
+    nemesis = None
+    if faults:
+        nemesis = Nemesis(base, compose_dir, faults)
+        nemesis.start()
+
+    # Discover client container names from compose ps
+    client_containers = _find_client_containers(base, compose_dir)
+    if not client_containers:
+        log.warning("Could not identify client containers; falling back to names 'c1','c2'")
+        client_containers = ["c1", "c2"]
+
+    # Poll until all clients have exited
+    print(f"  Waiting for clients {client_containers} (timeout={timeout}s)...")
+    deadline = time.monotonic() + timeout
+    all_done = _wait_for_containers(client_containers, deadline)
+    if not all_done:
+        log.warning(f"Timeout reached; some clients may not have finished.")
+
+    if nemesis is not None:
+        nemesis.stop()
+        events_path = logs_dir / "events-nemesis.json"
+        with open(events_path, "w") as f:
+            json.dump(nemesis.events, f, indent=1)
+        print(f"  Nemesis events ({len(nemesis.events)}) saved → {events_path}")
+
+    # Bring everything down gracefully
+    print("  Stopping remaining containers...")
+    subprocess.run(base + ["down"], cwd=str(compose_dir), timeout=60, check=False)
+    return all_done
+
+# ── Nemesis (fault injection during a run) ─────────────────────────────────────
+
+# action → (fault event type, recovery event type)
+NEMESIS_ACTIONS = {
+    "pause": ("node_pause", "node_resume"),
+    "kill": ("node_kill", "node_restart"),
+    "isolate": ("partition", "heal"),
+    "delay": ("delay", "delay_end"),
+}
+
+
+@dataclass
+class Fault:
+    """One scheduled fault: `action` on compose `service` from `start_s` for `duration_s`."""
+    action: str
+    service: str
+    start_s: float
+    duration_s: Optional[float] = None
+    arg: str = ""
+
+
+def parse_nemesis(spec: str) -> list[Fault]:
+    """
+    Parse a --nemesis schedule: comma-separated ACTION:SERVICE@START[+DURATION],
+    e.g. "pause:s2@5s+3s,kill:s3@10s,delay=50ms:s1@2s+5s". Times are durations
+    since the containers started; without +DURATION the fault is never undone.
+    """
+    faults = []
+    for item in filter(None, (x.strip() for x in spec.split(","))):
+        try:
+            action, rest = item.split(":", 1)
+            service, when = rest.split("@", 1)
+            start, _, duration = when.partition("+")
+        except ValueError:
+            raise ValueError(f"{item!r}: expected ACTION:SERVICE@START[+DURATION]") from None
+        action, _, arg = action.partition("=")
+        if action not in NEMESIS_ACTIONS:
+            raise ValueError(f"{item!r}: unknown action {action!r} (one of {', '.join(NEMESIS_ACTIONS)})")
+        if action == "delay" and not arg:
+            raise ValueError(f"{item!r}: delay needs a latency, e.g. delay=50ms")
+        faults.append(Fault(
+            action=action,
+            service=service,
+            start_s=parse_duration_ns(start) / 1e9,
+            duration_s=parse_duration_ns(duration) / 1e9 if duration else None,
+            arg=arg,
+        ))
+    return sorted(faults, key=lambda f: f.start_s)
+
+
+def _service_container(base: list[str], cwd: pathlib.Path, service: str) -> str:
+    result = subprocess.run(base + ["ps", "-q", service], capture_output=True, text=True,
+                            timeout=10, cwd=str(cwd))
+    return result.stdout.strip().splitlines()[0] if result.stdout.strip() else service
+
+
+def _service_network(container: str) -> str:
+    result = subprocess.run(
+        ["docker", "inspect", "--format",
+         "{{range $k, $v := .NetworkSettings.Networks}}{{$k}} {{end}}", container],
+        capture_output=True, text=True, timeout=5,
+    )
+    return result.stdout.split()[0] if result.stdout.split() else ""
+
+
+def _fault_commands(
+    base: list[str], cwd: pathlib.Path, fault: Fault
+) -> tuple[list[str], list[str]]:
+    """The (inject, recover) commands for a fault."""
+    svc = fault.service
+    if fault.action == "pause":
+        return base + ["pause", svc], base + ["unpause", svc]
+    if fault.action == "kill":
+        return base + ["kill", svc], base + ["start", svc]
+    if fault.action == "delay":
+        # Needs `tc` in the image and NET_ADMIN on the container.
+        tc = base + ["exec", "-T", svc, "tc", "qdisc"]
+        return (tc + ["add", "dev", "eth0", "root", "netem", "delay", fault.arg],
+                tc + ["del", "dev", "eth0", "root"])
+    container = _service_container(base, cwd, svc)
+    network = _service_network(container)
+    return (["docker", "network", "disconnect", network, container],
+            ["docker", "network", "connect", "--alias", svc, network, container])
+
+
+def _node_id(service: str) -> Optional[int]:
+    digits = service.lstrip("s")
+    return int(digits) if service.startswith("s") and digits.isdigit() else None
+
+
+class Nemesis(threading.Thread):
+    """
+    Applies a fault schedule to a running compose project and records every
+    injection/recovery as an event (wall-clock ns, the clients' history clock).
+    """
+
+    def __init__(self, base: list[str], cwd: pathlib.Path, faults: list[Fault]) -> None:
+        super().__init__(daemon=True)
+        self.base, self.cwd, self.faults = base, cwd, faults
+        self.events: list[dict] = []
+        self._done = threading.Event()
+
+    def _apply(self, cmd: list[str], fault: Fault, kind: str) -> None:
+        result = subprocess.run(cmd, capture_output=True, text=True, cwd=str(self.cwd), timeout=30)
+        if result.returncode != 0:
+            log.warning(f"nemesis: {' '.join(cmd[-4:])} failed: {result.stderr.strip()}")
+            return
+        event = {"time": time.time_ns(), "type": kind, "detail": fault.service}
+        if fault.arg:
+            event["detail"] += f" {fault.arg}"
+        node = _node_id(fault.service)
+        if node is not None:
+            event["node"] = node
+        self.events.append(event)
+        print(f"  nemesis: {kind} {event['detail']}")
+
+    def run(self) -> None:
+        start = time.monotonic()
+        # (due time, command, fault, event type), recoveries interleaved by time
+        steps = []
+        for fault in self.faults:
+            inject, recover = _fault_commands(self.base, self.cwd, fault)
+            on, off = NEMESIS_ACTIONS[fault.action]
+            steps.append((fault.start_s, inject, fault, on))
+            if fault.duration_s is not None:
+                steps.append((fault.start_s + fault.duration_s, recover, fault, off))
+        for due, cmd, fault, kind in sorted(steps, key=lambda s: s[0]):
+            if self._done.wait(max(0.0, start + due - time.monotonic())):
+                return
+            self._apply(cmd, fault, kind)
+
+    def stop(self) -> None:
+        self._done.set()
+        self.join(timeout=60)
+
+
+def _find_client_containers(base: list[str], cwd: pathlib.Path) -> list[str]:
+    """Return the names of containers whose service starts with 'c' (clients)."""
+    try:
+        result = subprocess.run(
+            base + ["ps", "--format", "json"],
+            capture_output=True, text=True, timeout=10, cwd=str(cwd)
+        )
+        names = []
+        for line in result.stdout.strip().splitlines():
+            line = line.strip()
+            if not line:
+                continue
+            try:
+                obj = json.loads(line)
+                svc = obj.get("Service", obj.get("Name", ""))
+                name = obj.get("Name", obj.get("ID", svc))
+                if svc.startswith("c") and svc[1:].isdigit():
+                    names.append(name)
+            except json.JSONDecodeError:
+                pass
+        return names
+    except Exception:
+        return []
+
+
+def _wait_for_containers(names: list[str], deadline: float) -> bool:
+    """Poll until all named containers report 'exited' status (or timeout)."""
+    while time.monotonic() < deadline:
+        time.sleep(3)
+        if all(_container_exited(n) for n in names):
+            return True
+    return all(_container_exited(n) for n in names)
+
+
+def _container_exited(name: str) -> bool:
+    try:
+        result = subprocess.run(
+            ["docker", "inspect", "--format", "{{.State.Status}}", name],
+            capture_output=True, text=True, timeout=5
+        )
+        return result.stdout.strip() == "exited"
+    except Exception:
+        return False
+
+# ── Packet capture import ──────────────────────────────────────────────────────
+
+#
+# Client↔proxy frames are 4-byte big-endian length-prefixed bincode (1.x
+# defaults: little-endian fixed-width ints, u32 enum tags, u64 string
+# lengths): the client's first frame is RegistrationMessage::ClientRegister,
+# then ClientMessage::Append(CommandId, KVCommand) frames; replies are
+# ServerMessage::Write(CommandId) or ::Read(CommandId, Option<String>).
+
+PCAP_MAGIC = {
+    b"\xd4\xc3\xb2\xa1": ("<", 1_000), b"\xa1\xb2\xc3\xd4": (">", 1_000),   # µs timestamps
+    b"\x4d\x3c\xb2\xa1": ("<", 1), b"\xa1\xb2\x3c\x4d": (">", 1),           # ns timestamps
+}
+DEFAULT_PROXY_PORT = 9000
+
+
+def read_pcap(path: pathlib.Path):
+    """Yield (time_ns, src, sport, dst, dport, seq, payload) for TCP segments."""
+    import struct
+    with open(path, "rb") as f:
+        header = f.read(24)
+        if header[:4] not in PCAP_MAGIC:
+            raise ValueError("not a classic pcap file (convert pcapng with: editcap -F pcap)")
+        endian, ts_scale = PCAP_MAGIC[header[:4]]
+        linktype = struct.unpack(endian + "I", header[20:24])[0]
+        while True:
+            rec = f.read(16)
+            if len(rec) < 16:
+                return
+            sec, frac, caplen, _ = struct.unpack(endian + "IIII", rec)
+            data = f.read(caplen)
+            if linktype == 1:                                   # Ethernet
+                off, proto = 14, data[12:14]
+                while proto == b"\x81\x00":                      # 802.1Q tags
+                    off, proto = off + 4, data[off + 2:off + 4]
+            elif linktype == 113:                               # Linux cooked (any)
+                off, proto = 16, data[14:16]
+            elif linktype == 276:                               # Linux cooked v2
+                off, proto = 20, data[0:2]
+            elif linktype in (0, 108):                          # BSD loopback
+                off, proto = 4, b"\x86\xdd" if data[0] in (24, 28, 30) or data[3] in (24, 28, 30) else b"\x08\x00"
+            elif linktype in (12, 101):                         # raw IP
+                off, proto = 0, b"\x86\xdd" if data[0] >> 4 == 6 else b"\x08\x00"
+            else:
+                raise ValueError(f"unsupported pcap link type {linktype}")
+            if proto == b"\x08\x00":
+                ihl = (data[off] & 0x0F) * 4
+                if data[off + 9] != 6:
+                    continue
+                total = struct.unpack(">H", data[off + 2:off + 4])[0]
+                src, dst = data[off + 12:off + 16], data[off + 16:off + 20]
+                tcp, end = off + ihl, off + total
+            elif proto == b"\x86\xdd":
+                if data[off + 6] != 6:                          # no extension headers
+                    continue
+                src, dst = data[off + 8:off + 24], data[off + 24:off + 40]
+                tcp = off + 40
+                end = tcp + struct.unpack(">H", data[off + 4:off + 6])[0]
+            else:
+                continue
+            sport, dport, seq = struct.unpack(">HHI", data[tcp:tcp + 8])
+            payload = data[tcp + (data[tcp + 12] >> 4) * 4:end]
+            yield sec * 1_000_000_000 + frac * ts_scale, src, sport, dst, dport, seq, payload
+
+
+def _reassemble(segments: list[tuple[int, int, bytes]]) -> tuple[bytes, list[tuple[int, int]]]:
+    """
+    One direction of a TCP stream from (time_ns, seq, payload) segments, in
+    capture order: the bytes, and (end offset, time_ns) marks giving when
+    each byte was first seen. Retransmitted bytes keep their first time.
+    """
+    data = bytearray()
+    marks: list[tuple[int, int]] = []
+    if not segments:
+        return bytes(data), marks
+    base = segments[0][1]
+    pending: dict[int, tuple[int, bytes]] = {}
+    for t, seq, payload in segments:
+        rel = (seq - base) % 2**32
+        if rel + len(payload) > len(data):
+            pending[rel] = (t, payload)
+        while True:
+            nxt = next((r for r in pending if r <= len(data)), None)
+            if nxt is None:
+                break
+            t0, chunk = pending.pop(nxt)
+            fresh = chunk[len(data) - nxt:]
+            if fresh:
+                data += fresh
+                marks.append((len(data), max(t, t0)))
+    return bytes(data), marks
+
+
+class _Bincode:
+    """Reader for bincode 1.x default-encoded values."""
+
+    def __init__(self, buf: bytes) -> None:
+        self.buf, self.pos = buf, 0
+
+    def _take(self, n: int) -> bytes:
+        if self.pos + n > len(self.buf):
+            raise ValueError("truncated frame")
+        self.pos += n
+        return self.buf[self.pos - n:self.pos]
+
+    def u8(self) -> int:
+        return self._take(1)[0]
+
+    def u32(self) -> int:
+        return int.from_bytes(self._take(4), "little")
+
+    def u64(self) -> int:
+        return int.from_bytes(self._take(8), "little")
+
+    def string(self) -> str:
+        return self._take(self.u64()).decode()
+
+    def option_string(self) -> Optional[str]:
+        return self.string() if self.u8() else None
+
+
+def _frames(data: bytes, marks: list[tuple[int, int]]):
+    """Yield (time_ns, frame) for each complete length-delimited frame."""
+    pos, mi = 0, 0
+    while pos + 4 <= len(data):
+        end = pos + 4 + int.from_bytes(data[pos:pos + 4], "big")
+        if end > len(data):
+            return
+        while marks[mi][0] < end:
+            mi += 1
+        yield marks[mi][1], data[pos + 4:end]
+        pos = end
+
+
+def history_from_pcap(path: pathlib.Path, port: int = DEFAULT_PROXY_PORT) -> tuple[dict[int, list[dict]], list[str]]:
+    """
+    Rebuild per-client histories from a capture of client connections to
+    `port`: {client number (connections in order of first packet): records},
+    plus warnings. Call/return times are when the last byte of the request
+    and of its reply crossed the capture point. Requests without a reply
+    get status "unknown" and the capture's end as their return time.
+    """
+    streams: dict[tuple, dict[str, list]] = {}
+    last_ns = 0
+    for t, src, sport, dst, dport, seq, payload in read_pcap(path):
+        last_ns = max(last_ns, t)
+        if dport == port:
+            conn, direction = (src, sport, dst), "req"
+        elif sport == port:
+            conn, direction = (dst, dport, src), "rep"
+        else:
+            continue
+        streams.setdefault(conn, {"req": [], "rep": []})
+        if payload:
+            streams[conn][direction].append((t, seq, payload))
+
+    histories: dict[int, list[dict]] = {}
+    warnings: list[str] = []
+    for conn_no, (conn, dirs) in enumerate(streams.items(), start=1):
+        calls: dict[int, dict] = {}
+        entries: list[dict] = []
+        try:
+            reqs = list(_frames(*_reassemble(dirs["req"])))
+            if reqs and len(reqs[0][1]) == 4:
+                reqs = reqs[1:]                             # RegistrationMessage::ClientRegister
+            for t, frame in reqs:
+                r = _Bincode(frame)
+                if r.u32() != 0:
+                    raise ValueError("unexpected client message")
+                cmd_id = r.u64()
+                op = KV_COMMANDS[r.u32()]
+                key = r.string()
+                entry = {"client_id": conn_no, "input": {"type": op, "key": key}, "call": t,
+                         "output": {"status": STATUS_UNKNOWN}, "return_time": last_ns, "op_id": f"{conn_no}:{cmd_id}"}
+                if op == "Put":
+                    entry["input"]["value"] = r.string()
+                calls[cmd_id] = entry
+                entries.append(entry)
+            for t, frame in _frames(*_reassemble(dirs["rep"])):
+                r = _Bincode(frame)
+                tag = r.u32()
+                if tag not in (0, 1):                           # StartSignal
+                    continue
+                entry = calls.pop(r.u64(), None)
+                if entry is None:
+                    continue
+                entry["output"] = {"status": STATUS_OK}
+                entry["return_time"] = t
+                if tag == 1:
+                    value = r.option_string()
+                    if value is not None:
+                        entry["output"]["value"] = value
+        except (ValueError, IndexError, UnicodeDecodeError) as ex:
+            warnings.append(f"connection {conn_no} (port {conn[1]}): undecodable after "
+                            f"{len(entries)} request(s): {ex}")
+        deletes = [e for e in entries if e["input"]["type"] == "Delete"]
+        if deletes:
+            warnings.append(f"connection {conn_no}: dropped {len(deletes)} Delete(s), which "
+                            f"histories cannot express")
+        if entries:
+            histories[conn_no] = [e for e in entries if e["input"]["type"] != "Delete"]
+    return histories, warnings
+
+# ── Replay against a live cluster ──────────────────────────────────────────────
+
+def _encode_frame(body: bytes) -> bytes:
+    return len(body).to_bytes(4, "big") + body
+
+
+def _encode_string(text: str) -> bytes:
+    raw = text.encode()
+    return len(raw).to_bytes(8, "little") + raw
+
+
+def _encode_append(cmd_id: int, op: Operation) -> bytes:
+    """ClientMessage::Append(cmd_id, KVCommand::Put/Get) as a frame."""
+    body = (0).to_bytes(4, "little") + cmd_id.to_bytes(8, "little")
+    body += KV_COMMANDS.index(op.op_type).to_bytes(4, "little") + _encode_string(op.key)
+    if op.op_type == "Put":
+        value = op.write_val
+        body += _encode_string(value if isinstance(value, str) else json.dumps(plain_value(value)))
+    return _encode_frame(body)
+
+
+def _replay_client(sock, ops: list[Operation], timed: bool, drain_s: float, out: list[dict]) -> None:
+    """
+    Issue one client's operations over its own proxy connection, in their
+    original call order: pipelined at their original offsets from its first
+    call when `timed`, otherwise each after the previous reply. Records go
+    to `out`.
+    """
+    sock.sendall(_encode_frame((1).to_bytes(4, "little")))     # RegistrationMessage::ClientRegister
+    entries: dict[int, dict] = {}
+    answered = threading.Condition()
+
+    def reader() -> None:
+        buf = b""
+        while True:
+            try:
+                chunk = sock.recv(65536)
+            except OSError:
+                return
+            if not chunk:
+                return
+            buf += chunk
+            while len(buf) >= 4 and len(buf) >= 4 + int.from_bytes(buf[:4], "big"):
+                end = 4 + int.from_bytes(buf[:4], "big")
+                r, buf = _Bincode(buf[4:end]), buf[end:]
+                tag = r.u32()
+                if tag not in (0, 1):
+                    continue
+                now = time.time_ns()
+                with answered:
+                    entry = entries.get(r.u64())
+                    if entry is None or entry["output"]["status"] != STATUS_UNKNOWN:
+                        continue
+                    entry["output"] = {"status": STATUS_OK}
+                    entry["return_time"] = now
+                    if tag == 1:
+                        value = r.option_string()
+                        if value is not None:
+                            entry["output"]["value"] = value
+                    answered.notify_all()
+
+    threading.Thread(target=reader, daemon=True).start()
+    first_call = ops[0].call_ns if ops else 0
+    t0 = time.time_ns()
+    for cmd_id, op in enumerate(ops):
+        if timed:
+            delay = (op.call_ns - first_call - (time.time_ns() - t0)) / 1e9
+            if delay > 0:
+                time.sleep(delay)
+        entry = {"client_id": op.client_id, "input": {"type": op.op_type, "key": op.key},
+                 "call": time.time_ns(), "output": {"status": STATUS_UNKNOWN}, "return_time": 0}
+        if op.op_type == "Put":
+            entry["input"]["value"] = plain_value(op.write_val)
+        with answered:
+            entries[cmd_id] = entry
+        sock.sendall(_encode_append(cmd_id, op))
+        if not timed:
+            with answered:
+                answered.wait_for(lambda: entry["output"]["status"] != STATUS_UNKNOWN, timeout=drain_s)
+    deadline = time.monotonic() + drain_s
+    with answered:
+        while any(e["output"]["status"] == STATUS_UNKNOWN for e in entries.values()):
+            if not answered.wait(max(0.0, deadline - time.monotonic())):
+                break
+        saved = time.time_ns()
+        for entry in entries.values():
+            if entry["output"]["status"] == STATUS_UNKNOWN:
+                entry["return_time"] = saved
+        out.extend(entries.values())
+    sock.close()
+
+
+def replay_history(
+    ops: list[Operation], address: tuple[str, int], timed: bool = False, drain_s: float = 5.0
+) -> dict[int, list[dict]]:
+    """
+    Re-issue a recorded history against a proxy, one connection per original
+    client, and return the fresh per-client records (see _replay_client).
+    Requests unanswered `drain_s` after the last send are left "unknown".
+    """
+    per_client: dict[int, list[Operation]] = defaultdict(list)
+    for op in sorted(ops, key=lambda o: o.call_ns):
+        per_client[op.client_id].append(op)
+    import socket
+    results: dict[int, list[dict]] = {c: [] for c in per_client}
+    threads = []
+    for c, c_ops in per_client.items():
+        sock = socket.create_connection(address)
+        sock.setsockopt(socket.IPPROTO_TCP, socket.TCP_NODELAY, 1)
+        threads.append(threading.Thread(target=_replay_client, args=(sock, c_ops, timed, drain_s, results[c])))
+    for t in threads:
+        t.start()
+    for t in threads:
+        t.join()
+    return results
+
+# ── Cluster health ─────────────────────────────────────────────────────────────
+
+PROBE_TIMEOUT_S = 5.0
+DEFAULT_NODE_PORT = 8000
+# "<server id>: Leader fully initialized", after docker compose logs --timestamps.
+LEADER_LOG = re.compile(r"\s(\d{4}-\d\d-\d\dT\S+)\s.*?\b(\d+): Leader fully initialized")
+
+
+class ClusterUnhealthy(Exception):
+    """A run's cluster failed its pre-flight check; `report` says why."""
+
+    def __init__(self, message: str, report: dict) -> None:
+        super().__init__(message)
+        self.report = report
+
+
+@dataclass
+class ClusterMember:
+    name: str                       # compose service, or the address given
+    role: str                       # "node" or "proxy"
+    port: int
+    host: Optional[str] = None      # None until resolved
+    node_id: Optional[int] = None
+    container: Optional[str] = None
+    state: Optional[str] = None     # container state, for compose services
+
+
+def _compose_server_id(compose_dir: pathlib.Path, name: str, service: dict) -> Optional[int]:
+    """server_id of the server config a service mounts, else the digits of its name."""
+    for volume in service.get("volumes", []):
+        if isinstance(volume, dict) and volume.get("target") == "/app/server-config.toml":
+            import tomllib
+            try:
+                return tomllib.loads((compose_dir / volume["source"]).read_text()).get("server_id")
+            except (OSError, ValueError):
+                break
+    digits = "".join(ch for ch in name if ch.isdigit())
+    return int(digits) if digits else None
+
+
+def compose_members(compose_file: pathlib.Path) -> list[ClusterMember]:
+    """
+    The server and proxy services of a compose file (by their image), with
+    their listen port, server id and, when up, container and its address.
+    """
+    base, cwd = compose_cmd(compose_file), str(compose_file.parent)
+    result = subprocess.run(base + ["config", "--format", "json"], capture_output=True, text=True,
+                            timeout=30, cwd=cwd)
+    if result.returncode != 0:
+        raise RuntimeError(f"docker compose config failed: {result.stderr.strip()}")
+    members = []
+    services = json.loads(result.stdout).get("services", {})
+    for name, service in sorted(services.items(), key=lambda kv: ("proxy" in kv[1].get("image", ""), kv[0])):
+        image, env = service.get("image", ""), service.get("environment") or {}
+        if "proxy" in image:
+            members.append(ClusterMember(
+                name, "proxy", int(env.get("OMNIPAXOS_PROXY_LISTEN_PORT") or DEFAULT_PROXY_PORT)))
+        elif "server" in image:
+            members.append(ClusterMember(
+                name, "node", int(env.get("OMNIPAXOS_LISTEN_PORT") or DEFAULT_NODE_PORT),
+                node_id=_compose_server_id(compose_file.parent, name, service)))
+    result = subprocess.run(base + ["ps", "--all", "--format", "json"], capture_output=True, text=True,
+                            timeout=10, cwd=cwd)
+    out = result.stdout.strip()
+    # docker compose prints one object per line, older versions one array.
+    containers = json.loads(out) if out.startswith("[") else [json.loads(l) for l in out.splitlines() if l.strip()]
+    by_service = {c.get("Service"): c for c in containers}
+    for m in members:
+        container = by_service.get(m.name)
+        if container is None:
+            continue
+        m.container, m.state = container.get("Name"), container.get("State")
+        inspect = subprocess.run(
+            ["docker", "inspect", "--format", "{{range .NetworkSettings.Networks}}{{.IPAddress}} {{end}}",
+             m.container], capture_output=True, text=True, timeout=5)
+        addresses = inspect.stdout.split()
+        m.host = addresses[0] if addresses else None
+    return members
+
+
+def compose_leader(compose_file: pathlib.Path, members: list[ClusterMember]) -> Optional[int]:
+    """The id of the last server to log that it became leader, if any did."""
+    services = [m.name for m in members if m.role == "node"]
+    result = subprocess.run(compose_cmd(compose_file) + ["logs", "--no-color", "--timestamps"] + services,
+                            capture_output=True, text=True, timeout=30, cwd=str(compose_file.parent))
+    latest = max((m.groups() for m in LEADER_LOG.finditer(result.stdout)), default=None)
+    return int(latest[1]) if latest else None
+
+
+def probe_connect(host: str, port: int) -> tuple[Optional[float], Optional[str]]:
+    """Open and close a TCP connection: (milliseconds taken, None) or (None, error)."""
+    started = time.monotonic()
+    try:
+        socket.create_connection((host, port), timeout=PROBE_TIMEOUT_S).close()
+    except OSError as ex:
+        return None, str(ex) or type(ex).__name__
+    return round((time.monotonic() - started) * 1000, 2), None
+
+
+def _read_reply(reader, cmd_id: int) -> Optional[str]:
+    """Read frames until the reply to `cmd_id`: its value for a Read, None for a Write."""
+    while True:
+        header = reader.read(4)
+        if len(header) < 4:
+            raise ConnectionError("the proxy closed the connection")
+        body = reader.read(int.from_bytes(header, "big"))
+        r = _Bincode(body)
+        tag = r.u32()
+        if tag in (0, 1) and r.u64() == cmd_id:
+            return r.option_string() if tag == 1 else None
+
+
+def probe_round_trip(host: str, port: int) -> dict:
+    """
+    Put a fresh key through the proxy and Get it back, as a client would:
+    {"ok", "put_ms", "get_ms", "error"}.
+    """
+    key = f"__health-{os.getpid()}-{time.time_ns()}"
+    out: dict = {"ok": False, "key": key, "put_ms": None, "get_ms": None, "error": None}
+    ops = (Operation(0, "Put", key, key, 0, 0, None), Operation(0, "Get", key, None, 0, 0, None))
+    try:
+        with socket.create_connection((host, port), timeout=PROBE_TIMEOUT_S) as sock:
+            sock.settimeout(PROBE_TIMEOUT_S)
+            sock.sendall(_encode_frame((1).to_bytes(4, "little")))     # RegistrationMessage::ClientRegister
+            reader = sock.makefile("rb")
+            for cmd_id, op in enumerate(ops):
+                started = time.monotonic()
+                sock.sendall(_encode_append(cmd_id, op))
+                try:
+                    value = _read_reply(reader, cmd_id)
+                except socket.timeout:
+                    out["error"] = (f"no reply to the {op.op_type} within {PROBE_TIMEOUT_S:g}s "
+                                    "(no leader, or no quorum reachable?)")
+                    return out
+                out[f"{op.op_type.lower()}_ms"] = round((time.monotonic() - started) * 1000, 2)
+                if op.op_type == "Get" and value != key:
+                    out["error"] = f"Get returned {value!r} right after Put({key!r}) was acknowledged"
+                    return out
+    except (OSError, ValueError) as ex:
+        out["error"] = str(ex) or type(ex).__name__
+        return out
+    out["ok"] = True
+    return out
+
+
+def cluster_health(name: str, members: list[ClusterMember], leader: Optional[int], logs_read: bool) -> dict:
+    """
+    Probe `members` and report: per member whether it is running and accepts
+    connections, the leader (when the servers' logs were read), and a put/get
+    round trip through the proxy; "problems" lists what is wrong, if anything.
+    """
+    problems, entries = [], []
+    for m in members:
+        entry = {"name": m.name, "role": m.role, "node_id": m.node_id, "container": m.container,
+                 "state": m.state, "address": f"{m.host}:{m.port}" if m.host else None,
+                 "reachable": False, "connect_ms": None, "error": None}
+        if m.container is not None and m.state != "running":
+            entry["error"] = f"container is {m.state}"
+        elif m.host is None:
+            entry["error"] = "not started" if m.container is None else "no address on any network"
+        else:
+            entry["connect_ms"], entry["error"] = probe_connect(m.host, m.port)
+            entry["reachable"] = entry["error"] is None
+        if entry["error"]:
+            problems.append(f"{m.role} {m.name}: {entry['error']}")
+        entries.append(entry)
+    if logs_read and leader is None:
+        problems.append("no leader: no node has logged 'Leader fully initialized' (RUST_LOG below info?)")
+    proxy = next((m for m in members if m.role == "proxy"), None)
+    round_trip = None
+    if proxy is not None and proxy.host is not None and not any(
+            e["error"] for e in entries if e["name"] == proxy.name):
+        round_trip = probe_round_trip(proxy.host, proxy.port)
+        if not round_trip["ok"]:
+            problems.append(f"round trip through {proxy.name}: {round_trip['error']}")
+    return {"config": name, "checked_at": utc_now(), "healthy": not problems,
+            "members": entries, "leader": leader, "round_trip": round_trip, "problems": problems}
+
+
+def print_cluster_health(report: dict) -> None:
+    mark = "✓" if report["healthy"] else "✗"
+    print(f"  {mark} {report['config']}: cluster {'healthy' if report['healthy'] else 'unhealthy'}")
+    for e in report["members"]:
+        where = "" if e["address"] == e["name"] else e["address"] or "-"
+        status = f"✓ {e['connect_ms']:g} ms" if e["reachable"] else f"✗ {e['error']}"
+        label = e["name"] + (f" (node {e['node_id']})" if e["node_id"] is not None else "")
+        print(f"      {e['role']:<5s} {label:<18s} {where:<22s} {status}")
+    if report["leader"] is not None:
+        print(f"      leader: node {report['leader']}")
+    rt = report["round_trip"]
+    if rt is None:
+        print("      round trip: skipped (no reachable proxy)")
+    elif rt["ok"]:
+        print(f"      round trip: ✓ put {rt['put_ms']:g} ms, get {rt['get_ms']:g} ms")
+    for problem in report["problems"]:
+        print(f"  ⚠  {problem}")
+
+
+def preflight_cluster(compose_file: pathlib.Path, wait_s: float) -> dict:
+    """
+    Wait up to `wait_s` for a started run's nodes and proxy to be running and
+    a leader to be elected, without touching them (see "Cluster health" in
+    CHECKER.md): clients are waiting for the start signal meanwhile. Saves the final
+    report to logs/cluster-health.json; raises ClusterUnhealthy on failure,
+    at once if a server or the proxy exits.
+    """
+    deadline = time.monotonic() + wait_s
+    print(f"  Pre-flight: waiting up to {wait_s:g}s for the nodes, the proxy and a leader...")
+    while True:
+        members = compose_members(compose_file)
+        leader = compose_leader(compose_file, members)
+        problems = [f"{m.role} {m.name}: " + (f"container is {m.state}" if m.container else "not started")
+                    for m in members if m.state != "running"]
+        if leader is None:
+            problems.append("no leader elected")
+        exited = [m for m in members if m.state in ("exited", "dead")]
+        if not problems or exited or time.monotonic() >= deadline:
+            break
+        time.sleep(1)
+    report = {"config": compose_file.parent.name, "checked_at": utc_now(),
+              "healthy": not problems, "leader": leader, "problems": problems,
+              "members": [{"name": m.name, "role": m.role, "node_id": m.node_id, "container": m.container,
+                           "state": m.state} for m in members]}
+    with open(compose_file.parent / "logs" / "cluster-health.json", "w") as f:
+        json.dump(report, f, indent=1)
+    if problems:
+        for m in exited:
+            tail = subprocess.run(compose_cmd(compose_file) + ["logs", "--no-color", "--tail", "10", m.name],
+                                  capture_output=True, text=True, timeout=30, cwd=str(compose_file.parent))
+            print(f"  Last log lines of {m.name}:")
+            for line in tail.stdout.splitlines():
+                print(f"      {line}")
+        raise ClusterUnhealthy("; ".join(problems), report)
+    print(f"  ✓ Pre-flight: {len(members)} container(s) running, leader node {leader}")
+    return report
+
+# ── Benchmark configs ──────────────────────────────────────────────────────────
+
+# Config files (globs in a benchmark folder) each scenario override applies to.
+SCENARIO_CONFIGS = {
+    "cluster": "cluster-config.toml",
+    "servers": "server-*-config.toml",
+    "proxy": "proxy-config.toml",
+    "clients": "client-*-config.toml",
+}
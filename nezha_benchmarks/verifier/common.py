@@ -0,0 +1,435 @@
+"""
+Data structures, logging, time and memory budgets and small helpers shared
+by the checker modules.
+"""
+
+from __future__ import annotations
+
+import contextvars
+import json
+import logging
+import os
+import pathlib
+import sys
+import time
+import webbrowser
+from dataclasses import dataclass, field
+from typing import Optional, Union
+
+# Default time budget for a single consistency check (seconds).
+DEFAULT_CHECK_TIMEOUT_S = 30
+DEFAULT_SNAPSHOT_WINDOW_NS = 1_000_000_000
+
+# Exit codes (see "Exit codes" in CHECKER.md).
+EXIT_OK = 0
+EXIT_VIOLATION = 1
+EXIT_UNKNOWN = 2
+EXIT_INPUT = 3
+EXIT_INTERNAL = 4
+EXIT_UNHEALTHY = 5
+
+# ── Data structures ────────────────────────────────────────────────────────────
+
+@dataclass(frozen=True)
+class JsonValue:
+    """A JSON object/array/bool value in canonical form: hashable, deep equality."""
+    text: str
+
+    def __repr__(self) -> str:
+        return self.text
+
+
+# Values are strings for omnipaxos-kv; other JSON scalars and documents are
+# accepted so foreign histories can be checked too.
+Value = Union[str, int, float, JsonValue]
+
+# Operation outcomes recorded in output.status (or a top-level `outcome`).
+# `ok` and `not_found` are definite; an `error`, `timeout` or `unknown` write
+# may or may not have taken effect, and such a read observed nothing. The
+# client records requests still unanswered at the end of a run as `unknown`.
+STATUS_OK = "ok"
+STATUS_NOT_FOUND = "not_found"
+STATUS_ERROR = "error"
+STATUS_TIMEOUT = "timeout"
+STATUS_UNKNOWN = "unknown"
+STATUS_INFO = "info"    # Jepsen/Porcupine's name for an unknown outcome
+STATUS_FAIL = "fail"    # definitely not applied
+DEFINITE_STATUSES = {STATUS_OK, STATUS_NOT_FOUND}
+STATUSES = DEFINITE_STATUSES | {STATUS_ERROR, STATUS_TIMEOUT, STATUS_UNKNOWN, STATUS_INFO, STATUS_FAIL}
+
+
+@dataclass(slots=True)
+class Operation:
+    client_id: int
+    op_type: str
+    key: str
+    write_val: Optional[Value]
+    call_ns: int
+    return_ns: int
+    result_val: Optional[Value]
+    status: str = STATUS_OK
+    op_id: Optional[str] = None
+    request_id: Optional[str] = None  # idempotency token shared by a client's retries
+    idempotent: bool = False        # the server deduplicates attempts sharing request_id
+    node: Optional[int] = None      # replica that served the request, if recorded
+    shard: Optional[str] = None     # OmniPaxos group that owns the key, if recorded
+    term: Optional[int] = None      # leader term (epoch) the request was served in
+    read_mode: Optional[str] = None # read path of a Get (e.g. leader, quorum, lease)
+    # Free-form "meta" object of the record, passed through unchecked.
+    meta: Optional[dict] = field(default=None, compare=False)
+    # History file and record index it was loaded from (not part of its identity).
+    source: Optional[tuple[str, int]] = field(default=None, compare=False)
+
+    @property
+    def ambiguous(self) -> bool:
+        """True if the outcome is unknown (the op may or may not have applied)."""
+        return self.status not in DEFINITE_STATUSES
+
+    @property
+    def failed(self) -> bool:
+        """True if the op definitely did not apply (and returned nothing)."""
+        return self.status == STATUS_FAIL
+
+
+@dataclass
+class Event:
+    """A fault/cluster event (node kill, partition, leader change) on the history's clock."""
+    time_ns: int
+    kind: str
+    node: Optional[int] = None
+    detail: str = ""
+    term: Optional[int] = None      # leader term starting at this event, if any
+
+
+@dataclass
+class LoadOptions:
+    """How history files are found, parsed and aligned."""
+    strict: bool = False
+    include: Optional[list[str]] = None
+    exclude: tuple[str, ...] = ()
+    sequential_clients: bool = False
+    namespace_clients: bool = False
+    time_offsets: tuple[tuple[str, int], ...] = ()   # (file glob, ns)
+    align_marker: Optional[str] = None
+    time_unit: str = "auto"
+    skip_invalid: bool = False
+    csv_columns: Optional[dict[str, str]] = None
+    field_map: Optional[dict] = None    # see parse_field_map
+    decided_logs: tuple[str, ...] = ()
+    state_snapshots: tuple[str, ...] = ()
+    request_logs: tuple[str, ...] = ()
+
+
+@dataclass
+class SelectOptions:
+    """Which operations of a loaded history are checked."""
+    keys: Optional[set[str]] = None
+    clients: Optional[set[int]] = None
+    from_ns: Optional[int] = None       # offsets from the first call
+    to_ns: Optional[int] = None
+    limit: Optional[int] = None
+
+
+@dataclass
+class ReportOptions:
+    """What is printed and saved besides the verdict."""
+    out_dir: Optional[pathlib.Path] = None
+    run_id: Optional[str] = None
+    stats: bool = False
+    contention: bool = False
+    verbosity: int = 0          # -1 with -q, 1 with -v
+    progress: bool = True
+    github_annotations: bool = False
+    emit_test: bool = False
+
+
+@dataclass
+class TimelineOptions:
+    """Timelines and traces of the checked operations."""
+    export: tuple[str, ...] = ()
+    failing: bool = False
+    page_ns: Optional[int] = None
+    max_ops: Optional[int] = None
+    tui_timeline: bool = False
+    tui: bool = False
+    lanes: str = "client"
+    otlp_url: Optional[str] = None
+
+
+@dataclass
+class CheckOptions:
+    """How a history is selected, checked and reported; built from the CLI flags."""
+    consistency: str = "linearizable"
+    auto_levels: bool = False   # --consistency auto
+    model: str = "kv"
+    check_timeout: float = DEFAULT_CHECK_TIMEOUT_S
+    clock_skew_ns: int = 0
+    bound_ns: int = 0
+    snapshot_window_ns: int = DEFAULT_SNAPSHOT_WINDOW_NS
+    window_ns: Optional[int] = None
+    window_stride_ns: Optional[int] = None
+    parallelism: int = 1
+    partition_timeout: Union[float, str, None] = None     # seconds or "auto"
+    partition: str = "key"      # "time": also split keys at quiescent points
+    resume: bool = False
+    shrink: bool = False
+    witness: bool = False
+    load: LoadOptions = field(default_factory=LoadOptions)
+    select: SelectOptions = field(default_factory=SelectOptions)
+    report: ReportOptions = field(default_factory=ReportOptions)
+    timeline: TimelineOptions = field(default_factory=TimelineOptions)
+
+
+def describe_op(op: Operation) -> str:
+    if op.op_type == "Put":
+        return f"Put('{op.key}', {op.write_val!r}) by client {op.client_id}"
+    return f"{op.op_type}('{op.key}') → {op.result_val!r} by client {op.client_id}"
+
+# ── Logging ────────────────────────────────────────────────────────────────────
+
+# Diagnostics (warnings, errors, progress) go to this logger, on stderr;
+# reports stay on stdout.
+log = logging.getLogger("omnipaxos_checker")
+
+# The config being checked, attached to JSON log records (see run_single).
+LOG_CONFIG: contextvars.ContextVar[Optional[str]] = contextvars.ContextVar("log_config", default=None)
+
+LOG_LEVELS = ("debug", "info", "warning", "error")
+LOG_FORMATS = ("text", "json")
+LOG_MARKS = {logging.WARNING: "⚠  ", logging.ERROR: "✗ ", logging.CRITICAL: "✗ "}
+
+# LogRecord attributes; anything else on a record came from `extra`.
+_RECORD_FIELDS = set(vars(logging.LogRecord("", 0, "", 0, "", None, None))) | {"message", "asctime"}
+
+
+class TextFormatter(logging.Formatter):
+    """The console look: indented, warnings and errors marked ⚠ and ✗."""
+
+    def format(self, record: logging.LogRecord) -> str:
+        text = "  " + LOG_MARKS.get(record.levelno, "") + record.getMessage()
+        if record.exc_info:
+            text += "\n" + self.formatException(record.exc_info)
+        return text
+
+
+class JsonFormatter(logging.Formatter):
+    """One JSON object per record: time (UTC), level, message, config, `extra` fields."""
+
+    converter = time.gmtime
+
+    def format(self, record: logging.LogRecord) -> str:
+        entry = {
+            "time": f"{self.formatTime(record, '%Y-%m-%dT%H:%M:%S')}.{int(record.msecs):03d}Z",
+            "level": record.levelname.lower(),
+            "message": record.getMessage(),
+        }
+        if LOG_CONFIG.get() is not None:
+            entry["config"] = LOG_CONFIG.get()
+        entry.update((k, v) for k, v in vars(record).items() if k not in _RECORD_FIELDS)
+        if record.exc_info:
+            entry["exception"] = self.formatException(record.exc_info)
+        return json.dumps(entry, default=str, ensure_ascii=False)
+
+
+def configure_logging(level: str = "info", fmt: str = "text") -> None:
+    """Send the checker's log to stderr at `level`, as text or JSON lines."""
+    handler = logging.StreamHandler(sys.stderr)
+    handler.setFormatter(JsonFormatter() if fmt == "json" else TextFormatter())
+    log.handlers[:] = [handler]
+    log.setLevel(level.upper())
+    log.propagate = False
+    PROGRESS.structured = fmt == "json"
+
+# ── Durations ──────────────────────────────────────────────────────────────────
+
+DURATION_UNITS_NS = {
+    "ns": 1, "us": 1_000, "µs": 1_000, "ms": 1_000_000, "s": 1_000_000_000,
+    "min": 60_000_000_000, "m": 60_000_000_000, "h": 3_600_000_000_000,
+}
+
+
+def parse_duration_ns(text: str) -> int:
+    """Parse '5ms', '250us', '2s', '43m' or a bare number of nanoseconds."""
+    text = text.strip()
+    for unit in sorted(DURATION_UNITS_NS, key=len, reverse=True):
+        if text.endswith(unit):
+            return int(float(text[: -len(unit)]) * DURATION_UNITS_NS[unit])
+    return int(text)
+
+# ── Time and memory budgets ────────────────────────────────────────────────────
+
+class CheckTimeout(Exception):
+    """Raised when a checker exceeds its time budget; the verdict is unknown."""
+
+
+class PartitionTimeout(CheckTimeout):
+    """Some key partitions ran out of their own (--partition-timeout) budget."""
+
+
+class MemoryBudget(CheckTimeout):
+    """Raised when a checker grows past its --max-memory share; the verdict is unknown."""
+
+
+SIZE_UNITS = {"k": 1 << 10, "m": 1 << 20, "g": 1 << 30, "t": 1 << 40}
+# Headroom a worker process needs before --max-memory lets it start.
+MIN_WORKER_MEMORY = 64 << 20
+MEMORY_POLL_S = 0.05
+
+
+def parse_size(text: str) -> int:
+    """Parse '512M', '2G', '1.5GiB', '800KB' (binary units) or a bare number of bytes."""
+    t = text.strip().lower().removesuffix("b").removesuffix("i")
+    if t and t[-1] in SIZE_UNITS:
+        return int(float(t[:-1]) * SIZE_UNITS[t[-1]])
+    return int(t)
+
+
+def fmt_bytes(n: int) -> str:
+    return f"{n / (1 << 30):.1f} GiB" if n >= 1 << 30 else f"{n / (1 << 20):.0f} MiB"
+
+
+def rss_bytes() -> int:
+    """Resident memory of this process (its peak where /proc is missing)."""
+    try:
+        with open("/proc/self/statm") as f:
+            return int(f.read().split()[1]) * os.sysconf("SC_PAGE_SIZE")
+    except (OSError, ValueError, IndexError):
+        try:
+            import resource
+        except ImportError:
+            return 0
+        peak = resource.getrusage(resource.RUSAGE_SELF).ru_maxrss
+        return peak if sys.platform == "darwin" else peak * 1024
+
+
+class MemoryWatch:
+    """
+    The --max-memory limit of this process: resident memory grown past
+    `baseline` (for a worker, what it shared with its parent when forked)
+    by more than `limit` bytes. Polled from the checkers' deadline checks
+    and the history loader, at most every MEMORY_POLL_S.
+    """
+
+    def __init__(self) -> None:
+        self.limit: Optional[int] = None
+        self.baseline = 0
+        self.last = 0.0
+
+    def used(self) -> int:
+        return max(rss_bytes() - self.baseline, 0)
+
+    def over(self) -> bool:
+        if self.limit is None:
+            return False
+        now = time.monotonic()
+        if now - self.last < MEMORY_POLL_S:
+            return False
+        self.last = now
+        return self.used() > self.limit
+
+    def workers(self, n: int) -> int:
+        """How many of `n` worker processes fit in what is left of the limit."""
+        if self.limit is None or n <= 1:
+            return n
+        return max(1, min(n, (self.limit - self.used()) // MIN_WORKER_MEMORY))
+
+    def share(self, n: int) -> Optional[int]:
+        """The limit of each of `n` workers: an equal part of what is left."""
+        if self.limit is None:
+            return None
+        return max(self.limit - self.used(), 0) // n
+
+
+MEMORY = MemoryWatch()
+
+
+class Progress:
+    """
+    Throttled status line for long checks, fed by the checkers' periodic
+    deadline checks: overwritten in place on a terminal, an info log record
+    every few seconds otherwise (or with --log-format json). Silent until
+    the check has run for a second.
+    """
+
+    def __init__(self) -> None:
+        self.enabled = False
+        self.structured = False
+        self.start = 0.0
+        self.last = 0.0
+        self.shown = False
+
+    def begin(self, enabled: bool) -> None:
+        self.enabled = enabled
+        self.start = self.last = time.monotonic()
+        self.shown = False
+
+    def tick(self, text: str) -> None:
+        if not self.enabled:
+            return
+        now = time.monotonic()
+        tty = sys.stderr.isatty() and not self.structured
+        if now - self.last < (0.5 if tty else 5.0) or now - self.start < 1.0:
+            return
+        self.last = now
+        if tty:
+            print(f"\r\033[K  … {text}  [{now - self.start:.0f}s elapsed]", end="", file=sys.stderr, flush=True)
+            self.shown = True
+        else:
+            log.info(f"… {text}  [{now - self.start:.0f}s elapsed]", extra={"elapsed_s": round(now - self.start)})
+
+    def end(self) -> None:
+        if self.shown and sys.stderr.isatty():
+            print("\r\033[K", end="", file=sys.stderr, flush=True)
+        self.enabled = False
+
+
+PROGRESS = Progress()
+
+
+def check_deadline(deadline: Optional[float], progress: str) -> None:
+    PROGRESS.tick(progress)
+    if deadline is not None and time.monotonic() > deadline:
+        raise CheckTimeout(progress)
+    if MEMORY.over():
+        raise MemoryBudget(f"{fmt_bytes(MEMORY.used())} in use at {progress}")
+
+
+def quiet_worker(memory_limit: Optional[int] = None) -> None:
+    PROGRESS.enabled = False
+    if memory_limit is not None:
+        MEMORY.limit, MEMORY.baseline = memory_limit, rss_bytes()
+
+
+def fit_workers(n: int) -> int:
+    """Cap a worker count to what --max-memory has room for, saying so."""
+    fit = MEMORY.workers(n)
+    if fit < n:
+        log.warning(f"{fmt_bytes(max(MEMORY.limit - MEMORY.used(), 0))} of --max-memory left: "
+                    f"checking with {fit} worker(s) instead of {n}")
+    return fit
+
+# ── Helpers ────────────────────────────────────────────────────────────────────
+
+def utc_now() -> str:
+    return time.strftime("%Y-%m-%dT%H:%M:%SZ", time.gmtime())
+
+
+def open_in_browser(target: str) -> None:
+    """Point the system browser at a URL or local file (--open)."""
+    url = target if "://" in target else pathlib.Path(target).resolve().as_uri()
+    if webbrowser.open(url):
+        print(f"Opened {url}")
+    else:
+        log.warning(f"--open: no browser found; open {url} by hand")
+
+# ── Verdicts ───────────────────────────────────────────────────────────────────
+
+VERDICT_RANK = {True: 0, None: 1, False: 2}
+
+
+def result_verdict(r: dict) -> str:
+    return {True: "PASS", None: "UNKNOWN", False: "FAIL"}[r.get("lin_ok", True)]
+
+# ── omnipaxos-kv commands ──────────────────────────────────────────────────────
+
+KV_COMMANDS = ("Put", "Delete", "Get")          # KVCommand variant order
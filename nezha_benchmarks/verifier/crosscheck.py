@@ -0,0 +1,307 @@
+"""
+Checks against the replicas' own records: decided logs and request logs.
+"""
+
+from __future__ import annotations
+
+import bisect
+import json
+import pathlib
+from collections import Counter, defaultdict
+from dataclasses import replace
+from typing import Optional
+
+from .common import KV_COMMANDS, Operation, Value, log
+from .history import is_int, plain_value
+
+# ── Decided log cross-check ────────────────────────────────────────────────────
+
+def load_decided_logs(logs_dir: pathlib.Path, extra: tuple[str, ...] = ()) -> dict[str, list[dict]]:
+    """
+    Decided-log dumps written by servers with decided_log_filepath (JSON
+    lines of {idx, client_id, coordinator_id, command_id, op, key, value?}):
+    logs/decided-*.jsonl plus the `extra` paths, by file name, in index order.
+    """
+    paths = sorted(logs_dir.glob("decided-*.jsonl")) + [pathlib.Path(p) for p in extra]
+    logs: dict[str, list[dict]] = {}
+    for path in paths:
+        entries = []
+        with open(path) as f:
+            for n, line in enumerate(f, 1):
+                if not line.strip():
+                    continue
+                try:
+                    e = json.loads(line)
+                    if not (isinstance(e, dict) and is_int(e.get("idx")) and e.get("op") in KV_COMMANDS
+                            and isinstance(e.get("key"), str)):
+                        raise ValueError("expected idx, op and key")
+                except ValueError as ex:
+                    # Typically the last line of a server killed mid-write.
+                    log.warning(f"{path.name}:{n}: skipped invalid entry ({ex})")
+                    continue
+                entries.append(e)
+        logs[path.name] = sorted(entries, key=lambda e: e["idx"])
+    return logs
+
+
+def stored_value(v: Optional[Value]) -> Optional[str]:
+    """A history value as the server stores it (a string)."""
+    plain = plain_value(v)
+    return plain if plain is None or isinstance(plain, str) else json.dumps(plain)
+
+
+def _fmt_log_entry(entry: tuple) -> str:
+    op, key, value, client, command = entry
+    args = f"{key!r}" if value is None else f"{key!r}, {value!r}"
+    return f"{op}({args}) from client {client} #{command}"
+
+
+def check_decided_log(ops: list[Operation], logs: dict[str, list[dict]]) -> list[str]:
+    """
+    Cross-check the history against the replicas' decided logs: replicas
+    agree on every index they both decided; every acknowledged Put was
+    decided; a Put reported failed was not (its value was decided no more
+    often than the other Puts of it account for); no Put was decided more
+    often than it was issued (the last two are checked independently, so
+    one write can break both); and on each key, a Put that returned before
+    another was invoked was decided before it, as any linearization
+    requires. Puts whose (key, value) is not unique are left out of the
+    order check.
+    """
+    problems: list[str] = []
+    first: dict[int, tuple[str, tuple]] = {}
+    for name, entries in logs.items():
+        for e in entries:
+            entry = (e["op"], e["key"], e.get("value"), e.get("client_id"), e.get("command_id"))
+            other, seen = first.setdefault(e["idx"], (name, entry))
+            if seen != entry:
+                problems.append(f"{name} and {other} disagree at index {e['idx']}: "
+                                f"{_fmt_log_entry(seen)} vs {_fmt_log_entry(entry)}")
+                break
+    log = max(logs.values(), key=len, default=[])
+    decided: dict[tuple[str, Optional[str]], list[int]] = defaultdict(list)
+    for e in log:
+        if e["op"] == "Put":
+            decided[(e["key"], e.get("value"))].append(e["idx"])
+    issued: dict[tuple[str, Optional[str]], list[Operation]] = defaultdict(list)
+    for op in ops:
+        if op.op_type == "Put":
+            issued[(op.key, stored_value(op.write_val))].append(op)
+    per_key: dict[str, list[tuple[Operation, int]]] = defaultdict(list)
+    for (key, value), puts in issued.items():
+        acked = [op for op in puts if not op.ambiguous]
+        failed = [op for op in puts if op.failed]
+        indices = decided.get((key, value), [])
+        if len(indices) < len(acked):
+            problems.append(
+                f"Put({key!r}, {value!r}) acknowledged {len(acked)}x (client {acked[0].client_id} "
+                f"at t={acked[0].return_ns:,}) but decided {len(indices)}x: an acknowledged write was lost")
+        if failed and len(indices) > len(puts) - len(failed):
+            problems.append(
+                f"Put({key!r}, {value!r}) reported failed (client {failed[0].client_id} at "
+                f"t={failed[0].return_ns:,}) but decided at index {indices[-1]}: a failed write was applied")
+        if len(indices) > len(puts):
+            problems.append(f"Put({key!r}, {value!r}) issued {len(puts)}x but decided {len(indices)}x "
+                            f"(indices {', '.join(map(str, indices[:5]))}): applied more than once")
+        if len(puts) == len(indices) == len(acked) == 1:
+            per_key[key].append((puts[0], indices[0]))
+    for key, pairs in per_key.items():
+        by_return = sorted(pairs, key=lambda p: p[0].return_ns)
+        returns = [op.return_ns for op, _ in by_return]
+        # latest[i]: the pair decided last among the first i+1 to return.
+        latest = list(by_return)
+        for i in range(1, len(latest)):
+            latest[i] = max(latest[i - 1], latest[i], key=lambda p: p[1])
+        for op, idx in pairs:
+            i = bisect.bisect_left(returns, op.call_ns)
+            if i and latest[i - 1][1] > idx:
+                earlier, earlier_idx = latest[i - 1]
+                problems.append(
+                    f"key {key!r}: Put({stored_value(earlier.write_val)!r}) returned at t={earlier.return_ns:,} "
+                    f"before Put({stored_value(op.write_val)!r}) was invoked at t={op.call_ns:,}, "
+                    f"but was decided after it (index {earlier_idx} > {idx})")
+    return problems
+
+
+def load_state_snapshots(logs_dir: pathlib.Path, extra: tuple[str, ...] = ()) -> dict[str, dict]:
+    """
+    Replica state snapshots written by servers with state_snapshot_filepath
+    ({server_id, decided_idx, state: {key: value}}): logs/state-*.json plus
+    the `extra` paths, by file name.
+    """
+    snapshots: dict[str, dict] = {}
+    for path in sorted(logs_dir.glob("state-*.json")) + [pathlib.Path(p) for p in extra]:
+        try:
+            with open(path) as f:
+                snap = json.load(f)
+            if not (isinstance(snap, dict) and is_int(snap.get("decided_idx"))
+                    and isinstance(snap.get("state"), dict)):
+                raise ValueError("expected decided_idx and state")
+        except ValueError as ex:
+            log.warning(f"Skipped state snapshot {path.name}: {ex}")
+            continue
+        snapshots[path.name] = snap
+    return snapshots
+
+
+def replay_decided_log(entries: list[dict], upto: int) -> dict[str, str]:
+    """The key-value state after applying the decided entries with idx < upto."""
+    state: dict[str, str] = {}
+    for e in entries:
+        if e["idx"] >= upto:
+            break
+        if e["op"] == "Put":
+            state[e["key"]] = e.get("value")
+        elif e["op"] == "Delete":
+            state.pop(e["key"], None)
+    return state
+
+
+def check_state_snapshots(logs: dict[str, list[dict]], snapshots: dict[str, dict], top: int = 10) -> list[str]:
+    """
+    Replay each snapshot's replica's decided log (decided-<server_id>.jsonl,
+    else the longest dump) up to the snapshot's decided_idx through the KV
+    model and report every key whose value differs from the snapshot.
+    """
+    problems: list[str] = []
+    longest = max(logs, key=lambda name: len(logs[name]), default=None)
+    for name, snap in snapshots.items():
+        log_name = f"decided-{snap.get('server_id')}.jsonl"
+        if log_name not in logs:
+            log_name = longest
+        if log_name is None:
+            problems.append(f"{name}: no decided log to replay")
+            continue
+        entries = logs[log_name]
+        upto = snap["decided_idx"]
+        indices = {e["idx"] for e in entries if e["idx"] < upto}
+        if len(indices) < upto:
+            problems.append(f"{name}: {log_name} has only {len(indices)} of the {upto} entries "
+                            f"the snapshot reflects; cannot replay")
+            continue
+        replayed = replay_decided_log(entries, upto)
+        state = snap["state"]
+        diverged = []
+        for key in sorted(set(state) | set(replayed), key=lambda k: (len(k), k)):
+            if state.get(key) != replayed.get(key):
+                diverged.append(f"key {key!r}: replica has {state.get(key)!r}, replaying {log_name} "
+                                f"to index {upto} gives {replayed.get(key)!r}")
+        problems.extend(f"{name}: {d}" for d in diverged[:top])
+        if len(diverged) > top:
+            problems.append(f"{name}: … and {len(diverged) - top} more divergent key(s)")
+    return problems
+
+# ── Request logs ───────────────────────────────────────────────────────────────
+
+REQUEST_LOG_ROLES = ("server", "proxy")
+
+
+def load_request_logs(logs_dir: pathlib.Path, extra: tuple[str, ...] = ()) -> dict[str, list[dict]]:
+    """
+    Request logs of servers and proxies (JSON lines of {request_id,
+    client_id?, node?, role?, time?, path?}): logs/requests-*.jsonl plus the
+    `extra` paths, by file name.
+    """
+    paths = sorted(logs_dir.glob("requests-*.jsonl")) + [pathlib.Path(p) for p in extra]
+    logs: dict[str, list[dict]] = {}
+    for path in paths:
+        records = []
+        with open(path) as f:
+            for n, line in enumerate(f, 1):
+                if not line.strip():
+                    continue
+                try:
+                    r = json.loads(line)
+                    if not (isinstance(r, dict) and (isinstance(r.get("request_id"), str)
+                                                     or is_int(r.get("request_id")))):
+                        raise ValueError("expected a request_id")
+                    for name in ("client_id", "node", "time"):
+                        if r.get(name) is not None and not is_int(r[name]):
+                            raise ValueError(f"{name} must be an integer")
+                    if r.setdefault("role", "server") not in REQUEST_LOG_ROLES:
+                        raise ValueError(f"role must be one of {', '.join(REQUEST_LOG_ROLES)}")
+                except ValueError as ex:
+                    log.warning(f"{path.name}:{n}: skipped invalid record ({ex})")
+                    continue
+                records.append(r)
+        logs[path.name] = records
+    return logs
+
+
+def _served_label(r: dict) -> str:
+    where = r["role"] if r.get("node") is None else f"{r['role']} {r['node']}"
+    return where + (f" ({r['path']})" if r.get("path") else "")
+
+
+def join_request_logs(
+    ops: list[Operation], logs: dict[str, list[dict]]
+) -> tuple[list[Operation], list[Operation], dict]:
+    """
+    Join request-log records to operations by (client_id, request_id), or
+    request_id alone for records without a client_id. Returns the ops with
+    the node that served them filled in (from the first server record, if
+    the op has none) and their records listed in meta "served"; the
+    acknowledged Puts with a request_id that no server record mentions
+    (none if only proxies logged); and a report.
+    """
+    by_client: dict[tuple[int, str], list[int]] = defaultdict(list)
+    by_id: dict[str, list[int]] = defaultdict(list)
+    for i, op in enumerate(ops):
+        if op.request_id is not None:
+            by_client[(op.client_id, op.request_id)].append(i)
+            by_id[op.request_id].append(i)
+    served: dict[int, list[dict]] = defaultdict(list)
+    unmatched = ambiguous = 0
+    for records in logs.values():
+        for r in records:
+            rid = str(r["request_id"])
+            idx = by_id.get(rid, []) if r.get("client_id") is None else by_client.get((r["client_id"], rid), [])
+            if not idx:
+                unmatched += 1
+            elif len(idx) > 1:
+                ambiguous += 1
+            else:
+                served[idx[0]].append(r)
+    joined = list(ops)
+    by_node: Counter = Counter()
+    for i, records in served.items():
+        op = ops[i]
+        nodes = [r["node"] for r in records if r["role"] == "server" and r.get("node") is not None]
+        node = op.node if op.node is not None else next(iter(nodes), None)
+        if node is not None:
+            by_node[node] += 1
+        joined[i] = replace(op, node=node, meta={**(op.meta or {}), "served": [_served_label(r) for r in records]})
+    logged_by_server = any(r["role"] == "server" for records in logs.values() for r in records)
+    unlogged = [] if not logged_by_server else [
+        op for i, op in enumerate(ops)
+        if op.op_type == "Put" and not op.ambiguous and op.request_id is not None
+        and not any(r["role"] == "server" for r in served.get(i, []))
+    ]
+    report = {
+        "logs": len(logs),
+        "records": sum(len(records) for records in logs.values()),
+        "with_request_id": sum(op.request_id is not None for op in ops),
+        "joined": len(served),
+        "unmatched": unmatched,
+        "ambiguous": ambiguous,
+        "by_node": {str(node): n for node, n in sorted(by_node.items())},
+        "servers": logged_by_server,
+        "missing_writes": len(unlogged),
+    }
+    return joined, unlogged, report
+
+
+def print_request_log_report(report: dict) -> None:
+    print(f"  Request logs: {report['records']} record(s) in {report['logs']} file(s), "
+          f"{report['joined']} of {report['with_request_id']} op(s) with a request_id joined")
+    if report["by_node"]:
+        print("    served by " + ", ".join(f"node {node}: {n}" for node, n in report["by_node"].items()))
+    if report["unmatched"] or report["ambiguous"]:
+        print(f"  ⚠  {report['unmatched']} record(s) match no operation, {report['ambiguous']} match "
+              f"several (log the client_id with the request_id)")
+    if not report["servers"]:
+        print("    (proxy logs only: acknowledged writes not checked)")
+    elif report["missing_writes"]:
+        print(f"    ✗ {report['missing_writes']} acknowledged write(s) in no server log (listed above)")
+    else:
+        print("    ✓ every acknowledged write with a request_id appears in a server log")
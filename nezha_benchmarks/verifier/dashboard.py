@@ -0,0 +1,533 @@
+"""
+The results store (SQLite) and the dashboard served over it.
+"""
+
+from __future__ import annotations
+
+import contextlib
+import errno
+import fnmatch
+import html
+import hmac
+import http.cookies
+import http.server
+import ipaddress
+import json
+import os
+import pathlib
+import re
+import secrets
+import signal
+import socket
+import sqlite3
+import subprocess
+import sys
+import threading
+import time
+import urllib.parse
+from typing import Callable, Optional
+
+from .checkers import CONSISTENCY_CHECKERS, MODELS
+from .common import log, open_in_browser, result_verdict
+from .history import HistoryError
+
+# ── Results store ──────────────────────────────────────────────────────────────
+
+STORE_SCHEMA = """
+CREATE TABLE IF NOT EXISTS runs (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    started_at  TEXT NOT NULL,
+    run_id      TEXT,
+    consistency TEXT,
+    argv        TEXT,
+    host        TEXT,
+    git_commit  TEXT
+);
+CREATE TABLE IF NOT EXISTS results (
+    run         INTEGER NOT NULL REFERENCES runs(id),
+    config      TEXT NOT NULL,
+    verdict     TEXT,
+    violations  INTEGER,
+    ops         INTEGER,
+    history_rps REAL,
+    p50_ms      REAL,
+    p95_ms      REAL,
+    p99_ms      REAL,
+    artifacts   TEXT,
+    result      TEXT
+);
+CREATE INDEX IF NOT EXISTS results_config ON results(config);
+"""
+
+# Runs listed by --history.
+STORE_HISTORY_RUNS = 20
+
+
+def _git_commit() -> Optional[str]:
+    try:
+        out = subprocess.run(["git", "rev-parse", "--short", "HEAD"], capture_output=True, text=True,
+                             cwd=pathlib.Path(__file__).resolve().parent, timeout=5)
+    except (OSError, subprocess.SubprocessError):
+        return None
+    return out.stdout.strip() or None
+
+
+def store_results(db: pathlib.Path, results: list[dict], started_at: float, run_id: Optional[str],
+                  consistency: str, checked: bool,
+                  argv: Optional[list[str]] = None) -> tuple[int, dict[str, int]]:
+    """
+    Append one run and its per-config results (verdict, violations, op count,
+    throughput, overall latency percentiles, artifact paths, and the full
+    --json result) to the SQLite database `db`, creating it if needed.
+    `argv` defaults to this process's arguments. Returns the run's row id
+    and each config's result row id.
+    """
+    db.parent.mkdir(parents=True, exist_ok=True)
+    with contextlib.closing(sqlite3.connect(db)) as conn, conn:
+        conn.executescript(STORE_SCHEMA)
+        cur = conn.execute(
+            "INSERT INTO runs (started_at, run_id, consistency, argv, host, git_commit) VALUES (?, ?, ?, ?, ?, ?)",
+            (time.strftime("%Y-%m-%d %H:%M:%S", time.localtime(started_at)), run_id, consistency,
+             json.dumps(sys.argv[1:] if argv is None else argv), socket.gethostname(), _git_commit()),
+        )
+        run = cur.lastrowid
+        rowids = {}
+        for r in results:
+            if r.get("skipped"):
+                continue
+            lat = (r.get("latency_ms") or {}).get("all") or {}
+            rowids[r["config"]] = conn.execute(
+                "INSERT INTO results VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+                (run, r["config"], result_verdict(r) if checked else None, r.get("violations", 0), r["ops"],
+                 r.get("history_rps"), lat.get("p50"), lat.get("p95"), lat.get("p99"),
+                 json.dumps(r.get("artifacts", [])), json.dumps(r)),
+            ).lastrowid
+    return run, rowids
+
+
+def print_store_history(db: pathlib.Path, config_glob: Optional[str],
+                        runs: int = STORE_HISTORY_RUNS) -> bool:
+    """
+    Print the latest `runs` runs stored in `db`, newest first, one line per
+    config result (only configs matching `config_glob`, if given). False if
+    `db` holds no runs.
+    """
+    with contextlib.closing(sqlite3.connect(db)) as conn:
+        conn.executescript(STORE_SCHEMA)
+        rows = conn.execute(
+            "SELECT id, started_at, run_id, consistency, host, git_commit FROM runs ORDER BY id DESC LIMIT ?",
+            (runs,),
+        ).fetchall()
+        if not rows:
+            return False
+        for run, started_at, run_id, consistency, host, commit in rows:
+            results = [
+                r for r in conn.execute(
+                    "SELECT config, verdict, violations, ops, history_rps, p99_ms, artifacts "
+                    "FROM results WHERE run = ? ORDER BY config", (run,),
+                ) if config_glob is None or fnmatch.fnmatch(r[0], config_glob)
+            ]
+            if config_glob is not None and not results:
+                continue
+            label = "  ".join(x for x in (run_id and f"run-id {run_id}", consistency,
+                                          commit and f"@{commit}", host) if x)
+            print(f"\n  #{run}  {started_at}  {label}")
+            for config, verdict, violations, ops, rps, p99, artifacts in results:
+                lin = {"PASS": "✓ PASS", "FAIL": f"✗ FAIL ({violations})",
+                       "UNKNOWN": "? UNKNOWN", None: "- not checked"}[verdict]
+                tp = f"  tp≈{rps:.0f}rps" if rps is not None else ""
+                lat = f"  p99 {p99:.2f}ms" if p99 is not None else ""
+                n = len(json.loads(artifacts or "[]"))
+                print(f"    {config:<30s}  {lin}  {ops} ops{tp}{lat}"
+                      + (f"  {n} artifact(s)" if n else ""))
+    return True
+
+# ── Results dashboard ──────────────────────────────────────────────────────────
+
+# Rows shown on one dashboard page.
+DASHBOARD_ROWS = 500
+
+ARTIFACT_TYPES = {".png": "image/png", ".svg": "image/svg+xml", ".json": "application/json"}
+
+DASHBOARD_STYLE = """
+body { font-family: sans-serif; margin: 1.5em; color: #222; }
+table { border-collapse: collapse; }
+th, td { padding: 3px 10px; border-bottom: 1px solid #ddd; text-align: left; white-space: nowrap; }
+th { background: #f3f3f3; }
+td.num { text-align: right; }
+.PASS { color: #2E7D32; } .FAIL { color: #C62828; font-weight: bold; } .UNKNOWN { color: #EF6C00; }
+form input, form select { margin-right: 1em; }
+pre { background: #f7f7f7; padding: 8px; overflow-x: auto; }
+img { max-width: 100%; border: 1px solid #ddd; margin: 6px 0; }
+"""
+
+
+def html_page(title: str, body: str) -> bytes:
+    return (f"<!DOCTYPE html><html><head><meta charset='utf-8'><title>{html.escape(title)}</title>"
+            f"<style>{DASHBOARD_STYLE}</style></head><body>{body}</body></html>").encode()
+
+
+def _dashboard_filters(query: dict[str, str]) -> tuple[str, list]:
+    """SQL WHERE clause and parameters for the dashboard's filter form."""
+    where, params = [], []
+    if query.get("since"):
+        where.append("runs.started_at >= ?")
+        params.append(query["since"])
+    if query.get("until"):
+        # A bare date includes that whole day.
+        where.append("runs.started_at <= ?")
+        params.append(query["until"] + ("T" if len(query["until"]) == 10 else ""))
+    if query.get("config"):
+        where.append("results.config GLOB ?")
+        params.append(query["config"])
+    if query.get("verdict"):
+        where.append("results.verdict IS ?" if query["verdict"] != "-" else "results.verdict IS NULL")
+        if query["verdict"] != "-":
+            params.append(query["verdict"])
+    if query.get("q"):
+        where.append("(runs.argv LIKE ? OR runs.run_id LIKE ? OR runs.host LIKE ? OR runs.git_commit LIKE ?)")
+        params.extend([f"%{query['q']}%"] * 4)
+    return (" WHERE " + " AND ".join(where)) if where else "", params
+
+
+def _dashboard_index(conn: sqlite3.Connection, query: dict[str, str]) -> bytes:
+    where, params = _dashboard_filters(query)
+    rows = conn.execute(
+        "SELECT results.rowid, runs.id, runs.started_at, runs.run_id, runs.git_commit, results.config, "
+        "results.verdict, results.violations, results.ops, results.history_rps, results.p99_ms, "
+        "results.artifacts FROM results JOIN runs ON results.run = runs.id" + where
+        + " ORDER BY runs.id DESC, results.config LIMIT ?",
+        (*params, DASHBOARD_ROWS),
+    ).fetchall()
+
+    def field(name: str, label: str, placeholder: str) -> str:
+        value = html.escape(query.get(name, ""), quote=True)
+        return f"<label>{label} <input name='{name}' value='{value}' placeholder='{placeholder}'></label>"
+
+    verdicts = "".join(
+        f"<option value='{v}'{' selected' if query.get('verdict', '') == v else ''}>{label}</option>"
+        for v, label in (("", "any"), ("PASS", "PASS"), ("FAIL", "FAIL"), ("UNKNOWN", "UNKNOWN"),
+                         ("-", "not checked"))
+    )
+    form = ("<form method='get'>"
+            + field("since", "From", "YYYY-MM-DD") + field("until", "to", "YYYY-MM-DD")
+            + field("config", "Config", "glob, e.g. adaptive_*")
+            + f"<label>Verdict <select name='verdict'>{verdicts}</select></label>"
+            + field("q", "Arguments", "e.g. --nemesis, run id, commit")
+            + "<input type='submit' value='Filter'></form>")
+    lines = []
+    for rowid, run, started_at, run_id, commit, config, verdict, violations, ops, rps, p99, artifacts in rows:
+        shown = verdict or "-"
+        if verdict == "FAIL":
+            shown += f" ({violations})"
+        lines.append(
+            f"<tr><td class='num'>#{run}</td><td>{html.escape(started_at)}</td>"
+            f"<td>{html.escape(run_id or '')}</td><td>{html.escape(commit or '')}</td>"
+            f"<td><a href='/result?id={rowid}'>{html.escape(config)}</a></td>"
+            f"<td class='{verdict or ''}'>{shown}</td><td class='num'>{ops}</td>"
+            f"<td class='num'>{'' if rps is None else f'{rps:.0f}'}</td>"
+            f"<td class='num'>{'' if p99 is None else f'{p99:.2f}'}</td>"
+            f"<td class='num'>{len(json.loads(artifacts or '[]')) or ''}</td></tr>"
+        )
+    table = ("<table><tr><th>Run</th><th>Started</th><th>Run id</th><th>Commit</th><th>Config</th>"
+             "<th>Verdict</th><th>Ops</th><th>rps</th><th>p99 ms</th><th>Artifacts</th></tr>"
+             + "".join(lines) + "</table>") if lines else "<p>No stored results match.</p>"
+    more = f"<p>Showing the latest {DASHBOARD_ROWS}; narrow the filter to see older ones.</p>" \
+        if len(rows) == DASHBOARD_ROWS else ""
+    return html_page("Verification runs", f"<h1>Verification runs</h1>{form}<p></p>{table}{more}")
+
+
+def _stored_result(conn: sqlite3.Connection, rowid: str) -> Optional[tuple]:
+    if not rowid.isdigit():
+        return None
+    return conn.execute(
+        "SELECT results.result, results.artifacts, runs.id, runs.started_at, runs.run_id, runs.argv, "
+        "runs.host, runs.git_commit, results.verdict FROM results JOIN runs ON results.run = runs.id "
+        "WHERE results.rowid = ?", (int(rowid),),
+    ).fetchone()
+
+
+def _dashboard_result(conn: sqlite3.Connection, rowid: str, recheck: bool) -> Optional[bytes]:
+    stored = _stored_result(conn, rowid)
+    if stored is None:
+        return None
+    result, artifacts, run, started_at, run_id, argv, host, commit, verdict = stored
+    r = json.loads(result)
+    meta = [
+        ("Run", f"#{run}" + (f" ({run_id})" if run_id else "")),
+        ("Started", started_at), ("Host", host or ""), ("Commit", commit or ""),
+        ("Arguments", " ".join(json.loads(argv or "[]"))),
+        ("Consistency", r.get("consistency", "")), ("Ops", r.get("ops", "")),
+        ("Throughput", "" if r.get("history_rps") is None else f"{r['history_rps']:.1f} rps"),
+    ]
+    lat = (r.get("latency_ms") or {}).get("all") or {}
+    if lat:
+        meta.append(("Latency", "  ".join(f"{q} {v:.2f} ms" for q, v in lat.items())))
+    if r.get("strongest_level"):
+        meta.append(("Strongest level", r["strongest_level"]))
+    body = [f"<p><a href='/'>← all runs</a></p><h1>{html.escape(r['config'])} "
+            f"<span class='{verdict or ''}'>{verdict or 'not checked'}</span></h1><table>"]
+    body += [f"<tr><th>{k}</th><td>{html.escape(str(v))}</td></tr>" for k, v in meta]
+    if r.get("recheck_of") is not None:
+        body.append(f"<tr><th>Recheck of</th><td><a href='/result?id={r['recheck_of']}'>"
+                    f"result {r['recheck_of']}</a></td></tr>")
+    body.append("</table>")
+    if recheck and r.get("config_dir"):
+        levels = "".join(f"<option{' selected' if c == r.get('consistency') else ''}>{c}</option>"
+                         for c in (*CONSISTENCY_CHECKERS, "auto"))
+        models = "<option value=''>as stored</option>" + "".join(f"<option>{m}</option>" for m in MODELS)
+        body.append(f"<form method='post' action='/results/{int(rowid)}/recheck'>"
+                    f"<label>Consistency <select name='consistency'>{levels}</select></label>"
+                    f"<label>Model <select name='model'>{models}</select></label>"
+                    "<label>Timeout (s) <input name='timeout' size='6' placeholder='as stored'></label>"
+                    "<label>Bound <input name='bound' size='8' placeholder='e.g. 200ms'></label>"
+                    "<input type='submit' value='Recheck'></form>")
+    if r.get("violation_details"):
+        body.append(f"<h2>Violations ({r['violations']})</h2><pre>"
+                    + html.escape("\n".join(r["violation_details"])) + "</pre>")
+    if r.get("explanations"):
+        body.append("<h2>Explanations</h2><pre>" + html.escape("\n\n".join(r["explanations"])) + "</pre>")
+    paths = json.loads(artifacts or "[]")
+    if paths:
+        body.append("<h2>Artifacts</h2>")
+    for i, path in enumerate(paths):
+        url = f"/artifact?id={rowid}&amp;n={i}"
+        name = html.escape(pathlib.Path(path).name)
+        body.append(f"<p><a href='{url}'>{name}</a></p>")
+        if pathlib.Path(path).suffix in (".png", ".svg"):
+            body.append(f"<img src='{url}' alt='{name}'>")
+    return html_page(r["config"], "".join(body))
+
+
+# Overrides the token the dashboard generates at startup.
+DASHBOARD_TOKEN_ENV = "OMNIPAXOS_DASHBOARD_TOKEN"
+
+
+def _is_loopback(host: Optional[str]) -> bool:
+    if host == "localhost":
+        return True
+    try:
+        return ipaddress.ip_address(host or "").is_loopback
+    except ValueError:
+        return False
+
+
+def make_dashboard_server(db: pathlib.Path, host: str, port: int, any_port: bool = False,
+                          token: Optional[str] = None, recheck: Optional[Callable] = None,
+                          ) -> http.server.ThreadingHTTPServer:
+    """
+    An HTTP server for the dashboard of the runs stored in `db` by --store:
+    a filterable list of per-config results, each linking to a page with its
+    run metadata, violations and artifacts (plots, timelines and
+    counterexamples, read from the paths recorded at the time). The only
+    write is POST /results/{id}/recheck, which calls `recheck(db, rowid,
+    stored, params)` to check a stored result's history again with the
+    request's parameters and store the outcome as a new run, returning its
+    row id and result; it raises ValueError on invalid parameters. Without
+    `recheck` the route does not exist and result pages offer no form.
+
+    Histories hold real keys and values, so `host` must be a loopback
+    address (ValueError otherwise) and every route needs `token` (a random
+    one if None; see the server's `token`): as "Authorization: Bearer", as
+    the cookie a ?token= query sets, which redirects to the URL without it,
+    or in the query itself. Requests naming another Host are refused too,
+    so a page in the browser cannot reach the dashboard by DNS rebinding.
+
+    The routes live on the server's own handler class, bound to `db`, so
+    several servers can run in one process: call serve_forever() (e.g. in a
+    thread) and shutdown() to stop. With `any_port`, a busy `port` falls
+    back to a free one (see server_address); otherwise OSError is raised.
+    """
+    if not _is_loopback(host):
+        raise ValueError(f"{host!r} is not a loopback address; the dashboard is only served locally")
+    token = token or secrets.token_urlsafe(24)
+    # Checks use process-wide state (deadlines, the memory budget, stdout).
+    recheck_lock = threading.Lock()
+
+    class Handler(http.server.BaseHTTPRequestHandler):
+        def do_GET(self) -> None:
+            url = urllib.parse.urlsplit(self.path)
+            query = {k: v[-1] for k, v in urllib.parse.parse_qs(url.query).items()}
+            if not self._authorized(query):
+                return
+            if "token" in query:
+                # Keep the token out of the address bar and the browser history.
+                rest = urllib.parse.urlencode({k: v for k, v in query.items() if k != "token"})
+                self.send_response(303)
+                self.send_header("Set-Cookie", f"{self._cookie()}={token}; Path=/; HttpOnly; SameSite=Strict")
+                self.send_header("Location", url.path + (f"?{rest}" if rest else ""))
+                self.send_header("Content-Length", "0")
+                self.end_headers()
+                return
+            with contextlib.closing(sqlite3.connect(db)) as conn:
+                if url.path == "/":
+                    self._send(200, "text/html; charset=utf-8", _dashboard_index(conn, query))
+                elif url.path == "/result":
+                    page = _dashboard_result(conn, query.get("id", ""), recheck is not None)
+                    if page is None:
+                        self.send_error(404, "No such result")
+                    else:
+                        self._send(200, "text/html; charset=utf-8", page)
+                elif url.path == "/artifact":
+                    self._artifact(conn, query)
+                else:
+                    self.send_error(404)
+
+        def do_POST(self) -> None:
+            url = urllib.parse.urlsplit(self.path)
+            match = re.fullmatch(r"/results/(\d+)/recheck", url.path)
+            if not match:
+                self.send_error(404)
+                return
+            if not self._authorized({k: v[-1] for k, v in urllib.parse.parse_qs(url.query).items()}):
+                return
+            if recheck is None:
+                self.send_error(404)
+                return
+            body = self.rfile.read(int(self.headers.get("Content-Length") or 0)).decode(errors="replace")
+            form = self.headers.get_content_type() == "application/x-www-form-urlencoded"
+            params = {k: v[-1] for k, v in urllib.parse.parse_qs(url.query).items()}
+            if form:
+                # Blank form fields keep the stored setting.
+                params.update((k, v[-1]) for k, v in urllib.parse.parse_qs(body).items() if v[-1])
+            elif body.strip():
+                try:
+                    data = json.loads(body)
+                except json.JSONDecodeError as ex:
+                    self.send_error(400, f"Invalid JSON body: {ex}")
+                    return
+                if not isinstance(data, dict):
+                    self.send_error(400, "Expected a JSON object of parameters")
+                    return
+                params.update((k, str(v)) for k, v in data.items())
+            params.pop("token", None)
+            rowid = int(match.group(1))
+            with contextlib.closing(sqlite3.connect(db)) as conn:
+                stored = _stored_result(conn, str(rowid))
+            if stored is None:
+                self.send_error(404, "No such result")
+                return
+            r = json.loads(stored[0])
+            if not r.get("config_dir"):
+                self.send_error(409, "The result does not record where its history is")
+                return
+            if not pathlib.Path(r["config_dir"]).is_dir():
+                self.send_error(410, f"{r['config_dir']} no longer exists")
+                return
+            try:
+                with recheck_lock:
+                    new_id, result = recheck(db, rowid, r, params)
+            except ValueError as ex:
+                self.send_error(400, str(ex))
+                return
+            except (HistoryError, OSError) as ex:
+                self.send_error(422, f"Cannot check the history: {ex}")
+                return
+            if form:
+                self.send_response(303)
+                self.send_header("Location", f"/result?id={new_id}")
+                self.send_header("Content-Length", "0")
+                self.end_headers()
+                return
+            self._send(201, "application/json", json.dumps({
+                "id": new_id, "recheck_of": rowid, "config": result["config"],
+                "consistency": result["consistency"], "verdict": result_verdict(result),
+                "violations": result["violations"], "ops": result["ops"],
+                "url": f"/result?id={new_id}",
+            }).encode())
+
+        def _cookie(self) -> str:
+            # Cookies are shared across ports: one per dashboard.
+            return f"dashboard_token_{self.server.server_address[1]}"
+
+        def _authorized(self, query: dict[str, str]) -> bool:
+            """Whether the request may proceed; sends the error response if not."""
+            if not _is_loopback(urllib.parse.urlsplit("//" + (self.headers.get("Host") or "")).hostname):
+                self.send_error(403, "The dashboard is only served to loopback Host names")
+                return False
+            scheme, _, bearer = (self.headers.get("Authorization") or "").partition(" ")
+            cookie = http.cookies.SimpleCookie(self.headers.get("Cookie") or "").get(self._cookie())
+            given = [bearer.strip() if scheme.lower() == "bearer" else "",
+                     cookie.value if cookie else "", query.get("token", "")]
+            if any(hmac.compare_digest(g.encode(), token.encode()) for g in given if g):
+                return True
+            self.send_response(401)
+            self.send_header("WWW-Authenticate", 'Bearer realm="dashboard"')
+            data = b"Open the URL printed by --serve, or send Authorization: Bearer TOKEN\n"
+            self.send_header("Content-Type", "text/plain; charset=utf-8")
+            self.send_header("Content-Length", str(len(data)))
+            self.end_headers()
+            self.wfile.write(data)
+            return False
+
+        def _artifact(self, conn: sqlite3.Connection, query: dict[str, str]) -> None:
+            # Only files a stored result lists are served.
+            stored = _stored_result(conn, query.get("id", ""))
+            paths = json.loads(stored[1] or "[]") if stored else []
+            n = query.get("n", "")
+            if not n.isdigit() or int(n) >= len(paths):
+                self.send_error(404, "No such artifact")
+                return
+            path = pathlib.Path(paths[int(n)])
+            try:
+                data = path.read_bytes()
+            except OSError:
+                self.send_error(410, f"{path} no longer exists")
+                return
+            self._send(200, ARTIFACT_TYPES.get(path.suffix, "application/octet-stream"), data)
+
+        def _send(self, status: int, content_type: str, data: bytes) -> None:
+            self.send_response(status)
+            self.send_header("Content-Type", content_type)
+            self.send_header("Content-Length", str(len(data)))
+            self.end_headers()
+            self.wfile.write(data)
+
+        def log_message(self, format: str, *args) -> None:
+            pass
+
+    try:
+        server = http.server.ThreadingHTTPServer((host, port), Handler)
+    except OSError as ex:
+        if not any_port or ex.errno != errno.EADDRINUSE:
+            raise
+        server = http.server.ThreadingHTTPServer((host, 0), Handler)
+        log.warning(f"Port {port} is in use; serving on {server.server_address[1]} instead")
+    # server_close() then waits for requests in progress (e.g. a recheck).
+    server.daemon_threads = False
+    server.token = token
+    return server
+
+
+def serve_dashboard(db: pathlib.Path, host: str, port: int, open_browser: bool = False,
+                    any_port: bool = False, recheck: Optional[Callable] = None) -> None:
+    """
+    Serve the make_dashboard_server() dashboard (rechecking results with
+    `recheck`, if given) until SIGINT or SIGTERM,
+    then stop accepting requests and let those in progress finish. With
+    `open_browser` the dashboard is opened in the system browser. The
+    access token comes from $OMNIPAXOS_DASHBOARD_TOKEN, else is generated
+    and printed as part of the URL.
+    """
+    given = os.environ.get(DASHBOARD_TOKEN_ENV)
+    server = make_dashboard_server(db, host, port, any_port, token=given, recheck=recheck)
+    address = f"[{host}]" if ":" in host else host
+    url = f"http://{address}:{server.server_address[1]}/"
+    print(f"Serving {db} on {url}" + (f"  (token from ${DASHBOARD_TOKEN_ENV})" if given else "")
+          + "  (Ctrl+C to stop)")
+    if not given:
+        print(f"  Open {url}?token={server.token}")
+    if open_browser:
+        open_in_browser(f"{url}?token={server.token}")
+    stop = threading.Event()
+    previous = {sig: signal.signal(sig, lambda *_: stop.set()) for sig in (signal.SIGINT, signal.SIGTERM)}
+    thread = threading.Thread(target=server.serve_forever, daemon=True)
+    thread.start()
+    try:
+        stop.wait()
+        print("Shutting down; waiting for requests in progress…")
+    finally:
+        server.shutdown()
+        server.server_close()
+        for sig, handler in previous.items():
+            signal.signal(sig, handler)
@@ -0,0 +1,1121 @@
+"""
+Loading, merging and writing histories, and preparing them for a check (time
+units, clock skew).
+"""
+
+from __future__ import annotations
+
+import csv
+import decimal
+import fnmatch
+import gzip
+import heapq
+import io
+import json
+import os
+import pathlib
+import re
+import sys
+import tempfile
+from collections import defaultdict
+from dataclasses import replace
+from typing import Callable, Optional
+
+from .common import (CheckOptions, DURATION_UNITS_NS, Event, JsonValue, MEMORY, MemoryBudget, Operation,
+                     STATUSES, STATUS_OK, Value, fmt_bytes, log)
+
+# ── History loading ────────────────────────────────────────────────────────────
+
+GZIP_MAGIC = b"\x1f\x8b"
+ZSTD_MAGIC = b"\x28\xb5\x2f\xfd"
+
+# The target "-": one history read from stdin as it streams in, never saved.
+STDIN = pathlib.Path("<stdin>")
+_stdin: Optional[io.BufferedIOBase] = None
+
+
+def stdin_history() -> io.BufferedIOBase:
+    """stdin as a peekable byte stream, decompressing gzip/zstd by magic bytes."""
+    global _stdin
+    if _stdin is None:
+        raw = sys.stdin.buffer
+        magic = raw.peek(4)[:4]
+        if magic.startswith(GZIP_MAGIC):
+            _stdin = gzip.GzipFile(fileobj=raw)
+        elif magic == ZSTD_MAGIC:
+            try:
+                import zstandard
+            except ImportError:
+                raise RuntimeError("stdin is zstd-compressed; pip install zstandard") from None
+            _stdin = io.BufferedReader(zstandard.ZstdDecompressor().stream_reader(raw))
+        else:
+            _stdin = raw
+    return _stdin
+
+
+def is_csv_history(path: pathlib.Path) -> bool:
+    """A .csv history file, or CSV piped to stdin (it does not start as JSON does)."""
+    if path != STDIN:
+        return ".csv" in path.suffixes
+    head = stdin_history().peek(STREAM_CHUNK).lstrip()
+    return bool(head) and head[:1] not in b"[{"
+
+
+def open_history(path: pathlib.Path) -> io.TextIOBase:
+    """Open a history file (or STDIN) as text, decompressing gzip/zstd by magic bytes."""
+    if path == STDIN:
+        return io.TextIOWrapper(stdin_history())
+    with open(path, "rb") as f:
+        magic = f.read(4)
+    if magic.startswith(GZIP_MAGIC):
+        return gzip.open(path, "rt")
+    if magic == ZSTD_MAGIC:
+        try:
+            import zstandard
+        except ImportError:
+            raise RuntimeError(f"{path.name} is zstd-compressed; pip install zstandard") from None
+        raw = open(path, "rb")
+        return io.TextIOWrapper(zstandard.ZstdDecompressor().stream_reader(raw, closefd=True))
+    return open(path)
+
+
+def canonical_value(v: object) -> Optional[Value]:
+    """
+    Normalize a decoded JSON value for comparison. Objects and arrays become
+    a sorted-key JsonValue (deep equality, hashable); bools do too, since
+    Python would otherwise treat true == 1.
+    """
+    if isinstance(v, (dict, list, bool)):
+        return JsonValue(json.dumps(v, sort_keys=True, separators=(",", ":")))
+    return v
+
+
+# Operation types the checkers understand.
+OP_TYPES = {"Put", "Get"}
+
+
+class HistoryError(Exception):
+    """A history file or record is malformed (raised in --strict mode)."""
+
+
+def is_int(v: object) -> bool:
+    return isinstance(v, int) and not isinstance(v, bool)
+
+
+class JsonFloat(float):
+    """A float decoded from a history's JSON, keeping the literal's digits."""
+    text: str
+
+    def __new__(cls, text: str) -> "JsonFloat":
+        v = super().__new__(cls, text)
+        v.text = text
+        return v
+
+
+# Fields holding timestamps written as strings or floats by some tools
+# (see "Timestamps" in CHECKER.md).
+TIMESTAMP_FIELDS = ("call", "return_time")
+
+
+def normalize_timestamp(v: object) -> tuple[object, Optional[str]]:
+    """
+    A timestamp given as a decimal string, float or scientific notation as
+    an integer, with how it is imprecise if it is; other values unchanged
+    (validate_entry reports them).
+    """
+    if is_int(v) or isinstance(v, bool):
+        return v, None
+    if isinstance(v, str):
+        text = v.strip()
+        if re.fullmatch(r"[+-]?\d+", text):
+            return int(text), None
+    elif isinstance(v, float):
+        text = v.text if isinstance(v, JsonFloat) else repr(v)
+    else:
+        return v, None
+    try:
+        d = decimal.Decimal(text)
+    except decimal.InvalidOperation:
+        return v, None
+    if not d.is_finite():
+        return v, None
+    n = int(d.to_integral_value(rounding=decimal.ROUND_HALF_EVEN))
+    exponent = d.as_tuple().exponent
+    if exponent > 0:
+        return n, f"{text}: last {exponent} digit(s) lost, precise to {10 ** exponent:,} units"
+    if d != n:
+        return n, f"{text}: fraction rounded off"
+    return n, None
+
+
+def validate_entry(e: object) -> list[tuple[str, str]]:
+    """Return (field, problem) pairs for a history record; empty if valid."""
+    if not isinstance(e, dict):
+        return [("<record>", f"expected an object, got {type(e).__name__}")]
+    problems: list[tuple[str, str]] = []
+    for field in ("client_id", "call", "return_time"):
+        if field not in e:
+            problems.append((field, "missing"))
+        elif not is_int(e[field]):
+            expected = "an integer" if field not in TIMESTAMP_FIELDS else "an integer (or a decimal string or float)"
+            problems.append((field, f"expected {expected}, got {type(e[field]).__name__} {e[field]!r}"))
+    inp = e.get("input")
+    if not isinstance(inp, dict):
+        problems.append(("input", "missing" if inp is None else "expected an object"))
+    else:
+        if inp.get("type") not in OP_TYPES:
+            problems.append(("input.type", f"expected one of {sorted(OP_TYPES)}, got {inp.get('type')!r}"))
+        if not isinstance(inp.get("key"), str):
+            problems.append(("input.key", "missing" if "key" not in inp else "expected a string"))
+        if inp.get("type") == "Put" and "value" not in inp:
+            problems.append(("input.value", "missing for Put"))
+    if "node" in e and e["node"] is not None and not is_int(e["node"]):
+        problems.append(("node", "expected an integer node id"))
+    if "shard" in e and e["shard"] is not None and not (isinstance(e["shard"], str) or is_int(e["shard"])):
+        problems.append(("shard", "expected a string or integer shard id"))
+    if "term" in e and e["term"] is not None and not is_int(e["term"]):
+        problems.append(("term", "expected an integer leader term"))
+    if "read_mode" in e and e["read_mode"] is not None and not isinstance(e["read_mode"], str):
+        problems.append(("read_mode", "expected a string (e.g. leader, quorum, lease)"))
+    if "meta" in e and e["meta"] is not None and not isinstance(e["meta"], dict):
+        problems.append(("meta", "expected an object"))
+    if "op_id" in e and not (isinstance(e["op_id"], str) or is_int(e["op_id"])):
+        problems.append(("op_id", "expected a string or integer"))
+    if "request_id" in e and e["request_id"] is not None and not (
+            isinstance(e["request_id"], str) or is_int(e["request_id"])):
+        problems.append(("request_id", "expected a string or integer"))
+    if "idempotent" in e and not isinstance(e["idempotent"], bool):
+        problems.append(("idempotent", "expected true or false"))
+    out = e.get("output", {})
+    if not isinstance(out, dict):
+        problems.append(("output", "expected an object"))
+    elif out.get("status", STATUS_OK) not in STATUSES:
+        problems.append(("output.status", f"expected one of {sorted(STATUSES)}, got {out.get('status')!r}"))
+    if "outcome" in e and e["outcome"] not in STATUSES:
+        problems.append(("outcome", f"expected one of {sorted(STATUSES)}, got {e['outcome']!r}"))
+    return problems
+
+
+def interval_problem(e: dict) -> Optional[str]:
+    """Why a schema-valid record's [call, return_time] cannot be real, if it can't."""
+    if e["call"] <= 0 or e["return_time"] <= 0:
+        return f"zero or negative timestamp (call={e['call']}, return_time={e['return_time']})"
+    if e["return_time"] < e["call"]:
+        return f"return_time {e['return_time']} is before call {e['call']}"
+    return None
+
+
+def parse_event(e: object) -> Event:
+    """Build an Event from a record like {"time": ns, "type": "node_kill", "node": 2}."""
+    if not isinstance(e, dict):
+        raise ValueError(f"expected an object, got {type(e).__name__}")
+    if not is_int(e.get("time")):
+        raise ValueError("time: expected an integer (ns)")
+    if not isinstance(e.get("type"), str):
+        raise ValueError("type: expected a string")
+    node = e.get("node")
+    if node is not None and not is_int(node):
+        raise ValueError("node: expected an integer")
+    term = e.get("term")
+    if term is not None and not is_int(term):
+        raise ValueError("term: expected an integer")
+    return Event(time_ns=e["time"], kind=e["type"], node=node, detail=str(e.get("detail", "")), term=term)
+
+
+def _load_events(entries: object, source: str, strict: bool) -> list[Event]:
+    if not isinstance(entries, list):
+        if strict:
+            raise HistoryError(f"{source}: events must be a JSON array")
+        log.warning(f"Ignoring events in {source}: expected a JSON array")
+        return []
+    events: list[Event] = []
+    for i, e in enumerate(entries):
+        try:
+            events.append(parse_event(e))
+        except ValueError as ex:
+            if strict:
+                raise HistoryError(f"{source} events[{i}]: {ex}") from None
+            log.warning(f"Skipped invalid event {source} events[{i}]: {ex}")
+    return events
+
+
+def load_events(logs_dir: pathlib.Path, strict: bool = False) -> list[Event]:
+    """
+    Load fault/cluster events from every events*.json file in `logs_dir`
+    (a JSON array of {time, type, node?, detail?, term?}), sorted by time.
+    """
+    events: list[Event] = []
+    for path in sorted(logs_dir.glob("events*.json")):
+        try:
+            with open(path) as f:
+                entries = json.load(f)
+        except Exception as ex:
+            if strict:
+                raise HistoryError(f"{path.name}: {ex}") from None
+            log.warning(f"Could not load {path}: {ex}")
+            continue
+        events.extend(_load_events(entries, path.name, strict))
+    events.sort(key=lambda ev: ev.time_ns)
+    return events
+
+
+# Characters read per step when streaming a history array.
+STREAM_CHUNK = 1 << 20
+_JSON_WS = re.compile(r"[ \t\n\r]*")
+
+
+def iter_json_array(f: io.TextIOBase, buf: str = ""):
+    """
+    Yield the elements of a top-level JSON array one at a time, reading `f`
+    in chunks, so multi-GB histories never sit in memory as text or as one
+    big list. `buf` holds text already read past the opening bracket.
+    """
+    decoder = json.JSONDecoder(parse_float=JsonFloat)
+    pos = 0
+    eof = False
+
+    def more() -> None:
+        nonlocal buf, pos, eof
+        chunk = f.read(STREAM_CHUNK)
+        eof = not chunk
+        buf, pos = buf[pos:] + chunk, 0
+
+    def skip_ws() -> None:
+        nonlocal pos
+        while True:
+            pos = _JSON_WS.match(buf, pos).end()
+            if pos < len(buf) or eof:
+                return
+            more()
+
+    def finish() -> None:
+        if (buf[pos + 1:] + f.read()).strip():
+            raise ValueError("extra data after the JSON array")
+
+    skip_ws()
+    if buf[pos:pos + 1] == "]":
+        finish()
+        return
+    while True:
+        skip_ws()
+        while True:
+            try:
+                value, end = decoder.raw_decode(buf, pos)
+                # Complete once the following delimiter is buffered too: a
+                # number cut at the chunk boundary would otherwise decode short.
+                nxt = _JSON_WS.match(buf, end).end()
+                if eof or buf[nxt:nxt + 1] in (",", "]"):
+                    break
+            except json.JSONDecodeError:
+                if eof:
+                    raise
+            more()
+        yield value
+        pos = end
+        skip_ws()
+        c = buf[pos:pos + 1]
+        if c == "]":
+            finish()
+            return
+        if c != ",":
+            raise ValueError(f"expected ',' or ']' after array element, got {c!r}" if c
+                             else "unterminated JSON array")
+        pos += 1
+
+
+def iter_history_entries(
+    f: io.TextIOBase, events: Optional[list[Event]], name: str, strict: bool
+):
+    """
+    Yield the operation records of a history file: a JSON array (streamed)
+    or an object {"operations": [...], "events": [...]} whose events are
+    appended to `events` when given.
+    """
+    buf = ""
+    while not buf.strip():
+        chunk = f.read(STREAM_CHUNK)
+        if not chunk:
+            raise ValueError("empty history file")
+        buf += chunk
+    buf = buf.lstrip()
+    if buf[0] == "[":
+        yield from iter_json_array(f, buf[1:])
+        return
+    doc = json.loads(buf + f.read(), parse_float=JsonFloat)
+    if not (isinstance(doc, dict) and isinstance(doc.get("operations"), list)):
+        raise ValueError("expected a JSON array of operations")
+    if events is not None and "events" in doc:
+        events.extend(_load_events(doc["events"], name, strict))
+    yield from doc["operations"]
+
+
+# CSV history columns (header names, remappable with --csv-columns).
+CSV_FIELDS = ("client", "op", "key", "value", "status", "call_ns", "return_ns")
+
+
+def parse_csv_columns(spec: str) -> dict[str, str]:
+    """'client=cid,call_ns=start' → {field: header} over the CSV_FIELDS defaults."""
+    columns = {field: field for field in CSV_FIELDS}
+    for item in filter(None, (part.strip() for part in spec.split(","))):
+        field, sep, header = item.partition("=")
+        if not sep or field not in columns or not header:
+            raise ValueError(f"{item!r}: expected FIELD=COLUMN with FIELD one of {', '.join(CSV_FIELDS)}")
+        columns[field] = header
+    return columns
+
+
+def iter_csv_entries(f: io.TextIOBase, columns: dict[str, str]):
+    """
+    Yield history records from a CSV file with a header row, one operation
+    per row. `value` is the written value of a Put and the result of a Get
+    (empty: not found); numeric fields that do not parse are passed through
+    for validate_entry to report. Non-empty cells of other columns become
+    the record's meta.
+    """
+    reader = csv.DictReader(f)
+    missing = [h for field, h in columns.items() if field != "status" and h not in (reader.fieldnames or [])]
+    if missing:
+        raise ValueError(f"CSV header lacks column(s) {', '.join(missing)}")
+    extra = [h for h in reader.fieldnames or [] if h not in columns.values()]
+
+    def num(text: str) -> object:
+        try:
+            return int(text)
+        except ValueError:
+            return text
+
+    for row in reader:
+        op = row[columns["op"]].strip().capitalize()
+        value = row[columns["value"]] or None
+        entry = {
+            "client_id": num(row[columns["client"]]),
+            "call": num(row[columns["call_ns"]]),
+            "return_time": num(row[columns["return_ns"]]),
+            "input": {"type": op, "key": row[columns["key"]]},
+            "output": {"status": row.get(columns["status"]) or STATUS_OK},
+        }
+        if op == "Put":
+            entry["input"]["value"] = value
+        else:
+            entry["output"]["value"] = value
+        meta = {h: row[h] for h in extra if row.get(h)}
+        if meta:
+            entry["meta"] = meta
+        yield entry
+
+
+# --namespace-clients: ids per file are offset by this much.
+CLIENT_NAMESPACE = 1000
+
+
+def history_files(
+    logs_dir: pathlib.Path, include: Optional[list[str]] = None, exclude: tuple[str, ...] = ()
+) -> list[pathlib.Path]:
+    """
+    The history files to load from `logs_dir`. By default only canonical
+    per-client files: history-1.json, history-2.json, … or history-N.csv
+    (optionally compressed as .gz / .zst); files with non-numeric suffixes (e.g.
+    history-raw-c1.json from older runs) would mix operations from different
+    experiments. `include` replaces that rule with file-name globs searched
+    recursively; `exclude` globs drop matches from either. STDIN is its
+    own only file.
+    """
+    if logs_dir == STDIN:
+        return [STDIN]
+    if include:
+        found = {p for pattern in include for p in logs_dir.rglob(pattern) if p.is_file()}
+    else:
+        _numeric_history = re.compile(r"^history-\d+\.(json|csv)(\.gz|\.zst)?$")
+        found = {p for p in logs_dir.glob("history-*") if _numeric_history.match(p.name)}
+    return sorted(
+        p for p in found
+        if not any(fnmatch.fnmatch(p.name, x) or fnmatch.fnmatch(str(p.relative_to(logs_dir)), x)
+                   for x in exclude)
+    )
+
+
+def load_history(
+    logs_dir: pathlib.Path,
+    strict: bool = False,
+    events: Optional[list[Event]] = None,
+    include: Optional[list[str]] = None,
+    exclude: tuple[str, ...] = (),
+    max_listed: Optional[int] = 10,
+    client_map: Optional[dict[int, dict]] = None,
+    time_offsets: tuple[tuple[str, int], ...] = (),
+    align_marker: Optional[str] = None,
+    time_unit: str = "auto",
+    quarantine: Optional[list[dict]] = None,
+    csv_columns: Optional[dict[str, str]] = None,
+    field_map: Optional[dict] = None,
+) -> list[Operation]:
+    """
+    Load and validate every per-client history file in `logs_dir`. Invalid
+    records are reported (file, index, field, problem; the first `max_listed`
+    per file, or all when None) and skipped; with `strict`, the first one
+    raises HistoryError instead.
+
+    A file is either a JSON array of operations or an object
+    {"operations": [...], "events": [...]}; events found in the latter are
+    appended to `events` when given. A .csv file is read with
+    iter_csv_entries (`csv_columns` maps its header, see parse_csv_columns). Records sharing an `op_id` are merged
+    (see dedup_ops), then a client's deduplicated retries sharing a
+    `request_id` (see merge_retries). JSON records in a foreign schema are rewritten first with
+    `field_map` (see remap_entry).
+
+    With `client_map` (a dict to fill), client ids are namespaced per file as
+    file_index * CLIENT_NAMESPACE + client_id, and the dict maps each new id
+    to its {"file", "client_id"}.
+
+    Timestamps of a file are shifted by the offset of the first `time_offsets`
+    glob matching it or, failing that, by the offset that lines up the midpoint
+    of its first operation on key `align_marker` with that of the first file
+    containing one (every node touches the marker key once, at startup).
+    Before that, timestamps are converted to ns from `time_unit`, or with
+    "auto" from the unit their magnitude suggests (see detect_time_unit).
+
+    Records whose interval cannot be real (see interval_problem) make the
+    whole load fail with HistoryError listing them, unless `quarantine` (a
+    list to fill) is given: then they are skipped and appended to it.
+
+    Growing past --max-memory while loading raises MemoryBudget.
+    """
+    ops: list[Operation] = []
+    bad_intervals: list[str] = []
+    marker_ref: Optional[int] = None
+    for file_index, path in enumerate(history_files(logs_dir, include, exclude)):
+        invalid: list[str] = []
+        n_invalid = 0
+        n_converted, imprecise = 0, []     # non-integer timestamps, those that lost precision
+        file_ops: list[Operation] = []
+        try:
+            with open_history(path) as f:
+                if is_csv_history(path):
+                    entries = iter_csv_entries(f, csv_columns or parse_csv_columns(""))
+                else:
+                    entries = iter_history_entries(f, events, path.name, strict)
+                    if field_map:
+                        entries = (remap_entry(e, field_map) for e in entries)
+                for i, e in enumerate(entries):
+                    if i % 10_000 == 0 and MEMORY.over():
+                        raise MemoryBudget(
+                            f"memory limit reached loading {path.name} after {len(ops) + len(file_ops):,} "
+                            f"operations ({fmt_bytes(MEMORY.used())} in use); load fewer files with "
+                            f"--include/--exclude or raise --max-memory"
+                        )
+                    if isinstance(e, dict):
+                        for field in TIMESTAMP_FIELDS:
+                            if field in e and not is_int(e[field]):
+                                e[field], loss = normalize_timestamp(e[field])
+                                n_converted += is_int(e[field])
+                                if loss:
+                                    imprecise.append(f"[{i}] {field} {loss}")
+                    problems = validate_entry(e)
+                    if problems:
+                        issue = f"{path.name}[{i}]: " + "; ".join(f"{f}: {p}" for f, p in problems)
+                        if strict:
+                            raise HistoryError(issue)
+                        n_invalid += 1
+                        if max_listed is None or len(invalid) < max_listed:
+                            invalid.append(issue)
+                        continue
+                    problem = interval_problem(e)
+                    if problem:
+                        issue = f"{path.name}[{i}]: {problem}"
+                        if strict:
+                            raise HistoryError(issue)
+                        bad_intervals.append(issue)
+                        if quarantine is not None:
+                            quarantine.append({"file": str(path.relative_to(logs_dir)), "index": i,
+                                               "problem": problem, "record": e})
+                        continue
+                    inp = e["input"]
+                    out = e.get("output", {})
+                    client_id = e["client_id"]
+                    if client_map is not None:
+                        if not 0 <= client_id < CLIENT_NAMESPACE:
+                            issue = (f"{path.name}[{i}]: client_id: {client_id} does not fit "
+                                     f"the per-file namespace (0..{CLIENT_NAMESPACE - 1})")
+                            if strict:
+                                raise HistoryError(issue)
+                            n_invalid += 1
+                            if max_listed is None or len(invalid) < max_listed:
+                                invalid.append(issue)
+                            continue
+                        client_id += file_index * CLIENT_NAMESPACE
+                        client_map[client_id] = {"file": str(path.relative_to(logs_dir)),
+                                                 "client_id": e["client_id"]}
+                    file_ops.append(Operation(
+                        client_id=client_id,
+                        op_type=inp["type"],
+                        key=inp["key"],
+                        write_val=canonical_value(inp.get("value")),
+                        call_ns=e["call"],
+                        return_ns=e["return_time"],
+                        result_val=canonical_value(out.get("value")),
+                        status=e.get("outcome", out.get("status", STATUS_OK)),
+                        op_id=str(e["op_id"]) if "op_id" in e else None,
+                        request_id=str(e["request_id"]) if e.get("request_id") is not None else None,
+                        idempotent=e.get("idempotent", False),
+                        node=e.get("node"),
+                        shard=str(e["shard"]) if e.get("shard") is not None else None,
+                        term=e.get("term"),
+                        read_mode=e.get("read_mode") if inp["type"] == "Get" else None,
+                        meta=e.get("meta") or None,
+                        source=(str(path), i),
+                    ))
+        except (HistoryError, MemoryBudget):
+            raise
+        except Exception as ex:
+            if strict:
+                raise HistoryError(f"{path.name}: {ex}") from None
+            log.warning(f"Could not load {path}: {ex}")
+        if imprecise:
+            log.warning(f"{path.name}: {len(imprecise)} of {n_converted} string/float timestamp(s) are "
+                        f"imprecise, e.g. " + "; ".join(imprecise[:3]))
+        elif n_converted:
+            print(f"  Read {n_converted} string/float timestamp(s) in {path.name} exactly")
+        detected = detect_time_unit([op.call_ns for op in file_ops])
+        unit = time_unit if time_unit != "auto" else detected or "ns"
+        if file_ops and detected is None and time_unit == "auto":
+            log.warning(f"{path.name}: timestamps are not epoch-based; cannot detect their "
+                        f"unit, assuming ns (set --time-unit)")
+        elif detected is not None and detected != unit:
+            log.warning(f"{path.name}: timestamps look like {detected}, not {unit} as given")
+        if unit != "ns":
+            scale = DURATION_UNITS_NS[unit]
+            file_ops = [
+                replace(op, call_ns=op.call_ns * scale, return_ns=op.return_ns * scale)
+                for op in file_ops
+            ]
+            if time_unit == "auto":
+                print(f"  Converted {path.name} from {unit} to ns")
+        rel = str(path.relative_to(logs_dir))
+        offset = next((ns for glob, ns in time_offsets
+                       if fnmatch.fnmatch(path.name, glob) or fnmatch.fnmatch(rel, glob)), None)
+        how = "configured"
+        if offset is None and align_marker is not None:
+            marks = [op for op in file_ops if op.key == align_marker and not op.ambiguous]
+            if not marks:
+                log.warning(f"{path.name}: no operation on marker key {align_marker!r}; not aligned")
+            else:
+                first = min(marks, key=lambda op: op.call_ns)
+                mid = (first.call_ns + first.return_ns) // 2
+                if marker_ref is None:
+                    marker_ref = mid
+                offset, how = marker_ref - mid, f"marker {align_marker!r}"
+        if offset:
+            file_ops = [
+                replace(op, call_ns=op.call_ns + offset, return_ns=op.return_ns + offset)
+                for op in file_ops
+            ]
+            print(f"  Shifted {path.name} by {offset / 1e6:+.3f} ms ({how})")
+        ops.extend(file_ops)
+        if n_invalid:
+            more = (f"\n       … and {n_invalid - len(invalid)} more (use -v to list all, "
+                    f"--strict to stop at the first)") if n_invalid > len(invalid) else ""
+            log.warning(f"Skipped {n_invalid} invalid record(s) in {path.name}:\n       "
+                        + "\n       ".join(invalid) + more, extra={"skipped": n_invalid})
+    if bad_intervals:
+        listed = bad_intervals if max_listed is None else bad_intervals[:max_listed]
+        more = f"\n       … and {len(bad_intervals) - len(listed)} more" if len(bad_intervals) > len(listed) else ""
+        if quarantine is None:
+            raise HistoryError(
+                f"{len(bad_intervals)} record(s) with an impossible interval "
+                f"(use --skip-invalid to quarantine them):\n       " + "\n       ".join(listed) + more
+            )
+        log.warning(f"Quarantined {len(bad_intervals)} record(s) with an impossible interval:\n       "
+                    + "\n       ".join(listed) + more, extra={"quarantined": len(bad_intervals)})
+    return merge_retries(dedup_ops(ops))
+
+
+def dedup_ops(ops: list[Operation]) -> list[Operation]:
+    """
+    Merge records that share an op_id (the same operation recorded at more
+    than one place, e.g. client and proxy). The record with a definite
+    outcome wins; among equals, the first loaded.
+    """
+    by_id: dict[str, int] = {}
+    merged: list[Operation] = []
+    dropped = 0
+    for op in ops:
+        if op.op_id is None:
+            merged.append(op)
+            continue
+        i = by_id.get(op.op_id)
+        if i is None:
+            by_id[op.op_id] = len(merged)
+            merged.append(op)
+            continue
+        dropped += 1
+        kept = merged[i]
+        if (kept.op_type, kept.key) != (op.op_type, op.key):
+            log.warning(f"op_id {op.op_id!r} is recorded as both {kept.op_type}({kept.key!r}) "
+                        f"and {op.op_type}({op.key!r}); keeping the first")
+        elif kept.ambiguous and not op.ambiguous:
+            merged[i] = op
+    if dropped:
+        print(f"  Merged {dropped} duplicate record(s) by op_id")
+    return merged
+
+
+def merge_retries(ops: list[Operation]) -> list[Operation]:
+    """
+    Collapse the attempts a client made under one idempotency token (same
+    client_id and request_id, all marked idempotent: the server applies
+    them at most once) into one at-most-once operation, in place of the
+    first attempt: invoked with the first attempt and returning with the
+    earliest one that definitely applied (a Get is that attempt as is);
+    failed if every attempt failed, else of unknown outcome until the last
+    attempt returned. Attempts that disagree on the operation, or that are
+    not all marked idempotent, are kept apart: each may have been applied.
+    """
+    groups: dict[tuple[int, str], list[int]] = defaultdict(list)
+    for i, op in enumerate(ops):
+        if op.request_id is not None:
+            groups[(op.client_id, op.request_id)].append(i)
+    drop: set[int] = set()
+    unmarked = 0
+    for (client, request_id), idx in groups.items():
+        if len(idx) < 2:
+            continue
+        attempts = [ops[i] for i in idx]
+        if not all(a.idempotent for a in attempts):
+            unmarked += 1
+            continue
+        first = min(attempts, key=lambda a: a.call_ns)
+        if any((a.op_type, a.key, a.write_val) != (first.op_type, first.key, first.write_val) for a in attempts):
+            log.warning(f"request_id {request_id!r} of client {client} is reused for different "
+                        f"operations; keeping its attempts apart")
+            continue
+        applied = [a for a in attempts if not a.ambiguous]
+        if applied:
+            done = min(applied, key=lambda a: a.return_ns)
+            merged = done if done.op_type == "Get" else replace(done, call_ns=first.call_ns)
+        elif all(a.failed for a in attempts):
+            merged = first
+        else:
+            last = max((a for a in attempts if not a.failed), key=lambda a: a.return_ns)
+            merged = replace(last, call_ns=first.call_ns)
+        ops[idx[0]] = merged
+        drop.update(idx[1:])
+    if unmarked:
+        log.warning(f"{unmarked} request_id(s) shared by attempts not marked idempotent; "
+                    f"checking each attempt as its own operation")
+    if drop:
+        print(f"  Merged {len(drop)} retried attempt(s) by request_id")
+    return [op for i, op in enumerate(ops) if i not in drop]
+
+
+def checkable_ops(ops: list[Operation]) -> list[Operation]:
+    """
+    Drop what constrains nothing: operations that definitely failed and reads
+    with an unknown outcome.
+    """
+    return [op for op in ops if not op.failed and not (op.op_type == "Get" and op.ambiguous)]
+
+
+def filter_ops(ops: list[Operation], opts: CheckOptions) -> tuple[list[Operation], int]:
+    """
+    Restrict the history to the keys/clients selected by --keys/--clients.
+    The other clients' Puts on the kept keys stay as context: the selected
+    clients may have read them, and dropping them would turn those reads
+    into violations. Returns (ops, context).
+    """
+    kept, context = [], 0
+    for op in ops:
+        if opts.select.keys is not None and op.key not in opts.select.keys:
+            continue
+        if opts.select.clients is None or op.client_id in opts.select.clients:
+            kept.append(op)
+        elif op.op_type == "Put":
+            kept.append(op)
+            context += 1
+    return kept, context
+
+
+def slice_ops(
+    ops: list[Operation], from_ns: Optional[int], to_ns: Optional[int], limit: Optional[int]
+) -> tuple[list[Operation], int]:
+    """
+    Restrict the history to operations overlapping [from_ns, to_ns] (offsets
+    from the first call), then to the first `limit` of those by call time.
+    Per key, Puts outside the slice that a kept Get may still have observed
+    are added back as context, so the cut does not turn legal reads into
+    violations: earlier Puts not yet overwritten (by a Put invoked after
+    they returned and finished before the key's first kept call), and later
+    Puts invoked before the key's last kept return. Returns (ops, context).
+    """
+    if not ops:
+        return ops, 0
+    origin = min(op.call_ns for op in ops)
+    lo = origin + from_ns if from_ns is not None else None
+    hi = origin + to_ns if to_ns is not None else None
+    ordered = sorted(ops, key=lambda o: (o.call_ns, o.client_id))
+    kept = [op for op in ordered
+            if (lo is None or op.return_ns >= lo) and (hi is None or op.call_ns <= hi)]
+    if limit is not None:
+        kept = kept[:limit]
+    first_call: dict[str, int] = {}
+    last_return: dict[str, int] = {}
+    for op in kept:
+        first_call[op.key] = min(first_call.get(op.key, op.call_ns), op.call_ns)
+        last_return[op.key] = max(last_return.get(op.key, op.return_ns), op.return_ns)
+    # Latest call of a definite Put that finished before the key's first kept call.
+    overwrite_call: dict[str, int] = {}
+    for op in ordered:
+        if (op.op_type == "Put" and not op.ambiguous and op.key in first_call
+                and op.return_ns < first_call[op.key]):
+            overwrite_call[op.key] = max(overwrite_call.get(op.key, op.call_ns), op.call_ns)
+    chosen = {id(op) for op in kept}
+    context = [
+        op for op in ordered
+        if op.op_type == "Put" and id(op) not in chosen and op.key in first_call
+        and (op.ambiguous or op.return_ns >= overwrite_call.get(op.key, op.return_ns))
+        and op.call_ns <= last_return[op.key]
+    ]
+    return sorted(kept + context, key=lambda o: (o.call_ns, o.client_id)), len(context)
+
+
+def find_client_anomalies(ops: list[Operation], sequential_clients: bool = False) -> list[str]:
+    """
+    Recording bugs the checkers would otherwise turn into confusing verdicts:
+    byte-identical duplicate records and, for clients known to issue one
+    request at a time, operations of the same client whose intervals overlap.
+    (The omnipaxos-kv client pipelines requests, so overlap is normal there.)
+    """
+    issues = []
+    seen: dict[tuple, int] = defaultdict(int)
+    for op in ops:
+        seen[(op.client_id, op.op_type, op.key, op.write_val, op.call_ns, op.return_ns,
+              op.result_val, op.status)] += 1
+    for (client, op_type, key, *_), n in seen.items():
+        if n > 1:
+            issues.append(f"client {client}: {op_type}({key!r}) recorded {n} times with identical timestamps")
+    if sequential_clients:
+        by_client: dict[int, list[Operation]] = defaultdict(list)
+        for op in ops:
+            by_client[op.client_id].append(op)
+        for client, cops in sorted(by_client.items()):
+            cops.sort(key=lambda o: o.call_ns)
+            for prev, op in zip(cops, cops[1:]):
+                if op.call_ns < prev.return_ns and op != prev:
+                    issues.append(
+                        f"client {client}: {op.op_type}({op.key!r}) called at t={op.call_ns:,} "
+                        f"before {prev.op_type}({prev.key!r}) returned at t={prev.return_ns:,}"
+                    )
+    return issues
+
+# ── History merging ────────────────────────────────────────────────────────────
+
+# Records of an out-of-order history file sorted in memory at a time.
+MERGE_CHUNK_OPS = 200_000
+# Sorted runs merged at once; more are merged in several passes.
+MERGE_FAN_IN = 64
+
+
+def _merge_key(e: dict) -> tuple[int, int]:
+    return e["call"], e["return_time"]
+
+
+def _merge_entries(path: pathlib.Path, csv_columns: dict[str, str], field_map: Optional[dict], strict: bool,
+                   events: Optional[list[Event]] = None, invalid: Optional[list[str]] = None):
+    """
+    Stream the schema-valid records of history file `path` with their
+    timestamps made integers, in file order. Invalid records are skipped and
+    appended to `invalid` when given; with `strict` the first one raises
+    HistoryError.
+    """
+    with open_history(path) as f:
+        if ".csv" in path.suffixes:
+            entries = iter_csv_entries(f, csv_columns)
+        else:
+            entries = iter_history_entries(f, events, path.name, strict)
+            if field_map:
+                entries = (remap_entry(e, field_map) for e in entries)
+        for i, e in enumerate(entries):
+            if isinstance(e, dict):
+                for field in TIMESTAMP_FIELDS:
+                    if field in e and not is_int(e[field]):
+                        e[field] = normalize_timestamp(e[field])[0]
+            problems = validate_entry(e)
+            if problems:
+                issue = f"{path.name}[{i}]: " + "; ".join(f"{f}: {p}" for f, p in problems)
+                if strict:
+                    raise HistoryError(issue)
+                if invalid is not None:
+                    invalid.append(issue)
+                continue
+            yield e
+
+
+def _spill_run(entries, tmp: pathlib.Path) -> pathlib.Path:
+    """Write records already in merge order to a new JSON-lines run file in `tmp`."""
+    fd, name = tempfile.mkstemp(suffix=".jsonl", dir=tmp)
+    with open(fd, "w") as f:
+        for e in entries:
+            f.write(json.dumps(e) + "\n")
+    return pathlib.Path(name)
+
+
+def _read_run(path: pathlib.Path):
+    with open(path) as f:
+        for line in f:
+            yield json.loads(line, parse_float=JsonFloat)
+
+
+def _event_entry(ev: Event) -> dict:
+    entry = {"time": ev.time_ns, "type": ev.kind, "node": ev.node, "detail": ev.detail or None, "term": ev.term}
+    return {k: v for k, v in entry.items() if v is not None}
+
+
+def merge_histories(
+    paths: list[pathlib.Path],
+    out: pathlib.Path,
+    csv_columns: Optional[dict[str, str]] = None,
+    field_map: Optional[dict] = None,
+    strict: bool = False,
+    chunk_ops: int = MERGE_CHUNK_OPS,
+    tmp_dir: Optional[pathlib.Path] = None,
+) -> int:
+    """
+    Merge history files into one at `out`, in call order (then return
+    order), without holding them in memory: a streaming k-way merge over
+    sorted runs. A file already in call order is a run as it is (a first
+    pass over it tells); any other is sorted `chunk_ops` records at a time
+    into runs spilled to a temporary directory (in `tmp_dir`, else the
+    system's). More than MERGE_FAN_IN runs are merged in several passes.
+
+    The output is written incrementally as a JSON array, or as an object
+    {"events": [...], "operations": [...]} if inputs carry events, gzipped
+    if `out` ends in .gz. Records are copied as they are, with integer
+    timestamps; invalid ones are skipped with a warning (HistoryError with
+    `strict`). Clock offsets, time units and client namespaces are not
+    applied: the inputs must share one clock. Returns the number of
+    records written.
+    """
+    csv_columns = csv_columns or parse_csv_columns("")
+    events: list[Event] = []
+    invalid: list[str] = []
+    n_invalid = 0
+    with tempfile.TemporaryDirectory(prefix="merge-", dir=tmp_dir) as tmp_name:
+        tmp = pathlib.Path(tmp_name)
+        runs: list[Callable] = []
+
+        def spill(entries) -> None:
+            path = _spill_run(entries, tmp)
+            runs.append(lambda: _read_run(path))
+
+        for path in paths:
+            def entries(path=path, events=None, invalid=None):
+                return _merge_entries(path, csv_columns, field_map, strict, events, invalid)
+
+            file_invalid: list[str] = []
+            last, in_order = None, True
+            for e in entries(events=events, invalid=file_invalid):
+                key = _merge_key(e)
+                in_order = in_order and (last is None or last <= key)
+                last = key
+            n_invalid += len(file_invalid)
+            invalid += file_invalid[:10 - len(invalid)]
+            if in_order:
+                runs.append(entries)
+                continue
+            batch: list[dict] = []
+            for e in entries():
+                batch.append(e)
+                if len(batch) == chunk_ops:
+                    spill(sorted(batch, key=_merge_key))
+                    batch = []
+            if batch:
+                spill(sorted(batch, key=_merge_key))
+        while len(runs) > MERGE_FAN_IN:
+            group, runs = runs[:MERGE_FAN_IN], runs[MERGE_FAN_IN:]
+            spill(heapq.merge(*(run() for run in group), key=_merge_key))
+
+        partial = out.with_name(out.name + ".partial")
+        n = 0
+        with (gzip.open(partial, "wt") if out.suffix == ".gz" else open(partial, "w")) as f:
+            if events:
+                f.write('{"events": ' + json.dumps([_event_entry(ev) for ev in events]) + ',\n "operations": ')
+            f.write("[")
+            for e in heapq.merge(*(run() for run in runs), key=_merge_key):
+                f.write(("\n" if n == 0 else ",\n") + json.dumps(e))
+                n += 1
+            f.write("\n]" + ("}" if events else "") + "\n")
+        os.replace(partial, out)
+    if n_invalid:
+        more = f"\n       … and {n_invalid - len(invalid)} more" if n_invalid > len(invalid) else ""
+        log.warning(f"Skipped {n_invalid} invalid record(s):\n       " + "\n       ".join(invalid) + more,
+                    extra={"skipped": n_invalid})
+    return n
+
+# ── Clock skew ─────────────────────────────────────────────────────────────────
+
+# Epoch timestamps (1973 to 5138) in each unit fall in a distinct decade range.
+EPOCH_UNIT_RANGES = (("s", 1e8, 1e11), ("ms", 1e11, 1e14), ("us", 1e14, 1e17), ("ns", 1e17, 1e20))
+
+
+def detect_time_unit(timestamps: list[int]) -> Optional[str]:
+    """
+    The unit of a file's epoch timestamps, from the magnitude of their
+    median; None when they are not epoch-based (e.g. relative to startup).
+    """
+    if not timestamps:
+        return None
+    median = sorted(timestamps)[len(timestamps) // 2]
+    return next((unit for unit, lo, hi in EPOCH_UNIT_RANGES if lo <= median < hi), None)
+
+
+def widen_intervals(ops: list[Operation], skew_ns: int) -> list[Operation]:
+    """Relax real-time order by widening every [call, return] by the skew bound."""
+    if skew_ns <= 0:
+        return ops
+    return [replace(op, call_ns=op.call_ns - skew_ns, return_ns=op.return_ns + skew_ns) for op in ops]
+
+
+def checker_params(opts: CheckOptions) -> dict:
+    """Model parameters a consistency checker takes beyond (ops, deadline)."""
+    params: dict = {}
+    if opts.consistency == "bounded-staleness":
+        params["bound_ns"] = opts.bound_ns
+    if opts.consistency in ("linearizable", "bounded-staleness") and opts.partition == "time":
+        params["epochs"] = True
+    return params
+
+
+def prepare_for_check(ops: list[Operation], opts: CheckOptions) -> list[Operation]:
+    """The operations a checker sees: decidable and skew-widened."""
+    return widen_intervals(checkable_ops(ops), opts.clock_skew_ns)
+
+
+def detect_clock_skew(ops: list[Operation]) -> tuple[int, int]:
+    """
+    Count reads that returned a value whose every write was invoked after the
+    read had already returned. With correct clocks that is impossible (it is
+    either a lost-causality bug or skew between the recording machines), so
+    the largest gap is a lower bound for --clock-skew. Returns (count, gap_ns).
+    """
+    first_call: dict[tuple[str, Value], int] = {}
+    for op in ops:
+        if op.op_type == "Put":
+            k = (op.key, op.write_val)
+            first_call[k] = min(first_call.get(k, op.call_ns), op.call_ns)
+    count, gap = 0, 0
+    for op in ops:
+        if op.op_type != "Get" or op.result_val is None:
+            continue
+        call = first_call.get((op.key, op.result_val))
+        if call is not None and call > op.return_ns:
+            count += 1
+            gap = max(gap, call - op.return_ns)
+    return count, gap
+
+# ── Writing histories ──────────────────────────────────────────────────────────
+
+def plain_value(v: Optional[Value]) -> object:
+    return json.loads(v.text) if isinstance(v, JsonValue) else v
+
+
+def to_history_entry(op: Operation) -> dict:
+    """Serialize an operation in the client's history-*.json format."""
+    inp = {"type": op.op_type, "key": op.key}
+    if op.write_val is not None:
+        inp["value"] = plain_value(op.write_val)
+    out = {"status": op.status}
+    if op.result_val is not None:
+        out["value"] = plain_value(op.result_val)
+    entry = {
+        "client_id": op.client_id,
+        "input": inp,
+        "call": op.call_ns,
+        "output": out,
+        "return_time": op.return_ns,
+    }
+    if op.op_id is not None:
+        entry["op_id"] = op.op_id
+    if op.request_id is not None:
+        entry["request_id"] = op.request_id
+    if op.idempotent:
+        entry["idempotent"] = True
+    if op.node is not None:
+        entry["node"] = op.node
+    if op.shard is not None:
+        entry["shard"] = op.shard
+    if op.term is not None:
+        entry["term"] = op.term
+    if op.read_mode is not None:
+        entry["read_mode"] = op.read_mode
+    if op.meta is not None:
+        entry["meta"] = op.meta
+    return entry
+
+# ── Field maps ─────────────────────────────────────────────────────────────────
+
+# Record fields (dotted for nested ones) that --field-map can take from
+# differently named, possibly nested, fields of a foreign schema.
+FIELD_MAP_FIELDS = (
+    "client_id", "call", "return_time", "input.type", "input.key", "input.value",
+    "output.value", "output.status", "outcome", "op_id", "request_id", "idempotent", "node", "shard", "term",
+    "read_mode", "meta",
+)
+
+
+def parse_field_map(data: dict) -> dict:
+    """
+    Validate a --field-map mapping: {FIELD: SOURCE_PATH} for FIELD in
+    FIELD_MAP_FIELDS, plus an optional "op_names" mapping the schema's
+    operation names to Put/Get.
+    """
+    fields: dict[str, str] = {}
+    op_names: dict[str, str] = {}
+    for name, source in data.items():
+        if name == "op_names":
+            if not isinstance(source, dict) or any(v not in OP_TYPES for v in source.values()):
+                raise ValueError(f"op_names: expected a mapping of operation names to {'/'.join(sorted(OP_TYPES))}")
+            op_names = {str(k): v for k, v in source.items()}
+        elif name not in FIELD_MAP_FIELDS:
+            raise ValueError(f"{name!r}: not one of {', '.join(FIELD_MAP_FIELDS)}, op_names")
+        elif not isinstance(source, str) or not source:
+            raise ValueError(f"{name}: expected the source field name (dotted for nested fields)")
+        else:
+            fields[name] = source
+    return {"fields": fields, "op_names": op_names}
+
+
+def remap_entry(e: object, field_map: dict) -> object:
+    """
+    A foreign history record rewritten to this script's schema per a
+    parse_field_map mapping; fields it does not map are kept where they are.
+    When one source field feeds both input.value and output.value, a Put
+    keeps only the former and a Get only the latter.
+    """
+    if not isinstance(e, dict):
+        return e
+    entry = {k: dict(v) if isinstance(v, dict) else v for k, v in e.items()}
+    fields = field_map["fields"]
+    for name, source in fields.items():
+        value: object = e
+        for part in source.split("."):
+            if not isinstance(value, dict) or part not in value:
+                break
+            value = value[part]
+        else:
+            *parents, leaf = name.split(".")
+            target = entry
+            for part in parents:
+                if not isinstance(target.get(part), dict):
+                    target[part] = {}
+                target = target[part]
+            target[leaf] = value
+    inp, out = entry.get("input"), entry.get("output")
+    if isinstance(inp, dict):
+        op = inp.get("type")
+        if isinstance(op, str) and field_map["op_names"]:
+            inp["type"] = field_map["op_names"].get(op, op)
+        if fields.get("input.value") == fields.get("output.value") and "input.value" in fields:
+            if inp.get("type") == "Get":
+                inp.pop("value", None)
+            elif isinstance(out, dict):
+                out.pop("value", None)
+    return entry
@@ -0,0 +1,709 @@
+"""
+The linearizability checker: per-key search for a linearization, with time
+and memory budgets.
+"""
+
+from __future__ import annotations
+
+import bisect
+import hashlib
+import json
+import pathlib
+import time
+from collections import defaultdict
+from typing import Callable, Optional, Union
+
+from .common import (CheckTimeout, MEMORY, MemoryBudget, Operation, PartitionTimeout, Value, check_deadline,
+                     describe_op, fit_workers, log, quiet_worker)
+from .history import to_history_entry
+
+# ── Linearizability checker ────────────────────────────────────────────────────
+
+def _check_key_rules(
+    key: str, ops: list[Operation], deadline: Optional[float] = None
+) -> tuple[bool, str]:
+    """
+    Rule-based linearizability check for a single key (single-register
+    model), each read against the writes. Sound when it rejects, but not
+    complete: reads that each have a justifying write can still need the
+    writes in two different orders, which only _search_key sees.
+
+    Puts with an ambiguous status may justify a read but are never required
+    to be visible, as they may not have taken effect.
+
+    Rules:
+    (1) Get → None:  violation if any definite Put.return_ns ≤ Get.call_ns
+                     (a committed write must be visible)
+    (2) Get → V:
+        (a) There must exist Put(K,V) with return_ns ≤ Get.return_ns.
+        (b) Some Put(K,V) must not have been overwritten for certain before the
+            Get began: for at least one of them, no definite Put(K,anything)
+            ran entirely between its return and Get.call_ns. (Ambiguous Puts
+            are never overwritten for certain: they may take effect late.)
+    """
+    puts = [op for op in ops if op.op_type == "Put"]
+    committed = [p for p in puts if not p.ambiguous]
+    gets = [op for op in ops if op.op_type == "Get"]
+    puts_of: dict[Value, list[Operation]] = defaultdict(list)
+    for p in puts:
+        puts_of[p.write_val].append(p)
+    # by_call[i:] are the definite Puts invoked at or after by_call_ns[i];
+    # min_ret[i] is the earliest any of them returned.
+    by_call = sorted(committed, key=lambda p: p.call_ns)
+    by_call_ns = [p.call_ns for p in by_call]
+    min_ret = [float("inf")] * (len(by_call) + 1)
+    for i in range(len(by_call) - 1, -1, -1):
+        min_ret[i] = min(by_call[i].return_ns, min_ret[i + 1])
+
+    def overwritten_before(p: Operation, t: int) -> Optional[Operation]:
+        # A definite Put invoked after p returned and returned by t.
+        if p.ambiguous:
+            return None
+        i = bisect.bisect_left(by_call_ns, p.return_ns)
+        if min_ret[i] > t:
+            return None
+        return next(q for q in by_call[i:] if q.return_ns <= t)
+
+    for i, g in enumerate(gets):
+        if i and i % 1024 == 0:
+            check_deadline(deadline, f"{i}/{len(gets)} reads of key {key!r} checked")
+        rv = g.result_val
+
+        if rv is None:
+            # No value returned — must mean the key was absent in this linearization.
+            # Violation if a write had fully committed before this get started.
+            for p in committed:
+                if p.return_ns <= g.call_ns:
+                    return False, (
+                        f"Key '{key}': Get by client {g.client_id} returned None, "
+                        f"but Put({p.write_val!r}) by client {p.client_id} "
+                        f"committed at t={p.return_ns:,} before Get started at t={g.call_ns:,}."
+                    )
+        else:
+            # Returned value rv must correspond to a write that could have been
+            # linearized before this Get.  Two operations can be ordered A before B
+            # iff A.call_ns ≤ B.return_ns (A started before B returned).  Using
+            # Put.return_ns ≤ Get.return_ns is too strict: it rejects valid
+            # concurrent executions where the Put's ack races the Get's ack but
+            # the write was committed (and visible) before the Get was served.
+            valid_writes = [p for p in puts_of.get(rv, ()) if p.call_ns <= g.return_ns]
+            if not valid_writes:
+                return False, (
+                    f"Key '{key}': Get by client {g.client_id} returned {rv!r}, "
+                    f"but no Put({rv!r}) started before Get.return_ns={g.return_ns:,}."
+                )
+
+            # Check for mandatory overwrite: every write of rv was followed,
+            # before this Get began, by a write that must come after it.
+            overwrites = [overwritten_before(p, g.call_ns) for p in valid_writes]
+            if all(overwrites):
+                p, q = max(zip(valid_writes, overwrites), key=lambda pq: pq[0].return_ns)
+                return False, (
+                    f"Key '{key}': Get by client {g.client_id} returned {rv!r}, "
+                    f"but Put({rv!r}) by client {p.client_id} (returned t={p.return_ns:,}) "
+                    f"was overwritten by Put({q.write_val!r}) by client {q.client_id} "
+                    f"(t={q.call_ns:,}..{q.return_ns:,}) before Get started at t={g.call_ns:,}, "
+                    f"and no later write of {rv!r} occurred."
+                )
+
+    return True, "ok"
+
+
+def check_key(
+    key: str, ops: list[Operation], deadline: Optional[float] = None
+) -> tuple[bool, str]:
+    """
+    Check linearizability for a single key (single-register model): the
+    _check_key_rules first, which reject most violations quickly and name
+    the read at fault, then the exact search for an order of all the ops,
+    which decides what the rules accept.
+    """
+    ok, message = _check_key_rules(key, ops, deadline)
+    if not ok:
+        return False, message
+    order, prefix = _search_key(ops, deadline=deadline)
+    if order is not None:
+        return True, "ok"
+    return False, _stuck_message(key, ops, prefix)
+
+
+def _stuck_message(key: str, ops: list[Operation], prefix: list[Operation], start: Optional[Value] = None) -> str:
+    """Why one key has no linearization, from the longest valid prefix the search found."""
+    placed = {id(op) for op in prefix}
+    pending = [op for op in ops if id(op) not in placed and not op.ambiguous]
+    value = next((op.write_val for op in reversed(prefix) if op.op_type == "Put"), start)
+    head = (f"Key '{key}': each read has a write to justify it, but no order of the {len(ops)} ops "
+            f"is linearizable: the longest valid prefix places {len(prefix)} of them")
+    if prefix:
+        head += f", ending with {describe_op(prefix[-1])} (t={prefix[-1].call_ns:,}..{prefix[-1].return_ns:,})"
+    head += f" with the value at {value!r}, and no remaining op can follow it"
+    if not pending:
+        return head + "."
+    nxt = min(pending, key=lambda o: o.return_ns)
+    return head + f"; the first of them to return is {describe_op(nxt)} (t={nxt.call_ns:,}..{nxt.return_ns:,})."
+
+
+def quiescent_segments(ops: list[Operation]) -> list[list[Operation]]:
+    """
+    One key's operations split at the points where none is in flight: every
+    op of a segment returned before any op of the next was invoked. An
+    ambiguous Put is in flight to the end (it may take effect at any time),
+    so nothing after its call is split off.
+    """
+    segments: list[list[Operation]] = []
+    current: list[Operation] = []
+    horizon = float("-inf")
+    for op in sorted(ops, key=lambda o: o.call_ns):
+        if current and op.call_ns > horizon:
+            segments.append(current)
+            current = []
+        current.append(op)
+        horizon = max(horizon, float("inf") if op.op_type == "Put" and op.ambiguous else op.return_ns)
+    if current:
+        segments.append(current)
+    return segments
+
+
+def _check_key_epochs(
+    key: str, ops: list[Operation], deadline: Optional[float] = None
+) -> tuple[bool, str]:
+    """
+    The same decision as check_key, reached over the quiescent_segments of
+    one key in order. Every op of a segment precedes every op of the next
+    in any linearization, so the key is linearizable iff each segment is
+    from some value the one before may have ended on. A segment is searched
+    exactly (_search_key) from each such value, once per value it may end
+    on: the one it started from if it writes nothing, else that of a Put no
+    other of its Puts was invoked after. This costs the sum of the
+    segments' searches rather than one over the whole key.
+    """
+    ok, message = _check_key_rules(key, ops, deadline)
+    if not ok:
+        return False, message
+    segments = quiescent_segments(ops)
+    starts: list[Optional[Value]] = [None]
+    for n, segment in enumerate(segments):
+        check_deadline(deadline, f"{n} time epoch(s) of key {key!r} checked")
+        puts = sorted((op for op in segment if op.op_type == "Put"), key=lambda p: p.call_ns)
+        if n == len(segments) - 1:
+            ends: Optional[list] = [_ANY_END]
+        elif puts:
+            # A Put can be the last one unless another was invoked after it returned.
+            last, runner_up = puts[-1], puts[-2].call_ns if len(puts) > 1 else float("-inf")
+            ends = list(dict.fromkeys(p.write_val for p in puts
+                                      if p.return_ns > (runner_up if p is last else last.call_ns)))
+        else:
+            ends = None
+        reached: list = []
+        for start in starts:
+            for end in ends if ends is not None else [start]:
+                if end not in reached and _search_key(segment, start, end, deadline)[0] is not None:
+                    reached.append(end)
+        if not reached:
+            prefix, start = max(((_search_key(segment, start, deadline=deadline)[1], start) for start in starts),
+                                key=lambda found: len(found[0]))
+            message = _stuck_message(key, segment, prefix, start)
+            if len(segments) > 1:
+                message = message[:-1] + f" (time epoch {n + 1} of {len(segments)}, from the value {start!r})."
+            return False, message
+        starts = reached
+    return True, "ok"
+
+
+def offending_read(key: str, ops: list[Operation]) -> Optional[Operation]:
+    """
+    The read of one key at which it stops being linearizable: the first (by
+    call time) such that the reads up to it and every write admit no order.
+    None if the key passes. Dropping reads only removes constraints, so it
+    is found by bisection.
+    """
+    puts = [op for op in ops if op.op_type == "Put"]
+    gets = sorted((op for op in ops if op.op_type == "Get"), key=lambda o: o.call_ns)
+
+    def fits(m: int) -> bool:
+        return check_key(key, puts + gets[:m])[0]
+
+    if fits(len(gets)):
+        return None
+    lo, hi = 0, len(gets)   # the writes alone always fit
+    while hi - lo > 1:
+        mid = (lo + hi) // 2
+        if fits(mid):
+            lo = mid
+        else:
+            hi = mid
+    return gets[hi - 1]
+
+
+def explain_key(key: str, ops: list[Operation], origin_ns: int) -> Optional[str]:
+    """
+    A narrative for the offending_read of one key, with times in ms since
+    `origin_ns`; None if every read is justified on its own.
+    """
+    def ms(t: int) -> str:
+        return f"t={(t - origin_ns) / 1e6:.3f}ms"
+
+    puts = [op for op in ops if op.op_type == "Put"]
+    g = offending_read(key, ops)
+    if g is None:
+        return None
+    read = f"Get({key!r}) by client {g.client_id} at {ms(g.call_ns)}–{(g.return_ns - origin_ns) / 1e6:.3f}ms"
+    if _check_key_rules(key, puts + [g])[0]:
+        # Justified on its own: it is the reads before it that fix another order of the writes.
+        before = [r for r in ops if r.op_type == "Get" and r.return_ns < g.call_ns]
+        other = max((r for r in before if r.result_val != g.result_val), key=lambda r: r.return_ns, default=None)
+        if other is None:
+            return (f"{read} returned {g.result_val!r}; each read has a write to justify it, but the "
+                    f"reads up to this one admit no single order of the writes.")
+        same = max((r for r in before if r.result_val == g.result_val and r.return_ns < other.call_ns),
+                   key=lambda r: r.return_ns, default=None)
+        seen = (f", after Get by client {same.client_id} had returned {g.result_val!r} at "
+                f"{ms(same.return_ns)}" if same else "")
+        return (f"{read} returned {g.result_val!r}, which a write could explain on its own, but Get by "
+                f"client {other.client_id} had returned {other.result_val!r} at {ms(other.return_ns)}{seen}; "
+                f"no single order of the writes explains all of these reads.")
+    done = [p for p in puts if not p.ambiguous and p.return_ns <= g.call_ns]
+    if g.result_val is None:
+        last = max(done, key=lambda p: p.return_ns)
+        return (f"{read} found no value, but Put({key!r}, {last.write_val!r}) by client "
+                f"{last.client_id} had completed at {ms(last.return_ns)}, before the read began; "
+                f"a completed write must be visible to every later read.")
+    sources = [p for p in puts if p.write_val == g.result_val]
+    if not any(p.call_ns <= g.return_ns for p in sources):
+        when = f" (the first one only started at {ms(min(p.call_ns for p in sources))})" if sources else ""
+        return (f"{read} returned {g.result_val!r}, but no Put({key!r}, {g.result_val!r}) had "
+                f"started by the time it returned{when}; the value was never written.")
+    source = max(sources, key=lambda p: p.return_ns)
+    newest = max(done, key=lambda p: p.return_ns)
+    return (f"{read} returned {g.result_val!r}, but the most recent completed Put({key!r}) wrote "
+            f"{newest.write_val!r} at {ms(newest.return_ns)}, and the write of {g.result_val!r} "
+            f"(client {source.client_id}, done at {ms(source.return_ns)}) had already been "
+            f"overwritten before the read began; no concurrent Put could justify {g.result_val!r}.")
+
+
+def partition_by_key(ops: list[Operation]) -> dict[str, list[Operation]]:
+    """Project the history onto each key, ordered numerically-then-lexically."""
+    by_key: dict[str, list[Operation]] = defaultdict(list)
+    for op in ops:
+        by_key[op.key].append(op)
+    return {key: by_key[key] for key in sorted(by_key, key=lambda k: (len(k), k))}
+
+
+# Below this many ops a check is quick however the keys are spread.
+BALANCE_MIN_OPS = 1000
+# A key with more than this share of the ops is reported as hot.
+HOT_KEY_SHARE = 0.5
+# Partitioning by key should make the check at least this much faster
+# (total ops / largest partition) before the spread is reported as skewed.
+BALANCE_MIN_SPEEDUP = 4.0
+
+
+def partition_balance(partitions: dict[str, list[Operation]], parallelism: int = 1) -> list[str]:
+    """
+    Warnings for a key spread that per-key checking handles badly: one key
+    holding most ops (its partition is checked as a whole, however long that
+    takes), or a skew that leaves the split (and --parallelism) little to
+    gain. Each names the keys and suggests workload or flag changes.
+    """
+    total = sum(map(len, partitions.values()))
+    if total < BALANCE_MIN_OPS or not partitions:
+        return []
+    top = sorted(partitions, key=lambda k: len(partitions[k]), reverse=True)
+    largest = len(partitions[top[0]])
+    speedup = total / largest
+    if largest / total > HOT_KEY_SHARE:
+        return [f"Hot key: {top[0]!r} has {largest / total:.0%} of the {total:,} ops and is checked as "
+                f"one partition, so splitting the history by key barely helps. Spread the workload over more keys (e.g. workload = \"kv\" or \"set\"), or "
+                "give the key time with --check-timeout / --partition-timeout auto, or check it "
+                "in time slices with --window."]
+    if speedup < BALANCE_MIN_SPEEDUP or 1 < parallelism and speedup < parallelism:
+        heavy = ", ".join(f"{k!r} {len(partitions[k]) / total:.0%}"
+                          for k in top[:3] if len(partitions[k]) * 100 >= total)
+        gain = f"--parallelism {parallelism}" if parallelism > 1 else "per-key partitioning"
+        if len(partitions) < 2 * BALANCE_MIN_SPEEDUP:
+            what = f"Few keys: the {total:,} ops fall on only {len(partitions)} keys"
+        else:
+            what = f"Skewed keys: a few of the {len(partitions)} keys hold most of the {total:,} ops"
+        return [f"{what} ({heavy}), so {gain} can make the check at most {speedup:.1f}x faster. "
+                f"Spread the workload's requests over more keys, or use --partition-timeout auto "
+                f"so the big keys cannot starve the rest."]
+    return []
+
+
+class Checkpoint:
+    """
+    Digests of key partitions already proven linearizable, appended to a
+    progress file as each one passes so an interrupted or timed-out check
+    can be resumed without redoing them.
+    """
+
+    def __init__(self, path: pathlib.Path, resume: bool) -> None:
+        self.path = path
+        self.passed: set[str] = set()
+        if resume and path.exists():
+            self.passed = set(path.read_text().split())
+        elif path.exists():
+            path.unlink()
+
+    @staticmethod
+    def digest(key: str, ops: list[Operation]) -> str:
+        doc = json.dumps([key, [to_history_entry(op) for op in ops]], sort_keys=True)
+        return hashlib.sha256(doc.encode()).hexdigest()
+
+    def mark(self, digest: str) -> None:
+        self.passed.add(digest)
+        self.path.parent.mkdir(parents=True, exist_ok=True)
+        with open(self.path, "a") as f:
+            f.write(digest + "\n")
+
+    def finish(self) -> None:
+        """The check completed: nothing left to resume."""
+        self.path.unlink(missing_ok=True)
+
+
+def _check_partition(
+    key: str, ops: list[Operation], budget: Optional[float], until: Optional[float] = None,
+    epochs: bool = False,
+) -> tuple[bool, str, bool]:
+    """
+    Check one key partition, by time epochs with `epochs`, within its own
+    budget, and not past the overall deadline `until`: (ok, message,
+    timed_out). The message of a timed-out partition is what ran out,
+    "time" or "memory".
+    """
+    deadline = time.monotonic() + budget if budget is not None else None
+    if until is not None:
+        deadline = until if deadline is None else min(deadline, until)
+    check = _check_key_epochs if epochs else check_key
+    try:
+        return (*check(key, ops, deadline), False)
+    except CheckTimeout as ex:
+        return True, "memory" if isinstance(ex, MemoryBudget) else "time", True
+
+
+# Smallest budget --partition-timeout auto gives a key partition.
+MIN_PARTITION_BUDGET_S = 0.5
+
+
+def check_linearizability(
+    ops: list[Operation],
+    deadline: Optional[float] = None,
+    checkpoint: Optional[Checkpoint] = None,
+    parallelism: int = 1,
+    partition_timeout: Union[float, str, None] = None,
+    verdicts: Optional[dict[str, tuple[str, int]]] = None,
+    epochs: bool = False,
+) -> tuple[bool, list[str]]:
+    """
+    Check the full history by projecting onto each key independently; with
+    `epochs` each key is checked by time epochs too (see _check_key_epochs).
+    `verdicts`, when given, receives key → (PASS/FAIL/UNKNOWN, op count)
+    for every partition that was decided or resumed; partitions not reached
+    before `deadline` are UNKNOWN.
+
+    With `parallelism` > 1 partitions are checked in that many worker
+    processes. With `partition_timeout` each partition gets its own budget,
+    so one huge key cannot starve the rest: that many seconds, or with
+    "auto" its share (by op count, across the workers) of the time left
+    until `deadline`, at least MIN_PARTITION_BUDGET_S. If none fails but
+    some ran out of budget, the verdict is unknown (CheckTimeout). Running
+    past `deadline` is only unknown if no completed partition failed.
+
+    Under --max-memory, fewer workers start if there is no room for them,
+    each limited to its share, and a key that runs out of memory is as one
+    that runs out of time (MemoryBudget if nothing else stopped the check).
+    """
+    partitions = partition_by_key(ops)
+    todo = []
+    skipped = 0
+    for key, key_ops in partitions.items():
+        digest = checkpoint.digest(key, key_ops) if checkpoint else None
+        if checkpoint and digest in checkpoint.passed:
+            skipped += 1
+            if verdicts is not None:
+                verdicts[key] = ("PASS", len(key_ops))
+        else:
+            todo.append((key, key_ops, digest))
+    if skipped:
+        print(f"  Resumed: {skipped}/{len(partitions)} key(s) already proven linearizable")
+
+    results: dict[str, tuple[bool, str, bool]] = {}
+    total_ops = sum(len(key_ops) for _, key_ops, _ in todo)
+    ops_done = 0
+    budget: Callable[[list[Operation]], Optional[float]] = lambda key_ops: partition_timeout
+    if partition_timeout == "auto":
+        left = None if deadline is None else max(deadline - time.monotonic(), 0.0)
+        budget = lambda key_ops: None if left is None else max(
+            MIN_PARTITION_BUDGET_S, left * min(parallelism, len(todo)) * len(key_ops) / max(total_ops, 1))
+
+    def status() -> str:
+        return (f"{skipped + len(results)}/{len(partitions)} keys checked, "
+                f"{ops_done:,}/{total_ops:,} ops")
+
+    def record(key: str, digest: Optional[str], result: tuple[bool, str, bool]) -> None:
+        nonlocal ops_done
+        ops_done += len(partitions[key])
+        results[key] = result
+        ok, _, timed_out = result
+        if verdicts is not None:
+            verdicts[key] = ("UNKNOWN" if timed_out else "PASS" if ok else "FAIL", len(partitions[key]))
+        if ok and not timed_out and checkpoint:
+            checkpoint.mark(digest)
+
+    def found() -> list[str]:
+        return [msg for key in partitions if key in results for ok, msg, _ in [results[key]] if not ok]
+
+    try:
+        if parallelism > 1 and len(todo) > 1:
+            from concurrent.futures import FIRST_COMPLETED, ProcessPoolExecutor, wait
+            parallelism = fit_workers(parallelism)
+            with ProcessPoolExecutor(max_workers=parallelism, initializer=quiet_worker,
+                                     initargs=(MEMORY.share(parallelism),)) as pool:
+                pending = {
+                    pool.submit(_check_partition, key, key_ops, budget(key_ops), deadline,
+                                epochs): (key, digest)
+                    for key, key_ops, digest in todo
+                }
+                try:
+                    while pending:
+                        check_deadline(deadline, status())
+                        # Wake up at least every second to refresh the progress line.
+                        timeout = 1.0 if deadline is None else min(1.0, max(0.0, deadline - time.monotonic()))
+                        done, _ = wait(pending, timeout=timeout, return_when=FIRST_COMPLETED)
+                        for fut in done:
+                            key, digest = pending.pop(fut)
+                            record(key, digest, fut.result())
+                except BaseException:
+                    for fut in pending:
+                        fut.cancel()
+                    raise
+        else:
+            for key, key_ops, digest in todo:
+                check_deadline(deadline, status())
+                record(key, digest, _check_partition(key, key_ops, budget(key_ops), deadline, epochs))
+        if any(t for _, _, t in results.values()):
+            # A partition cut short by the overall deadline, not its own budget.
+            check_deadline(deadline, status())
+    except CheckTimeout as ex:
+        unreached = [key for key, _, _ in todo if key not in results]
+        if verdicts is not None:
+            for key in unreached:
+                verdicts[key] = ("UNKNOWN", len(partitions[key]))
+        if not found():
+            raise
+        # A failed partition is a definite violation, whatever the rest would say.
+        what = "Memory limit reached" if isinstance(ex, MemoryBudget) else "Time budget ran out"
+        log.warning(f"{what} with {len(unreached)} key(s) unchecked; "
+                    f"the verdict stands on the {len(results)} checked")
+        return False, found()
+
+    violations = found()
+    timed_out = [key for key, (_, _, t) in results.items() if t]
+    if checkpoint:
+        checkpoint.finish()
+    if timed_out and not violations:
+        over_memory = [key for key in timed_out if results[key][1] == "memory"]
+        if over_memory:
+            raise MemoryBudget(f"{len(over_memory)} key(s) ran out of memory (e.g. {over_memory[0]!r})")
+        per_key = "its share of the" if partition_timeout == "auto" else f"the {partition_timeout:g}s"
+        raise PartitionTimeout(
+            f"{len(timed_out)} key(s) exceeded {per_key} per-key budget (e.g. {timed_out[0]!r})"
+        )
+    return not violations, violations
+
+
+# _search_key's `end` when any final value will do.
+_ANY_END = object()
+
+
+def _search_key(
+    ops: list[Operation], start: Optional[Value] = None, end: object = _ANY_END,
+    deadline: Optional[float] = None,
+) -> tuple[Optional[list[Operation]], list[Operation]]:
+    """
+    Wing & Gong search for a linearization of one key's operations under
+    single-register semantics, from the value `start` (None: unset) and, if
+    `end` is given, leaving that value. Ambiguous Puts may be left out.
+    Returns (order, []) for the first order found, else (None, the longest
+    valid prefix it reached).
+
+    Pending ops are kept in a doubly linked list of their call and return
+    times: those called before the first return may go next, so finding
+    them costs the number in flight, not the length of the key. A read that
+    may go next and sees the current value is taken without branching (it
+    changes nothing), and an ambiguous Put is dropped once no pending read
+    (nor `end`) wants its value. States are memoized on (linearized set,
+    value), the set as a bitmask from the first pending op on.
+    """
+    ops = sorted(ops, key=lambda o: o.call_ns)
+    n = len(ops)
+    inf = float("inf")
+    # At equal times a return goes first (the ops do not overlap), except an
+    # op's own. An ambiguous Put never has to be linearized, so never bounds others.
+    times = sorted(
+        [(op.call_ns, 1, i) for i, op in enumerate(ops)]
+        + [(inf, 0, i) if op.ambiguous else (op.return_ns, 0 if op.return_ns > op.call_ns else 2, i)
+           for i, op in enumerate(ops)]
+    )
+    last = 2 * n + 1                    # positions 1..2n; 0 and `last` are sentinels
+    nxt = list(range(1, last + 2))
+    prv = list(range(-1, last + 1))
+    owner = [-1] + [i for _, _, i in times] + [-1]
+    is_call = [False] + [kind == 1 for _, kind, _ in times] + [False]
+    call_at, ret_at = [0] * n, [0] * n
+    for pos, (_, kind, i) in enumerate(times, 1):
+        if kind == 1:
+            call_at[i] = pos
+        else:
+            ret_at[i] = pos
+    reads_left: dict[Optional[Value], int] = defaultdict(int)
+    maybe_puts: dict[Optional[Value], list[int]] = defaultdict(list)
+    for i, op in enumerate(ops):
+        if op.op_type == "Get":
+            reads_left[op.result_val] += 1
+        elif op.ambiguous:
+            maybe_puts[op.write_val].append(i)
+
+    required = sum(1 for op in ops if not op.ambiguous)
+    value = start
+    mask = 0
+    required_done = 0
+    trail: Optional[tuple] = None       # linearized ops, latest first: (i, rest)
+    depth = 0
+    best: Optional[tuple] = None
+    best_depth = 0
+    visited: set[tuple[int, int, Optional[Value]]] = set()
+    explored = 0
+
+    def unlink(i: int) -> None:
+        nonlocal mask
+        for pos in (call_at[i], ret_at[i]):
+            nxt[prv[pos]] = nxt[pos]
+            prv[nxt[pos]] = prv[pos]
+        mask |= 1 << i
+
+    def relink(i: int) -> None:
+        nonlocal mask
+        for pos in (ret_at[i], call_at[i]):
+            nxt[prv[pos]] = pos
+            prv[nxt[pos]] = pos
+        mask ^= 1 << i
+
+    def drop_unwanted(v: Optional[Value]) -> list[int]:
+        # Ambiguous Puts of a value nothing pending reads any more can only
+        # get in the way: leave them out, as if never applied.
+        if reads_left[v] or v == end:
+            return []
+        dropped = [i for i in maybe_puts.get(v, ()) if not mask >> i & 1]
+        for i in dropped:
+            unlink(i)
+        return dropped
+
+    def candidates() -> list[int]:
+        found = []
+        pos = nxt[0]
+        while is_call[pos]:
+            i = owner[pos]
+            if ops[i].op_type == "Put":
+                found.append(i)
+            elif ops[i].result_val == value:
+                return [i]
+            pos = nxt[pos]
+        return found
+
+    def state() -> tuple[int, int, Optional[Value]]:
+        lo = owner[nxt[0]] if is_call[nxt[0]] else n
+        return lo, mask >> lo, value
+
+    def complete() -> bool:
+        return required_done == required and (end is _ANY_END or value == end)
+
+    def undo(i: int, prev: Optional[Value], dropped: list[int]) -> None:
+        nonlocal value, required_done, trail, depth
+        for j in reversed(dropped):
+            relink(j)
+        if ops[i].op_type == "Get":
+            reads_left[ops[i].result_val] += 1
+        relink(i)
+        value = prev
+        trail = trail[1]
+        depth -= 1
+        required_done -= not ops[i].ambiguous
+
+    def linearized(t: Optional[tuple]) -> list[Operation]:
+        out = []
+        while t is not None:
+            out.append(ops[t[0]])
+            t = t[1]
+        return out[::-1]
+
+    for v in list(maybe_puts):
+        drop_unwanted(v)
+    if complete():
+        return [], []
+    visited.add(state())
+    frames: list[list] = [[candidates(), 0, None]]
+    while frames:
+        explored += 1
+        if explored % 4096 == 0:
+            check_deadline(deadline, f"{explored:,} states explored for key {ops[0].key!r}")
+        frame = frames[-1]
+        cands, idx, move = frame
+        if idx >= len(cands):
+            if depth > best_depth:
+                best, best_depth = trail, depth
+            frames.pop()
+            if move is not None:
+                undo(*move)
+            continue
+        frame[1] += 1
+        i = cands[idx]
+        prev = value
+        unlink(i)
+        dropped: list[int] = []
+        if ops[i].op_type == "Put":
+            value = ops[i].write_val
+        else:
+            reads_left[value] -= 1
+            dropped = drop_unwanted(value)
+        trail = (i, trail)
+        depth += 1
+        required_done += not ops[i].ambiguous
+        if complete():
+            return linearized(trail), []
+        key = state()
+        if key in visited:
+            undo(i, prev, dropped)
+            continue
+        visited.add(key)
+        frames.append([candidates(), 0, (i, prev, dropped)])
+    return None, linearized(best)
+
+
+def linearize_key(
+    ops: list[Operation], deadline: Optional[float] = None
+) -> Optional[list[Operation]]:
+    """
+    A witness linearization of one key's operations (see _search_key), or
+    None if there is none. Ambiguous Puts may be left out.
+    """
+    return _search_key(ops, deadline=deadline)[0]
+
+
+def write_witness(ops: list[Operation], path: pathlib.Path, deadline: Optional[float] = None) -> list[str]:
+    """
+    Write a witness linearization per key ({key: [ops in linearization
+    order]}, history format) to `path`. Returns the keys that have none:
+    the search is exhaustive, so these are not linearizable.
+    """
+    witness: dict[str, list[dict]] = {}
+    missing: list[str] = []
+    for key, key_ops in partition_by_key(ops).items():
+        order = linearize_key(key_ops, deadline)
+        if order is None:
+            missing.append(key)
+        else:
+            witness[key] = [to_history_entry(op) for op in order]
+    with open(path, "w") as f:
+        json.dump(witness, f, indent=2)
+    return missing
@@ -0,0 +1,978 @@
+"""
+Plots, timelines, traces and the interactive result browser.
+"""
+
+from __future__ import annotations
+
+import json
+import os
+import pathlib
+import re
+import shutil
+import sys
+import urllib.parse
+import urllib.request
+import webbrowser
+from collections import defaultdict
+from dataclasses import dataclass
+from typing import Callable, Optional
+
+from .checkers import SNAPSHOT_EVENTS
+from .common import CheckOptions, DEFINITE_STATUSES, Event, Operation, STATUS_ERROR, STATUS_FAIL, log
+from .history import plain_value
+from .linearizability import offending_read, partition_by_key
+from .reports import compute_history_latencies_ms, compute_history_rps, compute_time_series
+
+try:
+    import matplotlib
+    matplotlib.use("Agg")
+    import matplotlib.pyplot as plt
+    HAS_MATPLOTLIB = True
+except ImportError:
+    HAS_MATPLOTLIB = False
+
+try:
+    import curses
+except ImportError:         # e.g. Windows without windows-curses
+    curses = None
+
+# ── Timeline export ────────────────────────────────────────────────────────────
+
+TIMELINE_FORMAT_VERSION = 1
+
+
+def timeline_data(
+    config_name: str,
+    ops: list[Operation],
+    verdicts: dict[str, tuple[str, int]],
+    events: list[Event],
+    violations: list[str],
+    lin_ok: Optional[bool],
+    consistency: str,
+    chains: Optional[list[list[Operation]]] = None,
+) -> dict:
+    """
+    The data behind the plots, for external dashboards. Format (version 1):
+
+        config, consistency, verdict ("PASS"/"FAIL"/"UNKNOWN")
+        start_ns          absolute time (ns) that every *_ms field is relative to
+        operations[]      id, client_id, node, shard, term, read_mode,
+                          meta (or null), type, key, value
+                          (written or read), status, call_ms, return_ms,
+                          partition (= key), chain (index into chains of
+                          the first one the op is on, or null)
+        partitions{}      key → {verdict, ops}  (linearizable checks only)
+        events[]          time_ms, type, node, detail, term
+        violations[]      the checker's messages
+        chains[]          op ids of each causal cycle or violating
+                          dependency chain (see check_causal), in order
+
+    Reduced timelines (see reduce_timeline) also carry window_ms [from, to]
+    (the page shown) and note (what was left out).
+    """
+    start_ns = min((op.call_ns for op in ops), default=0)
+    ordered = sorted(ops, key=lambda o: (o.call_ns, o.client_id))
+    # The checker saw skew-widened copies: match them by record, else by content.
+    ids = {_op_identity(op): i for i, op in enumerate(ordered)}
+    chain_ids = [[ids[_op_identity(op)] for op in chain if _op_identity(op) in ids] for chain in chains or []]
+    on_chain: dict[int, int] = {}
+    for n, chain in enumerate(chain_ids):
+        for i in chain:
+            on_chain.setdefault(i, n)
+    return {
+        "format_version": TIMELINE_FORMAT_VERSION,
+        "config": config_name,
+        "consistency": consistency,
+        "verdict": {True: "PASS", False: "FAIL", None: "UNKNOWN"}[lin_ok],
+        "start_ns": start_ns,
+        "operations": [
+            {
+                "id": i,
+                "client_id": op.client_id,
+                "node": op.node,
+                "shard": op.shard,
+                "term": op.term,
+                "read_mode": op.read_mode,
+                "meta": op.meta,
+                "type": op.op_type,
+                "key": op.key,
+                "value": plain_value(op.write_val if op.op_type == "Put" else op.result_val),
+                "status": op.status,
+                "call_ms": (op.call_ns - start_ns) / 1e6,
+                "return_ms": (op.return_ns - start_ns) / 1e6,
+                "partition": op.key,
+                "chain": on_chain.get(i),
+            }
+            for i, op in enumerate(ordered)
+        ],
+        "partitions": {k: {"verdict": v, "ops": n} for k, (v, n) in verdicts.items()},
+        "events": [
+            {"time_ms": (ev.time_ns - start_ns) / 1e6, "type": ev.kind, "node": ev.node,
+             "detail": ev.detail, "term": ev.term}
+            for ev in events
+        ],
+        "violations": violations,
+        "chains": chain_ids,
+    }
+
+
+def _op_identity(op: Operation) -> tuple:
+    if op.source is not None:
+        return op.source
+    return (op.client_id, op.op_type, op.key, op.write_val, op.result_val, op.status, op.op_id)
+
+
+# Time buckets per lane that --timeline-max-ops thins independently.
+DOWNSAMPLE_BUCKETS = 500
+
+
+def _anomalous(op: dict, failed: set[str]) -> bool:
+    return op["partition"] in failed or op["status"] not in DEFINITE_STATUSES or op.get("chain") is not None
+
+
+def downsample_timeline(data: dict, max_ops: int, lanes: str = "client") -> dict:
+    """
+    Thin timeline_data() to about `max_ops` operations: every op on a failing
+    key or a violation's chain, or with an unknown outcome, is kept; the others are capped per lane
+    and time bucket (DOWNSAMPLE_BUCKETS across the window), at the largest
+    cap that fits, keeping evenly spaced ops, so only dense regions lose
+    detail. If not even one op per bucket fits, evenly spaced ops are kept.
+    """
+    ops = data["operations"]
+    if len(ops) <= max_ops:
+        return data
+    failed = {k for k, p in data["partitions"].items() if p["verdict"] == "FAIL"}
+    field = LANE_LAYOUTS[lanes][0]
+    start, end = _timeline_window(data)
+    buckets: dict[tuple, list[dict]] = defaultdict(list)
+    for op in ops:
+        if not _anomalous(op, failed):
+            bucket = int((op["call_ms"] - start) / ((end - start) or 1.0) * DOWNSAMPLE_BUCKETS)
+            buckets[(op[field], min(max(bucket, 0), DOWNSAMPLE_BUCKETS - 1))].append(op)
+    budget = max(max_ops - (len(ops) - sum(map(len, buckets.values()))), 0)
+    if budget < len(buckets):
+        buckets = {(): sorted((op for b in buckets.values() for op in b), key=lambda o: o["id"])}
+    lo, hi = 0, max((len(b) for b in buckets.values()), default=0)
+    while lo < hi:
+        cap = (lo + hi + 1) // 2
+        if sum(min(len(b), cap) for b in buckets.values()) <= budget:
+            lo = cap
+        else:
+            hi = cap - 1
+    dropped: set[int] = set()
+    for b in buckets.values():
+        if len(b) > lo:
+            keep = {round(i * (len(b) - 1) / (lo - 1)) for i in range(lo)} if lo > 1 else {len(b) // 2} if lo else set()
+            dropped.update(op["id"] for i, op in enumerate(b) if i not in keep)
+    kept = [op for op in ops if op["id"] not in dropped]
+    note = f"{len(kept)} of {len(ops)} ops shown (dense regions downsampled)"
+    return {**data, "operations": kept, "note": _join_notes(data.get("note"), note)}
+
+
+def _join_notes(*notes: Optional[str]) -> Optional[str]:
+    return "; ".join(n for n in notes if n) or None
+
+
+def reduce_timeline(data: dict, failing_only: bool = False, page_ms: Optional[float] = None,
+                    max_ops: Optional[int] = None, lanes: str = "client") -> list[dict]:
+    """
+    Make a large timeline_data() renderable: keep only the failing key
+    partitions and violation chains, split it into pages of `page_ms` (each with the ops that
+    overlap its window_ms), then downsample each page to `max_ops` (see
+    downsample_timeline). Pages without operations are dropped.
+    """
+    if failing_only:
+        failed = {k for k, p in data["partitions"].items() if p["verdict"] == "FAIL"}
+        ops = [op for op in data["operations"] if op["partition"] in failed or op.get("chain") is not None]
+        data = {**data, "operations": ops,
+                "note": f"failing keys only ({len(ops)} of {len(data['operations'])} ops)"}
+    pages = [data]
+    if page_ms:
+        end = max((op["return_ms"] for op in data["operations"]), default=0.0)
+        pages = []
+        for n in range(int(end // page_ms) + 1):
+            lo, hi = n * page_ms, (n + 1) * page_ms
+            ops = [op for op in data["operations"] if op["call_ms"] < hi and op["return_ms"] >= lo]
+            if ops:
+                pages.append({
+                    **data, "operations": ops, "window_ms": [lo, hi],
+                    "events": [ev for ev in data["events"] if lo <= ev["time_ms"] < hi],
+                    "note": _join_notes(data.get("note"), f"page {n + 1} of {int(end // page_ms) + 1}"),
+                })
+    if max_ops:
+        pages = [downsample_timeline(page, max_ops, lanes) for page in pages]
+    return [page for page in pages if page["operations"]]
+
+
+def _timeline_window(data: dict) -> tuple[float, float]:
+    """The [from, to] ms a timeline renders: its page, or 0 to the last return."""
+    if data.get("window_ms"):
+        return tuple(data["window_ms"])
+    return 0.0, max((op["return_ms"] for op in data["operations"]), default=1.0) or 1.0
+
+
+# Timeline colours (shared by the SVG and PNG exports).
+TIMELINE_COLORS = {"Put": "#2196F3", "Get": "#FF5722", "fail": "#D50000", "ambiguous": "#9E9E9E",
+                   "chain": "#212121"}
+# Event markers: snapshot installs / compactions stand out from the other events.
+EVENT_COLORS = {"default": "#6A1B9A", "snapshot": "#00897B"}
+
+
+def _event_color(ev: dict) -> str:
+    return EVENT_COLORS["snapshot" if ev["type"] in SNAPSHOT_EVENTS else "default"]
+
+
+def _timeline_color(op: dict, failed: set[str]) -> str:
+    if op["partition"] in failed:
+        return TIMELINE_COLORS["fail"]
+    if op["status"] not in DEFINITE_STATUSES:
+        return TIMELINE_COLORS["ambiguous"]
+    return TIMELINE_COLORS.get(op["type"], "#607D8B")
+
+
+# Timeline lane layouts: the field operations are grouped by, and its label.
+LANE_LAYOUTS = {
+    "client": ("client_id", "client"),
+    "node": ("node", "node"),
+    "shard": ("shard", "shard"),
+    "term": ("term", "term"),
+    "key": ("key", "key"),
+}
+
+
+def timeline_lanes(values: list, layout: str) -> dict:
+    """
+    Lane index and label per distinct value of the layout's field: numbers,
+    then keys numerically-then-lexically (as partition_by_key), unknown last.
+    """
+    label = LANE_LAYOUTS[layout][1]
+    known = sorted((v for v in set(values) if v is not None),
+                   key=lambda v: (len(v), v) if isinstance(v, str) else (0, v))
+    ordered = known + [None] * (None in values)
+    return {v: (i, f"{label} {v}" if v is not None else f"{label} ?") for i, v in enumerate(ordered)}
+
+
+def render_timeline_svg(data: dict, width: int = 1200, lanes: str = "client") -> str:
+    """
+    Render timeline_data() as a standalone SVG: one lane per client (or per
+    node / key, see LANE_LAYOUTS), one bar per operation from call to
+    return, ops on failing keys in red, ambiguous ones grey, events as
+    dashed vertical lines. The ops of a causal cycle or violating
+    dependency chain are outlined and linked by arrows in chain order.
+    Hovering a bar shows the op and its meta.
+    """
+    from xml.sax.saxutils import escape
+    ops = data["operations"]
+    field = LANE_LAYOUTS[lanes][0]
+    lane_of = timeline_lanes([op[field] for op in ops], lanes)
+    clients = list(lane_of)
+    failed = {k for k, p in data["partitions"].items() if p["verdict"] == "FAIL"}
+    left, top, lane_h = 90, 40, 26
+    lo, hi = _timeline_window(data)
+    span = hi - lo
+    plot_w = width - left - 20
+    height = top + lane_h * len(clients) + 40
+
+    def x(ms: float) -> float:
+        return left + (min(max(ms, lo), hi) - lo) / span * plot_w
+
+    note = f' <tspan font-size="11" font-weight="normal">({escape(data["note"])})</tspan>' \
+        if data.get("note") else ""
+    out = [
+        f'<svg xmlns="http://www.w3.org/2000/svg" width="{width}" height="{height}" '
+        f'font-family="sans-serif" font-size="11">',
+        f'<text x="{left}" y="20" font-size="14" font-weight="bold">'
+        f'{escape(data["config"])} — {escape(data["consistency"])}: {data["verdict"]}{note}</text>',
+    ]
+    for i, label in lane_of.values():
+        y = top + i * lane_h
+        out.append(f'<text x="{left - 8}" y="{y + lane_h / 2 + 4}" text-anchor="end">{escape(label)}</text>')
+        out.append(f'<line x1="{left}" y1="{y + lane_h}" x2="{left + plot_w}" y2="{y + lane_h}" stroke="#EEE"/>')
+    centers: dict[int, tuple[float, float]] = {}
+    for op in ops:
+        y = top + lane_of[op[field]][0] * lane_h + 4
+        x0, x1 = x(op["call_ms"]), x(op["return_ms"])
+        centers[op["id"]] = ((x0 + x1) / 2, y + (lane_h - 8) / 2)
+        value = "" if op["value"] is None else f" {op['value']!r}"
+        where = f"client {op['client_id']}" + (f" via node {op['node']}" if op.get("node") is not None else "")
+        tip = (f"{op['type']}({op['key']!r}){' →' if op['type'] == 'Get' else ''}{value} "
+               f"[{op['call_ms']:.3f}, {op['return_ms']:.3f}] ms {op['status']}, {where}")
+        for name, v in (op.get("meta") or {}).items():
+            tip += f"\n{name}: {v if isinstance(v, str) else json.dumps(v)}"
+        out.append(
+            f'<rect x="{x0:.2f}" y="{y}" width="{max(x1 - x0, 1.0):.2f}" height="{lane_h - 8}" '
+            f'fill="{_timeline_color(op, failed)}" fill-opacity="0.8"'
+            + (f' stroke="{TIMELINE_COLORS["chain"]}" stroke-width="2"' if op.get("chain") is not None else "")
+            + f'><title>{escape(tip)}</title></rect>'
+        )
+    if data.get("chains"):
+        out.append(f'<defs><marker id="chain-arrow" viewBox="0 0 10 10" refX="9" refY="5" markerWidth="6" '
+                   f'markerHeight="6" orient="auto"><path d="M0,0 L10,5 L0,10 z" '
+                   f'fill="{TIMELINE_COLORS["chain"]}"/></marker></defs>')
+    for chain in data.get("chains") or []:
+        for a, b in zip(chain, chain[1:]):
+            if a in centers and b in centers:
+                (ax, ay), (bx, by) = centers[a], centers[b]
+                out.append(f'<line x1="{ax:.2f}" y1="{ay:.2f}" x2="{bx:.2f}" y2="{by:.2f}" '
+                           f'stroke="{TIMELINE_COLORS["chain"]}" stroke-width="1.5" '
+                           f'marker-end="url(#chain-arrow)"/>')
+    bottom = top + lane_h * len(clients)
+    for ev in data["events"]:
+        ex = x(ev["time_ms"])
+        label = ev["type"] + (f" n{ev['node']}" if ev["node"] is not None else "")
+        color = _event_color(ev)
+        out.append(f'<line x1="{ex:.2f}" y1="{top - 6}" x2="{ex:.2f}" y2="{bottom}" '
+                   f'stroke="{color}" stroke-dasharray="4,3"/>')
+        out.append(f'<text x="{ex + 2:.2f}" y="{top - 8}" fill="{color}">{escape(label)}</text>')
+    for i in range(6):
+        ms = lo + span * i / 5
+        out.append(f'<text x="{x(ms):.2f}" y="{bottom + 16}" text-anchor="middle">{ms:.1f}</text>')
+    out.append(f'<text x="{left + plot_w / 2}" y="{bottom + 32}" text-anchor="middle">'
+               f'time since first call (ms)</text>')
+    out.append("</svg>")
+    return "\n".join(out)
+
+
+def plot_timeline_png(data: dict, out: pathlib.Path, lanes: str = "client") -> bool:
+    """The same timeline as render_timeline_svg, via matplotlib. False if unavailable."""
+    if not HAS_MATPLOTLIB:
+        return False
+    ops = data["operations"]
+    field = LANE_LAYOUTS[lanes][0]
+    lane_of = timeline_lanes([op[field] for op in ops], lanes)
+    failed = {k for k, p in data["partitions"].items() if p["verdict"] == "FAIL"}
+    fig, ax = plt.subplots(figsize=(14, 1 + 0.4 * len(lane_of)))
+    for value, (i, _) in lane_of.items():
+        lane_ops = [op for op in ops if op[field] == value]
+        ax.broken_barh(
+            [(op["call_ms"], max(op["return_ms"] - op["call_ms"], 1e-3)) for op in lane_ops],
+            (i - 0.35, 0.7),
+            facecolors=[_timeline_color(op, failed) for op in lane_ops],
+            edgecolors=[TIMELINE_COLORS["chain"] if op.get("chain") is not None else "none" for op in lane_ops],
+        )
+    centers = {op["id"]: ((op["call_ms"] + op["return_ms"]) / 2, lane_of[op[field]][0]) for op in ops}
+    for chain in data.get("chains") or []:
+        for a, b in zip(chain, chain[1:]):
+            if a in centers and b in centers:
+                ax.annotate("", xy=centers[b], xytext=centers[a],
+                            arrowprops={"arrowstyle": "->", "color": TIMELINE_COLORS["chain"]})
+    for ev in data["events"]:
+        ax.axvline(ev["time_ms"], color=_event_color(ev), linestyle="--", linewidth=1)
+    ax.set_xlim(*_timeline_window(data))
+    ax.set_yticks(range(len(lane_of)), [label for _, label in lane_of.values()])
+    ax.set_xlabel("Time since first call (ms)")
+    ax.set_title(f"{data['config']} — {data['consistency']}: {data['verdict']}"
+                 + (f" ({data['note']})" if data.get("note") else ""))
+    plt.tight_layout()
+    plt.savefig(out, dpi=150, bbox_inches="tight")
+    plt.close(fig)
+    return True
+
+
+def first_violation(
+    ops: list[Operation], fails: Callable[[list[Operation]], bool]
+) -> Optional[Operation]:
+    """
+    The operation whose completion first makes the history fail: binary
+    search for the shortest prefix, in return order, that `fails`.
+    """
+    ordered = sorted(ops, key=lambda o: (o.return_ns, o.call_ns))
+    if not ordered or not fails(ordered):
+        return None
+    lo, hi = 1, len(ordered)
+    while lo < hi:
+        mid = (lo + hi) // 2
+        if fails(ordered[:mid]):
+            hi = mid
+        else:
+            lo = mid + 1
+    return ordered[lo - 1]
+
+
+def print_tui_timeline(
+    ops: list[Operation],
+    failed_keys: set[str],
+    events: list[Event],
+    marked: Optional[Operation] = None,
+    width: Optional[int] = None,
+    lanes: str = "client",
+) -> None:
+    """
+    A compact per-client (or per-node / per-key) timeline for the terminal:
+    one row per lane, one column per time slice. W = Put, R = Get,
+    ? = ambiguous, X = op on a failing key, ! = the first non-linearizable
+    op; events are ^ below (s for snapshot installs and compactions).
+    """
+    if not ops:
+        return
+    width = width or shutil.get_terminal_size((100, 24)).columns
+    field = LANE_LAYOUTS[lanes][0]
+    lane_of = timeline_lanes([getattr(op, field) for op in ops], lanes)
+    label_w = max(len(label) for _, label in [*lane_of.values(), (0, "events")]) + 3
+    cols = max(20, width - label_w - 2)
+    start = min(op.call_ns for op in ops)
+    span = max(max(op.return_ns for op in ops) - start, 1)
+
+    def col(t: int) -> int:
+        return min(cols - 1, max(0, (t - start) * cols // span))
+
+    # An op is drawn as its letter at the call, then a dash up to the return
+    # (X and ! fill the whole span); overlapping ops keep the stronger mark.
+    rank = {"·": -1, "-": 0, "W": 1, "R": 1, "?": 2, "X": 3, "!": 4}
+    rows = {v: ["·"] * cols for v in lane_of}
+    for op in ops:
+        if op is marked:
+            ch = "!"
+        elif op.key in failed_keys:
+            ch = "X"
+        elif op.ambiguous:
+            ch = "?"
+        else:
+            ch = "W" if op.op_type == "Put" else "R"
+        row = rows[getattr(op, field)]
+        a, b = col(op.call_ns), col(op.return_ns)
+        for i in range(a, b + 1):
+            cur = ch if i == a or ch in "X!" else "-"
+            if rank[cur] >= rank[row[i]]:
+                row[i] = cur
+    print(f"\n  Timeline ({span / 1e6:.3f} ms, {span / cols / 1e6:.3f} ms per column):")
+    for v, (_, label) in lane_of.items():
+        print(f"  {label:<{label_w - 3}} │{''.join(rows[v])}│")
+    if events:
+        marks = [" "] * cols
+        for ev in events:
+            if start <= ev.time_ns <= start + span:
+                marks[col(ev.time_ns)] = "s" if ev.kind in SNAPSHOT_EVENTS else "^"
+        print(f"  {'events':<{label_w - 3}}  {''.join(marks)}")
+    print("  W put  R get  ? ambiguous  X failing key  ! first non-linearizable op"
+          + ("  ^ event" if events else "")
+          + ("  s snapshot/compaction" if any(ev.kind in SNAPSHOT_EVENTS for ev in events) else ""))
+    if marked is not None:
+        val = marked.write_val if marked.op_type == "Put" else marked.result_val
+        print(f"  ! {marked.op_type}({marked.key!r}) → {val!r} by client {marked.client_id}, "
+              f"{(marked.call_ns - start) / 1e6:.3f}–{(marked.return_ns - start) / 1e6:.3f} ms")
+
+# ── Trace export ───────────────────────────────────────────────────────────────
+
+# OTLP span kinds and status codes (opentelemetry/proto/trace/v1/trace.proto).
+OTLP_SPAN_KIND_INTERNAL = 1
+OTLP_SPAN_KIND_CLIENT = 3
+OTLP_STATUS_ERROR = 2
+OTLP_CHECKER_SERVICE = "omnipaxos-kv-checker"
+# Spans per export request, well under collectors' default 4 MiB limit.
+OTLP_BATCH_SPANS = 2000
+
+
+def _otlp_attributes(attrs: dict) -> list[dict]:
+    """OTLP/JSON key-value list of the non-None entries of `attrs`."""
+    out = []
+    for k, v in attrs.items():
+        if v is None:
+            continue
+        if isinstance(v, bool):
+            value = {"boolValue": v}
+        elif isinstance(v, int):
+            value = {"intValue": str(v)}     # int64 is a string in OTLP/JSON
+        elif isinstance(v, float):
+            value = {"doubleValue": v}
+        else:
+            v = plain_value(v)
+            value = {"stringValue": v if isinstance(v, str) else json.dumps(v)}
+        out.append({"key": k, "value": value})
+    return out
+
+
+def otlp_spans(
+    config_name: str,
+    ops: list[Operation],
+    verdicts: dict[str, tuple[str, int]],
+    events: list[Event],
+    violations: list[str],
+    lin_ok: Optional[bool],
+    consistency: str,
+    trace_id: str,
+) -> list[tuple[str, dict]]:
+    """
+    The history as OTLP/JSON spans of one trace, each with the name of the
+    service it belongs to: a root "check <config>" span of the checker
+    spanning the history, with the fault events and the violations as span
+    events, and a CLIENT span per operation under the service client-N.
+    Ops on failing keys, and failed ones, get an error status.
+    """
+    failed = {k for k, (v, _) in verdicts.items() if v == "FAIL"}
+    verdict = {True: "PASS", False: "FAIL", None: "UNKNOWN"}[lin_ok]
+    root_id = f"{1:016x}"
+    start = min(op.call_ns for op in ops)
+    end = max(op.return_ns for op in ops)
+    root = {
+        "traceId": trace_id,
+        "spanId": root_id,
+        "name": f"check {config_name}",
+        "kind": OTLP_SPAN_KIND_INTERNAL,
+        "startTimeUnixNano": str(start),
+        "endTimeUnixNano": str(end),
+        "attributes": _otlp_attributes({
+            "omnipaxos_kv.config": config_name,
+            "omnipaxos_kv.consistency": consistency,
+            "omnipaxos_kv.verdict": verdict,
+            "omnipaxos_kv.ops": len(ops),
+            "omnipaxos_kv.violations": len(violations),
+        }),
+        "events": [
+            {"timeUnixNano": str(ev.time_ns), "name": ev.kind,
+             "attributes": _otlp_attributes({"node": ev.node, "detail": ev.detail or None, "term": ev.term})}
+            for ev in events
+        ] + [
+            {"timeUnixNano": str(end), "name": "violation", "attributes": _otlp_attributes({"message": v})}
+            for v in violations
+        ],
+    }
+    if lin_ok is False:
+        root["status"] = {"code": OTLP_STATUS_ERROR, "message": f"not {consistency}"}
+    spans = [(OTLP_CHECKER_SERVICE, root)]
+    for i, op in enumerate(sorted(ops, key=lambda o: (o.call_ns, o.client_id)), 2):
+        span = {
+            "traceId": trace_id,
+            "spanId": f"{i:016x}",
+            "parentSpanId": root_id,
+            "name": op.op_type,
+            "kind": OTLP_SPAN_KIND_CLIENT,
+            "startTimeUnixNano": str(op.call_ns),
+            "endTimeUnixNano": str(op.return_ns),
+            "attributes": _otlp_attributes({
+                "db.system": "omnipaxos-kv",
+                "db.operation.name": op.op_type,
+                "kv.key": op.key,
+                "kv.value": op.write_val if op.op_type == "Put" else op.result_val,
+                "kv.status": op.status,
+                "kv.node": op.node,
+                "kv.shard": op.shard,
+                "kv.term": op.term,
+                "kv.read_mode": op.read_mode,
+                "kv.op_id": op.op_id,
+                "kv.request_id": op.request_id,
+            }),
+        }
+        if op.key in failed:
+            span["status"] = {"code": OTLP_STATUS_ERROR, "message": f"key {op.key!r} is not {consistency}"}
+        elif op.status in (STATUS_FAIL, STATUS_ERROR):
+            span["status"] = {"code": OTLP_STATUS_ERROR, "message": op.status}
+        spans.append((f"client-{op.client_id}", span))
+    return spans
+
+
+def _otlp_headers() -> dict[str, str]:
+    """Headers from OTEL_EXPORTER_OTLP_HEADERS, as the OpenTelemetry SDKs read it."""
+    headers = {}
+    for item in os.environ.get("OTEL_EXPORTER_OTLP_HEADERS", "").split(","):
+        name, sep, value = item.partition("=")
+        if sep and name.strip():
+            headers[urllib.parse.unquote(name.strip())] = urllib.parse.unquote(value.strip())
+    return headers
+
+
+def send_otlp(url: str, config_name: str, spans: list[tuple[str, dict]]) -> int:
+    """
+    POST `spans` (from otlp_spans) to the OTLP/HTTP collector at `url` in
+    batches of OTLP_BATCH_SPANS. Returns the number of spans accepted;
+    delivery errors are reported, not raised.
+    """
+    split = urllib.parse.urlsplit(url)
+    if split.path in ("", "/"):
+        url = urllib.parse.urlunsplit(split._replace(path="/v1/traces"))
+    headers = {"Content-Type": "application/json", **_otlp_headers()}
+    sent = 0
+    for at in range(0, len(spans), OTLP_BATCH_SPANS):
+        by_service: dict[str, list[dict]] = defaultdict(list)
+        for service, span in spans[at:at + OTLP_BATCH_SPANS]:
+            by_service[service].append(span)
+        payload = {"resourceSpans": [
+            {
+                "resource": {"attributes": _otlp_attributes({
+                    "service.name": service,
+                    "service.namespace": "omnipaxos-kv",
+                    "omnipaxos_kv.config": config_name,
+                })},
+                "scopeSpans": [{"scope": {"name": "benchmark_and_test"}, "spans": batch}],
+            }
+            for service, batch in by_service.items()
+        ]}
+        request = urllib.request.Request(url, data=json.dumps(payload).encode(), headers=headers, method="POST")
+        try:
+            with urllib.request.urlopen(request, timeout=30) as response:
+                response.read()
+        except (OSError, ValueError) as ex:
+            log.warning(f"Cannot send traces to {url}: {ex}")
+            break
+        sent += sum(len(batch) for batch in by_service.values())
+    return sent
+
+# ── Result browser ─────────────────────────────────────────────────────────────
+
+@dataclass
+class BrowseConfig:
+    """What --tui needs of one checked config, kept out of the JSON result."""
+    name: str
+    verdict: str                        # PASS / FAIL / UNKNOWN
+    ops: list[Operation]
+    by_key: dict[str, list[Operation]]
+    verdicts: dict[str, tuple[str, int]]
+    violations: list[str]
+    events: list[Event]
+    first_bad: dict[str, Operation]     # failing key → its offending_read
+    consistency: str
+    lin_ok: Optional[bool]
+    svg_path: pathlib.Path              # where "open in browser" renders the config
+
+
+def browse_config(
+    config_name: str,
+    ops: list[Operation],
+    verdicts: dict[str, tuple[str, int]],
+    events: list[Event],
+    violations: list[str],
+    lin_ok: Optional[bool],
+    opts: CheckOptions,
+    svg_path: pathlib.Path,
+) -> BrowseConfig:
+    by_key = partition_by_key(ops)
+    first_bad = {}
+    if opts.consistency == "linearizable":
+        for key, (v, _) in verdicts.items():
+            if v == "FAIL":
+                op = offending_read(key, by_key.get(key, []))
+                if op is not None:
+                    first_bad[key] = op
+    return BrowseConfig(config_name, {True: "PASS", False: "FAIL", None: "UNKNOWN"}[lin_ok],
+                        ops, by_key, verdicts, violations, events, first_bad, opts.consistency, lin_ok,
+                        svg_path)
+
+
+class ResultBrowser:
+    """
+    Curses browser behind --tui. Three levels: configs, the key partitions
+    of one config (failing first), and the operations of one partition in
+    call order. ↑/↓ (j/k), PgUp/PgDn move; Enter (→, l) opens; ← (h,
+    Backspace) goes back; f jumps to the first failing partition or
+    violating op; o renders the current config or partition as an SVG
+    timeline and opens it in the browser; q quits.
+    """
+
+    HELP = "↑↓ move  ⏎ open  ← back  f first violation  o open in browser  q quit"
+
+    def __init__(self, configs: list[BrowseConfig], lanes: str = "client", max_ops: Optional[int] = None):
+        self.configs = configs
+        self.lanes = lanes
+        self.max_ops = max_ops
+        self.stack: list[tuple[str, object, int]] = []     # (level, item, cursor) of the views left
+        self.level, self.item, self.cursor, self.top = "configs", None, 0, 0
+        self.status = ""
+
+    # Rows of the current view: (text, verdict or None, payload).
+    def view_rows(self) -> list[tuple[str, Optional[str], object]]:
+        if self.level == "configs":
+            return [(f"{c.name:<28} {c.verdict:<8} {len(c.ops):>8} ops  {len(c.violations):>4} violation(s)",
+                     c.verdict, c) for c in self.configs]
+        if self.level == "partitions":
+            cfg: BrowseConfig = self.item
+            order = {"FAIL": 0, "UNKNOWN": 1}
+            keys = sorted(cfg.by_key, key=lambda k: (order.get(cfg.verdicts.get(k, ("",))[0], 2), k))
+            return [(f"{k!r:<40} {cfg.verdicts.get(k, ('-',))[0]:<8} {len(cfg.by_key[k]):>8} ops",
+                     cfg.verdicts.get(k, (None,))[0], k) for k in keys]
+        cfg, key = self.item
+        start = min(op.call_ns for op in cfg.ops)
+        bad = cfg.first_bad.get(key)
+        out = []
+        for op in sorted(cfg.by_key[key], key=lambda o: o.call_ns):
+            val = op.write_val if op.op_type == "Put" else op.result_val
+            mark = "!" if op is bad else "?" if op.ambiguous else " "
+            out.append((f"{mark} {(op.call_ns - start) / 1e6:>12.3f}–{(op.return_ns - start) / 1e6:<12.3f} ms  "
+                        f"client {op.client_id:<5} {op.op_type:<6} {val!r:<24} {op.status}",
+                        "FAIL" if op is bad else None, op))
+        return out
+
+    def title(self) -> str:
+        if self.level == "configs":
+            return f"{len(self.configs)} config(s)"
+        if self.level == "partitions":
+            cfg = self.item
+            first = f" — {cfg.violations[0]}" if cfg.violations else ""
+            return f"{cfg.name}: {cfg.verdict} ({cfg.consistency}){first}"
+        cfg, key = self.item
+        return f"{cfg.name} › {key!r}: {cfg.verdicts.get(key, ('unchecked',))[0]}"
+
+    def open(self, rows) -> None:
+        if not rows or self.level == "ops":
+            return
+        payload = rows[self.cursor][2]
+        self.stack.append((self.level, self.item, self.cursor))
+        if self.level == "configs":
+            self.level, self.item = "partitions", payload
+        else:
+            self.level, self.item = "ops", (self.item, payload)
+        self.cursor = self.top = 0
+
+    def back(self) -> None:
+        if self.stack:
+            self.level, self.item, self.cursor = self.stack.pop()
+            self.top = 0
+
+    def jump(self, rows) -> None:
+        if self.level == "ops":
+            cfg, key = self.item
+            hits = [i for i, r in enumerate(rows) if r[2] is cfg.first_bad.get(key)]
+            self.status = "" if hits else "No single offending read on this key"
+        else:
+            hits = [i for i, r in enumerate(rows) if r[1] == "FAIL"]
+            self.status = "" if hits else "Nothing failed here"
+        if hits:
+            self.cursor = hits[0]
+
+    def open_in_browser(self, rows) -> None:
+        key = None
+        if self.level == "configs":
+            if not rows:
+                return
+            cfg = rows[self.cursor][2]
+        elif self.level == "partitions":
+            cfg = self.item
+        else:
+            cfg, key = self.item
+        ops, verdicts, path = cfg.ops, cfg.verdicts, cfg.svg_path
+        if key is not None:
+            ops = cfg.by_key[key]
+            verdicts = {k: v for k, v in verdicts.items() if k == key}
+            slug = re.sub(r"[^\w.-]+", "_", str(key))[:40]
+            path = path.with_name(f"{path.stem}-{slug}.svg")
+        data = timeline_data(cfg.name, ops, verdicts, cfg.events, cfg.violations, cfg.lin_ok, cfg.consistency)
+        pages = reduce_timeline(data, max_ops=self.max_ops, lanes=self.lanes)
+        if not pages:
+            self.status = "No operations to show"
+            return
+        path.write_text(render_timeline_svg(pages[0], lanes=self.lanes))
+        opened = webbrowser.open(path.resolve().as_uri())
+        self.status = f"{'Opened' if opened else 'Saved (no browser found)'} {path}"
+
+    def draw(self, scr, rows) -> None:
+        scr.erase()
+        height, width = scr.getmaxyx()
+        body = max(1, height - 3)
+        self.cursor = min(max(self.cursor, 0), max(len(rows) - 1, 0))
+        if self.cursor < self.top:
+            self.top = self.cursor
+        elif self.cursor >= self.top + body:
+            self.top = self.cursor - body + 1
+        scr.addnstr(0, 0, self.title(), width - 1, curses.A_BOLD)
+        for y, (text, verdict, _) in enumerate(rows[self.top:self.top + body], 1):
+            attr = curses.color_pair({"PASS": 1, "FAIL": 2, "UNKNOWN": 3}.get(verdict, 0))
+            if self.top + y - 1 == self.cursor:
+                attr |= curses.A_REVERSE
+            scr.addnstr(y, 0, text, width - 1, attr)
+        scr.addnstr(height - 2, 0, self.status, width - 1)
+        scr.addnstr(height - 1, 0, self.HELP, width - 1, curses.A_DIM)
+        scr.refresh()
+
+    def run(self, scr) -> None:
+        curses.curs_set(0)
+        if curses.has_colors():
+            curses.use_default_colors()
+            for n, color in enumerate((curses.COLOR_GREEN, curses.COLOR_RED, curses.COLOR_YELLOW), 1):
+                curses.init_pair(n, color, -1)
+        rows = None
+        while True:
+            if rows is None:
+                rows = self.view_rows()
+            self.draw(scr, rows)
+            ch = scr.getch()
+            page = max(1, scr.getmaxyx()[0] - 3)
+            if ch in (ord("q"), 27):
+                return
+            if ch != ord("o"):
+                self.status = ""
+            if ch in (curses.KEY_DOWN, ord("j")):
+                self.cursor += 1
+            elif ch in (curses.KEY_UP, ord("k")):
+                self.cursor -= 1
+            elif ch == curses.KEY_NPAGE:
+                self.cursor += page
+            elif ch == curses.KEY_PPAGE:
+                self.cursor -= page
+            elif ch in (curses.KEY_ENTER, 10, 13, curses.KEY_RIGHT, ord("l")):
+                self.open(rows)
+                rows = None
+            elif ch in (curses.KEY_LEFT, curses.KEY_BACKSPACE, 127, ord("h")):
+                self.back()
+                rows = None
+            elif ch == ord("f"):
+                self.jump(rows)
+            elif ch == ord("o"):
+                self.open_in_browser(rows)
+
+
+def browse_results(configs: list[BrowseConfig], lanes: str, max_ops: Optional[int]) -> None:
+    """Open the --tui browser on the checked configs (needs a terminal)."""
+    if curses is None or not sys.stdin.isatty() or not sys.stdout.isatty():
+        log.warning("--tui needs an interactive terminal (and the curses module); skipping it")
+        return
+    if not configs:
+        log.warning("--tui: nothing was checked")
+        return
+    curses.wrapper(ResultBrowser(configs, lanes, max_ops).run)
+
+# ── Plotting ───────────────────────────────────────────────────────────────────
+
+def plot_results(
+    config_name: str,
+    ops: list[Operation],
+    metrics: Optional[dict],
+    out: pathlib.Path,
+    events: Optional[list[Event]] = None,
+) -> bool:
+    """Plot latency/throughput panels to `out`; False if nothing was saved."""
+    if not HAS_MATPLOTLIB:
+        print("  (matplotlib not available — skipping plots)")
+        return False
+    if not ops and not metrics:
+        return False
+
+    fig, axes = plt.subplots(2, 2, figsize=(18, 10))
+    axes = axes.flatten()
+    fig.suptitle(f"Benchmark: {config_name}", fontsize=14, fontweight="bold")
+
+    # ── Panel 1: Latency CDF ──────────────────────────────────────────────────
+    ax = axes[0]
+    ax.set_title("End-to-End Latency CDF")
+    put_lats, get_lats, all_lats = compute_history_latencies_ms(ops)
+    for lats, label, color in [
+        (put_lats, "Put (write)", "#2196F3"),
+        (get_lats, "Get (read)", "#FF5722"),
+    ]:
+        if not lats:
+            continue
+        n = len(lats)
+        y = [(i + 1) / n for i in range(n)]
+        ax.plot(lats, y, label=label, color=color, linewidth=1.5)
+        for frac, pname in [(0.50, "p50"), (0.95, "p95"), (0.99, "p99")]:
+            v = lats[min(int(frac * n), n - 1)]
+            ax.axvline(v, color=color, linestyle="--", alpha=0.4, linewidth=0.8)
+            ax.text(v, frac + 0.02, f" {pname}={v:.1f}", fontsize=7, color=color)
+    ax.set_xlabel("Latency (ms)")
+    ax.set_ylabel("Cumulative fraction")
+    ax.legend(fontsize=8)
+    ax.grid(True, alpha=0.3)
+
+    # ── Panel 2: Latency histogram ────────────────────────────────────────────
+    ax = axes[1]
+    ax.set_title("Latency Distribution (histogram)")
+    if all_lats:
+        bins = min(60, max(20, len(all_lats) // 20))
+        ax.hist(put_lats, bins=bins, alpha=0.6, color="#2196F3", label="Put")
+        ax.hist(get_lats, bins=bins, alpha=0.6, color="#FF5722", label="Get")
+    ax.set_xlabel("Latency (ms)")
+    ax.set_ylabel("Count")
+    ax.legend(fontsize=8)
+    ax.grid(True, alpha=0.3)
+
+    # ── Panel 3: Path distribution (from proxy metrics) ───────────────────────
+    ax = axes[2]
+    if metrics:
+        fp = metrics.get("fast_path_committed", 0)
+        sp = metrics.get("slow_path_committed", 0)
+        aborted = metrics.get("fast_path_aborted", 0)
+        avg_fp_ms = metrics.get("avg_fast_path_latency_us", 0) / 1000.0
+        avg_sp_ms = metrics.get("avg_slow_path_latency_us", 0) / 1000.0
+        history_rps = compute_history_rps(ops)
+        throughput_label = (
+            f"throughput ≈ {history_rps:.0f} rps" if history_rps is not None else "throughput: n/a"
+        )
+        ax.set_title(f"Proxy metrics  |  {throughput_label}")
+        bars = ax.bar(
+            ["Fast-path", "Slow-path", "Aborted"],
+            [fp, sp, aborted],
+            color=["#4CAF50", "#FF9800", "#F44336"],
+        )
+        for bar, v in zip(bars, [fp, sp, aborted]):
+            ax.text(
+                bar.get_x() + bar.get_width() / 2,
+                bar.get_height() + 1,
+                str(v),
+                ha="center", va="bottom", fontsize=9,
+            )
+        ax.set_ylabel("Operations committed")
+        ax2 = ax.twinx()
+        ax2.plot(
+            ["Fast-path", "Slow-path"],
+            [avg_fp_ms, avg_sp_ms],
+            "D--", color="#9C27B0", markersize=8, label="Avg latency (ms)",
+        )
+        ax2.set_ylabel("Avg latency (ms)", color="#9C27B0")
+        ax2.tick_params(axis="y", labelcolor="#9C27B0")
+    else:
+        ax.set_title("Proxy metrics")
+        ax.text(
+            0.5, 0.5,
+            "No metrics.json\n(proxy telemetry flushed on shutdown;\n"
+            "check that the container exited cleanly)",
+            ha="center", va="center", transform=ax.transAxes, fontsize=9,
+        )
+
+    # ── Panel 4: Throughput and latency over time ─────────────────────────────
+    ax = axes[3]
+    ax.set_title("Throughput / Latency over time (1 s bins)")
+    series = compute_time_series(ops)
+    if series:
+        t = [b[0] for b in series]
+        ax.bar(t, [b[1] for b in series], width=0.9, align="edge",
+               color="#607D8B", alpha=0.6, label="Throughput (ops/s)")
+        ax.set_ylabel("Completed ops / s")
+        ax2 = ax.twinx()
+        lat_t = [b[0] + 0.5 for b in series if b[2] is not None]
+        lat_v = [b[2] for b in series if b[2] is not None]
+        ax2.plot(lat_t, lat_v, "o-", color="#E91E63", markersize=3, linewidth=1.2,
+                 label="Median latency (ms)")
+        ax2.set_ylabel("Median latency (ms)", color="#E91E63")
+        ax2.tick_params(axis="y", labelcolor="#E91E63")
+    if events and ops:
+        start_ns = min(op.call_ns for op in ops)
+        kinds = sorted({ev.kind for ev in events})
+        cmap = plt.get_cmap("tab10")
+        for ev in events:
+            color = cmap(kinds.index(ev.kind) % 10)
+            x = (ev.time_ns - start_ns) / 1e9
+            ax.axvline(x, color=color, linestyle=":", linewidth=1.2)
+            label = ev.kind if ev.node is None else f"{ev.kind} n{ev.node}"
+            ax.text(x, 0.98, f" {label}", transform=ax.get_xaxis_transform(),
+                    rotation=90, va="top", fontsize=7, color=color)
+    ax.set_xlabel("Time since first call (s)")
+    ax.grid(True, alpha=0.3)
+
+    plt.tight_layout()
+    plt.savefig(out, dpi=150, bbox_inches="tight")
+    plt.close(fig)
+    print(f"  Plot saved → {out}")
+    return True
+
+
+def print_partition_breakdown(
+    verdicts: dict[str, tuple[str, int]], top: int = 10, passing: bool = False
+) -> None:
+    """
+    Per-key verdicts: counts per outcome, then the failing/unknown keys (and
+    with `passing` the passing ones too, after them).
+    """
+    counts: dict[str, int] = defaultdict(int)
+    for verdict, _ in verdicts.values():
+        counts[verdict] += 1
+    print(
+        f"  Per-key verdicts: {counts['PASS']} pass / {counts['FAIL']} fail"
+        + (f" / {counts['UNKNOWN']} unknown" if counts["UNKNOWN"] else "")
+        + f"  ({len(verdicts)} keys)"
+    )
+    bad = sorted(
+        ((k, v, n) for k, (v, n) in verdicts.items() if passing or v != "PASS"),
+        key=lambda t: (t[1] == "PASS", t[1] != "FAIL", -t[2], t[0]),
+    )
+    for key, verdict, n in bad[:top]:
+        print(f"    {verdict:<7s} key {key!r}  ({n} ops)")
+    if len(bad) > top:
+        print(f"    … and {len(bad) - top} more")
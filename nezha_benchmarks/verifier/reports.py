@@ -0,0 +1,1004 @@
+"""
+Metrics and the reports built from results: summaries, CI and GitHub output,
+run comparison and failure notifications.
+"""
+
+from __future__ import annotations
+
+import bisect
+import html
+import json
+import pathlib
+import re
+import socket
+import urllib.request
+import xml.etree.ElementTree as ET
+from collections import Counter, defaultdict
+from dataclasses import dataclass
+from typing import Callable, Optional
+
+from .checkers import CONSISTENCY_CHECKERS
+from .cluster import NEMESIS_ACTIONS, SCENARIO_CONFIGS
+from .common import (DEFINITE_STATUSES, Event, Operation, STATUS_ERROR, STATUS_FAIL, VERDICT_RANK, log,
+                     open_in_browser, result_verdict)
+from .dashboard import html_page
+from .linearizability import offending_read, partition_by_key
+
+# ── Leader terms ───────────────────────────────────────────────────────────────
+
+def assign_terms(ops: list[Operation], events: list[Event]) -> Optional[str]:
+    """
+    Where the operations' leader terms come from: "ops" if records carry
+    them, else "events" after setting each op's term to that of the latest
+    event with a term at or before its call; None if neither has terms.
+    """
+    if any(op.term is not None for op in ops):
+        return "ops"
+    changes = sorted((ev.time_ns, ev.term) for ev in events if ev.term is not None)
+    if not changes:
+        return None
+    times = [t for t, _ in changes]
+    for op in ops:
+        i = bisect.bisect_right(times, op.call_ns)
+        if i:
+            op.term = changes[i - 1][1]
+    return "events"
+
+
+def term_report(
+    ops: list[Operation], failed_keys: set[str], events: Optional[list[Event]] = None
+) -> list[dict]:
+    """
+    Per leader term: ops served, time span (ns from the first call), ops on
+    failing keys, and handover ops (whose interval contains the start of
+    another term, i.e. were in flight while leadership changed). A term
+    starts at its event when `events` carry terms, else at its first call.
+    """
+    by_term: dict[Optional[int], list[Operation]] = defaultdict(list)
+    for op in ops:
+        by_term[op.term].append(op)
+    origin = min((op.call_ns for op in ops), default=0)
+    term_start = {term: min(op.call_ns for op in term_ops)
+                  for term, term_ops in by_term.items() if term is not None}
+    for ev in events or ():
+        if ev.term in term_start:
+            term_start[ev.term] = ev.time_ns
+    rows = []
+    for term in sorted(by_term, key=lambda t: (t is None, t or 0)):
+        term_ops = by_term[term]
+        starts = [t for other, t in term_start.items() if other != term]
+        handover = {id(op) for op in term_ops
+                    if any(op.call_ns < t <= op.return_ns for t in starts)}
+        failing = [op for op in term_ops if op.key in failed_keys]
+        rows.append({
+            "term": term,
+            "ops": len(term_ops),
+            "from_ns": min(op.call_ns for op in term_ops) - origin,
+            "to_ns": max(op.return_ns for op in term_ops) - origin,
+            "failing_key_ops": len(failing),
+            "handover_ops": len(handover),
+            "failing_handover_ops": sum(1 for op in failing if id(op) in handover),
+        })
+    return rows
+
+
+def print_term_report(rows: list[dict], source: str) -> None:
+    origin = " (from events)" if source == "events" else ""
+    print(f"  Leader terms{origin}: {sum(r['term'] is not None for r in rows)}")
+    print(f"    {'term':>6s} {'ops':>7s} {'handover':>9s} {'on failing keys':>16s}  span")
+    for r in rows:
+        term = "?" if r["term"] is None else str(r["term"])
+        mark = " ✗" if r["failing_key_ops"] else "  "
+        print(f"    {term:>6s} {r['ops']:7d} {r['handover_ops']:9d} {r['failing_key_ops']:14d}{mark}  "
+              f"{r['from_ns'] / 1e9:.3f}s–{r['to_ns'] / 1e9:.3f}s")
+    failing = [r for r in rows if r["failing_key_ops"]]
+    if len(failing) == 1 and failing[0]["term"] is not None:
+        r = failing[0]
+        during = (f", {r['failing_handover_ops']} of them during a leadership handover"
+                  if r["failing_handover_ops"] else "")
+        print(f"  ✗ All {r['failing_key_ops']} op(s) on failing keys were served in term {r['term']}{during}")
+
+# ── Availability ───────────────────────────────────────────────────────────────
+
+# Fault event type → the event type that undoes it (see NEMESIS_ACTIONS).
+FAULT_RECOVERIES = dict(NEMESIS_ACTIONS.values())
+# Phases of a run with faults, by each op's call: before the first fault,
+# while one is active, after the last recovery, not during a fault, or any time.
+AVAILABILITY_PHASES = ("before", "during", "after", "outside", "all")
+AVAILABILITY_CLASSES = ("reads", "writes", "ops")
+# Outcome rates: ok (answered), errors (error/fail), timeouts (timeout/info/unknown).
+AVAILABILITY_METRICS = ("ok", "errors", "timeouts")
+AVAILABILITY_SHORTHANDS = {"available": ("ok", ">=", 0.95), "unavailable": ("ok", "<=", 0.05)}
+AVAILABILITY_RULE = re.compile(r"(ok|errors|timeouts)\s*(<=|>=|<|>)\s*(\d+(?:\.\d+)?)(%?)")
+
+
+def fault_windows(events: list[Event], end_ns: int) -> list[tuple[int, int, str]]:
+    """
+    (start, end, description) of every fault in `events`: from the fault to
+    the first later recovery of the same kind on the same service or node,
+    else to `end_ns`.
+    """
+    windows = []
+    for i, ev in enumerate(events):
+        if ev.kind not in FAULT_RECOVERIES:
+            continue
+        target = (ev.node, ev.detail.split()[0] if ev.detail else "")
+        end = next((later.time_ns for later in events[i + 1:]
+                    if later.kind == FAULT_RECOVERIES[ev.kind]
+                    and (later.node, later.detail.split()[0] if later.detail else "") == target), end_ns)
+        windows.append((ev.time_ns, max(end, ev.time_ns), f"{ev.kind} {ev.detail}".strip()))
+    return windows
+
+
+def _outcome(op: Operation) -> str:
+    if op.status in DEFINITE_STATUSES:
+        return "ok"
+    return "errors" if op.status in (STATUS_ERROR, STATUS_FAIL) else "timeouts"
+
+
+def availability_report(ops: list[Operation], events: list[Event]) -> Optional[dict]:
+    """
+    Outcome counts per phase (AVAILABILITY_PHASES) and op class of a history
+    with fault events; None without any.
+    """
+    if not ops:
+        return None
+    origin, end = min(op.call_ns for op in ops), max(op.return_ns for op in ops)
+    windows = fault_windows(events, end)
+    if not windows:
+        return None
+    first, last = min(w[0] for w in windows), max(w[1] for w in windows)
+    phases = {phase: {cls: {"ops": 0, **{m: 0 for m in AVAILABILITY_METRICS}} for cls in AVAILABILITY_CLASSES}
+              for phase in AVAILABILITY_PHASES}
+    for op in ops:
+        during = any(start <= op.call_ns < stop for start, stop, _ in windows)
+        in_phases = ["all", "during" if during else "outside"]
+        if op.call_ns < first:
+            in_phases.append("before")
+        elif op.call_ns >= last:
+            in_phases.append("after")
+        outcome = _outcome(op)
+        for phase in in_phases:
+            for cls in ("reads" if op.op_type == "Get" else "writes", "ops"):
+                phases[phase][cls]["ops"] += 1
+                phases[phase][cls][outcome] += 1
+    return {
+        "faults": [{"fault": desc, "from_s": (start - origin) / 1e9, "to_s": (stop - origin) / 1e9}
+                   for start, stop, desc in windows],
+        "phases": phases,
+    }
+
+
+def print_availability_report(report: dict) -> None:
+    print(f"  Availability: {len(report['faults'])} fault(s), "
+          + ", ".join(f"{f['fault']} {f['from_s']:.1f}s–{f['to_s']:.1f}s" for f in report["faults"][:3])
+          + (" …" if len(report["faults"]) > 3 else ""))
+    print(f"    {'phase':<8s} {'reads ok':>12s} {'writes ok':>12s} {'errors':>7s} {'timeouts':>9s}")
+    for phase in ("before", "during", "after"):
+        row = report["phases"][phase]
+        if not row["ops"]["ops"]:
+            continue
+        rates = [f"{row[c]['ok'] / row[c]['ops']:.0%} of {row[c]['ops']}" if row[c]["ops"] else "-"
+                 for c in ("reads", "writes")]
+        print(f"    {phase:<8s} {rates[0]:>12s} {rates[1]:>12s} {row['ops']['errors']:7d} "
+              f"{row['ops']['timeouts']:9d}")
+
+
+def parse_availability(spec: object) -> list[tuple[str, str, str, str, float]]:
+    """
+    A scenario's availability expectations, {phase: {class: rule or [rules]}},
+    as (phase, class, metric, comparison, rate) rules. A rule is "available"
+    (ok >= 95%), "unavailable" (ok <= 5%) or METRIC OP RATE, e.g. "errors <= 10%".
+    """
+    if not isinstance(spec, dict) or not spec:
+        raise ValueError(f"expected a mapping of phases ({', '.join(AVAILABILITY_PHASES)}) to op classes")
+    rules = []
+    for phase, classes in spec.items():
+        if phase not in AVAILABILITY_PHASES:
+            raise ValueError(f"unknown phase {phase!r} (one of {', '.join(AVAILABILITY_PHASES)})")
+        if not isinstance(classes, dict):
+            raise ValueError(f"{phase}: expected a mapping of {', '.join(AVAILABILITY_CLASSES)} to rules")
+        for cls, entries in classes.items():
+            if cls not in AVAILABILITY_CLASSES:
+                raise ValueError(f"{phase}: unknown op class {cls!r} (one of {', '.join(AVAILABILITY_CLASSES)})")
+            for entry in [entries] if isinstance(entries, str) else entries:
+                text = str(entry).strip()
+                if text in AVAILABILITY_SHORTHANDS:
+                    rules.append((phase, cls, *AVAILABILITY_SHORTHANDS[text]))
+                    continue
+                m = AVAILABILITY_RULE.fullmatch(text)
+                if not m:
+                    raise ValueError(f"{phase}.{cls}: {text!r}: expected available, unavailable or "
+                                     "METRIC OP RATE (e.g. \"timeouts <= 10%\")")
+                rate = float(m.group(3)) / (100 if m.group(4) else 1)
+                if not 0 <= rate <= 1:
+                    raise ValueError(f"{phase}.{cls}: {text!r}: rate must be within 0–100%")
+                rules.append((phase, cls, m.group(1), m.group(2), rate))
+    return rules
+
+
+def availability_failures(report: Optional[dict], rules: list[tuple[str, str, str, str, float]]) -> list[str]:
+    """The availability expectations `report` misses, or why it cannot be judged."""
+    if not rules:
+        return []
+    if report is None:
+        return ["availability: no fault events recorded (logs/events*.json) to split the run into phases"]
+    failures = []
+    compare = {"<=": lambda a, b: a <= b, ">=": lambda a, b: a >= b,
+               "<": lambda a, b: a < b, ">": lambda a, b: a > b}
+    for phase, cls, metric, op, bound in rules:
+        counts = report["phases"][phase][cls]
+        if not counts["ops"]:
+            failures.append(f"availability {phase}: no {cls} to judge {metric} {op} {bound:.0%}")
+            continue
+        rate = counts[metric] / counts["ops"]
+        if not compare[op](rate, bound):
+            failures.append(f"availability {phase}: {cls} {metric} {rate:.1%} of {counts['ops']} "
+                            f"(expected {op} {bound:.0%})")
+    return failures
+
+# ── Metrics ────────────────────────────────────────────────────────────────────
+
+def load_metrics(logs_dir: pathlib.Path) -> Optional[dict]:
+    path = logs_dir / "metrics.json"
+    if not path.exists():
+        return None
+    with open(path) as f:
+        return json.load(f)
+
+
+def load_bench(logs_dir: pathlib.Path) -> dict[str, dict]:
+    """Totals written by clients run with `bench = true`, keyed by file stem."""
+    bench = {}
+    for path in sorted(logs_dir.glob("bench-*.json")):
+        try:
+            with open(path) as f:
+                bench[path.stem] = json.load(f)
+        except (OSError, json.JSONDecodeError) as ex:
+            log.warning(f"Could not read {path.name}: {ex}")
+    return bench
+
+
+def load_seeds(logs_dir: pathlib.Path) -> dict[str, int]:
+    """Workload seeds recorded in the client summaries, keyed by file stem."""
+    seeds = {}
+    for path in sorted(logs_dir.glob("client-*.json")):
+        try:
+            with open(path) as f:
+                seed = json.load(f).get("seed")
+        except (OSError, json.JSONDecodeError, AttributeError):
+            continue
+        if isinstance(seed, int):
+            seeds[path.stem] = seed
+    return seeds
+
+
+def compute_history_rps(ops: list[Operation]) -> Optional[float]:
+    """Compute end-to-end throughput from operation history timestamps."""
+    if not ops:
+        return None
+    start_ns = min(op.call_ns for op in ops)
+    end_ns = max(op.return_ns for op in ops)
+    duration_ns = end_ns - start_ns
+    if duration_ns <= 0:
+        return None
+    return len(ops) / (duration_ns / 1e9)
+
+
+def compute_history_latencies_ms(ops: list[Operation]) -> tuple[list[float], list[float], list[float]]:
+    """Compute E2E latencies from history call/return timestamps."""
+    put_lats: list[float] = []
+    get_lats: list[float] = []
+    all_lats: list[float] = []
+
+    for op in ops:
+        # Guard against malformed histories where return can be earlier than call.
+        duration_ns = op.return_ns - op.call_ns
+        if duration_ns < 0:
+            continue
+        lat_ms = duration_ns / 1e6
+        all_lats.append(lat_ms)
+        if op.op_type == "Put":
+            put_lats.append(lat_ms)
+        elif op.op_type == "Get":
+            get_lats.append(lat_ms)
+
+    put_lats.sort()
+    get_lats.sort()
+    all_lats.sort()
+    return put_lats, get_lats, all_lats
+
+
+def percentiles_ms(sorted_lats: list[float]) -> Optional[dict[str, float]]:
+    """p50/p95/p99 of an ascending latency list (None if empty)."""
+    n = len(sorted_lats)
+    if n == 0:
+        return None
+    return {
+        name: round(sorted_lats[min(int(frac * n), n - 1)], 3)
+        for name, frac in (("p50", 0.50), ("p95", 0.95), ("p99", 0.99))
+    }
+
+
+def compute_latency_report(ops: list[Operation]) -> dict:
+    """Latency percentiles overall, per op type and per client."""
+    put_lats, get_lats, all_lats = compute_history_latencies_ms(ops)
+    by_client: dict[int, list[Operation]] = defaultdict(list)
+    for op in ops:
+        by_client[op.client_id].append(op)
+    return {
+        "all": percentiles_ms(all_lats),
+        "Put": percentiles_ms(put_lats),
+        "Get": percentiles_ms(get_lats),
+        "clients": {
+            str(c): percentiles_ms(compute_history_latencies_ms(by_client[c])[2])
+            for c in sorted(by_client)
+        },
+    }
+
+
+def compute_time_series(
+    ops: list[Operation], bin_s: float = 1.0
+) -> list[tuple[float, int, Optional[float]]]:
+    """
+    Bin completed ops by return time (seconds since the first call) and return
+    (bin start, completed ops per second, median latency in ms) per bin.
+    Empty bins are kept so throughput collapses show up as zeros.
+    """
+    if not ops:
+        return []
+    start_ns = min(op.call_ns for op in ops)
+    bins: dict[int, list[float]] = defaultdict(list)
+    for op in ops:
+        if op.return_ns >= op.call_ns:
+            bins[int((op.return_ns - start_ns) / 1e9 // bin_s)].append((op.return_ns - op.call_ns) / 1e6)
+    if not bins:
+        return []
+    series = []
+    for b in range(max(bins) + 1):
+        lats = sorted(bins.get(b, []))
+        median = lats[len(lats) // 2] if lats else None
+        series.append((b * bin_s, int(len(lats) / bin_s), median))
+    return series
+
+
+def _fmt_percentiles(p: Optional[dict[str, float]]) -> str:
+    if p is None:
+        return "n/a"
+    return f"{p['p50']:.2f} / {p['p95']:.2f} / {p['p99']:.2f} ms"
+
+# ── History statistics ─────────────────────────────────────────────────────────
+
+@dataclass
+class KeyStats:
+    key: str
+    puts: int = 0
+    gets: int = 0
+    write_write: int = 0   # overlapping Put/Put pairs on this key
+    read_write: int = 0    # overlapping Get/Put pairs on this key
+    racing_ops: int = 0    # ops overlapping at least one conflicting op
+    peak_writers: int = 0  # most Puts in flight at once
+
+    @property
+    def ops(self) -> int:
+        return self.puts + self.gets
+
+    @property
+    def conflicts(self) -> int:
+        """Overlapping op pairs on this key with at least one Put."""
+        return self.write_write + self.read_write
+
+
+def compute_key_stats(ops: list[Operation]) -> list[KeyStats]:
+    """Per-key op counts and conflicts, hottest key first."""
+    stats: list[KeyStats] = []
+    for key, key_ops in partition_by_key(ops).items():
+        ks = KeyStats(key)
+        ks.puts = sum(1 for o in key_ops if o.op_type == "Put")
+        ks.gets = sum(1 for o in key_ops if o.op_type == "Get")
+        # Sweep by invocation; `active` holds ops whose interval is still open.
+        active: list[Operation] = []
+        racing: set[int] = set()
+        for op in sorted(key_ops, key=lambda o: o.call_ns):
+            active = [a for a in active if a.return_ns >= op.call_ns]
+            for a in active:
+                if a.op_type == op.op_type == "Put":
+                    ks.write_write += 1
+                elif "Put" in (a.op_type, op.op_type):
+                    ks.read_write += 1
+                else:
+                    continue
+                racing.update((id(a), id(op)))
+            active.append(op)
+            if op.op_type == "Put":
+                ks.peak_writers = max(ks.peak_writers, sum(1 for a in active if a.op_type == "Put"))
+        ks.racing_ops = len(racing)
+        stats.append(ks)
+    stats.sort(key=lambda ks: (-ks.ops, -ks.conflicts))
+    return stats
+
+
+def print_key_stats(ops: list[Operation], top: int = 10) -> None:
+    stats = compute_key_stats(ops)
+    if not stats:
+        return
+    puts = sum(ks.puts for ks in stats)
+    gets = sum(ks.gets for ks in stats)
+    contended = [ks for ks in stats if ks.conflicts]
+    print("  Per-key statistics")
+    print(f"  Keys     : {len(stats)}  ({len(ops) / len(stats):.1f} ops/key on average)")
+    print(f"  Read/write ratio: {gets}:{puts}  ({gets / max(puts + gets, 1) * 100:.1f}% reads)")
+    print(
+        f"  Conflicts: {sum(ks.conflicts for ks in stats)} overlapping op pair(s) "
+        f"on {len(contended)} key(s)"
+    )
+    print(f"  Hottest keys:")
+    print(f"    {'key':<20s} {'ops':>6s} {'puts':>6s} {'gets':>6s} {'conflicts':>10s}")
+    for ks in stats[:top]:
+        print(f"    {ks.key:<20.20s} {ks.ops:6d} {ks.puts:6d} {ks.gets:6d} {ks.conflicts:10d}")
+    if not contended:
+        print("  ⚠  No concurrent conflicting operations: the workload did not exercise contention.")
+
+
+# Buckets of the races-per-key distribution: (label, lowest count).
+RACE_BUCKETS = (("0", 0), ("1", 1), ("2-4", 2), ("5-9", 5), ("10-99", 10), ("100+", 100))
+
+
+def contention_report(ops: list[Operation]) -> dict:
+    """
+    How much the history stressed ordering: write-write and read-write races
+    (overlapping op pairs on one key), the share of ops in a race, the peak
+    number of concurrent writers on a key and keys per race-count bucket.
+    """
+    stats = compute_key_stats(ops)
+    buckets = {label: 0 for label, _ in RACE_BUCKETS}
+    for ks in stats:
+        label = next(label for label, lo in reversed(RACE_BUCKETS) if ks.conflicts >= lo)
+        buckets[label] += 1
+    hottest = sorted((ks for ks in stats if ks.conflicts), key=lambda ks: (-ks.conflicts, -ks.write_write))
+    peak = max(stats, key=lambda ks: ks.peak_writers, default=None)
+    return {
+        "keys": len(stats),
+        "ops": len(ops),
+        "write_write": sum(ks.write_write for ks in stats),
+        "read_write": sum(ks.read_write for ks in stats),
+        "write_write_keys": sum(1 for ks in stats if ks.write_write),
+        "read_write_keys": sum(1 for ks in stats if ks.read_write),
+        "racing_ops": sum(ks.racing_ops for ks in stats),
+        "peak_writers": peak.peak_writers if peak else 0,
+        "peak_writers_key": peak.key if peak else None,
+        "keys_by_races": buckets,
+        "most_contended": [
+            {"key": ks.key, "write_write": ks.write_write, "read_write": ks.read_write}
+            for ks in hottest[:10]
+        ],
+    }
+
+
+def print_contention_report(report: dict) -> None:
+    print("  Contention")
+    print(f"  Races    : write-write {report['write_write']} pair(s) on {report['write_write_keys']} key(s), "
+          f"read-write {report['read_write']} pair(s) on {report['read_write_keys']} key(s)")
+    share = report["racing_ops"] / max(report["ops"], 1) * 100
+    print(f"  Racing ops: {report['racing_ops']} of {report['ops']} ({share:.1f}%) overlap a "
+          f"conflicting op on their key")
+    if report["peak_writers_key"] is not None:
+        print(f"  Peak concurrent writers: {report['peak_writers']} (key {report['peak_writers_key']!r})")
+    print("  Keys by races:")
+    widest = max(report["keys_by_races"].values(), default=0)
+    for label, n in report["keys_by_races"].items():
+        bar = "█" * round(n / widest * 30) if widest else ""
+        print(f"    {label:>6s} {n:7d}  {bar}".rstrip())
+    if report["most_contended"]:
+        print(f"    {'key':<20s} {'W-W':>6s} {'R-W':>6s}")
+        for k in report["most_contended"]:
+            print(f"    {k['key']:<20.20s} {k['write_write']:6d} {k['read_write']:6d}")
+    if not report["write_write"]:
+        print("  ⚠  No concurrent writes to a key: writers never raced, so the check cannot "
+              "catch ordering bugs between them.")
+    if not report["write_write"] and not report["read_write"]:
+        print("  ⚠  Low-contention history: a PASS here says little; use a workload that "
+              "shares keys (e.g. register) or raise the request rate.")
+
+# ── Summary ────────────────────────────────────────────────────────────────────
+
+def print_summary(
+    config_name: str,
+    ops: list[Operation],
+    metrics: Optional[dict],
+    lin_ok: Optional[bool],
+    violations: list[str],
+    consistency: str = "linearizable",
+    events: Optional[list[Event]] = None,
+) -> None:
+    label = CONSISTENCY_CHECKERS[consistency][0]
+    puts = [o for o in ops if o.op_type == "Put"]
+    gets = [o for o in ops if o.op_type == "Get"]
+    _, _, lats = compute_history_latencies_ms(ops)
+    n = len(lats)
+
+    print(f"\n{'═' * 62}")
+    print(f"  Config : {config_name}")
+    print(f"  History: {len(ops)} ops  ({len(puts)} Puts / {len(gets)} Gets)")
+
+    if n > 0:
+        p50 = lats[int(0.50 * n)]
+        p95 = lats[int(0.95 * n)]
+        p99 = lats[min(int(0.99 * n), n - 1)]
+        print(
+            f"  E2E latency p50/p95/p99 : {p50:.2f} ms / {p95:.2f} ms / {p99:.2f} ms "
+            f"(from history call/return timestamps)"
+        )
+        report = compute_latency_report(ops)
+        print(f"    Put     : {_fmt_percentiles(report['Put'])}")
+        print(f"    Get     : {_fmt_percentiles(report['Get'])}")
+        for client, p in report["clients"].items():
+            print(f"    client {client:<3s}: {_fmt_percentiles(p)}")
+
+    history_rps = compute_history_rps(ops)
+
+    if metrics:
+        fp = metrics.get("fast_path_committed", 0)
+        sp = metrics.get("slow_path_committed", 0)
+        tot = fp + sp or 1
+        aborted = metrics.get("fast_path_aborted", 0)
+        avg_fp = metrics.get("avg_fast_path_latency_us", 0) / 1000
+        avg_sp = metrics.get("avg_slow_path_latency_us", 0) / 1000
+        print(
+            f"  Fast-path : {fp:6d} ops ({fp / tot * 100:.1f}%)  avg {avg_fp:.2f} ms "
+            f"| aborted: {aborted}"
+        )
+        print(f"  Slow-path : {sp:6d} ops ({sp / tot * 100:.1f}%)  avg {avg_sp:.2f} ms")
+    else:
+        print("  Proxy metrics: not available (metrics.json missing)")
+
+    if history_rps is not None:
+        print(f"  Throughput: {history_rps:.1f} rps  (from history)")
+    else:
+        print("  Throughput: n/a  (insufficient history timestamps)")
+
+    if events:
+        start_ns = min((op.call_ns for op in ops), default=events[0].time_ns)
+        print(f"  Events    : {len(events)}")
+        for ev in events[:10]:
+            node = f" node {ev.node}" if ev.node is not None else ""
+            detail = f"  ({ev.detail})" if ev.detail else ""
+            print(f"    {(ev.time_ns - start_ns) / 1e9:+9.3f}s  {ev.kind}{node}{detail}")
+        if len(events) > 10:
+            print(f"    … and {len(events) - 10} more")
+
+    if not ops:
+        print(f"  {label}: SKIPPED  (no history files found)")
+    elif lin_ok:
+        print(f"  {label}: ✓  PASS")
+    elif lin_ok is None:
+        print(f"  {label}: ?  UNKNOWN  (check timed out: {violations[0]})")
+    else:
+        print(f"  {label}: ✗  FAIL  ({len(violations)} violation(s))")
+        for v in violations[:5]:
+            print(f"    • {v}")
+        if len(violations) > 5:
+            print(f"    … and {len(violations) - 5} more")
+    print(f"{'═' * 62}")
+
+# ── CI report ──────────────────────────────────────────────────────────────────
+
+def threshold_failures(result: dict, min_ops: int) -> list[str]:
+    """CI assertions beyond the verdict itself that a config result violates."""
+    failures = []
+    if result["ops"] < min_ops:
+        failures.append(f"only {result['ops']} ops in history (--min-ops {min_ops})")
+    return failures
+
+
+def write_junit(results: list[dict], path: pathlib.Path, max_unknown: int) -> None:
+    """
+    Write a JUnit XML report: one test suite per config holding a consistency
+    test case and a thresholds test case. UNKNOWN verdicts are reported as
+    skipped while at most `max_unknown` configs are UNKNOWN, as errors beyond.
+    """
+    real = [r for r in results if not r.get("skipped")]
+    unknown_ok = sum(1 for r in real if r["lin_ok"] is None) <= max_unknown
+    root = ET.Element("testsuites", name="omnipaxos-kv consistency")
+    for r in real:
+        suite = ET.SubElement(root, "testsuite", name=r["config"])
+        case = ET.SubElement(suite, "testcase", classname=r["config"], name=r["consistency"])
+        if r["lin_ok"] is False:
+            failure = ET.SubElement(case, "failure", message=f"{r['violations']} violation(s)")
+            failure.text = "\n".join(r.get("violation_details", []))
+        elif r["lin_ok"] is None:
+            tag = "skipped" if unknown_ok else "error"
+            ET.SubElement(case, tag, message="check timed out (UNKNOWN)")
+        case = ET.SubElement(suite, "testcase", classname=r["config"], name="thresholds")
+        for failure in r.get("threshold_failures", []):
+            ET.SubElement(case, "failure", message=failure)
+        suite.set("tests", "2")
+        suite.set("failures", str(len(suite.findall("testcase/failure"))))
+        suite.set("errors", str(len(suite.findall("testcase/error"))))
+        suite.set("skipped", str(len(suite.findall("testcase/skipped"))))
+    path.parent.mkdir(parents=True, exist_ok=True)
+    ET.ElementTree(root).write(path, encoding="utf-8", xml_declaration=True)
+
+# ── GitHub annotations ─────────────────────────────────────────────────────────
+
+# Annotations for violations not tied to a failing key, per config.
+MAX_UNTIED_ANNOTATIONS = 10
+
+
+def failure_annotations(config: str, ops: list[Operation], verdicts: dict[str, tuple[str, int]],
+                        violations: list[str], consistency: str) -> list[dict]:
+    """
+    GitHub annotations ({"file", "title", "message"}) for a failed check: one
+    per failing key, on the history file of its offending read (with
+    linearizability) or else of its first operation, carrying that key's
+    violations; violations not tied to a key get one each, without a file.
+    """
+    by_key = partition_by_key(ops)
+    annotations = []
+    tied: set[str] = set()
+    for key, (verdict, _) in verdicts.items():
+        if verdict != "FAIL":
+            continue
+        mine = [v for v in violations if v.startswith(f"Key {key!r}:")]
+        tied.update(mine)
+        key_ops = by_key.get(key, [])
+        op = offending_read(key, key_ops) if consistency == "linearizable" else None
+        op = op or min(key_ops, key=lambda o: o.call_ns, default=None)
+        message = "\n".join(mine) or f"Operations on key {key!r} are not {consistency}."
+        if op is not None and op.source:
+            message = f"Record {op.source[1]} ({op.op_type} by client {op.client_id}): {message}"
+        annotations.append({"file": op.source[0] if op is not None and op.source else None,
+                            "title": f"{config}: key {key!r} not {consistency}", "message": message})
+    untied = [v for v in violations if v not in tied]
+    for v in untied[:MAX_UNTIED_ANNOTATIONS]:
+        annotations.append({"file": None, "title": f"{config}: not {consistency}", "message": v})
+    if len(untied) > MAX_UNTIED_ANNOTATIONS:
+        annotations.append({"file": None, "title": f"{config}: not {consistency}",
+                            "message": f"… and {len(untied) - MAX_UNTIED_ANNOTATIONS} more violation(s)"})
+    return annotations
+
+
+def _workflow_command(command: str, message: str, **props: Optional[str]) -> str:
+    """A GitHub Actions workflow command line, e.g. ::error file=F,title=T::message."""
+    def escape(text: str) -> str:
+        return text.replace("%", "%25").replace("\r", "%0D").replace("\n", "%0A")
+
+    fields = ",".join(f"{name}={escape(value).replace(':', '%3A').replace(',', '%2C')}"
+                      for name, value in props.items() if value is not None)
+    return f"::{command}{' ' + fields if fields else ''}::{escape(message)}"
+
+
+def print_github_annotations(results: list[dict], max_unknown: int) -> None:
+    """
+    Emit workflow annotations: an error per failure_annotations entry and
+    per failed threshold, and a warning (an error beyond `max_unknown`) per
+    UNKNOWN verdict.
+    """
+    real = [r for r in results if not r.get("skipped")]
+    unknown_ok = sum(1 for r in real if r.get("lin_ok", True) is None) <= max_unknown
+    for r in real:
+        for a in r.get("annotations", []):
+            print(_workflow_command("error", a["message"], file=a["file"], title=a["title"]))
+        if r.get("lin_ok", True) is None:
+            print(_workflow_command("warning" if unknown_ok else "error",
+                                    "The check timed out; raise --check-timeout.",
+                                    title=f"{r['config']}: {r['consistency']} verdict UNKNOWN"))
+        for failure in r.get("threshold_failures", []):
+            print(_workflow_command("error", failure, title=f"{r['config']}: threshold"))
+
+# ── Run comparison ─────────────────────────────────────────────────────────────
+
+def _pct_change(old: Optional[float], new: Optional[float]) -> Optional[float]:
+    if old is None or new is None or old == 0:
+        return None
+    return (new - old) / old * 100
+
+
+def compare_results(old: list[dict], new: list[dict], threshold_pct: float) -> int:
+    """
+    Print a per-config diff of two --json result files (verdict, violations,
+    op count, throughput, latency percentiles) and return the number of
+    regressions: a worse verdict, more violations, throughput down or a
+    latency percentile up by more than `threshold_pct` percent.
+    """
+    old_by = {r["config"]: r for r in old if not r.get("skipped")}
+    new_by = {r["config"]: r for r in new if not r.get("skipped")}
+    regressions = 0
+    for name in sorted(old_by.keys() | new_by.keys()):
+        print(f"\n  {name}")
+        if name not in old_by or name not in new_by:
+            print(f"    only in {'new' if name in new_by else 'old'} results")
+            continue
+        a, b = old_by[name], new_by[name]
+        rows: list[tuple[str, str, str, bool]] = []
+        worse = VERDICT_RANK[b.get("lin_ok", True)] > VERDICT_RANK[a.get("lin_ok", True)]
+        rows.append(("verdict", result_verdict(a), result_verdict(b), worse))
+        rows.append(("violations", str(a.get("violations", 0)), str(b.get("violations", 0)),
+                     b.get("violations", 0) > a.get("violations", 0)))
+        rows.append(("ops", str(a.get("ops", 0)), str(b.get("ops", 0)), False))
+        change = _pct_change(a.get("history_rps"), b.get("history_rps"))
+        rows.append((
+            "throughput rps",
+            f"{a['history_rps']:.1f}" if a.get("history_rps") is not None else "n/a",
+            f"{b['history_rps']:.1f}" if b.get("history_rps") is not None else "n/a",
+            change is not None and change < -threshold_pct,
+        ))
+        for group in ("all", "Put", "Get"):
+            pa = (a.get("latency_ms") or {}).get(group) or {}
+            pb = (b.get("latency_ms") or {}).get(group) or {}
+            for q in ("p50", "p95", "p99"):
+                if q not in pa and q not in pb:
+                    continue
+                change = _pct_change(pa.get(q), pb.get(q))
+                rows.append((
+                    f"{group} {q} ms",
+                    f"{pa[q]:.2f}" if q in pa else "n/a",
+                    f"{pb[q]:.2f}" if q in pb else "n/a",
+                    change is not None and change > threshold_pct,
+                ))
+        for label, va, vb, regressed in rows:
+            change = ""
+            try:
+                pct = _pct_change(float(va), float(vb))
+                if pct is not None:
+                    change = f"{pct:+.1f}%"
+            except ValueError:
+                pass
+            flag = "  ✗ REGRESSION" if regressed else ""
+            print(f"    {label:<16s} {va:>10s} → {vb:<10s} {change:>8s}{flag}")
+            regressions += regressed
+    return regressions
+
+# ── Configuration report ───────────────────────────────────────────────────────
+
+def _flatten_settings(data: dict, prefix: str = "") -> dict[str, object]:
+    flat: dict[str, object] = {}
+    for k, v in data.items():
+        if isinstance(v, dict):
+            flat.update(_flatten_settings(v, f"{prefix}{k}."))
+        else:
+            flat[prefix + k] = v
+    return flat
+
+
+def config_settings(config_dir: pathlib.Path) -> dict[str, object]:
+    """
+    The settings of a benchmark folder's config TOMLs as dotted keys
+    ("servers.clock.sync_freq") under their SCENARIO_CONFIGS name, keeping
+    only those every file of a kind agrees on (not server_id, listen_port,
+    ...), plus "nodes", the cluster size.
+    """
+    import tomllib
+    settings: dict[str, object] = {}
+    for kind, pattern in SCENARIO_CONFIGS.items():
+        files = []
+        for path in sorted(config_dir.glob(pattern)):
+            try:
+                files.append(_flatten_settings(tomllib.loads(path.read_text())))
+            except (OSError, ValueError):
+                continue
+        if not files:
+            continue
+        for k, v in files[0].items():
+            if all(f.get(k) == v for f in files[1:]):
+                settings[f"{kind}.{k}"] = v
+    if isinstance(settings.get("cluster.nodes"), list):
+        settings["nodes"] = len(settings["cluster.nodes"])
+    return settings
+
+
+# (label, value of a result dict); shown when any result is non-zero, the first two always.
+REPORT_ANOMALIES: list[tuple[str, Callable[[dict], int]]] = [
+    ("violations", lambda r: r.get("violations", 0)),
+    ("failing keys", lambda r: len(r.get("failed_keys") or {})),
+    ("threshold failures", lambda r: len(r.get("threshold_failures") or [])),
+    ("decided-log problems", lambda r: (r.get("decided_log") or {}).get("problems", 0)
+                                       + (r.get("decided_log") or {}).get("state_problems", 0)),
+    ("post-snapshot misses", lambda r: len((r.get("snapshot_reads") or {}).get("missed", []))),
+    ("writes missing from server logs", lambda r: (r.get("request_log") or {}).get("missing_writes", 0)),
+]
+
+
+def build_report(sources: list[tuple[str, list[dict]]]) -> dict:
+    """
+    The side-by-side comparison of the configs in several --json result
+    files (name, results): one column per config, labelled "config" or,
+    when names repeat across files, "config (file)". Settings come from the
+    results ("settings") or, for older ones, the config_dir if it still
+    exists; only those that differ between columns are listed. Rows are
+    (label, values, better) with better "low"/"high"/None for highlighting.
+    """
+    columns = []
+    names = Counter(r["config"] for _, results in sources for r in results if not r.get("skipped"))
+    for source, results in sources:
+        for r in results:
+            if r.get("skipped"):
+                continue
+            settings = r.get("settings")
+            if settings is None and r.get("config_dir") and pathlib.Path(r["config_dir"]).is_dir():
+                settings = config_settings(pathlib.Path(r["config_dir"]))
+            label = r["config"] if names[r["config"]] == 1 else f"{r['config']} ({source})"
+            columns.append((label, r, settings or {}))
+    keys = sorted({k for _, _, settings in columns for k in settings}, key=lambda k: (k != "nodes", k))
+    differing = {}
+    for k in keys:
+        values = [settings.get(k) for _, _, settings in columns]
+        if any(v != values[0] for v in values):
+            differing[k] = values
+    rows: list[tuple[str, list, Optional[str]]] = [
+        ("verdict", [result_verdict(r) for _, r, _ in columns], None),
+        ("consistency", [r.get("consistency") for _, r, _ in columns], None),
+        ("strongest level", [r.get("strongest_level") for _, r, _ in columns], None),
+        ("ops", [r.get("ops") for _, r, _ in columns], None),
+    ]
+    for n, (label, value) in enumerate(REPORT_ANOMALIES):
+        values = [value(r) for _, r, _ in columns]
+        if n < 2 or any(values):
+            rows.append((label, values, "low"))
+    rows.append(("throughput rps", [r.get("history_rps") for _, r, _ in columns], "high"))
+    for group in ("all", "Put", "Get"):
+        for q in ("p50", "p95", "p99"):
+            values = [((r.get("latency_ms") or {}).get(group) or {}).get(q) for _, r, _ in columns]
+            if any(v is not None for v in values):
+                rows.append((f"{group} {q} ms", values, "low"))
+    return {
+        "columns": [{"label": label, "config": r["config"], "config_dir": r.get("config_dir")}
+                    for label, r, _ in columns],
+        "settings": differing,
+        "rows": [{"label": label, "values": values, "better": better} for label, values, better in rows],
+    }
+
+
+def _report_cell(v: object) -> str:
+    if v is None:
+        return "n/a"
+    if isinstance(v, float):
+        return f"{v:.2f}"
+    if isinstance(v, (list, dict)):
+        return json.dumps(v, separators=(",", ":"))
+    return str(v).lower() if isinstance(v, bool) else str(v)
+
+
+def _best(values: list, better: Optional[str]) -> Optional[object]:
+    present = [v for v in values if isinstance(v, (int, float))]
+    if not better or len(present) < 2 or len(set(present)) == 1:
+        return None
+    return min(present) if better == "low" else max(present)
+
+
+def print_report(report: dict) -> None:
+    labels = [c["label"] for c in report["columns"]]
+    table = [("", labels, None)]
+    table += [(k, v, None) for k, v in report["settings"].items()]
+    table += [(row["label"], row["values"], row["better"]) for row in report["rows"]]
+    first = max(len(label) for label, _, _ in table) + 2
+    width = max(10, *(len(_report_cell(v)) + 2 for _, values, _ in table for v in values))
+    for i, (label, values, better) in enumerate(table):
+        best = _best(values, better)
+        cells = "".join(f"{_report_cell(v) + (' ✓' if best is not None and v == best else ''):>{width}s}"
+                        for v in values)
+        print(f"  {label:<{first}s}{cells}")
+        if i == 0 or i == len(report["settings"]):
+            print("  " + "─" * (first + width * len(values)))
+
+
+def render_report_html(report: dict) -> bytes:
+    escape = html.escape
+    head = "".join(f"<th>{escape(c['label'])}</th>" for c in report["columns"])
+    body = []
+    if report["settings"]:
+        body.append(f"<tr><th colspan='{len(report['columns']) + 1}'>Settings that differ</th></tr>")
+        for k, values in report["settings"].items():
+            body.append(f"<tr><td>{escape(k)}</td>"
+                        + "".join(f"<td>{escape(_report_cell(v))}</td>" for v in values) + "</tr>")
+        body.append(f"<tr><th colspan='{len(report['columns']) + 1}'>Results</th></tr>")
+    for row in report["rows"]:
+        best = _best(row["values"], row["better"])
+        cells = []
+        for v in row["values"]:
+            text = escape(_report_cell(v))
+            if row["label"] == "verdict":
+                cells.append(f"<td class='{text}'>{text}</td>")
+            elif best is not None and v == best:
+                cells.append(f"<td class='num'><b>{text}</b></td>")
+            else:
+                cells.append(f"<td class='num'>{text}</td>" if isinstance(v, (int, float)) else f"<td>{text}</td>")
+        body.append(f"<tr><td>{escape(row['label'])}</td>{''.join(cells)}</tr>")
+    return html_page("Configuration report",
+                 f"<h2>Configuration report</h2><p>Best value per row in bold.</p>"
+                 f"<table><tr><th></th>{head}</tr>{''.join(body)}</table>")
+
+# ── Failure notifications ──────────────────────────────────────────────────────
+
+NOTIFY_FORMATS = ("slack", "json")
+
+# Artifacts (name part, suffix) a notification links to when there is no
+# dashboard, best first; --run-id may follow the name part.
+NOTIFY_LINK_ARTIFACTS = (("-timeline", ".svg"), ("-timeline", ".png"), ("benchmark_results", ".png"),
+                         ("-counterexample", ".json"))
+
+
+def _failure_link(r: dict, dashboard_url: Optional[str], rowid: Optional[int]) -> Optional[str]:
+    if dashboard_url and rowid is not None:
+        return f"{dashboard_url.rstrip('/')}/result?id={rowid}"
+    for name, suffix in NOTIFY_LINK_ARTIFACTS:
+        for path in r.get("artifacts", []):
+            if name in pathlib.Path(path).stem and path.endswith(suffix):
+                return path
+    return None
+
+
+def open_visualization(results: list[dict]) -> None:
+    """
+    --open after a check: the best visualization (as a notification would
+    link it, see NOTIFY_LINK_ARTIFACTS) of the first failing config, else of
+    the first config that has one.
+    """
+    real = [r for r in results if not r.get("skipped")]
+    for r in sorted(real, key=lambda r: r.get("lin_ok", True) is not False):
+        link = _failure_link(r, None, None)
+        if link:
+            open_in_browser(link)
+            return
+    log.warning("--open: nothing to open; plots need matplotlib (and no --no-plots), "
+                "or add --export svg for a timeline")
+
+
+def notify_failures(url: str, fmt: str, results: list[dict], dashboard_url: Optional[str] = None,
+                    rowids: Optional[dict[str, int]] = None, quiet: bool = False) -> None:
+    """
+    POST a notification to the webhook `url` if any config is not consistent:
+    a summary line per failing config with its first violation and a link to
+    its visualization (the dashboard's result page when `dashboard_url` and
+    stored `rowids` are known, else the timeline/plot/counterexample path).
+    `fmt` "slack" posts {"text": ...} for Slack incoming webhooks; "json"
+    adds a "failures" list. Delivery errors are reported, not raised.
+    """
+    failed = [r for r in results if not r.get("skipped") and r.get("lin_ok", True) is False]
+    if not failed:
+        return
+    where = socket.gethostname()
+    lines = [f"✗ omnipaxos-kv: {len(failed)} config(s) not {failed[0]['consistency']} on {where}"]
+    failures = []
+    for r in failed:
+        link = _failure_link(r, dashboard_url, (rowids or {}).get(r["config"]))
+        first = (r.get("violation_details") or [""])[0]
+        line = f"• {r['config']}: {r['violations']} violation(s) in {r['ops']} ops"
+        if first:
+            line += f" — {first}"
+        if link:
+            line += f" <{link}|view>" if fmt == "slack" and "://" in link else f" ({link})"
+        lines.append(line)
+        failures.append({"config": r["config"], "consistency": r["consistency"], "violations": r["violations"],
+                         "ops": r["ops"], "first_violation": first or None, "link": link})
+    payload = {"text": "\n".join(lines)}
+    if fmt == "json":
+        payload["host"] = where
+        payload["failures"] = failures
+    request = urllib.request.Request(url, data=json.dumps(payload).encode(),
+                                     headers={"Content-Type": "application/json"}, method="POST")
+    try:
+        with urllib.request.urlopen(request, timeout=10) as response:
+            response.read()
+        if not quiet:
+            print(f"  Failure notification sent ({len(failed)} config(s))")
+    except (OSError, ValueError) as ex:
+        log.warning(f"Cannot send failure notification to {url}: {ex}")
+
+# ── Summary line ───────────────────────────────────────────────────────────────
+
+def summary_row(r: dict) -> str:
+    """One line per config for the global summary (and all that -q prints)."""
+    if r.get("lin_ok", True) is None:
+        lin = "? UNKNOWN"
+    elif r.get("lin_ok", True):
+        lin = "✓ PASS"
+    else:
+        lin = f"✗ FAIL ({r['violations']})"
+        if r.get("strongest_level"):
+            lin += f" [holds: {r['strongest_level']}]"
+    tp_str = ""
+    if r.get("history_rps") is not None:
+        tp_str = f"  tp≈{r['history_rps']:.0f}rps"
+    limits = "  ✗ " + "; ".join(r["threshold_failures"]) if r.get("threshold_failures") else ""
+    return f"  {r['config']:<30s}  {lin}  {r['ops']} ops{tp_str}{limits}"
@@ -1,12 +1,37 @@
-use crate::{configs::ClientConfig, data_collection::ClientData, network::Network};
+use crate::{
+    configs::{ClientConfig, Workload},
+    data_collection::ClientData,
+    network::Network,
+};
 use chrono::Utc;
 use log::*;
 use omnipaxos_kv::common::{kv::*, messages::*};
-use rand::Rng;
+use rand::{rngs::StdRng, Rng, SeedableRng};
 use std::time::Duration;
-use tokio::time::interval;
+use tokio::time::{interval, Instant};
 
 const NETWORK_BATCH_SIZE: usize = 100;
+const REGISTER_KEY: &str = "register";
+const BENCH_REPORT_INTERVAL: Duration = Duration::from_secs(1);
+// How often attempt timeouts and due retries are looked at.
+const RETRY_CHECK_INTERVAL: Duration = Duration::from_millis(10);
+
+// An operation of the workload, sent once per attempt under the retry policy.
+struct PendingOp {
+    // Command id of the first attempt, recorded as retry_of by the others.
+    request_id: usize,
+    key: String,
+    write_value: Option<String>,
+    // Command ids of the attempts sent so far.
+    attempts: Vec<CommandId>,
+}
+
+// An attempt awaiting its response until the deadline.
+struct InFlight {
+    command_id: CommandId,
+    deadline: Instant,
+    op: PendingOp,
+}
 
 pub struct Client {
     id: ClientId,
@@ -17,10 +42,22 @@ pub struct Client {
     active_server: NodeId,
     final_request_count: Option<usize>,
     next_request_id: usize,
+    // Elements added so far by the set workload.
+    set_elements: Vec<String>,
+    // Drives every random workload decision, so a run is reproducible from its seed.
+    rng: StdRng,
+    // Attempts under a timeout, and operations waiting to be retried.
+    in_flight: Vec<InFlight>,
+    backing_off: Vec<(Instant, PendingOp)>,
+    // Sequence number of the next history segment, with history_rotate_sec.
+    history_segment: usize,
 }
 
 impl Client {
-    pub async fn new(config: ClientConfig) -> Self {
+    pub async fn new(mut config: ClientConfig) -> Self {
+        // Pick a seed if none was given and keep it in the config so the
+        // summary records it.
+        let seed = *config.seed.get_or_insert_with(rand::random);
         let server_network = Network::new(
             vec![(config.server_id, config.server_address.clone())],
             NETWORK_BATCH_SIZE,
@@ -35,7 +72,7 @@ impl Client {
         } else {
             None
         };
-        Client {
+        let mut client = Client {
             id: config.server_id,
             server_network,
             proxy_network,
@@ -44,7 +81,16 @@ impl Client {
             client_data: ClientData::new(),
             final_request_count: None,
             next_request_id: 0,
-        }
+            set_elements: Vec::new(),
+            rng: StdRng::seed_from_u64(seed),
+            in_flight: Vec::new(),
+            backing_off: Vec::new(),
+            history_segment: 0,
+        };
+        // Offset by the client id so clients sharing a seed draw different streams.
+        client.rng = StdRng::seed_from_u64(seed.wrapping_add(client.history_client_id()));
+        info!("{}: Workload seed {seed}", client.id);
+        client
     }
 
     pub async fn run(&mut self) {
@@ -78,13 +124,21 @@ impl Client {
         }
 
         // Initialize intervals
-        let mut rng = rand::thread_rng();
         let mut intervals = intervals.iter();
         let first_interval = intervals.next().unwrap();
         let mut read_ratio = first_interval.get_read_ratio();
         let mut request_interval = interval(first_interval.get_request_delay());
         let mut next_interval = interval(first_interval.get_interval_duration());
         let _ = next_interval.tick().await;
+        let mut bench_interval = interval(BENCH_REPORT_INTERVAL);
+        let _ = bench_interval.tick().await;
+        let mut retry_interval = interval(RETRY_CHECK_INTERVAL);
+        let retries = self.config.retry.enabled();
+        let rotate = self.config.history_rotate_sec.is_some();
+        let mut rotate_interval = interval(Duration::from_secs(
+            self.config.history_rotate_sec.unwrap_or(1).max(1),
+        ));
+        let _ = rotate_interval.tick().await;
 
         // Main event loop
         info!("{}: Starting requests", self.id);
@@ -108,9 +162,21 @@ impl Client {
                         }
                     }
                     _ = request_interval.tick(), if self.final_request_count.is_none() => {
-                        let is_write = rng.gen::<f64>() > read_ratio;
+                        let is_write = self.rng.gen::<f64>() > read_ratio;
                         self.send_request(is_write).await;
                     },
+                    _ = bench_interval.tick(), if self.config.bench => {
+                        self.report_bench_window();
+                    },
+                    _ = retry_interval.tick(), if retries => {
+                        self.check_retries().await;
+                        if self.run_finished() {
+                            break;
+                        }
+                    },
+                    _ = rotate_interval.tick(), if rotate => {
+                        self.rotate_history();
+                    },
                     _ = next_interval.tick() => {
                         match intervals.next() {
                             Some(new_interval) => {
@@ -152,9 +218,21 @@ impl Client {
                         }
                     }
                     _ = request_interval.tick(), if self.final_request_count.is_none() => {
-                        let is_write = rng.gen::<f64>() > read_ratio;
+                        let is_write = self.rng.gen::<f64>() > read_ratio;
                         self.send_request(is_write).await;
                     },
+                    _ = bench_interval.tick(), if self.config.bench => {
+                        self.report_bench_window();
+                    },
+                    _ = retry_interval.tick(), if retries => {
+                        self.check_retries().await;
+                        if self.run_finished() {
+                            break;
+                        }
+                    },
+                    _ = rotate_interval.tick(), if rotate => {
+                        self.rotate_history();
+                    },
                     _ = next_interval.tick() => {
                         match intervals.next() {
                             Some(new_interval) => {
@@ -194,6 +272,13 @@ impl Client {
             self.id,
             self.client_data.response_count(),
         );
+        if retries {
+            let (timed_out, failed) = self.client_data.given_up_counts();
+            info!(
+                "{}: {timed_out} attempt(s) timed out, {failed} failed",
+                self.id
+            );
+        }
         self.server_network.shutdown();
         if let Some(proxy_network) = self.proxy_network.as_mut() {
             proxy_network.shutdown();
@@ -201,6 +286,14 @@ impl Client {
         self.save_results().expect("Failed to save results");
     }
 
+    fn report_bench_window(&mut self) {
+        let stats = self.client_data.take_window_stats(BENCH_REPORT_INTERVAL);
+        info!(
+            "{}: bench: {:.0} ops/s, p50 {} ms, p95 {} ms, p99 {} ms, max {} ms",
+            self.id, stats.throughput, stats.p50_ms, stats.p95_ms, stats.p99_ms, stats.max_ms,
+        );
+    }
+
     fn handle_server_message(&mut self, msg: ServerMessage) {
         match msg {
             ServerMessage::StartSignal(_) => (),
@@ -227,38 +320,176 @@ impl Client {
         }
     }
 
+    // Key and (for writes) value of the next request under the configured workload.
+    fn next_operation(&mut self, is_write: bool) -> (String, Option<String>) {
+        let id = self.next_request_id;
+        match self.config.workload {
+            Workload::Kv => (id.to_string(), is_write.then(|| id.to_string())),
+            Workload::Register => (
+                REGISTER_KEY.to_string(),
+                is_write.then(|| format!("{}-{id}", self.history_client_id())),
+            ),
+            Workload::Set => {
+                if is_write || self.set_elements.is_empty() {
+                    let element = format!("set-{}-{id}", self.history_client_id());
+                    self.set_elements.push(element.clone());
+                    (element.clone(), Some(element))
+                } else {
+                    let i = self.rng.gen_range(0..self.set_elements.len());
+                    (self.set_elements[i].clone(), None)
+                }
+            }
+        }
+    }
+
     async fn send_request(&mut self, is_write: bool) {
-        let key = self.next_request_id.to_string();
-        let write_value = if is_write { Some(key.clone()) } else { None };
-        let cmd = match is_write {
-            true => KVCommand::Put(key.clone(), key.clone()),
-            false => KVCommand::Get(key.clone()),
+        let (key, write_value) = self.next_operation(is_write);
+        let op = PendingOp {
+            request_id: self.next_request_id,
+            key,
+            write_value,
+            attempts: Vec::new(),
+        };
+        self.send_attempt(op).await;
+    }
+
+    // Send the next attempt of an operation, each under its own command id.
+    async fn send_attempt(&mut self, mut op: PendingOp) {
+        let command_id = self.next_request_id;
+        self.next_request_id += 1;
+        let is_write = op.write_value.is_some();
+        let policy = *self.config.retry.for_op(is_write);
+        let cmd = match &op.write_value {
+            Some(value) => KVCommand::Put(op.key.clone(), value.clone()),
+            None => KVCommand::Get(op.key.clone()),
         };
-        
-        let request = ClientMessage::Append(self.next_request_id, cmd);
+
+        let request = ClientMessage::Append(command_id, cmd);
         debug!("Sending {request:?}");
 
-        if self.config.use_proxy {
+        op.attempts.push(command_id);
+        // The server does not deduplicate retries: each attempt is a request
+        // of its own that may be applied, so it gets its own request_id.
+        self.client_data.new_request(
+            is_write,
+            op.key.clone(),
+            op.write_value.clone(),
+            (policy.attempts > 1).then_some(command_id),
+            op.attempts.len() as u32,
+            (op.attempts.len() > 1).then_some(op.request_id),
+        );
+        let sent = if self.config.use_proxy {
             self.proxy_network
                 .as_mut()
                 .expect("Proxy network missing")
                 .send(self.active_server, request)
-                .await;
+                .await
         } else {
-            self.server_network.send(self.active_server, request).await;
+            self.server_network.send(self.active_server, request).await
+        };
+
+        if !sent {
+            self.client_data.fail(command_id);
+            self.retry_later(op);
+        } else if let Some(timeout) = policy.timeout() {
+            self.in_flight.push(InFlight {
+                command_id,
+                deadline: Instant::now() + timeout,
+                op,
+            });
         }
+    }
 
-        self.client_data.new_request(is_write, key, write_value);
-        self.next_request_id += 1
+    // Schedule the operation's next attempt, if its policy allows one.
+    fn retry_later(&mut self, op: PendingOp) {
+        let policy = self.config.retry.for_op(op.write_value.is_some());
+        let retry = op.attempts.len() as u32;
+        if retry < policy.attempts {
+            self.backing_off
+                .push((Instant::now() + policy.backoff(retry), op));
+        }
     }
 
-    fn run_finished(&self) -> bool {
-        if let Some(count) = self.final_request_count {
-            if self.client_data.response_count() >= count {
-                return true;
+    // Time out attempts past their deadline and send the retries now due.
+    async fn check_retries(&mut self) {
+        let now = Instant::now();
+        for attempt in std::mem::take(&mut self.in_flight) {
+            if self.client_data.answered(attempt.command_id) {
+                continue;
             }
+            if attempt.deadline > now {
+                self.in_flight.push(attempt);
+                continue;
+            }
+            debug!("{}: attempt {} timed out", self.id, attempt.command_id);
+            self.client_data.time_out(attempt.command_id);
+            self.retry_later(attempt.op);
+        }
+        let (due, waiting) = std::mem::take(&mut self.backing_off)
+            .into_iter()
+            .partition::<Vec<_>, _>(|(at, _)| *at <= now);
+        self.backing_off = waiting;
+        for (_, op) in due {
+            // A timed-out attempt answered late has completed the operation.
+            if op.attempts.iter().any(|&id| self.client_data.answered(id)) {
+                continue;
+            }
+            self.send_attempt(op).await;
         }
-        false
+    }
+
+    // Path of the next history segment; the last one is marked as such so
+    // a soak checker knows this client is done.
+    fn history_segment_path(&self, last: bool) -> String {
+        let dir = std::path::Path::new(&self.config.summary_filepath)
+            .parent()
+            .unwrap_or(std::path::Path::new("."))
+            .join("segments");
+        let name = format!(
+            "history-{}.{:06}{}.json",
+            self.history_client_id(),
+            self.history_segment,
+            if last { ".last" } else { "" }
+        );
+        dir.join(name).to_string_lossy().into_owned()
+    }
+
+    fn rotate_history(&mut self) {
+        // Attempts the retry logic still looks up stay in memory.
+        let keep_from = self
+            .in_flight
+            .iter()
+            .map(|a| a.command_id)
+            .chain(
+                self.backing_off
+                    .iter()
+                    .flat_map(|(_, op)| op.attempts.iter().copied()),
+            )
+            .min()
+            .unwrap_or(self.next_request_id);
+        // A request left unanswered for a whole period is given up on.
+        let max_wait = Duration::from_secs(self.config.history_rotate_sec.unwrap_or(1).max(1));
+        let path = self.history_segment_path(false);
+        let client_id = self.history_client_id();
+        match self.client_data.rotate(
+            keep_from,
+            max_wait,
+            &path,
+            &self.config.output_filepath,
+            client_id,
+        ) {
+            Ok(n) => {
+                info!("{}: History segment saved → {path} ({n} requests)", self.id);
+                self.history_segment += 1;
+            }
+            Err(e) => warn!("Failed to write history segment {path}: {e}"),
+        }
+    }
+
+    fn run_finished(&self) -> bool {
+        self.final_request_count.is_some()
+            && self.client_data.outstanding() == 0
+            && self.backing_off.is_empty()
     }
 
     // Wait until the scheduled start time to synchronize client starts.
@@ -277,12 +508,11 @@ impl Client {
         }
     }
 
-    fn save_results(&self) -> Result<(), std::io::Error> {
-        self.client_data.save_summary(self.config.clone())?;
-        self.client_data
-            .to_csv(self.config.output_filepath.clone())?;
-        let history_path = self.config.summary_filepath.replace("client-", "history-");
-        let client_id = self.config.summary_filepath
+    // The client id recorded in the history: the N of client-N.json, which
+    // unlike server_id is unique per client.
+    fn history_client_id(&self) -> u64 {
+        self.config
+            .summary_filepath
             .chars()
             .rev()
             .skip(5) // skip ".json"
@@ -292,10 +522,39 @@ impl Client {
             .rev()
             .collect::<String>()
             .parse::<u64>()
-            .unwrap_or(self.id as u64);
+            .unwrap_or(self.id as u64)
+    }
+
+    fn save_results(&self) -> Result<(), std::io::Error> {
+        self.client_data.save_summary(self.config.clone())?;
+        self.client_data
+            .to_csv(self.config.output_filepath.clone())?;
+        let history_path = if self.config.history_rotate_sec.is_some() {
+            self.history_segment_path(true)
+        } else {
+            self.config.summary_filepath.replace("client-", "history-")
+        };
+        let client_id = self.history_client_id();
         if let Err(e) = self.client_data.save_history(&history_path, client_id) {
             log::warn!("Failed to write history file {}: {}", history_path, e);
         }
+        if self.config.bench {
+            let stats = self.client_data.bench_stats();
+            info!(
+                "{}: bench total: {} responses, {:.0} ops/s, p50 {} ms, p95 {} ms, p99 {} ms, max {} ms",
+                self.id,
+                stats.responses,
+                stats.throughput,
+                stats.p50_ms,
+                stats.p95_ms,
+                stats.p99_ms,
+                stats.max_ms,
+            );
+            let bench_path = self.config.summary_filepath.replace("client-", "bench-");
+            if let Err(e) = self.client_data.save_bench(&bench_path) {
+                log::warn!("Failed to write bench file {}: {}", bench_path, e);
+            }
+        }
         Ok(())
     }
 }
@@ -12,6 +12,25 @@ pub struct ClientConfig {
     pub proxy_address: String,
     pub use_proxy: bool,
     pub requests: Vec<RequestInterval>,
+    #[serde(default)]
+    pub workload: Workload,
+    /// Log windowed throughput and latency percentiles while running and save
+    /// the totals next to the history.
+    #[serde(default)]
+    pub bench: bool,
+    /// Seed for the workload's random choices (read/write mix, set lookups).
+    /// A random one is picked when unset; either way it is saved in the
+    /// summary so the run can be regenerated.
+    #[serde(default)]
+    pub seed: Option<u64>,
+    /// Timeout, retry and backoff policy for reads and writes.
+    #[serde(default)]
+    pub retry: RetryPolicies,
+    /// For soak tests: every this many seconds, move the requests settled so
+    /// far out of memory into a new history segment under logs/segments/
+    /// (and onto the CSV), instead of keeping the whole history for the end.
+    #[serde(default)]
+    pub history_rotate_sec: Option<u64>,
     pub sync_time: Option<Timestamp>,
     pub summary_filepath: String,
     pub output_filepath: String,
@@ -33,6 +52,94 @@ impl ClientConfig {
 
 }
 
+/// Shape of the generated requests. The property workloads make concurrent
+/// clients touch the same keys, so the history checks have something to find.
+#[derive(Debug, Serialize, Deserialize, Clone, Copy, Default, PartialEq, Eq)]
+#[serde(rename_all = "lowercase")]
+pub enum Workload {
+    /// Every request on a fresh key.
+    #[default]
+    Kv,
+    /// All requests on a single register; every write has a unique value.
+    Register,
+    /// Writes add a unique element (one key each); reads look up an element
+    /// this client already added, which must survive once acknowledged.
+    Set,
+}
+
+/// Retry policies per operation type (`[retry.get]` and `[retry.put]`).
+#[derive(Debug, Serialize, Deserialize, Clone, Copy, Default)]
+#[serde(default)]
+pub struct RetryPolicies {
+    pub get: RetryPolicy,
+    pub put: RetryPolicy,
+}
+
+impl RetryPolicies {
+    pub fn for_op(&self, is_write: bool) -> &RetryPolicy {
+        if is_write {
+            &self.put
+        } else {
+            &self.get
+        }
+    }
+
+    // Whether attempts need watching at all: the defaults wait for every
+    // response and never retry.
+    pub fn enabled(&self) -> bool {
+        [&self.get, &self.put]
+            .iter()
+            .any(|p| p.timeout_ms.is_some() || p.attempts > 1)
+    }
+}
+
+/// How long to wait on an attempt and how to retry it. An attempt that
+/// times out may still be applied, so it is recorded with an `info`
+/// outcome (or `ok` if its response turns up later); one that could not be
+/// sent is recorded as `fail`. Either way the next attempt, if any, is sent
+/// after the backoff with the same key and value.
+#[derive(Debug, Serialize, Deserialize, Clone, Copy)]
+#[serde(default)]
+pub struct RetryPolicy {
+    /// Give up on an attempt after this long; unset waits for the response.
+    pub timeout_ms: Option<u64>,
+    /// Attempts per operation, the first included.
+    pub attempts: u32,
+    /// Delay before the first retry, multiplied by `backoff_multiplier`
+    /// for each further one and capped at `max_backoff_ms`.
+    pub backoff_ms: u64,
+    pub backoff_multiplier: f64,
+    pub max_backoff_ms: u64,
+}
+
+impl Default for RetryPolicy {
+    fn default() -> Self {
+        RetryPolicy {
+            timeout_ms: None,
+            attempts: 1,
+            backoff_ms: 100,
+            backoff_multiplier: 2.0,
+            max_backoff_ms: 5000,
+        }
+    }
+}
+
+impl RetryPolicy {
+    pub fn timeout(&self) -> Option<Duration> {
+        self.timeout_ms.map(Duration::from_millis)
+    }
+
+    // Delay before retry number `retry` (1 for the second attempt).
+    pub fn backoff(&self, retry: u32) -> Duration {
+        let factor = self
+            .backoff_multiplier
+            .max(1.0)
+            .powi(retry.saturating_sub(1) as i32);
+        let delay_ms = (self.backoff_ms as f64 * factor).min(self.max_backoff_ms as f64);
+        Duration::from_millis(delay_ms as u64)
+    }
+}
+
 #[derive(Debug, Serialize, Deserialize, Clone, Copy)]
 pub struct RequestInterval {
     pub duration_sec: u64,
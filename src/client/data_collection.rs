@@ -1,7 +1,7 @@
-use std::{fs::File, io::Write};
+use std::{collections::BTreeMap, fs::File, io::Write, time::Duration};
 
 use chrono::Utc;
-use csv::Writer;
+use csv::WriterBuilder;
 use omnipaxos_kv::common::{kv::CommandId, utils::Timestamp};
 use serde::Serialize;
 
@@ -25,22 +25,119 @@ struct RequestData {
     return_time_ns: Option<i64>,
     #[serde(skip)]
     response_value: Option<String>,
+    // Each attempt of a retryable operation is its own request, under its
+    // own command id; retry_of is the command id of the first attempt.
+    #[serde(skip)]
+    request_id: Option<usize>,
+    #[serde(skip)]
+    attempt: u32,
+    #[serde(skip)]
+    retry_of: Option<usize>,
+    #[serde(skip)]
+    gave_up: Option<GaveUp>,
+}
+
+// Why the client stopped waiting on an unanswered attempt.
+#[derive(Debug, Clone, Copy)]
+enum GaveUp {
+    // Timed out: it may still be applied.
+    TimedOut,
+    // Never reached a connection (at this time, ns): it was not applied.
+    Failed(i64),
 }
 
 pub struct ClientData {
+    // Requests not yet rotated out to a history segment, from command id
+    // first_id on.
     request_data: Vec<RequestData>,
+    first_id: CommandId,
     response_count: usize,
+    // Attempts neither answered nor given up on.
+    outstanding: usize,
+    timed_out: usize,
+    failed: usize,
+    // Whether rows were already written to the CSV, which is then appended to.
+    csv_started: bool,
+    // Latencies (ms) of responses since the last bench window was taken.
+    window_latencies: Vec<Timestamp>,
+    // What bench_stats needs of the requests rotated out: a latency (ms)
+    // histogram of their responses, the first request and the last response.
+    rotated_latencies: BTreeMap<Timestamp, usize>,
+    rotated_first_request: Option<Timestamp>,
+    rotated_last_response: Option<Timestamp>,
+}
+
+/// Throughput and latency percentiles over a set of responses.
+#[derive(Debug, Serialize, Clone, Copy)]
+pub struct BenchStats {
+    pub responses: usize,
+    pub throughput: f64,
+    pub p50_ms: Timestamp,
+    pub p95_ms: Timestamp,
+    pub p99_ms: Timestamp,
+    pub max_ms: Timestamp,
+}
+
+impl BenchStats {
+    fn from_latencies(latencies: Vec<Timestamp>, elapsed_ms: Timestamp) -> Self {
+        let mut histogram = BTreeMap::new();
+        for latency in latencies {
+            *histogram.entry(latency).or_default() += 1;
+        }
+        Self::from_histogram(&histogram, elapsed_ms)
+    }
+
+    // From latency (ms) -> number of responses with it.
+    fn from_histogram(histogram: &BTreeMap<Timestamp, usize>, elapsed_ms: Timestamp) -> Self {
+        let responses: usize = histogram.values().sum();
+        let percentile = |p: f64| -> Timestamp {
+            let rank = ((p * responses as f64).ceil() as usize).max(1);
+            let mut seen = 0;
+            for (&latency, &count) in histogram {
+                seen += count;
+                if seen >= rank {
+                    return latency;
+                }
+            }
+            0
+        };
+        BenchStats {
+            responses,
+            throughput: responses as f64 * 1000.0 / elapsed_ms.max(1) as f64,
+            p50_ms: percentile(0.50),
+            p95_ms: percentile(0.95),
+            p99_ms: percentile(0.99),
+            max_ms: histogram.keys().next_back().copied().unwrap_or(0),
+        }
+    }
 }
 
 impl ClientData {
     pub fn new() -> Self {
         Self {
             request_data: Vec::new(),
+            first_id: 0,
             response_count: 0,
+            outstanding: 0,
+            timed_out: 0,
+            failed: 0,
+            csv_started: false,
+            window_latencies: Vec::new(),
+            rotated_latencies: BTreeMap::new(),
+            rotated_first_request: None,
+            rotated_last_response: None,
         }
     }
 
-    pub fn new_request(&mut self, is_write: bool, key: String, write_value: Option<String>) {
+    pub fn new_request(
+        &mut self,
+        is_write: bool,
+        key: String,
+        write_value: Option<String>,
+        request_id: Option<usize>,
+        attempt: u32,
+        retry_of: Option<usize>,
+    ) {
         let now_ms = Utc::now().timestamp_millis();
         let now_ns = Utc::now().timestamp_nanos_opt().unwrap_or(now_ms * 1_000_000);
         let data = RequestData {
@@ -53,30 +150,123 @@ impl ClientData {
             call_time_ns: now_ns,
             return_time_ns: None,
             response_value: None,
+            request_id,
+            attempt,
+            retry_of,
+            gave_up: None,
         };
         self.request_data.push(data);
+        self.outstanding += 1;
     }
 
     pub fn new_response(&mut self, command_id: CommandId, response_value: Option<String>) {
         let now_ms = Utc::now().timestamp_millis();
         let now_ns = Utc::now().timestamp_nanos_opt().unwrap_or(now_ms * 1_000_000);
-        if let Some(request_data) = self.request_data.get_mut(command_id) {
+        let index = command_id.wrapping_sub(self.first_id);
+        if let Some(request_data) = self.request_data.get_mut(index) {
             if request_data.response_time.is_none() {
+                // A late response settles a timed-out attempt as ok, but it
+                // was already given up on.
+                if request_data.gave_up.is_none() {
+                    self.outstanding -= 1;
+                }
                 request_data.response_time = Some(now_ms);
                 request_data.return_time_ns = Some(now_ns);
                 request_data.response_value = response_value;
+                self.window_latencies.push(now_ms - request_data.request_time);
             }
             request_data.response_count += 1;
             self.response_count += 1;
         }
     }
 
+    // Stop waiting on an unanswered attempt that may still be applied.
+    pub fn time_out(&mut self, command_id: CommandId) {
+        self.give_up(command_id, GaveUp::TimedOut);
+    }
+
+    // Record an attempt that was never sent as failed.
+    pub fn fail(&mut self, command_id: CommandId) {
+        let now_ms = Utc::now().timestamp_millis();
+        let now_ns = Utc::now().timestamp_nanos_opt().unwrap_or(now_ms * 1_000_000);
+        self.give_up(command_id, GaveUp::Failed(now_ns));
+    }
+
+    fn give_up(&mut self, command_id: CommandId, reason: GaveUp) {
+        let index = command_id.wrapping_sub(self.first_id);
+        if let Some(request_data) = self.request_data.get_mut(index) {
+            if request_data.response_time.is_none() && request_data.gave_up.is_none() {
+                request_data.gave_up = Some(reason);
+                self.outstanding -= 1;
+                match reason {
+                    GaveUp::TimedOut => self.timed_out += 1,
+                    GaveUp::Failed(_) => self.failed += 1,
+                }
+            }
+        }
+    }
+
+    pub fn answered(&self, command_id: CommandId) -> bool {
+        self.request_data
+            .get(command_id.wrapping_sub(self.first_id))
+            .is_some_and(|r| r.response_time.is_some())
+    }
+
+    // Attempts still awaiting a response.
+    pub fn outstanding(&self) -> usize {
+        self.outstanding
+    }
+
+    // Attempts timed out and failed so far.
+    pub fn given_up_counts(&self) -> (usize, usize) {
+        (self.timed_out, self.failed)
+    }
+
     pub fn response_count(&self) -> usize {
         self.response_count
     }
 
     pub fn request_count(&self) -> usize {
-        self.request_data.len()
+        self.first_id + self.request_data.len()
+    }
+
+    // Stats over the responses received since the previous call.
+    pub fn take_window_stats(&mut self, elapsed: Duration) -> BenchStats {
+        let latencies = std::mem::take(&mut self.window_latencies);
+        BenchStats::from_latencies(latencies, elapsed.as_millis() as Timestamp)
+    }
+
+    // Stats over the whole run, from the first request to the last response,
+    // including the requests already rotated out to history segments.
+    pub fn bench_stats(&self) -> BenchStats {
+        let mut latencies = self.rotated_latencies.clone();
+        for r in &self.request_data {
+            if let Some(t) = r.response_time {
+                *latencies.entry(t - r.request_time).or_default() += 1;
+            }
+        }
+        let first_request = self
+            .rotated_first_request
+            .or_else(|| self.request_data.first().map(|r| r.request_time));
+        let last_response = self
+            .request_data
+            .iter()
+            .filter_map(|r| r.response_time)
+            .chain(self.rotated_last_response)
+            .max();
+        let elapsed_ms = match (first_request, last_response) {
+            (Some(start), Some(end)) => end - start,
+            _ => 0,
+        };
+        BenchStats::from_histogram(&latencies, elapsed_ms)
+    }
+
+    pub fn save_bench(&self, file_path: &str) -> Result<(), std::io::Error> {
+        let json = serde_json::to_string_pretty(&self.bench_stats())?;
+        let mut file = File::create(file_path)?;
+        file.write_all(json.as_bytes())?;
+        file.flush()?;
+        Ok(())
     }
 
     pub fn save_summary(&self, config: ClientConfig) -> Result<(), std::io::Error> {
@@ -88,68 +278,160 @@ impl ClientData {
     }
 
     pub fn to_csv(&self, file_path: String) -> Result<(), std::io::Error> {
-        let file = File::create(file_path)?;
-        let mut writer = Writer::from_writer(file);
-        for data in &self.request_data {
-            writer.serialize(data)?;
-        }
-        writer.flush()?;
-        Ok(())
+        write_csv(&self.request_data, &file_path, self.csv_started)
     }
 
     pub fn save_history(&self, file_path: &str, client_id: u64) -> Result<(), std::io::Error> {
-        #[derive(Serialize)]
-        struct HistoryInput<'a> {
-            #[serde(rename = "type")]
-            op_type: &'a str,
-            key: &'a str,
-            #[serde(skip_serializing_if = "Option::is_none")]
-            value: Option<&'a str>,
+        write_history(&self.request_data, file_path, client_id)
+    }
+
+    // Move the requests settled so far (answered or given up on), up to the
+    // first one still awaited or before command id `keep_from`, out of
+    // memory: into the history segment at `file_path` and onto the CSV.
+    // Requests before `keep_from` still unanswered after `max_wait` are
+    // timed out first, so one lost response cannot hold every later request
+    // in memory. Returns how many were written.
+    pub fn rotate(
+        &mut self,
+        keep_from: CommandId,
+        max_wait: Duration,
+        file_path: &str,
+        csv_path: &str,
+        client_id: u64,
+    ) -> Result<usize, std::io::Error> {
+        let rotatable = keep_from
+            .saturating_sub(self.first_id)
+            .min(self.request_data.len());
+        let cutoff = Utc::now().timestamp_millis() - max_wait.as_millis() as Timestamp;
+        let stale = self.request_data[..rotatable]
+            .iter()
+            .take_while(|r| r.request_time <= cutoff)
+            .count();
+        for command_id in self.first_id..self.first_id + stale {
+            self.time_out(command_id);
         }
-        #[derive(Serialize)]
-        struct HistoryOutput<'a> {
-            status: &'a str,
-            #[serde(skip_serializing_if = "Option::is_none")]
-            value: Option<&'a str>,
+        let settled = self.request_data[..rotatable]
+            .iter()
+            .take_while(|r| r.response_time.is_some() || r.gave_up.is_some())
+            .count();
+        let segment = &self.request_data[..settled];
+        // Written under a temporary name so a reader never sees half a segment.
+        let partial_path = format!("{file_path}.partial");
+        write_history(segment, &partial_path, client_id)?;
+        std::fs::rename(&partial_path, file_path)?;
+        write_csv(segment, csv_path, self.csv_started)?;
+        self.csv_started = true;
+        if let Some(first) = segment.first() {
+            self.rotated_first_request.get_or_insert(first.request_time);
         }
-        #[derive(Serialize)]
-        struct HistoryEntry<'a> {
-            client_id: u64,
-            input: HistoryInput<'a>,
-            call: i64,
-            output: HistoryOutput<'a>,
-            return_time: i64,
+        for r in segment {
+            if let Some(t) = r.response_time {
+                *self.rotated_latencies.entry(t - r.request_time).or_default() += 1;
+                self.rotated_last_response = self.rotated_last_response.max(Some(t));
+            }
         }
+        self.request_data.drain(..settled);
+        self.first_id += settled;
+        Ok(settled)
+    }
+}
 
-        let mut entries: Vec<HistoryEntry> = Vec::with_capacity(self.request_data.len());
-        for req in &self.request_data {
-            let Some(return_ns) = req.return_time_ns else { continue };
-            let (op_type, value) = if req.write {
-                ("Put", req.write_value.as_deref())
-            } else {
-                ("Get", None)
-            };
-            entries.push(HistoryEntry {
-                client_id,
-                input: HistoryInput { op_type, key: &req.key, value },
-                call: req.call_time_ns,
-                output: HistoryOutput {
-                    status: "ok",
-                    value: req.response_value.as_deref(),
-                },
-                return_time: return_ns,
-            });
-        }
+fn write_csv(rows: &[RequestData], file_path: &str, append: bool) -> Result<(), std::io::Error> {
+    let file = std::fs::OpenOptions::new()
+        .write(true)
+        .create(true)
+        .append(append)
+        .truncate(!append)
+        .open(file_path)?;
+    let mut writer = WriterBuilder::new().has_headers(!append).from_writer(file);
+    for data in rows {
+        writer.serialize(data)?;
+    }
+    writer.flush()?;
+    Ok(())
+}
 
-        let json = serde_json::to_string_pretty(&entries)
-            .map_err(|e| std::io::Error::new(std::io::ErrorKind::Other, e))?;
-        // Ensure parent directory exists
-        if let Some(parent) = std::path::Path::new(file_path).parent() {
-            std::fs::create_dir_all(parent)?;
-        }
-        let mut file = File::create(file_path)?;
-        file.write_all(json.as_bytes())?;
-        file.flush()?;
-        Ok(())
+fn write_history(
+    requests: &[RequestData],
+    file_path: &str,
+    client_id: u64,
+) -> Result<(), std::io::Error> {
+    #[derive(Serialize)]
+    struct HistoryInput<'a> {
+        #[serde(rename = "type")]
+        op_type: &'a str,
+        key: &'a str,
+        #[serde(skip_serializing_if = "Option::is_none")]
+        value: Option<&'a str>,
+    }
+    #[derive(Serialize)]
+    struct HistoryOutput<'a> {
+        status: &'a str,
+        #[serde(skip_serializing_if = "Option::is_none")]
+        value: Option<&'a str>,
+    }
+    #[derive(Serialize)]
+    struct HistoryMeta {
+        attempt: u32,
+        #[serde(skip_serializing_if = "Option::is_none")]
+        retry_of: Option<usize>,
+    }
+    #[derive(Serialize)]
+    struct HistoryEntry<'a> {
+        client_id: u64,
+        input: HistoryInput<'a>,
+        call: i64,
+        output: HistoryOutput<'a>,
+        return_time: i64,
+        #[serde(skip_serializing_if = "Option::is_none")]
+        request_id: Option<usize>,
+        #[serde(skip_serializing_if = "Option::is_none")]
+        meta: Option<HistoryMeta>,
+    }
+
+    // Requests still unanswered may or may not have been applied: record
+    // them with an unknown outcome (info if the client timed them out),
+    // open until the history is saved. Failed attempts were never sent.
+    let now_ms = Utc::now().timestamp_millis();
+    let saved_ns = Utc::now().timestamp_nanos_opt().unwrap_or(now_ms * 1_000_000);
+    let mut entries: Vec<HistoryEntry> = Vec::with_capacity(requests.len());
+    for req in requests {
+        let (status, return_ns) = match (req.return_time_ns, req.gave_up) {
+            (Some(return_ns), _) => ("ok", return_ns),
+            (None, Some(GaveUp::Failed(failed_ns))) => ("fail", failed_ns),
+            (None, Some(GaveUp::TimedOut)) => ("info", saved_ns),
+            (None, None) => ("unknown", saved_ns),
+        };
+        let (op_type, value) = if req.write {
+            ("Put", req.write_value.as_deref())
+        } else {
+            ("Get", None)
+        };
+        entries.push(HistoryEntry {
+            client_id,
+            input: HistoryInput { op_type, key: &req.key, value },
+            call: req.call_time_ns,
+            output: HistoryOutput {
+                status,
+                value: req.response_value.as_deref(),
+            },
+            return_time: return_ns,
+            request_id: req.request_id,
+            meta: req.request_id.map(|_| HistoryMeta {
+                attempt: req.attempt,
+                retry_of: req.retry_of,
+            }),
+        });
+    }
+
+    let json = serde_json::to_string_pretty(&entries)
+        .map_err(|e| std::io::Error::new(std::io::ErrorKind::Other, e))?;
+    // Ensure parent directory exists
+    if let Some(parent) = std::path::Path::new(file_path).parent() {
+        std::fs::create_dir_all(parent)?;
     }
+    let mut file = File::create(file_path)?;
+    file.write_all(json.as_bytes())?;
+    file.flush()?;
+    Ok(())
 }
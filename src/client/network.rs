@@ -92,18 +92,28 @@ impl Network {
         }
     }
 
-    pub async fn send(&mut self, to: NodeId, msg: ClientMessage) {
+    // Returns false if the message never reached a connection (and so was
+    // certainly not delivered).
+    pub async fn send(&mut self, to: NodeId, msg: ClientMessage) -> bool {
         match self.server_connections.get_mut(to as usize) {
             Some(connection_slot) => match connection_slot {
                 Some(connection) => {
                     if let Err(err) = connection.send(msg).await {
                         warn!("Couldn't send msg to server {to}: {err}");
                         self.server_connections[to as usize] = None;
+                        return false;
                     }
+                    true
+                }
+                None => {
+                    error!("Not connected to server {to}");
+                    false
                 }
-                None => error!("Not connected to server {to}"),
             },
-            None => error!("Sending to unexpected server {to}"),
+            None => {
+                error!("Sending to unexpected server {to}");
+                false
+            }
         }
     }
 
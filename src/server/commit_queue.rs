@@ -18,6 +18,10 @@ impl CommitQueue {
         }
     }
 
+    pub fn is_empty(&self) -> bool {
+        self.commands.is_empty()
+    }
+
     pub fn push(&mut self, command: Command, state: CommitState) {
         self.commands.push_back((command, state));
     }
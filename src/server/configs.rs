@@ -47,6 +47,14 @@ pub struct LocalConfig {
     /// Maximum number of simulated failures. 0 means unlimited.
     #[serde(default = "default_failure_max_events")]
     pub failure_max_events: u64,
+    /// Append every decided log entry to this file (JSON lines) for offline
+    /// cross-checks against the client histories.
+    #[serde(default)]
+    pub decided_log_filepath: Option<String>,
+    /// Periodically save the key-value state, with the decided index it
+    /// reflects, to this file so it can be diffed against a replay of the log.
+    #[serde(default)]
+    pub state_snapshot_filepath: Option<String>,
 }
 
 #[derive(Debug, Serialize, Deserialize, Clone)]
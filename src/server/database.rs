@@ -10,6 +10,10 @@ impl Database {
         Self { db: HashMap::new() }
     }
 
+    pub fn entries(&self) -> &HashMap<String, String> {
+        &self.db
+    }
+
     pub fn handle_command(&mut self, command: KVCommand) -> Option<Option<String>> {
         match command {
             KVCommand::Put(key, value) => {
@@ -12,7 +12,7 @@ use omnipaxos_kv::dom::dom::Dom;
 use omnipaxos_kv::dom::config::DomConfig;
 use omnipaxos_storage::memory_storage::MemoryStorage;
 use serde::Serialize;
-use std::{collections::HashSet, fs::File, io::Write, time::{Duration, Instant}};
+use std::{collections::{HashMap, HashSet}, fs::File, io::Write, time::{Duration, Instant}};
 
 use crate::commit_queue::{CommitQueue, CommitState};
 
@@ -24,6 +24,25 @@ const STATS_FLUSH_INTERVAL: Duration = Duration::from_secs(5);
 const LATE_BUFFER_DRAIN_INTERVAL: Duration = Duration::from_millis(10);
 
 
+#[derive(Debug, Serialize)]
+struct DecidedLogEntry<'a> {
+    idx: usize,
+    client_id: ClientId,
+    coordinator_id: NodeId,
+    command_id: CommandId,
+    op: &'a str,
+    key: &'a str,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    value: Option<&'a str>,
+}
+
+#[derive(Debug, Serialize)]
+struct StateSnapshot<'a> {
+    server_id: NodeId,
+    decided_idx: usize,
+    state: &'a HashMap<String, String>,
+}
+
 #[derive(Debug, Serialize)]
 struct ServerStats<'a> {
     config: &'a OmniPaxosKVConfig,
@@ -31,6 +50,17 @@ struct ServerStats<'a> {
     late_buffer_rate_rps: f64,
 }
 
+// The decided log is a debug artifact: a replica that cannot create it runs without it.
+fn open_decided_log(id: NodeId, path: &str) -> Option<File> {
+    match File::create(path) {
+        Ok(file) => Some(file),
+        Err(e) => {
+            warn!("{id}: Cannot create decided log {path}: {e}; running without it");
+            None
+        }
+    }
+}
+
 pub struct OmniPaxosServer {
     id: NodeId,
     database: Database,
@@ -51,6 +81,7 @@ pub struct OmniPaxosServer {
     fast_path_executed: HashSet<(ClientId, CommandId)>,
 
     log_hash: LogHash,
+    decided_log: Option<File>,
 
     stats_window_start: Instant,
 }
@@ -64,6 +95,11 @@ impl OmniPaxosServer {
         let omnipaxos = omnipaxos_config.build(storage).unwrap();
         // Waits for client and server network connections to be established
         let network = Network::new(config.clone(), NETWORK_BATCH_SIZE).await;
+        let decided_log = config
+            .local
+            .decided_log_filepath
+            .as_ref()
+            .and_then(|path| open_decided_log(config.local.server_id, path));
         OmniPaxosServer {
             id: config.local.server_id,
             database: Database::new(),
@@ -80,6 +116,7 @@ impl OmniPaxosServer {
             proxy_command_ids: HashSet::new(),
             fast_path_executed: HashSet::new(),
             log_hash: LogHash::new(),
+            decided_log,
             commit_queue: CommitQueue::new(),
             stats_window_start: Instant::now(),
         }
@@ -286,6 +323,7 @@ impl OmniPaxosServer {
                 .omnipaxos
                 .read_decided_suffix(self.current_decided_idx)
                 .unwrap();
+            let first_idx = self.current_decided_idx;
             self.current_decided_idx = new_decided_idx;
             debug!("Decided {new_decided_idx}");
             let decided_commands = decided_entries
@@ -300,10 +338,45 @@ impl OmniPaxosServer {
             for cmd in &decided_commands {
                 self.log_hash.add_entry(cmd);
             }
+            self.write_decided_log(first_idx, &decided_commands);
             self.update_database_and_respond(decided_commands);
         }
     }
 
+    // Written unbuffered, one batch per write, so a killed server loses nothing decided.
+    fn write_decided_log(&mut self, first_idx: usize, commands: &[Command]) {
+        let Some(file) = self.decided_log.as_mut() else {
+            return;
+        };
+        let mut lines = String::new();
+        for (i, cmd) in commands.iter().enumerate() {
+            let (op, key, value) = match &cmd.kv_cmd {
+                KVCommand::Put(key, value) => ("Put", key, Some(value.as_str())),
+                KVCommand::Delete(key) => ("Delete", key, None),
+                KVCommand::Get(key) => ("Get", key, None),
+            };
+            let entry = DecidedLogEntry {
+                idx: first_idx + i,
+                client_id: cmd.client_id,
+                coordinator_id: cmd.coordinator_id,
+                command_id: cmd.id,
+                op,
+                key,
+                value,
+            };
+            match serde_json::to_string(&entry) {
+                Ok(line) => {
+                    lines.push_str(&line);
+                    lines.push('\n');
+                }
+                Err(e) => warn!("{}: Failed to serialize decided entry: {e}", self.id),
+            }
+        }
+        if let Err(e) = file.write_all(lines.as_bytes()) {
+            warn!("{}: Failed to write decided log: {e}", self.id);
+        }
+    }
+
     fn update_database_and_respond(&mut self, commands: Vec<Command>) {
         for command in commands {
             let key = (command.client_id, command.id);
@@ -638,4 +711,35 @@ impl OmniPaxosServer {
             }
             Err(e) => warn!("{}: Failed to serialize stats: {e}", self.id),
         }
+        self.save_state_snapshot();
+    }
+
+    // Only taken when no command is applied ahead of the decided log (fast-path
+    // executions awaiting their decision, queued follower commits), so the
+    // state should equal a replay of the first decided_idx log entries.
+    fn save_state_snapshot(&self) {
+        let Some(path) = self.config.local.state_snapshot_filepath.as_ref() else {
+            return;
+        };
+        if !self.fast_path_executed.is_empty() || !self.commit_queue.is_empty() {
+            return;
+        }
+        let snapshot = StateSnapshot {
+            server_id: self.id,
+            decided_idx: self.current_decided_idx,
+            state: self.database.entries(),
+        };
+        // Write then rename, so a server killed mid-write keeps the previous snapshot.
+        let tmp_path = format!("{path}.tmp");
+        let result = serde_json::to_string(&snapshot)
+            .map_err(std::io::Error::from)
+            .and_then(|json| {
+                let mut f = File::create(&tmp_path)?;
+                f.write_all(json.as_bytes())?;
+                f.flush()
+            })
+            .and_then(|_| std::fs::rename(&tmp_path, path));
+        if let Err(e) = result {
+            warn!("{}: Failed to save state snapshot: {e}", self.id);
+        }
     }}